@@ -2,6 +2,7 @@ package main
 
 import (
 	"backed-api-v2/libs/1_application/service_helper"
+	"backed-api-v2/libs/2_domain_methods/command_service"
 	"backed-api-v2/libs/5_common/smart_context"
 	"context"
 	"net/http"
@@ -48,5 +49,7 @@ func main() {
 			}
 			return nil
 		},
+		service_helper.BackgroundWorker{Name: "command_scheduler", Run: command_service.RunScheduler},
+		service_helper.BackgroundWorker{Name: "command_sweeper", Run: command_service.RunCommandSweeper},
 	)
 }
\ No newline at end of file
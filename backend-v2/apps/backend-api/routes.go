@@ -2,15 +2,21 @@ package main
 
 import (
 	"backed-api-v2/libs/1_application/ws_server"
+	"backed-api-v2/libs/2_domain_methods/auth_service"
 	"backed-api-v2/libs/2_domain_methods/handlers"
+	"backed-api-v2/libs/2_domain_methods/handlers/api_keys"
 	"backed-api-v2/libs/2_domain_methods/handlers/applications"
+	"backed-api-v2/libs/2_domain_methods/handlers/audit"
 	"backed-api-v2/libs/2_domain_methods/handlers/auth"
+	"backed-api-v2/libs/2_domain_methods/handlers/commands"
 	"backed-api-v2/libs/2_domain_methods/handlers/device_groups"
 	"backed-api-v2/libs/2_domain_methods/handlers/devices"
 	"backed-api-v2/libs/2_domain_methods/handlers/dicts"
 	"backed-api-v2/libs/2_domain_methods/handlers/metrics"
+	"backed-api-v2/libs/2_domain_methods/handlers/roles"
 	"backed-api-v2/libs/2_domain_methods/handlers/test_handlers"
 	"backed-api-v2/libs/2_domain_methods/handlers/users"
+	"backed-api-v2/libs/2_domain_methods/permissions"
 	"backed-api-v2/libs/2_domain_methods/run_processor"
 	"backed-api-v2/libs/5_common/rest_middleware"
 	"backed-api-v2/libs/5_common/smart_context"
@@ -26,62 +32,205 @@ func initRoutes(sctx smart_context.ISmartContext) (*chi.Mux, error) {
 
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "HEAD"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "HEAD"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Requested-With", "X-Request-Id", "X-Session-Id", "X-Api-Key", "X-Auth-Provider"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
 
-	r.Get("/rnd2", run_processor.WrapRestApiSmartHandler(sctx, test_handlers.RndHandler2))
-
-	// Запрос для обработки команд
-	r.Post("/send_command", rest_middleware.RoleMiddleware("ADMIN",
-		run_processor.WrapRestApiSmartHandler(sctx, handlers.SendCommandHandler)))
-
-	// запросы для фронта
-	r.Get("/api/dicts/roles", run_processor.WrapRestApiSmartHandler(sctx, dicts.GetRoleDictsHandler))
-
-	// Получение профиля текущего пользователя
-	r.Get("/api/profile", run_processor.WrapRestApiSmartHandler(sctx, users.GetProfileHandler))
-	// Обновление профиля текущего пользователя
-	r.Put("/api/profile", run_processor.WrapRestApiSmartHandler(sctx, users.UpdateProfileHandler))
-
-	// Device Groups endpoints
-	r.Get("/api/device-groups", run_processor.WrapRestApiSmartHandler(sctx, device_groups.GetDeviceGroupsHandler))
-	r.Post("/api/device-groups", run_processor.WrapRestApiSmartHandler(sctx, device_groups.CreateDeviceGroupHandler))
-	r.Put("/api/device-groups", run_processor.WrapRestApiSmartHandler(sctx, device_groups.UpdateDeviceGroupHandler))
-	r.Delete("/api/device-groups", run_processor.WrapRestApiSmartHandler(sctx, device_groups.DeleteDeviceGroupHandler))
-	r.Post("/api/device-groups/assign", run_processor.WrapRestApiSmartHandler(sctx, device_groups.AssignDeviceToGroupHandler))
-
-	r.Get("/api/devices", run_processor.WrapRestApiSmartHandler(sctx, devices.GetDevicesHandler))
-	r.Get("/api/users", rest_middleware.RoleMiddleware("ADMIN",
-		run_processor.WrapRestApiSmartHandler(sctx, users.GetUsersHandler)))
-	r.Get("/api/devices/{id}", run_processor.WrapRestApiSmartHandler(sctx, devices.GetDevicesByIDHandler))
-	r.Get("/api/metrics", run_processor.WrapRestApiSmartHandler(sctx, metrics.GetMetricsHandler))
-	r.Get("/api/metrics/{id}", run_processor.WrapRestApiSmartHandler(sctx, metrics.GetMetricsByDeviceIDHandler))         // тут id это id девайса
-	r.Get("/api/apps/{id}", run_processor.WrapRestApiSmartHandler(sctx, applications.GetApplicationsByDevicesIDHandler)) // тут id это id девайса
-
-	// запросы на регистрацию и авторизацию
-	r.Post("/api/auth/register", rest_middleware.RoleMiddleware("ADMIN",
-		run_processor.WrapRestApiSmartHandler(sctx, auth.RegisterHandler)))
-	r.Post("/api/auth/login", run_processor.WrapRestApiSmartHandler(sctx, auth.LoginHandler))
-	// pprof
-	runtime.SetMutexProfileFraction(1)
-	r.Mount("/debug", chi_middleware.Profiler())
-
-	// Create a subrouter for other routes that require middleware
-	protectedRoutes := chi.NewRouter()
-
-	wsupgrader := ws_server.NewWsUpgrader(sctx)
-
-	// Register the WebSocket handler
-	protectedRoutes.Get("/ws", rest_middleware.WithWsApiSmartContext(sctx, wsupgrader.HandleWebSocket))
-
-	protectedRoutes.NotFound(wsupgrader.HandleNotFound)
-
-	// Mount the subrouter on the main router
-	r.Mount("/", protectedRoutes)
+	// Открытые маршруты: доступны без аутентификации. Новые маршруты сюда добавлять только осознанно
+	r.Group(func(r chi.Router) {
+		r.Use(rest_middleware.Public)
+
+		r.Get("/rnd2", run_processor.WrapRestApiSmartHandler(sctx, test_handlers.RndHandler2))
+
+		r.Post("/api/auth/login", run_processor.WrapRestApiSmartHandler(sctx, auth.LoginHandler))
+		// Обновление и завершение сессии по refresh токену: access токен к этому моменту может быть истекшим
+		r.Post("/api/auth/refresh", run_processor.WrapRestApiSmartHandler(sctx, auth.RefreshHandler))
+		r.Post("/api/auth/logout", run_processor.WrapRestApiSmartHandler(sctx, auth.LogoutHandler))
+		// Регистрация по одноразовому коду приглашения
+		r.Post("/api/auth/accept-invite", run_processor.WrapRestApiSmartHandler(sctx, auth.AcceptInvitationHandler))
+		// Второй шаг входа с 2FA: по challenge_token из ответа /api/auth/login
+		r.Post("/api/auth/2fa/setup", run_processor.WrapRestApiSmartHandler(sctx, auth.TwoFactorSetupHandler))
+		r.Post("/api/auth/2fa/verify", run_processor.WrapRestApiSmartHandler(sctx, auth.TwoFactorVerifyHandler))
+
+		// Подроутер WebSocket, он же обрабатывает неизвестные пути
+		wsRoutes := chi.NewRouter()
+
+		wsupgrader := ws_server.NewWsUpgrader(sctx)
+
+		// WebSocket: рукопожатие открыто, авторизация выполняется внутри сессии
+		wsRoutes.Get("/ws", rest_middleware.WithWsApiSmartContext(sctx, wsupgrader.HandleWebSocket))
+
+		wsRoutes.NotFound(wsupgrader.HandleNotFound)
+
+		// Mount the subrouter on the main router
+		r.Mount("/", wsRoutes)
+	})
+
+	// Все остальные маршруты требуют валидный access JWT (Authorization: Bearer <token>) неотозванной сессии
+	// или API ключ (X-Api-Key). Пользователь доступен хендлерам через sctx.GetUserID / GetUsername / GetUserRole,
+	// ограничения API ключа – через sctx.GetAPIKeyScope
+	r.Group(func(r chi.Router) {
+		r.Use(rest_middleware.Authenticate(sctx, auth_service.ValidateAccessToken, auth_service.ValidateAPIKey))
+
+		// Доступ к маршруту – по праву роли пользователя (role_permissions), права меняются через /api/roles/{code}/permissions
+		requirePermission := rest_middleware.PermissionMiddleware(sctx, permissions.RoleHasPermission)
+
+		// Запрос для обработки команд. Право на тип команды проверяется по каталогу команд
+		r.Post("/send_command", requirePermission(permissions.CommandsSend,
+			run_processor.WrapRestApiSmartHandler(sctx, handlers.SendCommandHandler)))
+		// История команд с фильтрами и курсорной пагинацией
+		r.Get("/api/commands", requirePermission(permissions.CommandsRead,
+			run_processor.WrapRestApiSmartHandler(sctx, commands.GetCommandsHandler)))
+		r.Post("/api/commands/{id}/cancel", requirePermission(permissions.CommandsCancel,
+			run_processor.WrapRestApiSmartHandler(sctx, commands.CancelCommandHandler)))
+		// Подтверждение опасных команд вторым администратором
+		r.Post("/api/commands/{id}/approve", requirePermission(permissions.CommandsApprove,
+			run_processor.WrapRestApiSmartHandler(sctx, commands.ApproveCommandHandler)))
+		r.Post("/api/commands/{id}/reject", requirePermission(permissions.CommandsApprove,
+			run_processor.WrapRestApiSmartHandler(sctx, commands.RejectCommandHandler)))
+		r.Post("/api/commands/batches/{id}/approve", requirePermission(permissions.CommandsApprove,
+			run_processor.WrapRestApiSmartHandler(sctx, commands.ApproveBatchHandler)))
+		r.Post("/api/commands/batches/{id}/reject", requirePermission(permissions.CommandsApprove,
+			run_processor.WrapRestApiSmartHandler(sctx, commands.RejectBatchHandler)))
+		r.Get("/api/commands/catalog", requirePermission(permissions.CommandsRead,
+			run_processor.WrapRestApiSmartHandler(sctx, commands.GetCommandCatalogHandler)))
+		// Массовые команды: на группу, список устройств или по фильтру. Офлайн устройства получат команду при подключении
+		r.Post("/api/commands/bulk", requirePermission(permissions.CommandsSend,
+			run_processor.WrapRestApiSmartHandler(sctx, commands.SendBulkCommandHandler)))
+		r.Get("/api/commands/batches", requirePermission(permissions.CommandsRead,
+			run_processor.WrapRestApiSmartHandler(sctx, commands.GetCommandBatchesHandler)))
+		r.Get("/api/commands/batches/{id}", requirePermission(permissions.CommandsRead,
+			run_processor.WrapRestApiSmartHandler(sctx, commands.GetCommandBatchHandler)))
+
+		// Отложенные и повторяющиеся команды (cron). При срабатывании создается батч обычных команд
+		r.Get("/api/command-schedules", requirePermission(permissions.SchedulesRead,
+			run_processor.WrapRestApiSmartHandler(sctx, commands.GetCommandSchedulesHandler)))
+		r.Get("/api/command-schedules/preview", requirePermission(permissions.SchedulesRead,
+			run_processor.WrapRestApiSmartHandler(sctx, commands.PreviewCommandScheduleHandler)))
+		r.Get("/api/command-schedules/{id}", requirePermission(permissions.SchedulesRead,
+			run_processor.WrapRestApiSmartHandler(sctx, commands.GetCommandScheduleHandler)))
+		r.Post("/api/command-schedules", requirePermission(permissions.SchedulesWrite,
+			run_processor.WrapRestApiSmartHandler(sctx, commands.CreateCommandScheduleHandler)))
+		r.Put("/api/command-schedules/{id}", requirePermission(permissions.SchedulesWrite,
+			run_processor.WrapRestApiSmartHandler(sctx, commands.UpdateCommandScheduleHandler)))
+		r.Delete("/api/command-schedules/{id}", requirePermission(permissions.SchedulesDelete,
+			run_processor.WrapRestApiSmartHandler(sctx, commands.DeleteCommandScheduleHandler)))
+
+		// запросы для фронта
+		r.Get("/api/dicts/roles", run_processor.WrapRestApiSmartHandler(sctx, dicts.GetRoleDictsHandler))
+
+		// Профиль, 2FA и API ключи – только для пользователя, вошедшего интерактивно, не для API ключей
+		r.Group(func(r chi.Router) {
+			r.Use(rest_middleware.UserSessionOnly)
+
+			// Получение профиля текущего пользователя
+			r.Get("/api/profile", run_processor.WrapRestApiSmartHandler(sctx, users.GetProfileHandler))
+			// Обновление профиля текущего пользователя
+			r.Put("/api/profile", run_processor.WrapRestApiTypedHandler(sctx, users.UpdateProfileHandler))
+			// Двухфакторная аутентификация текущего пользователя
+			r.Get("/api/profile/2fa", run_processor.WrapRestApiSmartHandler(sctx, users.GetTwoFactorStatusHandler))
+			r.Post("/api/profile/2fa/setup", run_processor.WrapRestApiSmartHandler(sctx, users.BeginTwoFactorSetupHandler))
+			r.Post("/api/profile/2fa/enable", run_processor.WrapRestApiSmartHandler(sctx, users.EnableTwoFactorHandler))
+			r.Post("/api/profile/2fa/disable", run_processor.WrapRestApiSmartHandler(sctx, users.DisableTwoFactorHandler))
+			r.Post("/api/profile/2fa/recovery-codes", run_processor.WrapRestApiSmartHandler(sctx, users.RegenerateRecoveryCodesHandler))
+
+			r.Get("/api/api-keys", requirePermission(permissions.APIKeysManage,
+				run_processor.WrapRestApiSmartHandler(sctx, api_keys.GetAPIKeysHandler)))
+			r.Post("/api/api-keys", requirePermission(permissions.APIKeysManage,
+				run_processor.WrapRestApiSmartHandler(sctx, api_keys.CreateAPIKeyHandler)))
+			r.Delete("/api/api-keys/{id}", requirePermission(permissions.APIKeysManage,
+				run_processor.WrapRestApiSmartHandler(sctx, api_keys.RevokeAPIKeyHandler)))
+		})
+
+		// Device Groups endpoints
+		r.Get("/api/device-groups", requirePermission(permissions.DeviceGroupsRead,
+			run_processor.WrapRestApiSmartHandler(sctx, device_groups.GetDeviceGroupsHandler)))
+		r.Post("/api/device-groups", requirePermission(permissions.DeviceGroupsManage,
+			run_processor.WrapRestApiTypedHandler(sctx, device_groups.CreateDeviceGroupHandler)))
+		r.Put("/api/device-groups", requirePermission(permissions.DeviceGroupsManage,
+			run_processor.WrapRestApiTypedHandler(sctx, device_groups.UpdateDeviceGroupHandler)))
+		r.Delete("/api/device-groups", requirePermission(permissions.DeviceGroupsManage,
+			run_processor.WrapRestApiTypedHandler(sctx, device_groups.DeleteDeviceGroupHandler)))
+		r.Post("/api/device-groups/assign", requirePermission(permissions.DeviceGroupsManage,
+			run_processor.WrapRestApiTypedHandler(sctx, device_groups.AssignDeviceToGroupHandler)))
+
+		r.Get("/api/devices", requirePermission(permissions.DevicesRead,
+			run_processor.WrapRestApiSmartHandler(sctx, devices.GetDevicesHandler)))
+		r.Get("/api/users", requirePermission(permissions.UsersManage,
+			run_processor.WrapRestApiSmartHandler(sctx, users.GetUsersHandler)))
+		r.Put("/api/users/{id}/role", requirePermission(permissions.UsersManage,
+			run_processor.WrapRestApiSmartHandler(sctx, users.UpdateUserRoleHandler)))
+		// Группы устройств пользователя: без права devices:all_groups он видит только устройства этих групп
+		r.Get("/api/users/{id}/device-groups", requirePermission(permissions.UsersManage,
+			run_processor.WrapRestApiSmartHandler(sctx, users.GetUserDeviceGroupsHandler)))
+		r.Put("/api/users/{id}/device-groups", requirePermission(permissions.UsersManage,
+			run_processor.WrapRestApiSmartHandler(sctx, users.SetUserDeviceGroupsHandler)))
+		// Блокировки входа после неудачных попыток: журнал и снятие блокировки пользователя
+		r.Get("/api/auth/lockouts", requirePermission(permissions.UsersManage,
+			run_processor.WrapRestApiSmartHandler(sctx, users.GetLoginLockoutsHandler)))
+		r.Post("/api/users/{id}/unlock", requirePermission(permissions.UsersManage,
+			run_processor.WrapRestApiSmartHandler(sctx, users.UnlockUserHandler)))
+		r.Delete("/api/users/{id}/2fa", requirePermission(permissions.UsersManage,
+			run_processor.WrapRestApiSmartHandler(sctx, users.ResetUserTwoFactorHandler)))
+		// Регистрация устройств: токены регистрации и очередь устройств, подключившихся без токена
+		r.Get("/api/devices/pending", requirePermission(permissions.DevicesEnroll,
+			run_processor.WrapRestApiSmartHandler(sctx, devices.GetPendingDevicesHandler)))
+		r.Post("/api/devices/{id}/accept", requirePermission(permissions.DevicesEnroll,
+			run_processor.WrapRestApiSmartHandler(sctx, devices.AcceptDeviceHandler)))
+		r.Post("/api/devices/{id}/reject", requirePermission(permissions.DevicesEnroll,
+			run_processor.WrapRestApiSmartHandler(sctx, devices.RejectDeviceHandler)))
+		r.Get("/api/enrollment-tokens", requirePermission(permissions.DevicesEnroll,
+			run_processor.WrapRestApiSmartHandler(sctx, devices.GetEnrollmentTokensHandler)))
+		r.Post("/api/enrollment-tokens", requirePermission(permissions.DevicesEnroll,
+			run_processor.WrapRestApiSmartHandler(sctx, devices.CreateEnrollmentTokenHandler)))
+		r.Delete("/api/enrollment-tokens/{id}", requirePermission(permissions.DevicesEnroll,
+			run_processor.WrapRestApiSmartHandler(sctx, devices.RevokeEnrollmentTokenHandler)))
+		r.Get("/api/devices/{id}", requirePermission(permissions.DevicesRead,
+			run_processor.WrapRestApiSmartHandler(sctx, devices.GetDevicesByIDHandler)))
+		r.Get("/api/devices/{id}/viewers", requirePermission(permissions.DevicesRead,
+			run_processor.WrapRestApiSmartHandler(sctx, devices.GetDeviceViewersHandler)))
+		r.Get("/api/devices/{id}/commands", requirePermission(permissions.CommandsRead,
+			run_processor.WrapRestApiSmartHandler(sctx, commands.GetDeviceCommandsHandler)))
+		r.Get("/api/metrics", requirePermission(permissions.DevicesRead,
+			run_processor.WrapRestApiSmartHandler(sctx, metrics.GetMetricsHandler)))
+		r.Get("/api/metrics/{id}", requirePermission(permissions.DevicesRead,
+			run_processor.WrapRestApiSmartHandler(sctx, metrics.GetMetricsByDeviceIDHandler))) // тут id это id девайса
+		r.Get("/api/apps/{id}", requirePermission(permissions.DevicesRead,
+			run_processor.WrapRestApiSmartHandler(sctx, applications.GetApplicationsByDevicesIDHandler))) // тут id это id девайса
+
+		// запросы на регистрацию и авторизацию
+		r.Post("/api/auth/register", requirePermission(permissions.UsersManage,
+			run_processor.WrapRestApiSmartHandler(sctx, auth.RegisterHandler)))
+		// Приглашения пользователей: код показывается один раз при создании
+		r.Get("/api/invitations", requirePermission(permissions.UsersManage,
+			run_processor.WrapRestApiSmartHandler(sctx, auth.GetInvitationsHandler)))
+		r.Post("/api/invitations", requirePermission(permissions.UsersManage,
+			run_processor.WrapRestApiSmartHandler(sctx, auth.CreateInvitationHandler)))
+		r.Delete("/api/invitations/{id}", requirePermission(permissions.UsersManage,
+			run_processor.WrapRestApiSmartHandler(sctx, auth.RevokeInvitationHandler)))
+
+		// Права ролей
+		r.Get("/api/permissions", requirePermission(permissions.RolesManage,
+			run_processor.WrapRestApiSmartHandler(sctx, roles.GetPermissionsHandler)))
+		r.Get("/api/roles/{code}/permissions", requirePermission(permissions.RolesManage,
+			run_processor.WrapRestApiSmartHandler(sctx, roles.GetRolePermissionsHandler)))
+		r.Put("/api/roles/{code}/permissions", requirePermission(permissions.RolesManage,
+			run_processor.WrapRestApiSmartHandler(sctx, roles.SetRolePermissionsHandler)))
+		// Требование 2FA для пользователей роли
+		r.Put("/api/roles/{code}/two-factor", requirePermission(permissions.RolesManage,
+			run_processor.WrapRestApiSmartHandler(sctx, roles.SetRoleTwoFactorHandler)))
+
+		// Журнал аудита: фильтры и курсорная пагинация, format=csv – выгрузка в CSV
+		r.Get("/api/audit", requirePermission(permissions.AuditRead,
+			run_processor.WrapRestApiSmartHandler(sctx, audit.GetAuditEventsHandler)))
+
+		// pprof
+		runtime.SetMutexProfileFraction(1)
+		r.Mount("/debug", rest_middleware.RoleMiddleware("ADMIN", chi_middleware.Profiler().ServeHTTP))
+	})
 
 	return r, nil
 }
@@ -7,6 +7,7 @@ import (
 	"os"
 
 	"gorm.io/gen"
+	"gorm.io/gorm"
 )
 
 // Dynamic SQL
@@ -14,6 +15,18 @@ type Querier interface {
 	FilterWithNameAndRole(name, role string) ([]gen.T, error)
 }
 
+// hiddenColumns – колонки с секретами и их хэшами по таблицам: в моделях они получают json:"-",
+// чтобы модель, отданная хендлером как есть, не раскрывала их
+var hiddenColumns = map[string][]string{
+	"api_keys":            {"key_hash"},
+	"auth_sessions":       {"refresh_token_hash", "previous_token_hash"},
+	"devices":             {"secret_hash"},
+	"enrollment_tokens":   {"token_hash"},
+	"invitations":         {"code_hash"},
+	"user_recovery_codes": {"code_hash"},
+	"user_totp":           {"secret", "last_used_step"},
+}
+
 func main() {
 	env_vars.LoadEnvVars()
 	os.Setenv("LOG_LEVEL", "info")
@@ -33,9 +46,27 @@ func main() {
 
 	g.UseDB(logger.GetDB())
 
-	g.ApplyBasic(
-		g.GenerateAllTable()...,
-	)
+	// json/jsonb колонки (результаты и параметры команд) генерируем как datatypes.JSON, а не string
+	jsonType := func(columnType gorm.ColumnType) string { return "datatypes.JSON" }
+	g.WithDataTypeMap(map[string]func(columnType gorm.ColumnType) string{
+		"json":  jsonType,
+		"jsonb": jsonType,
+	})
+	g.WithImportPkgPath("gorm.io/datatypes")
+
+	tables, err := logger.GetDB().Migrator().GetTables()
+	if err != nil {
+		logger.Fatalf("GetTables failed: %v", err)
+	}
+	models := make([]interface{}, 0, len(tables))
+	for _, table := range tables {
+		var opts []gen.ModelOpt
+		for _, column := range hiddenColumns[table] {
+			opts = append(opts, gen.FieldJSONTag(column, "-"))
+		}
+		models = append(models, g.GenerateModel(table, opts...))
+	}
+	g.ApplyBasic(models...)
 
 	g.Execute()
 }
@@ -3,7 +3,9 @@ package service_helper
 import (
 	"backed-api-v2/libs/4_infrastructure/db_manager"
 	"backed-api-v2/libs/4_infrastructure/offilne_geocoding_db"
+	"backed-api-v2/libs/4_infrastructure/redis_manager"
 	"backed-api-v2/libs/5_common/env_vars"
+	"backed-api-v2/libs/5_common/safe_go"
 	"backed-api-v2/libs/5_common/shutdown"
 	"backed-api-v2/libs/5_common/smart_context"
 	"context"
@@ -13,15 +15,23 @@ import (
 	"time"
 )
 
+// BackgroundWorker – фоновый цикл сервиса (планировщик, чистильщик и т.п.).
+// Run должен завершиться после отмены sctx.GetContext() – сервис ждет его через wait group перед закрытием
+type BackgroundWorker struct {
+	Name string
+	Run  func(sctx smart_context.ISmartContext)
+}
+
 func StartService(serviceName string,
 	initFunc func(sctx smart_context.ISmartContext) error,
 	startFunc func(sctx smart_context.ISmartContext) error,
 	closeFunc func(sctx smart_context.ISmartContext) error,
+	workers ...BackgroundWorker,
 ) {
 	env_vars.LoadEnvVars()
 	os.Setenv("LOG_LEVEL", "debug") // ставим наиболее детальный уровень чтобы далее уже юзерские настройки работали
 	sctx := smart_context.NewSmartContext()
-	err := internalStartService(sctx, serviceName, initFunc, startFunc, closeFunc)
+	err := internalStartService(sctx, serviceName, initFunc, startFunc, closeFunc, workers)
 	if err != nil {
 		sctx.Fatalf("Error starting service: %v", err)
 	}
@@ -33,6 +43,7 @@ func internalStartService(
 	initFunc func(sctx smart_context.ISmartContext) error,
 	startFunc func(sctx smart_context.ISmartContext) error,
 	closeFunc func(sctx smart_context.ISmartContext) error,
+	workers []BackgroundWorker,
 ) error {
 	prefix := fmt.Sprintf("Service '%s'", serviceName)
 	sctx.Infof("%s: Initializing", prefix)
@@ -70,6 +81,14 @@ func internalStartService(
 	// 	sctx = sctx.WithRedisCacheManager(rcm)
 	// }
 
+	// Redis необязателен: без него проверки (например, отзыв сессий) идут в Postgres
+	rm, err := redis_manager.NewRedisManager(sctx)
+	if err != nil {
+		sctx.Warnf("Redis is not available, falling back to Postgres: %v", err)
+	} else {
+		sctx = sctx.WithRedisManager(rm)
+	}
+
 	// custom init
 	err = initFunc(sctx)
 	if err != nil {
@@ -82,6 +101,10 @@ func internalStartService(
 	if err != nil {
 		return err
 	}
+
+	for _, worker := range workers {
+		startBackgroundWorker(sctx, prefix, worker)
+	}
 	sctx.Infof("%s: Started. Working...", prefix)
 
 	defer func() {
@@ -103,3 +126,14 @@ func internalStartService(
 	sctx.Infof("%s: All requests finished. Closing", prefix)
 	return nil
 }
+
+// startBackgroundWorker запускает фоновый цикл под wait group сервиса
+func startBackgroundWorker(sctx smart_context.ISmartContext, prefix string, worker BackgroundWorker) {
+	sctx.Infof("%s: Starting background worker '%s'", prefix, worker.Name)
+	wg := sctx.GetWaitGroup()
+	wg.Add(1)
+	safe_go.SafeGo(sctx, func() {
+		defer wg.Done()
+		worker.Run(sctx.LogField("worker", worker.Name))
+	})
+}
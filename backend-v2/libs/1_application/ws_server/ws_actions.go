@@ -0,0 +1,369 @@
+package ws_server
+
+import (
+	"backed-api-v2/libs/2_domain_methods/audit"
+	"backed-api-v2/libs/2_domain_methods/auth_service"
+	"backed-api-v2/libs/2_domain_methods/command_service"
+	"backed-api-v2/libs/2_domain_methods/device_auth"
+	"backed-api-v2/libs/2_domain_methods/device_scope"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/ws_registry"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// SubscriptionPayload – подписка/отписка фронтенда на топики устройства.
+// Если topics пустой – подписка на все топики (отписка от устройства целиком).
+type SubscriptionPayload struct {
+	DeviceID string   `json:"device_id,omitempty"`
+	Topics   []string `json:"topics,omitempty"`
+}
+
+// RegisterDevicePayload – учетные данные устройства. Секрет выдается сервером при первом подключении (action device_credentials).
+// Новое устройство передает токен регистрации, без него оно ждет подтверждения администратора
+type RegisterDevicePayload struct {
+	Secret          string `json:"secret,omitempty"`
+	EnrollmentToken string `json:"enrollment_token,omitempty"`
+}
+
+// DeviceCredentialsPayload – секрет, выданный устройству. Устройство сохраняет его и передает в каждом register_device
+type DeviceCredentialsPayload struct {
+	DeviceID string `json:"device_id"`
+	Secret   string `json:"secret"`
+}
+
+// RegisterFrontendPayload – JWT пользователя (если не передан в query параметре token) и, опционально, подписка на устройство
+type RegisterFrontendPayload struct {
+	Token string `json:"token,omitempty"`
+	SubscriptionPayload
+}
+
+// ListViewersPayload – запрос списка зрителей устройства
+type ListViewersPayload struct {
+	DeviceID string `json:"device_id,omitempty"`
+}
+
+// registerDefaultActions регистрирует все action, которые понимает сервер.
+// Новые action агента добавляются здесь (или через RegisterAction снаружи), без изменений цикла чтения.
+func registerDefaultActions(router *WsRouter) {
+	RegisterAction(router, "register_device", SenderAny, handleRegisterDevice)
+	RegisterAction(router, "register_frontend", SenderAny, handleRegisterFrontend)
+
+	RegisterAction(router, "subscribe", SenderFrontend, handleSubscribe)
+	RegisterAction(router, "unsubscribe", SenderFrontend, handleUnsubscribe)
+	RegisterAction(router, "list_viewers", SenderFrontend, handleListViewers)
+
+	RegisterAction(router, "command_ack", SenderDevice, handleCommandAck)
+	RegisterAction(router, "command_executed", SenderDevice, handleCommandExecuted)
+	RegisterAction(router, "sent_metrics", SenderDevice, handleSentMetrics)
+	RegisterAction(router, "sent_apps", SenderDevice, handleSentApps)
+
+	// медиа от устройства пересылаем подписанным фронтендам как есть.
+	// стримы устаревают быстро - если зритель не успевает, выкидываем самые старые кадры
+	RegisterAction(router, ws_registry.TopicCameraFrame, SenderDevice, forwardToViewers(ws_registry.DropPolicyOldest))
+	RegisterAction(router, ws_registry.TopicAudioStream, SenderDevice, forwardToViewers(ws_registry.DropPolicyOldest))
+	RegisterAction(router, ws_registry.TopicCaptureFrame, SenderDevice, forwardToViewers(ws_registry.DropPolicyBlock))
+	RegisterAction(router, ws_registry.TopicScreenshot, SenderDevice, forwardToViewers(ws_registry.DropPolicyBlock))
+	RegisterAction(router, ws_registry.TopicRecordedAudio, SenderDevice, forwardToViewers(ws_registry.DropPolicyBlock))
+}
+
+func handleRegisterDevice(sctx smart_context.ISmartContext, session *WsSession, wsMsg WSMessage, payload RegisterDevicePayload) error {
+	sctx.Infof("Register device action: device_key=%s", wsMsg.DeviceKey)
+	if session.IsAuthenticated() {
+		return fmt.Errorf("session is already registered as %s", session.Kind())
+	}
+	if wsMsg.DeviceKey == "" {
+		return &WsAuthError{Message: "missing device_key"}
+	}
+
+	device, issuedSecret, err := registerDevice(sctx, wsMsg.DeviceKey, payload.Secret, payload.EnrollmentToken)
+	if issuedSecret != "" {
+		// секрет нужен устройству и в ожидании подтверждения: с ним оно переподключится после решения администратора
+		sendDeviceCredentials(sctx, session, device, issuedSecret)
+	}
+	switch {
+	case errors.Is(err, device_auth.ErrPendingApproval):
+		return &WsAuthError{Code: WsErrorPendingApproval, Message: err.Error()}
+	case errors.Is(err, device_auth.ErrInvalidCredentials), errors.Is(err, device_auth.ErrDeviceRejected):
+		return &WsAuthError{Message: err.Error()}
+	case err != nil:
+		return fmt.Errorf("error registering device: %w", err)
+	}
+
+	session.SetDevice(device)
+	registrWSConnection(session.Conn(), device.ID)
+	publishDeviceStatus(sctx, device)
+
+	go command_service.SendPendingCommands(sctx, device.ID, session.Conn())
+	return nil
+}
+
+func sendDeviceCredentials(sctx smart_context.ISmartContext, session *WsSession, device *model.Device, secret string) {
+	credentials, err := json.Marshal(DeviceCredentialsPayload{DeviceID: device.ID, Secret: secret})
+	if err != nil {
+		sctx.Errorf("Failed to marshal credentials of device %s: %v", device.ID, err)
+		return
+	}
+	session.Reply(sctx, WSMessage{
+		Action:    "device_credentials",
+		DeviceKey: device.DeviceIdentifier,
+		Payload:   credentials,
+	})
+}
+
+// handleRegisterFrontend аутентифицирует фронтенд по JWT и, если передан device_key (id устройства), подписывает на него.
+// Сессия, уже аутентифицированная токеном из query параметра, может сразу подписаться
+func handleRegisterFrontend(sctx smart_context.ISmartContext, session *WsSession, wsMsg WSMessage, payload RegisterFrontendPayload) error {
+	switch session.Kind() {
+	case SenderDevice:
+		return fmt.Errorf("session is already registered as %s", session.Kind())
+	case SenderAny:
+		if payload.Token == "" {
+			return &WsAuthError{Message: "missing token"}
+		}
+		user, err := auth_service.ValidateAccessToken(sctx, payload.Token)
+		if err != nil {
+			return &WsAuthError{Message: "invalid token"}
+		}
+		session.SetFrontend(user)
+		ws_registry.AddFrontend(session.Conn(), ws_registry.FrontendUser{UserID: user.UserID, SessionID: user.SessionID})
+		sctx.Infof("Registered frontend client of user %s, session: %s", user.Username, session.Conn().ID())
+	}
+
+	subscription := payload.SubscriptionPayload
+	if subscription.DeviceID == "" {
+		subscription.DeviceID = wsMsg.DeviceKey
+	}
+	if subscription.DeviceID == "" {
+		return nil
+	}
+	return handleSubscribe(sctx, session, wsMsg, subscription)
+}
+
+// authorizeDevice проверяет, что сессия пользователя фронтенда действительна и он может смотреть устройство
+// (оно в доступных ему группах), и возвращает его. Недоступное устройство не отличается от несуществующего
+func authorizeDevice(sctx smart_context.ISmartContext, session *WsSession, deviceID string) (*model.Device, error) {
+	user := session.User()
+	if user == nil {
+		return nil, &WsAuthError{Message: "authentication required"}
+	}
+	// JWT проверен при подключении: сессию могли отозвать, а пользователя – удалить или сменить ему роль
+	if err := auth_service.ValidateIdentity(sctx, user); err != nil {
+		if errors.Is(err, auth_service.ErrSessionRevoked) {
+			recordViewsStopped(sctx, session, ws_registry.UnsubscribeAll(session.Conn()))
+			return nil, &WsAuthError{Message: "session expired or revoked"}
+		}
+		return nil, err
+	}
+
+	scope, err := device_scope.ForUser(sctx.WithUserID(user.UserID).WithUserRole(user.Role))
+	if err != nil {
+		return nil, err
+	}
+	device, err := scope.GetDevice(sctx, deviceID)
+	if errors.Is(err, device_scope.ErrDeviceNotFound) {
+		return nil, fmt.Errorf("device '%s' not found", deviceID)
+	}
+	return device, err
+}
+
+func handleSubscribe(sctx smart_context.ISmartContext, session *WsSession, wsMsg WSMessage, payload SubscriptionPayload) error {
+	deviceID := payload.DeviceID
+	if deviceID == "" {
+		deviceID = wsMsg.DeviceKey
+	}
+	if deviceID == "" {
+		return fmt.Errorf("missing device_id")
+	}
+	for _, topic := range payload.Topics {
+		if !ws_registry.IsKnownTopic(topic) {
+			return fmt.Errorf("unknown topic '%s'", topic)
+		}
+	}
+
+	device, err := authorizeDevice(sctx, session, deviceID)
+	if err != nil {
+		return err
+	}
+
+	ws_registry.Subscribe(device.ID, session.Conn(), payload.Topics)
+	sctx.Infof("Frontend session %s subscribed to device %s, topics: %v", session.Conn().ID(), device.ID, payload.Topics)
+	recordMediaView(sctx, session, audit.ActionMediaViewStarted, device.ID, payload.Topics)
+	return nil
+}
+
+// recordMediaView записывает в журнал аудита начало или конец просмотра медиа устройства (камера, экран, звук).
+// Подписка только на статус устройства не записывается
+func recordMediaView(sctx smart_context.ISmartContext, session *WsSession, action string, deviceID string, topics []string) {
+	if len(topics) == 0 {
+		topics = ws_registry.AllTopics
+	}
+	var media []string
+	for _, topic := range topics {
+		if topic != ws_registry.TopicStatus {
+			media = append(media, topic)
+		}
+	}
+	user := session.User()
+	if len(media) == 0 || user == nil {
+		return
+	}
+	audit.Record(sctx, audit.Event{
+		Action:     action,
+		TargetType: audit.TargetDevice,
+		TargetID:   deviceID,
+		After:      map[string]any{"topics": media, "session_id": session.Conn().ID()},
+		ActorID:    user.UserID,
+		ActorName:  user.Username,
+	})
+}
+
+func handleUnsubscribe(sctx smart_context.ISmartContext, session *WsSession, wsMsg WSMessage, payload SubscriptionPayload) error {
+	deviceID := payload.DeviceID
+	if deviceID == "" {
+		deviceID = wsMsg.DeviceKey
+	}
+
+	if deviceID == "" {
+		recordViewsStopped(sctx, session, ws_registry.UnsubscribeAll(session.Conn()))
+		sctx.Infof("Frontend session %s unsubscribed from all devices", session.Conn().ID())
+		return nil
+	}
+
+	// в журнал попадают только действительно снятые подписки: отписка от чужого устройства ничего не меняет
+	removed := ws_registry.Unsubscribe(deviceID, session.Conn(), payload.Topics)
+	sctx.Infof("Frontend session %s unsubscribed from device %s, topics: %v", session.Conn().ID(), deviceID, removed)
+	recordViewsStopped(sctx, session, map[string][]string{deviceID: removed})
+	return nil
+}
+
+// recordViewsStopped записывает конец просмотра медиа по снятым подпискам (топики по id устройства)
+func recordViewsStopped(sctx smart_context.ISmartContext, session *WsSession, removed map[string][]string) {
+	for _, deviceID := range slices.Sorted(maps.Keys(removed)) {
+		if topics := removed[deviceID]; len(topics) > 0 {
+			recordMediaView(sctx, session, audit.ActionMediaViewStopped, deviceID, topics)
+		}
+	}
+}
+
+// removeConnection снимает соединение с реестра и записывает конец просмотра по его подпискам.
+// Вызывается и после отмены контекста сессии, поэтому журнал пишется с контекстом без отмены
+func removeConnection(sctx smart_context.ISmartContext, session *WsSession) {
+	removed := ws_registry.RemoveConnection(session.Conn())
+	recordViewsStopped(sctx.WithContext(context.WithoutCancel(sctx.GetContext())), session, removed)
+}
+
+func handleListViewers(sctx smart_context.ISmartContext, session *WsSession, wsMsg WSMessage, payload ListViewersPayload) error {
+	deviceID := payload.DeviceID
+	if deviceID == "" {
+		deviceID = wsMsg.DeviceKey
+	}
+	if deviceID == "" {
+		return fmt.Errorf("missing device_id")
+	}
+	if _, err := authorizeDevice(sctx, session, deviceID); err != nil {
+		return err
+	}
+
+	viewers, err := json.Marshal(ws_registry.ListViewers(deviceID))
+	if err != nil {
+		return fmt.Errorf("failed to marshal viewers: %w", err)
+	}
+	session.Reply(sctx, WSMessage{
+		Action:    "viewers",
+		DeviceKey: deviceID,
+		Payload:   viewers,
+	})
+	return nil
+}
+
+// handleCommandAck обновляет статус конкретной команды (по commands.id): DELIVERED, RUNNING, EXECUTED, FAILED
+func handleCommandAck(sctx smart_context.ISmartContext, session *WsSession, wsMsg WSMessage, ack command_service.CommandAck) error {
+	_, err := command_service.ApplyAck(sctx, session.Device().ID, ack)
+	return err
+}
+
+// handleCommandExecuted – финальное подтверждение: EXECUTED, либо FAILED если агент прислал ошибку
+func handleCommandExecuted(sctx smart_context.ISmartContext, session *WsSession, wsMsg WSMessage, ack command_service.CommandAck) error {
+	ack.Status = command_service.StatusExecuted
+	if ack.Error != "" {
+		ack.Status = command_service.StatusFailed
+	}
+	_, err := command_service.ApplyAck(sctx, session.Device().ID, ack)
+	return err
+}
+
+func handleSentMetrics(sctx smart_context.ISmartContext, session *WsSession, wsMsg WSMessage, metrics model.Metric) error {
+	metrics.DeviceID = session.Device().ID
+	metrics.CreatedAt = time.Now()
+
+	geo := sctx.GetGeocoder()
+	if geo == nil {
+		sctx.Warnf("Geocoder not available; cannot perform geocoding")
+		metrics.Latitude, metrics.Longitude = 0, 0
+	} else {
+		lat, lon, err := geo.LocalGeocode(metrics.PublicIP)
+		if err != nil {
+			sctx.Warnf("Local geocoding failed for IP %s: %v", metrics.PublicIP, err)
+			lat, lon = 0, 0
+		}
+		metrics.Latitude = lat
+		metrics.Longitude = lon
+	}
+
+	if err := sctx.GetDB().Create(&metrics).Error; err != nil {
+		return fmt.Errorf("error saving metrics for device %s: %w", metrics.DeviceID, err)
+	}
+	sctx.Infof("Metrics saved for device: %s", metrics.DeviceID)
+	return nil
+}
+
+func handleSentApps(sctx smart_context.ISmartContext, session *WsSession, wsMsg WSMessage, installedApps []model.Application) error {
+	device := session.Device()
+
+	// Сохраняем в отдельные таблицы (applications, device_applications)
+	if err := saveInstalledApps(sctx, device.ID, installedApps); err != nil {
+		return fmt.Errorf("error saving installed apps: %w", err)
+	}
+	sctx.Infof("Installed apps saved for device: %s", device.ID)
+	return nil
+}
+
+// forwardToViewers пересылает исходное сообщение устройства всем фронтендам, подписанным на топик с именем action
+func forwardToViewers(policy ws_registry.DropPolicy) WsActionHandler[json.RawMessage] {
+	return func(sctx smart_context.ISmartContext, session *WsSession, wsMsg WSMessage, _ json.RawMessage) error {
+		device := session.Device()
+
+		sent := ws_registry.Publish(sctx, device.ID, wsMsg.Action, wsMsg.Raw, policy)
+		sctx.Debugf("Received %s from device %s, forwarded to %d viewers", wsMsg.Action, device.DeviceIdentifier, sent)
+		return nil
+	}
+}
+
+// publishDeviceStatus уведомляет зрителей устройства о смене статуса
+func publishDeviceStatus(sctx smart_context.ISmartContext, device *model.Device) {
+	payload, err := json.Marshal(map[string]any{
+		"status":    device.Status,
+		"last_seen": device.LastSeen,
+	})
+	if err != nil {
+		sctx.Errorf("Failed to marshal status of device %s: %v", device.ID, err)
+		return
+	}
+	data, err := json.Marshal(WSMessage{
+		Action:    ws_registry.TopicStatus,
+		DeviceKey: device.ID,
+		Payload:   payload,
+	})
+	if err != nil {
+		sctx.Errorf("Failed to marshal status message of device %s: %v", device.ID, err)
+		return
+	}
+	ws_registry.Publish(sctx, device.ID, ws_registry.TopicStatus, data, ws_registry.DropPolicyBlock)
+}
@@ -0,0 +1,177 @@
+package ws_server
+
+import (
+	"backed-api-v2/libs/5_common/smart_context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// SenderKind определяет, кто имеет право отправлять action.
+type SenderKind int
+
+const (
+	SenderAny      SenderKind = iota // action доступен до аутентификации (register_device, register_frontend)
+	SenderDevice                     // только сессии, зарегистрированные через register_device
+	SenderFrontend                   // только сессии, зарегистрированные через register_frontend
+)
+
+func (k SenderKind) String() string {
+	switch k {
+	case SenderDevice:
+		return "device"
+	case SenderFrontend:
+		return "frontend"
+	default:
+		return "any"
+	}
+}
+
+// Коды ошибок, которые уходят отправителю в сообщении с action "error"
+const (
+	WsErrorInvalidMessage  = "invalid_message"
+	WsErrorUnknownAction   = "unknown_action"
+	WsErrorDecodePayload   = "decode_error"
+	WsErrorForbidden       = "forbidden_sender"
+	WsErrorActionFailed    = "action_failed"
+	WsErrorUnauthorized    = "unauthorized"
+	WsErrorPendingApproval = "pending_approval"
+)
+
+// WsAuthError – ошибка аутентификации. Отправитель получает Code (по умолчанию "unauthorized"),
+// после чего соединение закрывается
+type WsAuthError struct {
+	Code    string
+	Message string
+}
+
+func (e *WsAuthError) Error() string {
+	return e.Message
+}
+
+// WsErrorPayload – payload ответа с action "error"
+type WsErrorPayload struct {
+	Action  string `json:"action,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// WsActionHandler – типизированный обработчик action. payload уже раскодирован в T.
+type WsActionHandler[T any] func(sctx smart_context.ISmartContext, session *WsSession, wsMsg WSMessage, payload T) error
+
+type wsAction struct {
+	sender SenderKind
+	decode func(raw json.RawMessage) (any, error)
+	handle func(sctx smart_context.ISmartContext, session *WsSession, wsMsg WSMessage, payload any) error
+}
+
+// WsRouter хранит зарегистрированные action и маршрутизирует по ним входящие сообщения.
+type WsRouter struct {
+	mu      sync.RWMutex
+	actions map[string]wsAction
+}
+
+func NewWsRouter() *WsRouter {
+	return &WsRouter{
+		actions: make(map[string]wsAction),
+	}
+}
+
+// RegisterAction регистрирует обработчик action с типизированным payload.
+// Повторная регистрация того же action заменяет предыдущий обработчик.
+func RegisterAction[T any](router *WsRouter, action string, sender SenderKind, handler WsActionHandler[T]) {
+	router.mu.Lock()
+	defer router.mu.Unlock()
+
+	router.actions[action] = wsAction{
+		sender: sender,
+		decode: func(raw json.RawMessage) (any, error) {
+			var payload T
+			if len(raw) == 0 {
+				// payload не передали - отдаем нулевое значение, проверка обязательных полей на стороне обработчика
+				return payload, nil
+			}
+			if err := json.Unmarshal(raw, &payload); err != nil {
+				return nil, err
+			}
+			return payload, nil
+		},
+		handle: func(sctx smart_context.ISmartContext, session *WsSession, wsMsg WSMessage, payload any) error {
+			return handler(sctx, session, wsMsg, payload.(T))
+		},
+	}
+}
+
+// Actions возвращает список зарегистрированных action (для логов и отладки)
+func (router *WsRouter) Actions() []string {
+	router.mu.RLock()
+	defer router.mu.RUnlock()
+
+	result := make([]string, 0, len(router.actions))
+	for name := range router.actions {
+		result = append(result, name)
+	}
+	return result
+}
+
+// Dispatch разбирает входящее текстовое сообщение и вызывает обработчик action.
+// Все ошибки (неизвестный action, ошибка декодирования, чужой отправитель) возвращаются отправителю.
+func (router *WsRouter) Dispatch(sctx smart_context.ISmartContext, session *WsSession, data []byte) {
+	var wsMsg WSMessage
+	if err := json.Unmarshal(data, &wsMsg); err != nil {
+		sctx.Errorf("Error unmarshalling WebSocket message: %v", err)
+		session.ReplyError(sctx, "", WsErrorInvalidMessage, fmt.Sprintf("invalid message: %v", err))
+		return
+	}
+	wsMsg.Raw = data
+
+	sctx = sctx.LogField("action", wsMsg.Action)
+
+	router.mu.RLock()
+	action, ok := router.actions[wsMsg.Action]
+	router.mu.RUnlock()
+	if !ok {
+		sctx.Warnf("Unknown action received: %s", wsMsg.Action)
+		session.ReplyError(sctx, wsMsg.Action, WsErrorUnknownAction, fmt.Sprintf("unknown action '%s'", wsMsg.Action))
+		return
+	}
+
+	if action.sender != SenderAny && !session.IsAuthenticated() {
+		sctx.Warnf("Action '%s' received before authentication, closing session", wsMsg.Action)
+		session.ReplyError(sctx, wsMsg.Action, WsErrorUnauthorized, "authentication required")
+		session.Close(websocket.ClosePolicyViolation, "authentication required")
+		return
+	}
+
+	if action.sender != SenderAny && action.sender != session.Kind() {
+		sctx.Warnf("Action '%s' is allowed only for %s sessions, session is %s", wsMsg.Action, action.sender, session.Kind())
+		session.ReplyError(sctx, wsMsg.Action, WsErrorForbidden, fmt.Sprintf("action '%s' is allowed only for %s", wsMsg.Action, action.sender))
+		return
+	}
+
+	payload, err := action.decode(wsMsg.Payload)
+	if err != nil {
+		sctx.Errorf("Error unmarshalling %s payload: %v", wsMsg.Action, err)
+		session.ReplyError(sctx, wsMsg.Action, WsErrorDecodePayload, fmt.Sprintf("invalid payload: %v", err))
+		return
+	}
+
+	if err := action.handle(sctx, session, wsMsg, payload); err != nil {
+		var authErr *WsAuthError
+		if errors.As(err, &authErr) {
+			sctx.Warnf("Authentication failed on '%s': %v", wsMsg.Action, err)
+			code := authErr.Code
+			if code == "" {
+				code = WsErrorUnauthorized
+			}
+			session.ReplyError(sctx, wsMsg.Action, code, authErr.Message)
+			session.Close(websocket.ClosePolicyViolation, "unauthorized")
+			return
+		}
+		sctx.Errorf("Error handling action '%s': %v", wsMsg.Action, err)
+		session.ReplyError(sctx, wsMsg.Action, WsErrorActionFailed, err.Error())
+	}
+}
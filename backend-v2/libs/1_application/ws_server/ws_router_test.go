@@ -0,0 +1,133 @@
+package ws_server
+
+import (
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/ws_registry"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+type pingPayload struct {
+	Value int `json:"value"`
+}
+
+// testSession – сессия поверх настоящего WebSocket соединения: ответы остаются в очереди соединения
+// (writePump не запущен), закрытие записывается в closedWith
+type testSession struct {
+	*WsSession
+	closedWith int
+}
+
+func newTestSession(t *testing.T, kind SenderKind) *testSession {
+	t.Helper()
+	serverConns := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		serverConns <- conn
+	}))
+	t.Cleanup(server.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	conn := <-serverConns
+	t.Cleanup(func() { _ = conn.Close() })
+
+	session := &testSession{}
+	session.WsSession = newWsSession(ws_registry.NewConnection("test", conn, 0), func(code int, reason string) {
+		session.closedWith = code
+	})
+	session.kind = kind
+	return session
+}
+
+// lastError возвращает payload последнего ответа с action "error" или nil, если ответов нет
+func (s *testSession) lastError(t *testing.T) *WsErrorPayload {
+	t.Helper()
+	var result *WsErrorPayload
+	for {
+		select {
+		case msg := <-s.conn.Queue():
+			var reply WSMessage
+			if err := json.Unmarshal(msg.Data, &reply); err != nil {
+				t.Fatalf("bad reply %s: %v", msg.Data, err)
+			}
+			if reply.Action != "error" {
+				continue
+			}
+			result = &WsErrorPayload{}
+			if err := json.Unmarshal(reply.Payload, result); err != nil {
+				t.Fatalf("bad error payload %s: %v", reply.Payload, err)
+			}
+		default:
+			return result
+		}
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	var handled []pingPayload
+	router := NewWsRouter()
+	RegisterAction(router, "ping", SenderDevice, func(sctx smart_context.ISmartContext, session *WsSession, wsMsg WSMessage, payload pingPayload) error {
+		handled = append(handled, payload)
+		return nil
+	})
+	RegisterAction(router, "auth", SenderAny, func(sctx smart_context.ISmartContext, session *WsSession, wsMsg WSMessage, payload pingPayload) error {
+		return &WsAuthError{Code: WsErrorPendingApproval, Message: "device is waiting for approval"}
+	})
+	RegisterAction(router, "fail", SenderDevice, func(sctx smart_context.ISmartContext, session *WsSession, wsMsg WSMessage, payload pingPayload) error {
+		return errors.New("boom")
+	})
+
+	tests := []struct {
+		name        string
+		kind        SenderKind
+		message     string
+		wantCode    string // "" – ошибки быть не должно
+		wantClose   bool
+		wantHandled []pingPayload
+	}{
+		{"handled", SenderDevice, `{"action":"ping","payload":{"value":7}}`, "", false, []pingPayload{{Value: 7}}},
+		{"empty payload", SenderDevice, `{"action":"ping"}`, "", false, []pingPayload{{}}},
+		{"invalid message", SenderDevice, `{"action":`, WsErrorInvalidMessage, false, nil},
+		{"unknown action", SenderDevice, `{"action":"missing"}`, WsErrorUnknownAction, false, nil},
+		{"decode error", SenderDevice, `{"action":"ping","payload":{"value":"seven"}}`, WsErrorDecodePayload, false, nil},
+		{"before authentication", SenderAny, `{"action":"ping","payload":{"value":1}}`, WsErrorUnauthorized, true, nil},
+		{"wrong sender kind", SenderFrontend, `{"action":"ping","payload":{"value":1}}`, WsErrorForbidden, false, nil},
+		{"auth error", SenderAny, `{"action":"auth"}`, WsErrorPendingApproval, true, nil},
+		{"handler error", SenderDevice, `{"action":"fail"}`, WsErrorActionFailed, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled = nil
+			session := newTestSession(t, tt.kind)
+			router.Dispatch(smart_context.NewSmartContext(), session.WsSession, []byte(tt.message))
+
+			errPayload := session.lastError(t)
+			switch {
+			case tt.wantCode == "" && errPayload != nil:
+				t.Errorf("unexpected error reply %+v", errPayload)
+			case tt.wantCode != "" && (errPayload == nil || errPayload.Code != tt.wantCode):
+				t.Errorf("error reply = %+v, want code %s", errPayload, tt.wantCode)
+			}
+			if closed := session.closedWith != 0; closed != tt.wantClose {
+				t.Errorf("session closed = %v, want %v", closed, tt.wantClose)
+			}
+			if len(handled) != len(tt.wantHandled) || (len(handled) > 0 && handled[0] != tt.wantHandled[0]) {
+				t.Errorf("handled = %+v, want %+v", handled, tt.wantHandled)
+			}
+		})
+	}
+}
@@ -1,8 +1,11 @@
 package ws_server
 
 import (
+	"backed-api-v2/libs/2_domain_methods/auth_service"
+	"backed-api-v2/libs/2_domain_methods/device_auth"
 	"backed-api-v2/libs/3_generated_models/model"
 	"backed-api-v2/libs/5_common/env_vars"
+	"backed-api-v2/libs/5_common/rest_middleware"
 	"backed-api-v2/libs/5_common/safe_go"
 	"backed-api-v2/libs/5_common/smart_context"
 	"backed-api-v2/libs/5_common/ws_registry"
@@ -12,6 +15,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,27 +24,41 @@ import (
 	"gorm.io/gorm"
 )
 
-type Message struct {
-	Sctx smart_context.ISmartContext // чтобы логгировать под тем же request id
-	Type int                         // WebSocket message type (e.g., TextMessage, PingMessage)
-	Data []byte                      // Actual message data
-}
-
 type WSMessage struct {
 	Action    string          `json:"action"`
 	DeviceKey string          `json:"device_key,omitempty"`
 	Payload   json.RawMessage `json:"payload,omitempty"`
+
+	Raw []byte `json:"-"` // исходное сообщение, чтобы пересылать его без повторной сериализации
 }
 
+const (
+	DefaultAuthTimeoutSec  = 10
+	DefaultSessionCheckSec = 60
+	handshakeReadLimit     = 64 << 10        // максимальный размер сообщения до аутентификации
+	closeGracePeriod       = 5 * time.Second // сколько ждем ответа клиента на CloseMessage
+)
+
 type WsUpgrader struct {
 	sctx     smart_context.ISmartContext
 	Upgrader websocket.Upgrader
+	router   *WsRouter
 
-	apiRequestTimeout time.Duration
+	apiRequestTimeout    time.Duration
+	outboundQueueSize    int
+	authTimeout          time.Duration
+	sessionCheckInterval time.Duration
 }
 
 func NewWsUpgrader(sctx smart_context.ISmartContext) *WsUpgrader {
 	apiRequestTimeoutSec := env_vars.GetEnvAsInt(sctx, "API_REQUEST_TIMEOUT", 600)
+	outboundQueueSize := env_vars.GetEnvAsInt(sctx, "WS_OUTBOUND_QUEUE_SIZE", ws_registry.DefaultQueueSize)
+	authTimeoutSec := env_vars.GetEnvAsInt(sctx, "WS_AUTH_TIMEOUT_SEC", DefaultAuthTimeoutSec)
+	sessionCheckSec := env_vars.GetEnvAsInt(sctx, "WS_SESSION_CHECK_SEC", DefaultSessionCheckSec)
+	allowedOrigins := parseAllowedOrigins(os.Getenv("WS_ALLOWED_ORIGINS"))
+
+	router := NewWsRouter()
+	registerDefaultActions(router)
 
 	return &WsUpgrader{
 		sctx: sctx.
@@ -48,11 +67,40 @@ func NewWsUpgrader(sctx smart_context.ISmartContext) *WsUpgrader {
 			EnableCompression: true, // Enable Per-Message Deflate compression
 
 			CheckOrigin: func(r *http.Request) bool {
-				return true
+				return isOriginAllowed(allowedOrigins, r.Header.Get("Origin"))
 			},
 		},
-		apiRequestTimeout: time.Duration(apiRequestTimeoutSec) * time.Second,
+		router:               router,
+		apiRequestTimeout:    time.Duration(apiRequestTimeoutSec) * time.Second,
+		outboundQueueSize:    outboundQueueSize,
+		authTimeout:          time.Duration(authTimeoutSec) * time.Second,
+		sessionCheckInterval: time.Duration(sessionCheckSec) * time.Second,
+	}
+}
+
+// parseAllowedOrigins разбирает WS_ALLOWED_ORIGINS – список origin через запятую
+func parseAllowedOrigins(value string) map[string]bool {
+	origins := make(map[string]bool)
+	for _, origin := range strings.Split(value, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins[strings.ToLower(origin)] = true
+		}
 	}
+	return origins
+}
+
+// isOriginAllowed: без заголовка Origin подключаются агенты (не браузер), если список не задан – разрешены все.
+// Доступ все равно требует аутентификации, список origin лишь отсекает чужие страницы
+func isOriginAllowed(allowed map[string]bool, origin string) bool {
+	if origin == "" || len(allowed) == 0 {
+		return true
+	}
+	return allowed[strings.ToLower(origin)]
+}
+
+// GetRouter возвращает роутер action, чтобы можно было регистрировать дополнительные обработчики
+func (u *WsUpgrader) GetRouter() *WsRouter {
+	return u.router
 }
 
 func (u *WsUpgrader) HandleNotFound(w http.ResponseWriter, r *http.Request) {
@@ -63,26 +111,29 @@ func (u *WsUpgrader) HandleNotFound(w http.ResponseWriter, r *http.Request) {
 	http.NotFound(w, r)
 }
 
-func (u *WsUpgrader) sendResponse(sctx smart_context.ISmartContext, messageChan chan<- Message, msg Message) {
-	// если контекст прервали то не нужно отправять ответ!
-	msg.Sctx = sctx // чисто для логгирования!
-	ctx := sctx.GetContext()
-
-	// Use a select statement to handle context cancellation or sending the message.
-	select {
-	case <-ctx.Done():
-		// If the context is canceled, log the cancellation and return without sending the message.
-		sctx.Warnf("WebSocket connection: sendResponse: context canceled, when was trying to send '%s' to out channel", messageTypeToString(msg.Type))
-		return
-	case messageChan <- msg:
-		// If the context is active, send the response to the channel.
-		// sctx.Debug("sendResponse(): response sent successfully to out channel")
+func (u *WsUpgrader) sendResponse(sctx smart_context.ISmartContext, wsConn *ws_registry.Connection, msgType int, data []byte) {
+	// если контекст прервали или соединение закрыто то не нужно отправять ответ!
+	err := wsConn.Send(sctx, msgType, data, ws_registry.DropPolicyBlock, 0)
+	if err != nil {
+		sctx.Warnf("WebSocket connection: sendResponse: %v, when was trying to send '%s' to out queue", err, messageTypeToString(msgType))
 	}
 }
 
 func (u *WsUpgrader) HandleWebSocket(sctx smart_context.ISmartContext, w http.ResponseWriter, r *http.Request) {
 	serverCtx := sctx.GetContext()
 
+	// Фронтенд передает JWT в query параметре token или в первом сообщении register_frontend.
+	// Устройства аутентифицируются секретом в register_device
+	var user *rest_middleware.Identity
+	if token := r.URL.Query().Get("token"); token != "" {
+		var err error
+		if user, err = auth_service.ValidateAccessToken(sctx, token); err != nil {
+			sctx.Warnf("WebSocket connection: invalid token: %v", err)
+			_ = rest_middleware.WriteError(w, http.StatusUnauthorized, rest_middleware.ErrorResponse{Error: "Invalid token", RequestID: sctx.GetRequestID()})
+			return
+		}
+	}
+
 	conn, err := u.Upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		sctx.Errorf("WebSocket connection: request received, error upgrading to WebSocket: ", err)
@@ -98,26 +149,48 @@ func (u *WsUpgrader) HandleWebSocket(sctx smart_context.ISmartContext, w http.Re
 	// Session started
 	u.sctx.Infof("WebSocket connection: request received, upgraded to WebSocket")
 
-	messageChan := make(chan Message, 100) // Buffered channel to avoid blocking
+	// все записи в сокет идут через очередь соединения, пишет только writePump
+	wsConn := ws_registry.NewConnection(sctx.GetSessionId(), conn, u.outboundQueueSize)
 	wg := sync.WaitGroup{}
 
 	sessionCtx, cancelSessionCtx := context.WithCancel(r.Context())
 	defer cancelSessionCtx()
-	sctx = sctx.WithContext(sessionCtx)
+	// IP клиента – для журнала аудита (просмотр медиа устройства)
+	sctx = sctx.WithContext(sessionCtx).WithClientIP(rest_middleware.ClientIP(sctx, r))
 
+	// Состояние сессии: кто подключился (устройство или фронтенд) и какое устройство за ним стоит
+	session := newWsSession(wsConn, func(code int, reason string) {
+		u.sendResponse(sctx, wsConn, websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+		// если клиент не ответит на CloseMessage, цикл чтения завершится по дедлайну
+		if err := conn.SetReadDeadline(time.Now().Add(closeGracePeriod)); err != nil {
+			sctx.Errorf("WebSocket connection: error setting close deadline: %v", err)
+		}
+	})
 	defer func() {
-		sctx.Infof("WebSocket connection: defer block: closing messages channel")
-		close(messageChan)
+		sctx.Infof("WebSocket connection: defer block: closing outbound queue")
+		removeConnection(sctx, session)
+		wsConn.Close()
 	}()
 
-	// Переменная для хранения зарегистрированного device key,
-	// полученного из сообщения "register_device"
-	// TODO: решить проблему с локально переменой. Придумать куда сохранять это
-	var registeredDeviceKey string
+	if user != nil {
+		session.SetFrontend(user)
+		ws_registry.AddFrontend(wsConn, ws_registry.FrontendUser{UserID: user.UserID, SessionID: user.SessionID})
+		sctx.Infof("WebSocket connection: frontend of user %s authenticated by token", user.Username)
+	} else {
+		// до аутентификации принимаем только небольшие сообщения рукопожатия и ждем его не дольше authTimeout
+		conn.SetReadLimit(handshakeReadLimit)
+		authTimer := time.AfterFunc(u.authTimeout, func() {
+			if !session.IsAuthenticated() && sessionCtx.Err() == nil {
+				sctx.Warnf("WebSocket connection: not authenticated in %s, closing", u.authTimeout)
+				session.Close(websocket.ClosePolicyViolation, "authentication timeout")
+			}
+		})
+		defer authTimer.Stop()
+	}
 
 	safe_go.SafeGo(sctx, func() {
-		// Канал запроектся только в defer когда все писатели запишут туда что хотели и завершат свою работу (wg опустет)
-		u.writePump(conn, messageChan, sctx)
+		// Очередь закроется только в defer когда все писатели запишут туда что хотели и завершат свою работу (wg опустет)
+		u.writePump(wsConn, sctx)
 	})
 
 	isRealEnv := smart_context.IsRealEnv()
@@ -145,11 +218,7 @@ func (u *WsUpgrader) HandleWebSocket(sctx smart_context.ISmartContext, w http.Re
 	conn.SetPingHandler(func(appData string) error {
 		// in case client sends a ping message, we should respond with a pong message
 		sctx.Debugf("WebSocket connection: received %s", messageTypeToString(websocket.PingMessage))
-		msg := Message{
-			Type: websocket.PongMessage,
-			Data: []byte(appData),
-		}
-		u.sendResponse(sctx, messageChan, msg)
+		u.sendResponse(sctx, wsConn, websocket.PongMessage, []byte(appData))
 		// sctx.Debugf("WebSocket connection: pong sent")
 		return nil
 	})
@@ -158,11 +227,11 @@ func (u *WsUpgrader) HandleWebSocket(sctx smart_context.ISmartContext, w http.Re
 	conn.SetCloseHandler(func(code int, text string) error {
 		sctx.Infof("WebSocket connection: connection closed (%d - %s)", code, text)
 		// Если соединение закрыто клиентом, обновляем статус устройства на OFFLINE.
-		if code == websocket.CloseNormalClosure || code == websocket.CloseGoingAway {
-			setDeviceStatusOffline(sctx, registeredDeviceKey)
+		if session.Kind() == SenderDevice && (code == websocket.CloseNormalClosure || code == websocket.CloseGoingAway) {
+			setDeviceStatusOffline(sctx, session.DeviceIdentifier())
 		}
 
-		ws_registry.RemoveConnection(conn)
+		removeConnection(sctx, session)
 
 		return nil
 	})
@@ -171,17 +240,18 @@ func (u *WsUpgrader) HandleWebSocket(sctx smart_context.ISmartContext, w http.Re
 	go func() {
 		ticker := time.NewTicker(30 * time.Second) // Ping every 30 seconds
 		defer ticker.Stop()
+		sessionCheckTicker := time.NewTicker(u.sessionCheckInterval)
+		defer sessionCheckTicker.Stop()
 
 		for {
 			select {
 			case <-ticker.C:
-				msg := Message{
-					Type: websocket.PingMessage,
-					Data: nil,
-				}
-				u.sendResponse(sctx, messageChan, msg)
+				u.sendResponse(sctx, wsConn, websocket.PingMessage, nil)
 				// sctx.Debugf("WebSocket connection: ping sent")
 
+			case <-sessionCheckTicker.C:
+				u.checkFrontendSession(sctx, session)
+
 			case <-sessionCtx.Done():
 				// юзер закрыл браузер (или сервер закрылся и мы дождались завершения всех запросов и отправки их ответов) - перестаем слать пинги
 				return
@@ -210,16 +280,7 @@ func (u *WsUpgrader) HandleWebSocket(sctx smart_context.ISmartContext, w http.Re
 
 			sctx.Debugf("Received %s", messageTypeToString(messageType))
 			if messageType == websocket.TextMessage {
-				// TODO: переработать вот это. Выглядит ужастно
-				var wsMsg WSMessage
-				sctx.Infof("WSMessage: %v", wsMsg.Action)
-				if err := json.Unmarshal(messageData, &wsMsg); err != nil {
-					sctx.Errorf("Error unmarshalling WebSocket message: %v", err)
-					continue
-				}
-
-				handleWsActionMessage(sctx, conn, wsMsg)
-				registeredDeviceKey = wsMsg.DeviceKey
+				u.router.Dispatch(sctx, session, messageData)
 			} else {
 				// Для других типов сообщений можно добавить дополнительную обработку
 				sctx.Infof("Non-text message received")
@@ -231,7 +292,7 @@ func (u *WsUpgrader) HandleWebSocket(sctx smart_context.ISmartContext, w http.Re
 				// Если контекст прервали - то не нужно обрабатывать запросы - просто их игнорируем
 				sctx.Infof("WebSocket connection: read message loop: server context canceled, need to respond with error")
 				// done: нельзя просто игнорировать- надо вернуть ошибку!
-				// u.safeProcessRequest(sctx, messageChan, msg, true)
+				// u.safeProcessRequest(sctx, wsConn, msg, true)
 				continue // продолжаем дальше вычитывать сообщения - коннект скоро закроют и мы выйдем из цикла
 			}
 
@@ -240,7 +301,7 @@ func (u *WsUpgrader) HandleWebSocket(sctx smart_context.ISmartContext, w http.Re
 				defer wg.Done()
 				// если контекст прервут мы быстро выйдем даже если результат уже готов для отправки в канал и наружу
 				// TODO: не надо выходить по прерыванию контекста
-				// u.safeProcessRequest(sctx, messageChan, msg, false)
+				// u.safeProcessRequest(sctx, wsConn, msg, false)
 			})
 		}
 	}()
@@ -259,11 +320,7 @@ func (u *WsUpgrader) HandleWebSocket(sctx smart_context.ISmartContext, w http.Re
 		sctx.Infof("WebSocket connection: main block: all requests finished - send CloseMessage to user")
 
 		// send CloseMessage to user
-		msg := Message{
-			Type: websocket.CloseMessage,
-			Data: websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Server context canceled"),
-		}
-		u.sendResponse(sctx, messageChan, msg)
+		u.sendResponse(sctx, wsConn, websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Server context canceled"))
 		// после этого сообщения юзер должен разорвать соединение. но если не разорвет - не страшно - мы все равно уже выходим
 
 		sctx.Infof("WebSocket connection: main block: CloseMessage sent to user, canceling session context")
@@ -279,6 +336,25 @@ func (u *WsUpgrader) HandleWebSocket(sctx smart_context.ISmartContext, w http.Re
 	}
 }
 
+// checkFrontendSession закрывает соединение фронтенда, если его сессия отозвана (выход, смена пароля или роли)
+// или пользователь удален: JWT проверяется при подключении, а соединение живет дольше
+func (u *WsUpgrader) checkFrontendSession(sctx smart_context.ISmartContext, session *WsSession) {
+	user := session.User()
+	if user == nil {
+		return
+	}
+	err := auth_service.ValidateIdentity(sctx, user)
+	if errors.Is(err, auth_service.ErrSessionRevoked) {
+		sctx.Infof("WebSocket connection: session of user %s is no longer valid, closing", user.Username)
+		recordViewsStopped(sctx, session, ws_registry.UnsubscribeAll(session.Conn()))
+		session.Close(websocket.ClosePolicyViolation, "session revoked")
+		return
+	}
+	if err != nil {
+		sctx.Warnf("WebSocket connection: error checking session of user %s: %v", user.Username, err)
+	}
+}
+
 func messageTypeToString(messageType int) string {
 	switch messageType {
 	case websocket.TextMessage:
@@ -296,15 +372,28 @@ func messageTypeToString(messageType int) string {
 	}
 }
 
-func (u *WsUpgrader) writePump(conn *websocket.Conn, messageChan chan Message, sctx smart_context.ISmartContext) {
+func (u *WsUpgrader) writePump(wsConn *ws_registry.Connection, sctx smart_context.ISmartContext) {
+	conn := wsConn.Conn()
 	defer func() {
 		sctx.Infof("WebSocket connection: close connection on server side")
+		wsConn.Close()
 		conn.Close() // закрываем соединение когда выйдем из функции
 	}()
 
-	// если контекст прервут то все быстро прекратят слать данные в канал, все запросы завершатся и мы выйдем и канал закроем
-	// поэтому тут безопасно и красиво всё вычитывать до конца
-	for msg := range messageChan {
+	// если контекст прервут то все быстро прекратят слать данные в очередь, все запросы завершатся и мы выйдем и очередь закроем
+	// после закрытия дописываем то, что уже успели положить в очередь
+	for {
+		var msg ws_registry.OutboundMessage
+		select {
+		case msg = <-wsConn.Queue():
+		case <-wsConn.Done():
+			select {
+			case msg = <-wsConn.Queue():
+			default:
+				return
+			}
+		}
+
 		startSendingAt := time.Now()
 		curSctx := sctx
 		if msg.Sctx != nil {
@@ -334,6 +423,9 @@ func (u *WsUpgrader) writePump(conn *websocket.Conn, messageChan chan Message, s
 		size := len(msg.Data)
 
 		if err != nil {
+			// после ошибки записи соединение больше не пригодно - помечаем закрытым, чтобы писатели сразу получали ошибку
+			wsConn.Close()
+
 			// эти статусы ошибки не ошибка сервера (например, клиент закрыл соединение), для них функция вернет false
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				curSctx.
@@ -355,271 +447,32 @@ func (u *WsUpgrader) writePump(conn *websocket.Conn, messageChan chan Message, s
 	}
 }
 
-// handleWsActionMessage обрабатывает полученное сообщение в зависимости от action
-func handleWsActionMessage(sctx smart_context.ISmartContext, conn *websocket.Conn, wsMsg WSMessage) {
-	switch wsMsg.Action {
-	case "register_device":
-		sctx.Infof("Register device action: device_key=%s", wsMsg.DeviceKey)
-		device_id, err := registerDevice(sctx, wsMsg.DeviceKey)
-		if err != nil {
-			return
-		}
-
-		registrWSConnection(conn, device_id)
-
-		go checkAndSendPendingCommands(sctx, device_id, conn)
-	case "register_frontend":
-		regKey := "frontend_" + wsMsg.DeviceKey
-		ws_registry.SetClient(regKey, conn)
-		sctx.Infof("Registered frontend client with key: %s", regKey)
-	case "command_executed":
-		var payload struct {
-			Command   string `json:"command"`
-			Timestamp int64  `json:"timestamp"`
-		}
-		if err := json.Unmarshal(wsMsg.Payload, &payload); err != nil {
-			sctx.Errorf("Error unmarshalling command_executed payload: %v", err)
-			return
-		}
-
-		var device model.Device
-		err := sctx.GetDB().Where("device_identifier = ?", wsMsg.DeviceKey).First(&device).Error
-		if err != nil {
-			sctx.Warnf("Error finding device for audio stream: %v", err)
-			return
-		}
-		// Здесь можно выполнить логику обновления команды в БД.
-		// Например, найти команду с соответствующим типом и статусом "sent" (или "pending") для данного устройства,
-		// и обновить ее статус на "executed".
-		if err := sctx.GetDB().Model(&model.Command{}).
-			Where("device_id = ? AND command_type = ? AND status IN (?)", device.ID, payload.Command, []string{"PENDING", "SENT"}).
-			Updates(map[string]any{
-				"status":      "EXECUTED",
-				"executed_at": time.Now(),
-			}).Error; err != nil {
-			sctx.Errorf("Error updating command status for command '%s': %v", payload.Command, err)
-		} else {
-			sctx.Infof("Command '%s' for device '%s' marked as executed", payload.Command, wsMsg.DeviceKey)
-		}
-	case "sent_metrics":
-		var metrics model.Metric
-		if err := json.Unmarshal(wsMsg.Payload, &metrics); err != nil {
-			sctx.Errorf("Error unmarshalling metrics payload: %v", err)
-			return
-		}
-
-		var device model.Device
-		err := sctx.GetDB().Where("device_identifier = ?", wsMsg.DeviceKey).First(&device).Error
-		if err != nil {
-			return
-		}
-
-		metrics.DeviceID = device.ID
-		metrics.CreatedAt = time.Now()
-
-		geo := sctx.GetGeocoder()
-		if geo == nil {
-			sctx.Warnf("Geocoder not available; cannot perform geocoding")
-			metrics.Latitude, metrics.Longitude = 0, 0
-		} else {
-			lat, lon, err := geo.LocalGeocode(metrics.PublicIP)
-			if err != nil {
-				sctx.Warnf("Local geocoding failed for IP %s: %v", metrics.PublicIP, err)
-				lat, lon = 0, 0
-			}
-			metrics.Latitude = lat
-			metrics.Longitude = lon
-		}
-
-		if err := sctx.GetDB().Create(&metrics).Error; err != nil {
-			sctx.Errorf("Error saving metrics for device %s: %v", metrics.DeviceID, err)
-			return
-		}
-		sctx.Infof("Metrics saved for device: %s", metrics.DeviceID)
-	case "sent_apps":
-		// Обрабатываем список приложений
-		var installedApps []model.Application
-		if err := json.Unmarshal(wsMsg.Payload, &installedApps); err != nil {
-			sctx.Errorf("Error unmarshalling installed apps payload: %v", err)
-			return
-		}
-
-		// Находим device_id по device_key
-		var device model.Device
-		err := sctx.GetDB().Where("device_identifier = ?", wsMsg.DeviceKey).First(&device).Error
-		if err != nil {
-			sctx.Errorf("Error finding device by device_key %s: %v", wsMsg.DeviceKey, err)
-			return
-		}
-
-		// Сохраняем в отдельные таблицы (applications, device_applications)
-		err = saveInstalledApps(sctx, device.ID, installedApps)
-		if err != nil {
-			sctx.Errorf("Error saving installed apps: %v", err)
-		}
-		sctx.Infof("Installed apps saved for device: %s", device.ID)
-	case "camera_frame":
-		sctx.Infof("Received camera frame from device: %s", wsMsg.DeviceKey)
-		// Формируем ключ для фронтенд клиента
-
-		var device model.Device
-		err := sctx.GetDB().Where("device_identifier = ?", wsMsg.DeviceKey).First(&device).Error
-		if err != nil {
-			sctx.Warnf("ошибка при получении устройства: %w", err)
-			return
-		}
-
-		targetKey := "frontend_" + device.ID
-		sctx.Infof("targetKey: %v", targetKey)
-		targetConn, found := ws_registry.GetClient(targetKey)
-		if !found {
-			sctx.Warnf("Frontend client not found for key: %s", targetKey)
-			return
-		}
-		data, err := json.Marshal(wsMsg)
-		if err != nil {
-			sctx.Errorf("Failed to marshal camera_frame message: %v", err)
-			return
-		}
-		if err := targetConn.WriteMessage(websocket.TextMessage, data); err != nil {
-			sctx.Errorf("Failed to forward camera_frame: %v", err)
-		}
-	case "recorded_audio":
-		sctx.Infof("Received recorded audio from device: %s", wsMsg.DeviceKey)
-
-		var device model.Device
-		err := sctx.GetDB().Where("device_identifier = ?", wsMsg.DeviceKey).First(&device).Error
-		if err != nil {
-			sctx.Warnf("ошибка при получении устройства: %w", err)
-			return
-		}
-
-		targetKey := "frontend_" + device.ID
-		targetConn, found := ws_registry.GetClient(targetKey)
-		if !found {
-			sctx.Warnf("Frontend client not found for key: %s", targetKey)
-			return
-		}
-		data, err := json.Marshal(wsMsg)
-		if err != nil {
-			sctx.Errorf("Failed to marshal recorded_audio message: %v", err)
-			return
-		}
-		if err := targetConn.WriteMessage(websocket.TextMessage, data); err != nil {
-			sctx.Errorf("Failed to forward recorded_audio: %v", err)
-		}
-	case "capture_frame":
-		sctx.Infof("Received command '%s' from frontend for device: %s", wsMsg.Action, wsMsg.DeviceKey)
-		var device model.Device
-		err := sctx.GetDB().Where("device_identifier = ?", wsMsg.DeviceKey).First(&device).Error
-		if err != nil {
-			sctx.Warnf("ошибка при получении устройства: %w", err)
-			return
-		}
-
-		targetKey := "frontend_" + device.ID
-		targetConn, found := ws_registry.GetClient(targetKey)
-		if !found {
-			sctx.Warnf("Frontend client not found for key: %s", targetKey)
-			return
-		}
-		data, err := json.Marshal(wsMsg)
-		if err != nil {
-			sctx.Errorf("Failed to marshal %s message: %v", wsMsg.Action, err)
-			return
-		}
-		if err := targetConn.WriteMessage(websocket.TextMessage, data); err != nil {
-			sctx.Errorf("Failed to forward %s message: %v", wsMsg.Action, err)
-		}
-	case "screenshot":
-		sctx.Infof("Received command '%s' from frontend for device: %s", wsMsg.Action, wsMsg.DeviceKey)
-		var device model.Device
-		err := sctx.GetDB().Where("device_identifier = ?", wsMsg.DeviceKey).First(&device).Error
-		if err != nil {
-			sctx.Warnf("ошибка при получении устройства: %w", err)
-			return
-		}
-
-		targetKey := "frontend_" + device.ID
-		targetConn, found := ws_registry.GetClient(targetKey)
-		if !found {
-			sctx.Warnf("Frontend client not found for key: %s", targetKey)
-			return
-		}
-		data, err := json.Marshal(wsMsg)
-		if err != nil {
-			sctx.Errorf("Failed to marshal %s message: %v", wsMsg.Action, err)
-			return
-		}
-		if err := targetConn.WriteMessage(websocket.TextMessage, data); err != nil {
-			sctx.Errorf("Failed to forward %s message: %v", wsMsg.Action, err)
-		}
-	case "audio_stream":
-		sctx.Infof("Received audio stream chunk from device: %s", wsMsg.DeviceKey)
-		// Если требуется пересылка на frontend:
-		var device model.Device
-		err := sctx.GetDB().Where("device_identifier = ?", wsMsg.DeviceKey).First(&device).Error
-		if err != nil {
-			sctx.Warnf("Error finding device for audio stream: %v", err)
-			return
-		}
-		// Формируем ключ для фронтенд-клиента
-		targetKey := "frontend_" + device.ID
-		targetConn, found := ws_registry.GetClient(targetKey)
-		if !found {
-			sctx.Warnf("Frontend client not found for key: %s", targetKey)
-			return
-		}
-		// Маршрутизируем сообщение, пересылая его на фронтенд
-		data, err := json.Marshal(wsMsg)
-		if err != nil {
-			sctx.Errorf("Failed to marshal audio_stream message: %v", err)
-			return
-		}
-		if err := targetConn.WriteMessage(websocket.TextMessage, data); err != nil {
-			sctx.Errorf("Failed to forward audio_stream message: %v", err)
-		}
-	default:
-		sctx.Warnf("Unknown action received: %s", wsMsg.Action)
+// registerDevice проверяет учетные данные устройства и помечает его ONLINE.
+// issuedSecret не пустой, если устройству только что выдан секрет. Для неподтвержденного устройства
+// возвращается ошибка device_auth.CheckApproved вместе с устройством и выданным секретом
+func registerDevice(sctx smart_context.ISmartContext, deviceIdentifier string, secret string, enrollmentToken string) (device *model.Device, issuedSecret string, err error) {
+	device, issuedSecret, err = device_auth.Authenticate(sctx, deviceIdentifier, secret, enrollmentToken)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := device_auth.CheckApproved(device); err != nil {
+		return device, issuedSecret, err
 	}
-}
 
-func registerDevice(sctx smart_context.ISmartContext, deviceIdentifier string) (string, error) {
-	var device model.Device
-	err := sctx.GetDB().Where("device_identifier = ?", deviceIdentifier).First(&device).Error
+	device.LastSeen = time.Now()
+	device.Status = "ONLINE"
+	device.UpdatedAt = device.LastSeen
+	err = sctx.GetDB().Model(device).Updates(map[string]any{
+		"last_seen":  device.LastSeen,
+		"status":     device.Status,
+		"updated_at": device.UpdatedAt,
+	}).Error
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			// Устройство не найдено, создаём новую запись
-			device = model.Device{
-				DeviceIdentifier: deviceIdentifier,
-				Status:           "ONLINE",
-				LastSeen:         time.Now(),
-				CreatedAt:        time.Now(),
-				UpdatedAt:        time.Now(),
-			}
-			if err := sctx.GetDB().Create(&device).Error; err != nil {
-				sctx.Errorf("Error registering device %s: %v", deviceIdentifier, err)
-				return "", err
-			}
-			sctx.Infof("Device registered: %s", deviceIdentifier)
-		} else {
-			sctx.Errorf("DB error when processing device %s: %v", deviceIdentifier, err)
-			return "", err
-		}
-	} else {
-		// Устройство найдено, обновляем информацию
-		device.LastSeen = time.Now()
-		device.Status = "ONLINE"
-		if err := sctx.GetDB().Save(&device).Error; err != nil {
-			sctx.Errorf("Error updating device %s: %v", deviceIdentifier, err)
-			return "", err
-		}
-		sctx.Infof("Device updated: %s", deviceIdentifier)
+		sctx.Errorf("Error updating device %s: %v", deviceIdentifier, err)
+		return nil, "", err
 	}
-	// Сохраняем фактический device_id (primary key) в контекст под новым ключом
-	// sctx = sctx.WithField("device_id", device.ID)
-	// sctx.Infof("Saved device_id in context: %v", device.ID)
-	return device.ID, nil
+	sctx.Infof("Device updated: %s", deviceIdentifier)
+	return device, issuedSecret, nil
 }
 
 func setDeviceStatusOffline(sctx smart_context.ISmartContext, deviceIdentifier string) error {
@@ -638,11 +491,13 @@ func setDeviceStatusOffline(sctx smart_context.ISmartContext, deviceIdentifier s
 	sctx.Infof("Device %s set to OFFLINE; id: %s", deviceIdentifier, device.ID)
 	// Удаляем соединение
 	ws_registry.RemoveClient(device.ID)
+	device.Status = "OFFLINE"
+	publishDeviceStatus(sctx, &device)
 
 	return nil
 }
 
-func registrWSConnection(conn *websocket.Conn, device_id string) {
+func registrWSConnection(conn *ws_registry.Connection, device_id string) {
 	ws_registry.SetClient(device_id, conn)
 }
 
@@ -691,29 +546,3 @@ func saveInstalledApps(sctx smart_context.ISmartContext, deviceID string, instal
 	}
 	return nil
 }
-
-func checkAndSendPendingCommands(sctx smart_context.ISmartContext, deviceID string, conn *websocket.Conn) {
-	var pendingCommands []model.Command
-	if err := sctx.GetDB().Where("device_id = ? AND status = ?", deviceID, "PENDING").Find(&pendingCommands).Error; err != nil {
-		sctx.Errorf("Error fetching pending commands for device %s: %v", deviceID, err)
-		return
-	}
-	if len(pendingCommands) == 0 {
-		sctx.Infof("No pending commands for device %s", deviceID)
-		return
-	}
-	sctx.Infof("Found %d pending commands for device %s", len(pendingCommands), deviceID)
-	for _, cmd := range pendingCommands {
-		// Отправляем команду через WS
-		if err := conn.WriteMessage(websocket.TextMessage, []byte(cmd.CommandType)); err != nil {
-			sctx.Errorf("Error sending pending command %s: %v", cmd.ID, err)
-			continue
-		}
-		// Обновляем статус команды на "sent"
-		sctx.GetDB().Model(&cmd).Updates(map[string]any{
-			"status":      "sent",
-			"executed_at": time.Now(),
-		})
-		sctx.Infof("Pending command %s sent to device %s", cmd.ID, deviceID)
-	}
-}
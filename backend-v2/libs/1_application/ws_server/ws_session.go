@@ -0,0 +1,122 @@
+package ws_server
+
+import (
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/rest_middleware"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/ws_registry"
+	"encoding/json"
+	"sync"
+)
+
+// WsSession – состояние одного WebSocket соединения.
+// Устройство резолвится один раз при register_device и дальше берется отсюда, без запросов в БД на каждое сообщение.
+// Пока сессия не аутентифицирована (kind == SenderAny), ей доступны только register_device и register_frontend.
+type WsSession struct {
+	conn  *ws_registry.Connection // все ответы идут через очередь writePump
+	close func(code int, reason string)
+
+	mu     sync.RWMutex
+	kind   SenderKind
+	device *model.Device             // заполнено для сессий устройств
+	user   *rest_middleware.Identity // заполнено для сессий фронтенда
+}
+
+func newWsSession(conn *ws_registry.Connection, close func(code int, reason string)) *WsSession {
+	return &WsSession{
+		conn:  conn,
+		close: close,
+		kind:  SenderAny,
+	}
+}
+
+func (s *WsSession) Conn() *ws_registry.Connection {
+	return s.conn
+}
+
+func (s *WsSession) Kind() SenderKind {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.kind
+}
+
+// SetDevice помечает сессию как сессию устройства
+func (s *WsSession) SetDevice(device *model.Device) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.kind = SenderDevice
+	s.device = device
+	s.conn.Conn().SetReadLimit(0) // сессия аутентифицирована – снимаем ограничение рукопожатия
+}
+
+// Device возвращает устройство сессии или nil, если сессия не зарегистрирована как устройство
+func (s *WsSession) Device() *model.Device {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.device
+}
+
+// DeviceIdentifier возвращает device_identifier устройства сессии или пустую строку
+func (s *WsSession) DeviceIdentifier() string {
+	device := s.Device()
+	if device == nil {
+		return ""
+	}
+	return device.DeviceIdentifier
+}
+
+// SetFrontend помечает сессию как фронтенд пользователя из проверенного JWT.
+// Устройства, которые он смотрит, хранятся в подписках ws_registry.
+func (s *WsSession) SetFrontend(user *rest_middleware.Identity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.kind = SenderFrontend
+	s.user = user
+	s.conn.Conn().SetReadLimit(0) // сессия аутентифицирована – снимаем ограничение рукопожатия
+}
+
+// User возвращает пользователя фронтенд сессии или nil
+func (s *WsSession) User() *rest_middleware.Identity {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.user
+}
+
+// IsAuthenticated – сессия зарегистрирована как устройство или фронтенд
+func (s *WsSession) IsAuthenticated() bool {
+	return s.Kind() != SenderAny
+}
+
+// Close отправляет клиенту CloseMessage и разрывает соединение
+func (s *WsSession) Close(code int, reason string) {
+	s.close(code, reason)
+}
+
+// Reply отправляет сообщение обратно отправителю через очередь writePump
+func (s *WsSession) Reply(sctx smart_context.ISmartContext, wsMsg WSMessage) {
+	data, err := json.Marshal(wsMsg)
+	if err != nil {
+		sctx.Errorf("Failed to marshal %s reply: %v", wsMsg.Action, err)
+		return
+	}
+	if err := s.conn.SendText(sctx, data); err != nil {
+		sctx.Warnf("Failed to send %s reply: %v", wsMsg.Action, err)
+	}
+}
+
+// ReplyError отправляет отправителю сообщение с action "error"
+func (s *WsSession) ReplyError(sctx smart_context.ISmartContext, action string, code string, message string) {
+	payload, err := json.Marshal(WsErrorPayload{
+		Action:  action,
+		Code:    code,
+		Message: message,
+	})
+	if err != nil {
+		sctx.Errorf("Failed to marshal error payload: %v", err)
+		return
+	}
+	s.Reply(sctx, WSMessage{
+		Action:  "error",
+		Payload: payload,
+	})
+}
@@ -0,0 +1,203 @@
+package audit
+
+import (
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+// Действия журнала аудита (audit_events.action)
+const (
+	ActionLogin                    = "auth.login"
+	ActionLoginFailed              = "auth.login_failed"
+	ActionLoginLocked              = "auth.login_locked"
+	ActionLogout                   = "auth.logout"
+	ActionRefreshTokenReused       = "auth.refresh_token_reused"
+	ActionTwoFactorEnabled         = "auth.2fa_enabled"
+	ActionTwoFactorDisabled        = "auth.2fa_disabled"
+	ActionTwoFactorReset           = "auth.2fa_reset"
+	ActionRecoveryCodesRegenerated = "auth.recovery_codes_regenerated"
+	ActionAPIKeyCreated            = "auth.api_key_created"
+	ActionAPIKeyRevoked            = "auth.api_key_revoked"
+
+	ActionUserRegistered         = "user.registered"
+	ActionUserUpdated            = "user.updated"
+	ActionUserRoleChanged        = "user.role_changed"
+	ActionUserGroupsChanged      = "user.device_groups_changed"
+	ActionUserUnlocked           = "user.unlocked"
+	ActionInvitationCreated      = "user.invitation_created"
+	ActionInvitationRevoked      = "user.invitation_revoked"
+	ActionInvitationAccepted     = "user.invitation_accepted"
+	ActionRolePermissionsChanged = "role.permissions_changed"
+	ActionRoleTwoFactorChanged   = "role.2fa_requirement_changed"
+
+	ActionDeviceGroupCreated     = "device_group.created"
+	ActionDeviceGroupUpdated     = "device_group.updated"
+	ActionDeviceGroupDeleted     = "device_group.deleted"
+	ActionDeviceGroupAssigned    = "device.group_assigned"
+	ActionDeviceAccepted         = "device.accepted"
+	ActionDeviceRejected         = "device.rejected"
+	ActionEnrollmentTokenCreated = "device.enrollment_token_created"
+	ActionEnrollmentTokenRevoked = "device.enrollment_token_revoked"
+
+	ActionCommandSent      = "command.sent"
+	ActionBulkCommandSent  = "command.bulk_sent"
+	ActionCommandCancelled = "command.cancelled"
+	ActionCommandApproved  = "command.approved"
+	ActionCommandRejected  = "command.rejected"
+	ActionBatchApproved    = "command.batch_approved"
+	ActionBatchRejected    = "command.batch_rejected"
+	ActionScheduleCreated  = "command.schedule_created"
+	ActionScheduleUpdated  = "command.schedule_updated"
+	ActionScheduleDeleted  = "command.schedule_deleted"
+	ActionMediaViewStarted = "media.view_started"
+	ActionMediaViewStopped = "media.view_stopped"
+)
+
+// Типы объектов действий (audit_events.target_type)
+const (
+	TargetUser            = "user"
+	TargetAccount         = "account" // email, под которым пытались войти
+	TargetIP              = "ip"
+	TargetSession         = "session"
+	TargetRole            = "role"
+	TargetInvitation      = "invitation"
+	TargetAPIKey          = "api_key"
+	TargetDevice          = "device"
+	TargetDeviceGroup     = "device_group"
+	TargetEnrollmentToken = "enrollment_token"
+	TargetCommand         = "command"
+	TargetCommandBatch    = "command_batch"
+	TargetCommandSchedule = "command_schedule"
+)
+
+// поля, которые не попадают в журнал ни в каком виде
+var secretFields = map[string]bool{
+	"password":           true,
+	"password_hash":      true,
+	"code_hash":          true,
+	"key_hash":           true,
+	"token_hash":         true,
+	"refresh_token_hash": true,
+	"secret":             true,
+	"secret_hash":        true,
+}
+
+// Event – действие для журнала аудита
+type Event struct {
+	Action     string
+	TargetType string
+	TargetID   string
+	Before     any // состояние до действия (nil – объект создан)
+	After      any // состояние после действия (nil – объект удален)
+
+	// Исполнитель, если он не пользователь запроса (например, только что вошедший пользователь).
+	// По умолчанию – sctx.GetUserID / GetUsername
+	ActorID   string
+	ActorName string
+}
+
+// Record записывает действие в audit_events. Исполнитель, API ключ, request_id и IP клиента берутся из sctx.
+// Before и After сериализуются в JSON, для объектов сохраняются только изменившиеся поля, секреты отбрасываются.
+// Ошибка записи журналируется и не прерывает само действие
+func Record(sctx smart_context.ISmartContext, event Event) {
+	record := &model.AuditEvent{
+		CreatedAt:  time.Now(),
+		ActorID:    event.ActorID,
+		ActorName:  event.ActorName,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		RequestID:  sctx.GetRequestID(),
+		ClientIP:   sctx.GetClientIP(),
+	}
+	if record.ActorID == "" {
+		record.ActorID = sctx.GetUserID()
+		record.ActorName = sctx.GetUsername()
+	}
+	if scope := sctx.GetAPIKeyScope(); scope != nil {
+		record.APIKeyID = scope.ID
+	}
+
+	var err error
+	if record.Before, record.After, err = diff(event.Before, event.After); err != nil {
+		sctx.Errorf("Error encoding audit event %s of %s %s: %v", event.Action, event.TargetType, event.TargetID, err)
+	}
+	if err := sctx.GetDB().Create(record).Error; err != nil {
+		sctx.Errorf("Error recording audit event %s of %s %s: %v", event.Action, event.TargetType, event.TargetID, err)
+	}
+}
+
+// diff сериализует состояния до и после. Если оба – объекты, остаются только различающиеся поля
+func diff(before any, after any) ([]byte, []byte, error) {
+	beforeValue, err := normalize(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	afterValue, err := normalize(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	beforeMap, beforeIsMap := beforeValue.(map[string]any)
+	afterMap, afterIsMap := afterValue.(map[string]any)
+	if beforeIsMap && afterIsMap {
+		for key, value := range beforeMap {
+			if other, ok := afterMap[key]; ok && reflect.DeepEqual(value, other) {
+				delete(beforeMap, key)
+				delete(afterMap, key)
+			}
+		}
+	}
+
+	beforeJSON, err := encode(beforeValue)
+	if err != nil {
+		return nil, nil, err
+	}
+	afterJSON, err := encode(afterValue)
+	return beforeJSON, afterJSON, err
+}
+
+// normalize приводит значение к виду после json.Unmarshal (map, slice, примитивы) без секретных полей
+func normalize(value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var result any
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	dropSecrets(result)
+	return result, nil
+}
+
+// dropSecrets удаляет секретные поля из объекта JSON на любой глубине (вложенные объекты и массивы)
+func dropSecrets(value any) {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, item := range value {
+			if secretFields[key] {
+				delete(value, key)
+				continue
+			}
+			dropSecrets(item)
+		}
+	case []any:
+		for _, item := range value {
+			dropSecrets(item)
+		}
+	}
+}
+
+func encode(value any) ([]byte, error) {
+	if value == nil {
+		return nil, nil
+	}
+	return json.Marshal(value)
+}
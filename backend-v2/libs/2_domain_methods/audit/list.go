@@ -0,0 +1,121 @@
+package audit
+
+import (
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultListLimit = 100
+	MaxListLimit     = 1000
+	MaxExportLimit   = 50000
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Filter – фильтры и страница журнала аудита
+type Filter struct {
+	ActorID    string
+	Action     string // точное действие или область с ".*" на конце (auth.*)
+	TargetType string
+	TargetID   string
+	RequestID  string
+	From       time.Time // created_at >= From
+	To         time.Time // created_at < To
+
+	Limit  int
+	Cursor string // next_cursor предыдущей страницы
+}
+
+// Page – страница журнала, новые события первыми. NextCursor пустой на последней странице
+type Page struct {
+	Items      []model.AuditEvent `json:"items"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// List возвращает страницу журнала аудита (keyset пагинация по id)
+func List(sctx smart_context.ISmartContext, filter Filter) (*Page, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultListLimit
+	}
+	filter.Limit = min(filter.Limit, MaxListLimit)
+
+	query, err := filteredQuery(sctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	// берем на одну запись больше, чтобы понять, есть ли следующая страница
+	var items []model.AuditEvent
+	if err := query.Order("id DESC").Limit(filter.Limit + 1).Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("error loading audit events: %w", err)
+	}
+
+	page := &Page{Items: items}
+	if page.Items == nil {
+		page.Items = []model.AuditEvent{}
+	}
+	if len(items) > filter.Limit {
+		page.Items = items[:filter.Limit]
+		page.NextCursor = strconv.FormatInt(page.Items[len(page.Items)-1].ID, 10)
+	}
+	return page, nil
+}
+
+// Export возвращает события по фильтру для выгрузки (не больше MaxExportLimit), новые первыми
+func Export(sctx smart_context.ISmartContext, filter Filter) ([]model.AuditEvent, error) {
+	query, err := filteredQuery(sctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var items []model.AuditEvent
+	if err := query.Order("id DESC").Limit(MaxExportLimit).Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("error exporting audit events: %w", err)
+	}
+	return items, nil
+}
+
+func filteredQuery(sctx smart_context.ISmartContext, filter Filter) (*gorm.DB, error) {
+	query := sctx.GetDB().Model(&model.AuditEvent{})
+	if filter.ActorID != "" {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if area, ok := strings.CutSuffix(filter.Action, ".*"); ok {
+		query = query.Where("action LIKE ?", escapeLike(area)+".%")
+	} else if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.RequestID != "" {
+		query = query.Where("request_id = ?", filter.RequestID)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	if filter.Cursor != "" {
+		lastID, err := strconv.ParseInt(filter.Cursor, 10, 64)
+		if err != nil || lastID <= 0 {
+			return nil, ErrInvalidCursor
+		}
+		query = query.Where("id < ?", lastID)
+	}
+	return query, nil
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,209 @@
+package auth_service
+
+import (
+	"backed-api-v2/libs/2_domain_methods/device_scope"
+	"backed-api-v2/libs/2_domain_methods/permissions"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/rest_middleware"
+	"backed-api-v2/libs/5_common/smart_context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	apiKeyPrefix       = "ak_"
+	apiKeyBytes        = 32
+	apiKeyPrefixLength = len(apiKeyPrefix) + 8 // ak_ и первые 8 символов ключа – для опознания в списке
+
+	// lastUsedUpdateInterval – last_used_at обновляется не чаще, чтобы не писать в БД на каждый запрос
+	lastUsedUpdateInterval = time.Minute
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	ErrInvalidAPIKey  = errors.New("invalid, expired or revoked API key")
+)
+
+// PermissionsNotGrantedError – ключу нельзя дать права, которых нет у роли создателя
+type PermissionsNotGrantedError struct {
+	Codes []string
+}
+
+func (e *PermissionsNotGrantedError) Error() string {
+	return fmt.Sprintf("permissions not granted to your role: %s", strings.Join(e.Codes, ", "))
+}
+
+// APIKeyRequest – параметры нового API ключа
+type APIKeyRequest struct {
+	Name        string
+	Permissions []string
+	GroupIDs    []string      // пустой список – устройства, доступные создателю
+	TTL         time.Duration // 0 – бессрочный
+}
+
+// CreateAPIKey создает API ключ от имени пользователя запроса. Права ключа должны быть у роли создателя,
+// группы – доступны ему. Возвращает запись и сам ключ – он показывается один раз
+func CreateAPIKey(sctx smart_context.ISmartContext, req APIKeyRequest) (*model.APIKey, string, error) {
+	codes := uniqueSortedIDs(req.Permissions)
+	var known []string
+	if err := sctx.GetDB().Model(&model.Permission{}).Where("code IN ?", codes).Pluck("code", &known).Error; err != nil {
+		return nil, "", fmt.Errorf("error checking permissions: %w", err)
+	}
+	if len(known) != len(codes) {
+		return nil, "", &permissions.UnknownPermissionError{Codes: missingIDs(codes, known)}
+	}
+	granted, err := permissions.RolePermissionSet(sctx, sctx.GetUserRole())
+	if err != nil {
+		return nil, "", err
+	}
+	var notGranted []string
+	for _, code := range codes {
+		if !granted[code] {
+			notGranted = append(notGranted, code)
+		}
+	}
+	if len(notGranted) > 0 {
+		return nil, "", &PermissionsNotGrantedError{Codes: notGranted}
+	}
+
+	groupIDs := uniqueSortedIDs(req.GroupIDs)
+	if len(groupIDs) > 0 {
+		scope, err := device_scope.ForUser(sctx)
+		if err != nil {
+			return nil, "", err
+		}
+		// группы вне доступа создателя не отличаются от несуществующих
+		if err := sctx.GetDB().Model(&model.DeviceGroup{}).Where("id IN ?", groupIDs).Pluck("id", &known).Error; err != nil {
+			return nil, "", fmt.Errorf("error checking device groups: %w", err)
+		}
+		var unknown []string
+		for _, groupID := range groupIDs {
+			if !scope.AllowsGroup(groupID) || !slices.Contains(known, groupID) {
+				unknown = append(unknown, groupID)
+			}
+		}
+		if len(unknown) > 0 {
+			return nil, "", &device_scope.UnknownGroupsError{GroupIDs: unknown}
+		}
+	}
+
+	permissionsJSON, err := json.Marshal(codes)
+	if err != nil {
+		return nil, "", fmt.Errorf("error encoding permissions: %w", err)
+	}
+	groupsJSON, err := json.Marshal(groupIDs)
+	if err != nil {
+		return nil, "", fmt.Errorf("error encoding device groups: %w", err)
+	}
+
+	buf := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", fmt.Errorf("error generating API key: %w", err)
+	}
+	key := apiKeyPrefix + hex.EncodeToString(buf)
+
+	now := time.Now()
+	record := &model.APIKey{
+		Name:        req.Name,
+		KeyPrefix:   key[:apiKeyPrefixLength],
+		KeyHash:     hashToken(key),
+		Permissions: permissionsJSON,
+		GroupIDs:    groupsJSON,
+		CreatedBy:   sctx.GetUserID(),
+		CreatedAt:   now,
+	}
+	// last_used_at и revoked_at остаются NULL до первого использования и отзыва, expires_at – для бессрочного ключа
+	omit := []string{"last_used_at", "revoked_at"}
+	if req.TTL > 0 {
+		record.ExpiresAt = now.Add(req.TTL)
+	} else {
+		omit = append(omit, "expires_at")
+	}
+	if err := sctx.GetDB().Omit(omit...).Create(record).Error; err != nil {
+		return nil, "", fmt.Errorf("error saving API key: %w", err)
+	}
+	return record, key, nil
+}
+
+// ListAPIKeys возвращает API ключи (без самих ключей), новые первыми
+func ListAPIKeys(sctx smart_context.ISmartContext) ([]model.APIKey, error) {
+	keys := []model.APIKey{}
+	if err := sctx.GetDB().Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("error loading API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey отзывает API ключ: следующие запросы с ним отклоняются
+func RevokeAPIKey(sctx smart_context.ISmartContext, id string) error {
+	result := sctx.GetDB().Model(&model.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("error revoking API key %s: %w", id, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		if err := sctx.GetDB().Model(&model.APIKey{}).Where("id = ?", id).Count(&count).Error; err != nil {
+			return fmt.Errorf("error checking API key %s: %w", id, err)
+		}
+		if count == 0 {
+			return ErrAPIKeyNotFound
+		}
+	}
+	return nil
+}
+
+// ValidateAPIKey проверяет ключ из X-Api-Key и возвращает его создателя (с текущей ролью) с ограничениями ключа.
+// Используется middleware Authenticate
+func ValidateAPIKey(sctx smart_context.ISmartContext, key string) (*rest_middleware.Identity, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	now := time.Now()
+	var record model.APIKey
+	err := sctx.GetDB().
+		Where("key_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", hashToken(key), now).
+		Limit(1).Find(&record).Error
+	if err != nil {
+		return nil, fmt.Errorf("error loading API key: %w", err)
+	}
+	if record.ID == "" {
+		return nil, ErrInvalidAPIKey
+	}
+	var user model.User
+	if err := sctx.GetDB().Where("id = ?", record.CreatedBy).Limit(1).Find(&user).Error; err != nil {
+		return nil, fmt.Errorf("error loading owner of API key %s: %w", record.ID, err)
+	}
+	if user.ID == "" {
+		return nil, ErrInvalidAPIKey
+	}
+
+	scope := &smart_context.APIKeyScope{ID: record.ID, Name: record.Name}
+	if err := json.Unmarshal(record.Permissions, &scope.Permissions); err != nil {
+		return nil, fmt.Errorf("error decoding permissions of API key %s: %w", record.ID, err)
+	}
+	if err := json.Unmarshal(record.GroupIDs, &scope.GroupIDs); err != nil {
+		return nil, fmt.Errorf("error decoding device groups of API key %s: %w", record.ID, err)
+	}
+
+	err = sctx.GetDB().Model(&model.APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", record.ID, now.Add(-lastUsedUpdateInterval)).
+		Updates(map[string]any{"last_used_at": now, "last_used_ip": sctx.GetClientIP()}).Error
+	if err != nil {
+		sctx.Warnf("Error updating last use of API key %s: %v", record.ID, err)
+	}
+
+	return &rest_middleware.Identity{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     user.RoleCode,
+		APIKey:   scope,
+	}, nil
+}
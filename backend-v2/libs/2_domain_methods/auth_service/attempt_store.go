@@ -0,0 +1,172 @@
+package auth_service
+
+import (
+	"backed-api-v2/libs/5_common/smart_context"
+	"sync"
+	"time"
+)
+
+// attemptStore хранит счетчики неудачных попыток входа и блокировки. Основное хранилище – Redis
+// (общее для всех экземпляров сервиса), без него – память процесса
+type attemptStore interface {
+	increment(key string, window time.Duration) (int64, error)
+	lock(key string, duration time.Duration) error
+	lockedFor(key string) (time.Duration, error)
+	reset(keys ...string) error
+}
+
+// attempts возвращает хранилище попыток: Redis, если он подключен, с переходом на память при его ошибках
+func attempts(sctx smart_context.ISmartContext) attemptStore {
+	rm := sctx.GetRedisManager()
+	if rm == nil {
+		return memoryAttempts
+	}
+	return &fallbackAttemptStore{sctx: sctx, primary: &redisAttemptStore{sctx: sctx, rm: rm}}
+}
+
+type redisAttemptStore struct {
+	sctx smart_context.ISmartContext
+	rm   smart_context.IRedisManager
+}
+
+func (s *redisAttemptStore) increment(key string, window time.Duration) (int64, error) {
+	return s.rm.Increment(s.sctx.GetContext(), key, window)
+}
+
+func (s *redisAttemptStore) lock(key string, duration time.Duration) error {
+	return s.rm.SetValue(s.sctx.GetContext(), key, 1, duration)
+}
+
+func (s *redisAttemptStore) lockedFor(key string) (time.Duration, error) {
+	ttl, err := s.rm.TTL(s.sctx.GetContext(), key)
+	if err != nil || ttl < 0 {
+		return 0, err
+	}
+	return ttl, nil
+}
+
+func (s *redisAttemptStore) reset(keys ...string) error {
+	return s.rm.Delete(s.sctx.GetContext(), keys...)
+}
+
+// fallbackAttemptStore при ошибке Redis выполняет операцию в памяти процесса: защита от перебора
+// продолжает работать, хотя счетчики и не общие для экземпляров сервиса
+type fallbackAttemptStore struct {
+	sctx    smart_context.ISmartContext
+	primary attemptStore
+}
+
+func (s *fallbackAttemptStore) warn(err error) {
+	s.sctx.Warnf("Redis error, login attempts are counted in memory: %v", err)
+}
+
+func (s *fallbackAttemptStore) increment(key string, window time.Duration) (int64, error) {
+	count, err := s.primary.increment(key, window)
+	if err != nil {
+		s.warn(err)
+		return memoryAttempts.increment(key, window)
+	}
+	return count, nil
+}
+
+func (s *fallbackAttemptStore) lock(key string, duration time.Duration) error {
+	if err := s.primary.lock(key, duration); err != nil {
+		s.warn(err)
+		return memoryAttempts.lock(key, duration)
+	}
+	return nil
+}
+
+func (s *fallbackAttemptStore) lockedFor(key string) (time.Duration, error) {
+	remaining, err := s.primary.lockedFor(key)
+	if err != nil {
+		s.warn(err)
+		return memoryAttempts.lockedFor(key)
+	}
+	return remaining, nil
+}
+
+// reset очищает оба хранилища: ключи могли попасть в память, пока Redis был недоступен
+func (s *fallbackAttemptStore) reset(keys ...string) error {
+	_ = memoryAttempts.reset(keys...)
+	if err := s.primary.reset(keys...); err != nil {
+		s.warn(err)
+	}
+	return nil
+}
+
+// memoryAttemptStore – счетчики в памяти процесса, истекшие записи удаляются при обращении к ним и при росте карты
+type memoryAttemptStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryAttemptEntry
+}
+
+type memoryAttemptEntry struct {
+	count     int64
+	expiresAt time.Time
+}
+
+const memoryAttemptsSweepSize = 10000
+
+var memoryAttempts = &memoryAttemptStore{entries: map[string]memoryAttemptEntry{}}
+
+func (s *memoryAttemptStore) get(key string, now time.Time) (memoryAttemptEntry, bool) {
+	entry, ok := s.entries[key]
+	if ok && !now.Before(entry.expiresAt) {
+		delete(s.entries, key)
+		return memoryAttemptEntry{}, false
+	}
+	return entry, ok
+}
+
+func (s *memoryAttemptStore) put(key string, entry memoryAttemptEntry, now time.Time) {
+	if len(s.entries) >= memoryAttemptsSweepSize {
+		for k, e := range s.entries {
+			if !now.Before(e.expiresAt) {
+				delete(s.entries, k)
+			}
+		}
+	}
+	s.entries[key] = entry
+}
+
+func (s *memoryAttemptStore) increment(key string, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	entry, ok := s.get(key, now)
+	if !ok {
+		entry = memoryAttemptEntry{expiresAt: now.Add(window)}
+	}
+	entry.count++
+	s.put(key, entry, now)
+	return entry.count, nil
+}
+
+func (s *memoryAttemptStore) lock(key string, duration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.put(key, memoryAttemptEntry{count: 1, expiresAt: now.Add(duration)}, now)
+	return nil
+}
+
+func (s *memoryAttemptStore) lockedFor(key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	entry, ok := s.get(key, now)
+	if !ok {
+		return 0, nil
+	}
+	return entry.expiresAt.Sub(now), nil
+}
+
+func (s *memoryAttemptStore) reset(keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.entries, key)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package auth_service
+
+import (
+	"backed-api-v2/libs/5_common/smart_context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newMemoryAttempts() *memoryAttemptStore {
+	return &memoryAttemptStore{entries: map[string]memoryAttemptEntry{}}
+}
+
+func TestMemoryAttemptStoreIncrement(t *testing.T) {
+	store := newMemoryAttempts()
+	for want := int64(1); want <= 3; want++ {
+		got, err := store.increment("key", time.Minute)
+		if err != nil {
+			t.Fatalf("increment: %v", err)
+		}
+		if got != want {
+			t.Errorf("increment = %d, want %d", got, want)
+		}
+	}
+
+	// окно истекло - счет начинается заново
+	store.entries["key"] = memoryAttemptEntry{count: 3, expiresAt: time.Now().Add(-time.Second)}
+	if got, _ := store.increment("key", time.Minute); got != 1 {
+		t.Errorf("increment after window = %d, want 1", got)
+	}
+
+	if err := store.reset("key"); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if got, _ := store.increment("key", time.Minute); got != 1 {
+		t.Errorf("increment after reset = %d, want 1", got)
+	}
+}
+
+func TestMemoryAttemptStoreLock(t *testing.T) {
+	store := newMemoryAttempts()
+	if remaining, _ := store.lockedFor("lock"); remaining != 0 {
+		t.Errorf("lockedFor without lock = %s, want 0", remaining)
+	}
+	if err := store.lock("lock", time.Minute); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if remaining, _ := store.lockedFor("lock"); remaining <= 0 || remaining > time.Minute {
+		t.Errorf("lockedFor = %s, want (0, 1m]", remaining)
+	}
+
+	store.entries["lock"] = memoryAttemptEntry{count: 1, expiresAt: time.Now().Add(-time.Second)}
+	if remaining, _ := store.lockedFor("lock"); remaining != 0 {
+		t.Errorf("lockedFor expired lock = %s, want 0", remaining)
+	}
+	if _, ok := store.entries["lock"]; ok {
+		t.Error("expired lock was not removed")
+	}
+}
+
+// failingAttemptStore – недоступный Redis
+type failingAttemptStore struct{}
+
+var errRedisDown = errors.New("redis is down")
+
+func (failingAttemptStore) increment(string, time.Duration) (int64, error) { return 0, errRedisDown }
+func (failingAttemptStore) lock(string, time.Duration) error               { return errRedisDown }
+func (failingAttemptStore) lockedFor(string) (time.Duration, error)        { return 0, errRedisDown }
+func (failingAttemptStore) reset(...string) error                          { return errRedisDown }
+
+// при ошибках Redis попытки считаются и блокировки ставятся в памяти процесса
+func TestFallbackAttemptStore(t *testing.T) {
+	store := &fallbackAttemptStore{sctx: smart_context.NewSmartContext(), primary: failingAttemptStore{}}
+	const key, lock = "test:fallback:failures", "test:fallback:lock"
+	t.Cleanup(func() { _ = memoryAttempts.reset(key, lock) })
+
+	for want := int64(1); want <= 2; want++ {
+		got, err := store.increment(key, time.Minute)
+		if err != nil || got != want {
+			t.Errorf("increment = %d, %v, want %d", got, err, want)
+		}
+	}
+	if err := store.lock(lock, time.Minute); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if remaining, err := store.lockedFor(lock); err != nil || remaining <= 0 {
+		t.Errorf("lockedFor = %s, %v, want active lock", remaining, err)
+	}
+	if err := store.reset(key, lock); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if remaining, _ := store.lockedFor(lock); remaining != 0 {
+		t.Errorf("lockedFor after reset = %s, want 0", remaining)
+	}
+}
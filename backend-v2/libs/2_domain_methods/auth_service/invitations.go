@@ -0,0 +1,242 @@
+package auth_service
+
+import (
+	"backed-api-v2/libs/2_domain_methods/device_scope"
+	"backed-api-v2/libs/2_domain_methods/permissions"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	invitationCodePrefix = "inv_"
+
+	DefaultInvitationTTL = 7 * 24 * time.Hour
+	MaxInvitationTTL     = 90 * 24 * time.Hour
+)
+
+var (
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvalidInvitation  = errors.New("invalid, expired or already used invitation")
+	ErrEmailTaken         = errors.New("user with this email already exists")
+	ErrUsernameTaken      = errors.New("user with this username already exists")
+)
+
+// InvitationRequest – параметры нового приглашения
+type InvitationRequest struct {
+	Email     string
+	RoleCode  string
+	GroupIDs  []string // группы устройств нового пользователя
+	TTL       time.Duration
+	CreatedBy string
+}
+
+// CreateInvitation создает приглашение. Возвращает запись и код – он показывается один раз, в БД хранится только хэш.
+// Роль и группы должны существовать (permissions.ErrRoleNotFound, device_scope.UnknownGroupsError),
+// email не должен быть занят (ErrEmailTaken)
+func CreateInvitation(sctx smart_context.ISmartContext, req InvitationRequest) (*model.Invitation, string, error) {
+	db := sctx.GetDB()
+	var count int64
+	if err := db.Model(&model.Role{}).Where("code = ?", req.RoleCode).Count(&count).Error; err != nil {
+		return nil, "", fmt.Errorf("error checking role %s: %w", req.RoleCode, err)
+	}
+	if count == 0 {
+		return nil, "", permissions.ErrRoleNotFound
+	}
+	if err := db.Model(&model.User{}).Where("email = ?", req.Email).Count(&count).Error; err != nil {
+		return nil, "", fmt.Errorf("error checking email %s: %w", req.Email, err)
+	}
+	if count > 0 {
+		return nil, "", ErrEmailTaken
+	}
+
+	groupIDs := uniqueSortedIDs(req.GroupIDs)
+	var known []string
+	if err := db.Model(&model.DeviceGroup{}).Where("id IN ?", groupIDs).Pluck("id", &known).Error; err != nil {
+		return nil, "", fmt.Errorf("error checking device groups: %w", err)
+	}
+	if len(known) != len(groupIDs) {
+		return nil, "", &device_scope.UnknownGroupsError{GroupIDs: missingIDs(groupIDs, known)}
+	}
+	groupsJSON, err := json.Marshal(groupIDs)
+	if err != nil {
+		return nil, "", fmt.Errorf("error encoding device groups: %w", err)
+	}
+
+	buf := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", fmt.Errorf("error generating invitation code: %w", err)
+	}
+	code := invitationCodePrefix + hex.EncodeToString(buf)
+
+	if req.TTL <= 0 {
+		req.TTL = DefaultInvitationTTL
+	}
+	now := time.Now()
+	record := &model.Invitation{
+		CodeHash:  hashToken(code),
+		Email:     req.Email,
+		RoleCode:  req.RoleCode,
+		GroupIDs:  groupsJSON,
+		ExpiresAt: now.Add(min(req.TTL, MaxInvitationTTL)),
+		CreatedBy: req.CreatedBy,
+		CreatedAt: now,
+	}
+	// accepted_at и revoked_at остаются NULL, пока приглашение не принято или не отозвано
+	if err := db.Omit("accepted_at", "accepted_user_id", "revoked_at").Create(record).Error; err != nil {
+		return nil, "", fmt.Errorf("error saving invitation: %w", err)
+	}
+	return record, code, nil
+}
+
+// ListInvitations возвращает приглашения, новые первыми
+func ListInvitations(sctx smart_context.ISmartContext) ([]model.Invitation, error) {
+	invitations := []model.Invitation{}
+	if err := sctx.GetDB().Order("created_at DESC").Find(&invitations).Error; err != nil {
+		return nil, fmt.Errorf("error loading invitations: %w", err)
+	}
+	return invitations, nil
+}
+
+// RevokeInvitation отзывает непринятое приглашение. Пользователь, уже зарегистрированный по нему, не затрагивается
+func RevokeInvitation(sctx smart_context.ISmartContext, id string) error {
+	result := sctx.GetDB().Model(&model.Invitation{}).
+		Where("id = ? AND revoked_at IS NULL AND accepted_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("error revoking invitation %s: %w", id, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		if err := sctx.GetDB().Model(&model.Invitation{}).Where("id = ?", id).Count(&count).Error; err != nil {
+			return fmt.Errorf("error checking invitation %s: %w", id, err)
+		}
+		if count == 0 {
+			return ErrInvitationNotFound
+		}
+	}
+	return nil
+}
+
+// AcceptInvitation создает пользователя по коду приглашения: email, роль и группы устройств берутся из приглашения.
+// Приглашение используется атомарно и один раз; при ошибке создания пользователя оно остается действительным
+func AcceptInvitation(sctx smart_context.ISmartContext, code string, username string, password string) (*model.User, error) {
+	if code == "" {
+		return nil, ErrInvalidInvitation
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("error hashing password: %w", err)
+	}
+
+	var user model.User
+	err = sctx.GetDB().Transaction(func(tx *gorm.DB) error {
+		var claimed []model.Invitation
+		now := time.Now()
+		err := tx.Model(&claimed).
+			Clauses(clause.Returning{}).
+			Where("code_hash = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", hashToken(code), now).
+			Update("accepted_at", now).Error
+		if err != nil {
+			return fmt.Errorf("error claiming invitation: %w", err)
+		}
+		if len(claimed) == 0 {
+			return ErrInvalidInvitation
+		}
+		invitation := claimed[0]
+
+		var count int64
+		if err := tx.Model(&model.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+			return fmt.Errorf("error checking username %s: %w", username, err)
+		}
+		if count > 0 {
+			return ErrUsernameTaken
+		}
+		if err := tx.Model(&model.User{}).Where("email = ?", invitation.Email).Count(&count).Error; err != nil {
+			return fmt.Errorf("error checking email %s: %w", invitation.Email, err)
+		}
+		if count > 0 {
+			return ErrEmailTaken
+		}
+
+		user = model.User{
+			Username:     username,
+			Email:        invitation.Email,
+			PasswordHash: string(hashedPassword),
+			RoleCode:     invitation.RoleCode,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return fmt.Errorf("error creating user: %w", err)
+		}
+
+		// группы, удаленные после создания приглашения, пропускаются
+		var groupIDs []string
+		if err := json.Unmarshal(invitation.GroupIDs, &groupIDs); err != nil {
+			return fmt.Errorf("error decoding device groups of invitation %s: %w", invitation.ID, err)
+		}
+		var known []string
+		if err := tx.Model(&model.DeviceGroup{}).Where("id IN ?", groupIDs).Pluck("id", &known).Error; err != nil {
+			return fmt.Errorf("error checking device groups: %w", err)
+		}
+		if len(known) > 0 {
+			rows := make([]model.UserDeviceGroup, 0, len(known))
+			for _, groupID := range known {
+				rows = append(rows, model.UserDeviceGroup{UserID: user.ID, GroupID: groupID, CreatedAt: now})
+			}
+			if err := tx.Create(&rows).Error; err != nil {
+				return fmt.Errorf("error saving device groups of user %s: %w", user.ID, err)
+			}
+		}
+
+		err = tx.Model(&model.Invitation{}).Where("id = ?", invitation.ID).Update("accepted_user_id", user.ID).Error
+		if err != nil {
+			return fmt.Errorf("error updating invitation %s: %w", invitation.ID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func uniqueSortedIDs(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value != "" && !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func missingIDs(values []string, known []string) []string {
+	knownSet := make(map[string]bool, len(known))
+	for _, value := range known {
+		knownSet[value] = true
+	}
+	var result []string
+	for _, value := range values {
+		if !knownSet[value] {
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,292 @@
+package auth_service
+
+import (
+	"backed-api-v2/libs/2_domain_methods/audit"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/env_vars"
+	"backed-api-v2/libs/5_common/smart_context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Параметры защиты от перебора паролей, переопределяются переменными окружения.
+// Попытки с IP считаются по sctx.GetClientIP(): за обратным прокси нужен TRUST_PROXY_HEADERS=true,
+// иначе у всех клиентов адрес прокси и LOGIN_MAX_IP_FAILURES блокирует вход всем сразу
+const (
+	DefaultLoginMaxAccountFailures = 5    // LOGIN_MAX_ACCOUNT_FAILURES – неудачных попыток на email до блокировки
+	DefaultLoginMaxIPFailures      = 20   // LOGIN_MAX_IP_FAILURES – неудачных попыток с IP до блокировки
+	DefaultLoginFailureWindowSec   = 900  // LOGIN_FAILURE_WINDOW_SEC – окно подсчета неудачных попыток
+	DefaultLoginLockoutSec         = 900  // LOGIN_LOCKOUT_SEC – длительность блокировки
+	DefaultLoginMaxDelayMs         = 5000 // LOGIN_MAX_DELAY_MS – предел задержки ответа на неудачную попытку
+
+	loginBaseDelay = 250 * time.Millisecond
+)
+
+// Тип блокировки (login_lockouts.subject_type)
+const (
+	LockoutSubjectAccount = "account"
+	LockoutSubjectIP      = "ip"
+)
+
+var (
+	// ErrInvalidCredentials – единый ответ на неверный email или пароль: не раскрывает, существует ли пользователь
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrUserNotFound       = errors.New("user not found")
+)
+
+// LoginLockedError – вход временно заблокирован после серии неудачных попыток
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return "too many failed login attempts, try again later"
+}
+
+// Login проверяет email и пароль и создает сессию. Неудачные попытки считаются по email и по IP клиента:
+// каждая следующая неудача отвечает с растущей задержкой, после LOGIN_MAX_*_FAILURES вход блокируется
+// на LOGIN_LOCKOUT_SEC (LoginLockedError), блокировка записывается в login_lockouts.
+// Неизвестный email и неверный пароль неотличимы: ErrInvalidCredentials, проверка bcrypt выполняется в обоих случаях.
+// Если пользователю нужен второй фактор, вместо токенов возвращается challenge (см. VerifyTwoFactorLogin)
+func Login(sctx smart_context.ISmartContext, email string, password string) (*TokenPair, *TwoFactorChallenge, error) {
+	email = normalizeEmail(email)
+	ip := sctx.GetClientIP()
+	store := attempts(sctx)
+
+	if err := checkLoginLocks(store, email, ip); err != nil {
+		return nil, nil, err
+	}
+
+	var user model.User
+	if err := sctx.GetDB().Where("LOWER(email) = ?", email).Limit(1).Find(&user).Error; err != nil {
+		return nil, nil, fmt.Errorf("error loading user: %w", err)
+	}
+	passwordHash := user.PasswordHash
+	if user.ID == "" {
+		passwordHash = dummyPasswordHash()
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)); err != nil || user.ID == "" {
+		recordLoginFailure(sctx, email, "invalid_credentials")
+		return nil, nil, loginFailed(sctx, store, email, ip)
+	}
+
+	// счетчик неудач сбрасывается только после второго фактора, иначе верный пароль обнулял бы перебор кодов
+	challenge, err := loginChallenge(sctx, &user)
+	if err != nil || challenge != nil {
+		return nil, challenge, err
+	}
+
+	if err := store.reset(failuresKey(LockoutSubjectAccount, email)); err != nil {
+		sctx.Warnf("Error resetting login failures of %s: %v", email, err)
+	}
+	tokens, err := IssueTokens(sctx, &user)
+	if err != nil {
+		return nil, nil, err
+	}
+	recordLogin(sctx, &user, false)
+	return tokens, nil, nil
+}
+
+// recordLogin записывает успешный вход в журнал аудита
+func recordLogin(sctx smart_context.ISmartContext, user *model.User, twoFactor bool) {
+	audit.Record(sctx, audit.Event{
+		Action:     audit.ActionLogin,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+		After:      map[string]bool{"two_factor": twoFactor},
+		ActorID:    user.ID,
+		ActorName:  user.Username,
+	})
+}
+
+// recordLoginFailure записывает неудачную попытку входа (неверный пароль или код второго фактора)
+func recordLoginFailure(sctx smart_context.ISmartContext, email string, reason string) {
+	audit.Record(sctx, audit.Event{
+		Action:     audit.ActionLoginFailed,
+		TargetType: audit.TargetAccount,
+		TargetID:   email,
+		After:      map[string]string{"reason": reason},
+	})
+}
+
+func checkLoginLocks(store attemptStore, email string, ip string) error {
+	for subjectType, subject := range map[string]string{LockoutSubjectAccount: email, LockoutSubjectIP: ip} {
+		if subject == "" {
+			continue
+		}
+		remaining, err := store.lockedFor(lockKey(subjectType, subject))
+		if err != nil {
+			return fmt.Errorf("error checking login lock: %w", err)
+		}
+		if remaining > 0 {
+			return &LoginLockedError{RetryAfter: remaining}
+		}
+	}
+	return nil
+}
+
+// loginFailed учитывает неудачную попытку, при превышении лимита блокирует вход и выдерживает задержку ответа
+func loginFailed(sctx smart_context.ISmartContext, store attemptStore, email string, ip string) error {
+	window := time.Duration(env_vars.GetEnvAsInt(sctx, "LOGIN_FAILURE_WINDOW_SEC", DefaultLoginFailureWindowSec)) * time.Second
+	lockout := time.Duration(env_vars.GetEnvAsInt(sctx, "LOGIN_LOCKOUT_SEC", DefaultLoginLockoutSec)) * time.Second
+	limits := map[string]int64{
+		LockoutSubjectAccount: int64(env_vars.GetEnvAsInt(sctx, "LOGIN_MAX_ACCOUNT_FAILURES", DefaultLoginMaxAccountFailures)),
+		LockoutSubjectIP:      int64(env_vars.GetEnvAsInt(sctx, "LOGIN_MAX_IP_FAILURES", DefaultLoginMaxIPFailures)),
+	}
+
+	var result error = ErrInvalidCredentials
+	var accountFailures int64
+	for _, subjectType := range []string{LockoutSubjectAccount, LockoutSubjectIP} {
+		subject := email
+		if subjectType == LockoutSubjectIP {
+			subject = ip
+		}
+		if subject == "" {
+			continue
+		}
+		failures, err := store.increment(failuresKey(subjectType, subject), window)
+		if err != nil {
+			return fmt.Errorf("error counting login failure: %w", err)
+		}
+		if subjectType == LockoutSubjectAccount {
+			accountFailures = failures
+		}
+		if failures < limits[subjectType] {
+			continue
+		}
+		if err := store.lock(lockKey(subjectType, subject), lockout); err != nil {
+			return fmt.Errorf("error locking login: %w", err)
+		}
+		_ = store.reset(failuresKey(subjectType, subject))
+		sctx.Warnf("Login locked for %s %s after %d failed attempts (client ip %s)", subjectType, subject, failures, ip)
+		recordLockout(sctx, subjectType, subject, ip, failures, time.Now().Add(lockout))
+		result = &LoginLockedError{RetryAfter: lockout}
+	}
+
+	delayLoginResponse(sctx, accountFailures)
+	return result
+}
+
+// delayLoginResponse – задержка ответа, удваивающаяся с каждой неудачной попыткой подряд
+func delayLoginResponse(sctx smart_context.ISmartContext, failures int64) {
+	if failures <= 0 {
+		return
+	}
+	maxDelay := time.Duration(env_vars.GetEnvAsInt(sctx, "LOGIN_MAX_DELAY_MS", DefaultLoginMaxDelayMs)) * time.Millisecond
+	delay := loginBaseDelay << min(failures-1, 16)
+	timer := time.NewTimer(min(delay, maxDelay))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-sctx.GetContext().Done():
+	}
+}
+
+// recordLockout записывает блокировку в журнал; ошибка записи не должна мешать самой блокировке
+func recordLockout(sctx smart_context.ISmartContext, subjectType string, subject string, ip string, failures int64, lockedUntil time.Time) {
+	lockout := &model.LoginLockout{
+		SubjectType:    subjectType,
+		Subject:        subject,
+		ClientIP:       ip,
+		FailedAttempts: int32(failures),
+		LockedUntil:    lockedUntil,
+		CreatedAt:      time.Now(),
+	}
+	// unlocked_at и unlocked_by остаются NULL, пока администратор не снимет блокировку
+	omit := []string{"unlocked_at", "unlocked_by"}
+	if subjectType == LockoutSubjectAccount {
+		var user model.User
+		if err := sctx.GetDB().Where("LOWER(email) = ?", subject).Limit(1).Find(&user).Error; err != nil {
+			sctx.Errorf("Error loading user %s for lockout record: %v", subject, err)
+		}
+		lockout.UserID = user.ID
+	}
+	if lockout.UserID == "" {
+		// блокировка по IP или неизвестному email - user_id NULL
+		omit = append(omit, "user_id")
+	}
+	if err := sctx.GetDB().Omit(omit...).Create(lockout).Error; err != nil {
+		sctx.Errorf("Error recording login lockout of %s %s: %v", subjectType, subject, err)
+	}
+
+	targetType := audit.TargetAccount
+	if subjectType == LockoutSubjectIP {
+		targetType = audit.TargetIP
+	}
+	audit.Record(sctx, audit.Event{
+		Action:     audit.ActionLoginLocked,
+		TargetType: targetType,
+		TargetID:   subject,
+		After:      map[string]any{"failed_attempts": failures, "locked_until": lockedUntil},
+	})
+}
+
+// ListLockouts возвращает журнал блокировок входа, новые первыми
+func ListLockouts(sctx smart_context.ISmartContext, limit int) ([]model.LoginLockout, error) {
+	lockouts := []model.LoginLockout{}
+	if err := sctx.GetDB().Order("created_at DESC").Limit(limit).Find(&lockouts).Error; err != nil {
+		return nil, fmt.Errorf("error loading login lockouts: %w", err)
+	}
+	return lockouts, nil
+}
+
+// UnlockUser снимает блокировку входа пользователя и сбрасывает счетчик неудачных попыток по его email.
+// Возвращает ErrUserNotFound для неизвестного пользователя
+func UnlockUser(sctx smart_context.ISmartContext, userID string, unlockedBy string) error {
+	var user model.User
+	if err := sctx.GetDB().Where("id = ?", userID).Limit(1).Find(&user).Error; err != nil {
+		return fmt.Errorf("error loading user %s: %w", userID, err)
+	}
+	if user.ID == "" {
+		return ErrUserNotFound
+	}
+	email := normalizeEmail(user.Email)
+	if err := attempts(sctx).reset(lockKey(LockoutSubjectAccount, email), failuresKey(LockoutSubjectAccount, email)); err != nil {
+		return fmt.Errorf("error unlocking user %s: %w", userID, err)
+	}
+
+	now := time.Now()
+	updates := map[string]any{"unlocked_at": now}
+	if unlockedBy != "" {
+		updates["unlocked_by"] = unlockedBy
+	}
+	err := sctx.GetDB().Model(&model.LoginLockout{}).
+		Where("subject_type = ? AND subject = ? AND unlocked_at IS NULL AND locked_until > ?", LockoutSubjectAccount, email, now).
+		Updates(updates).Error
+	if err != nil {
+		return fmt.Errorf("error recording unlock of user %s: %w", userID, err)
+	}
+	return nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func failuresKey(subjectType string, subject string) string {
+	return "auth:login_failures:" + subjectType + ":" + subject
+}
+
+func lockKey(subjectType string, subject string) string {
+	return "auth:login_lock:" + subjectType + ":" + subject
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// dummyPasswordHash – хэш для проверки пароля неизвестного пользователя: ответ занимает столько же времени,
+// сколько для существующего
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		hash, _ := bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+		dummyHash = string(hash)
+	})
+	return dummyHash
+}
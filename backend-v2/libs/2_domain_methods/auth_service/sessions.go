@@ -0,0 +1,220 @@
+package auth_service
+
+import (
+	"backed-api-v2/libs/2_domain_methods/audit"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/ws_registry"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Причины отзыва сессий (auth_sessions.revoke_reason)
+const (
+	RevokeReasonLogout          = "logout"
+	RevokeReasonPasswordChanged = "password_changed"
+	RevokeReasonRoleChanged     = "role_changed"
+	RevokeReasonTokenReuse      = "refresh_token_reuse"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used, session revoked")
+)
+
+// IssueTokens создает сессию пользователя и выдает для нее access и refresh токены
+func IssueTokens(sctx smart_context.ISmartContext, user *model.User) (*TokenPair, error) {
+	refreshToken, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := &model.AuthSession{
+		UserID:           user.ID,
+		RefreshTokenHash: hash,
+		CreatedAt:        now,
+		RefreshedAt:      now,
+		ExpiresAt:        now.Add(RefreshTTL(sctx)),
+	}
+	// revoked_at и revoke_reason остаются NULL, пока сессия не отозвана, previous_token_hash – до первого обновления
+	if err := sctx.GetDB().Omit("revoked_at", "revoke_reason", "previous_token_hash").Create(session).Error; err != nil {
+		return nil, fmt.Errorf("error creating session for user %s: %w", user.ID, err)
+	}
+	return tokenPair(sctx, user, session, refreshToken)
+}
+
+func tokenPair(sctx smart_context.ISmartContext, user *model.User, session *model.AuthSession, refreshToken string) (*TokenPair, error) {
+	expiresAt := time.Now().Add(AccessTTL(sctx))
+	token, err := generateAccessToken(user, session.ID, expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("error generating access token: %w", err)
+	}
+	return &TokenPair{
+		Token:            token,
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+// Refresh выдает новую пару токенов по refresh токену. Refresh токен одноразовый: он заменяется новым,
+// а срок сессии продлевается. Повторное предъявление уже замененного токена означает его утечку –
+// сессия отзывается целиком
+func Refresh(sctx smart_context.ISmartContext, refreshToken string) (*TokenPair, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	hash := hashToken(refreshToken)
+	newToken, newHash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	var session model.AuthSession
+	var user model.User
+	reusedSessionID, reusedUserID := "", ""
+	err = sctx.GetDB().Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("refresh_token_hash = ? AND revoked_at IS NULL AND expires_at > ?", hash, time.Now()).
+			Limit(1).Find(&session).Error
+		if err != nil {
+			return fmt.Errorf("error loading session: %w", err)
+		}
+		if session.ID == "" {
+			var reused model.AuthSession
+			err := tx.Where("previous_token_hash = ? AND revoked_at IS NULL", hash).Limit(1).Find(&reused).Error
+			if err != nil {
+				return fmt.Errorf("error checking refresh token reuse: %w", err)
+			}
+			if reused.ID != "" {
+				reusedSessionID, reusedUserID = reused.ID, reused.UserID
+				return ErrRefreshTokenReused
+			}
+			return ErrInvalidRefreshToken
+		}
+
+		if err := tx.Where("id = ?", session.UserID).First(&user).Error; err != nil {
+			return fmt.Errorf("error loading user %s: %w", session.UserID, err)
+		}
+
+		now := time.Now()
+		session.RefreshTokenHash = newHash
+		session.PreviousTokenHash = hash
+		session.RefreshedAt = now
+		session.ExpiresAt = now.Add(RefreshTTL(sctx))
+		return tx.Model(&session).Updates(map[string]any{
+			"refresh_token_hash":  session.RefreshTokenHash,
+			"previous_token_hash": hash,
+			"refreshed_at":        session.RefreshedAt,
+			"expires_at":          session.ExpiresAt,
+		}).Error
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		sctx.Warnf("Refresh token reuse detected for session %s, revoking it", reusedSessionID)
+		audit.Record(sctx, audit.Event{
+			Action:     audit.ActionRefreshTokenReused,
+			TargetType: audit.TargetSession,
+			TargetID:   reusedSessionID,
+			ActorID:    reusedUserID,
+		})
+		if _, revokeErr := revokeSessions(sctx, sctx.GetDB().Where("id = ?", reusedSessionID), RevokeReasonTokenReuse); revokeErr != nil {
+			return nil, revokeErr
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tokenPair(sctx, &user, &session, newToken)
+}
+
+// Logout отзывает сессию refresh токена. Неизвестный или уже отозванный токен – не ошибка
+func Logout(sctx smart_context.ISmartContext, refreshToken string) error {
+	if refreshToken == "" {
+		return ErrInvalidRefreshToken
+	}
+	var session model.AuthSession
+	err := sctx.GetDB().Where("refresh_token_hash = ? AND revoked_at IS NULL", hashToken(refreshToken)).Limit(1).Find(&session).Error
+	if err != nil {
+		return fmt.Errorf("error loading session: %w", err)
+	}
+	if session.ID == "" {
+		return nil
+	}
+	count, err := revokeSessions(sctx, sctx.GetDB().Where("id = ?", session.ID), RevokeReasonLogout)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		audit.Record(sctx, audit.Event{
+			Action:     audit.ActionLogout,
+			TargetType: audit.TargetSession,
+			TargetID:   session.ID,
+			ActorID:    session.UserID,
+		})
+	}
+	return nil
+}
+
+// RevokeUserSessions отзывает все сессии пользователя: их access токены перестают приниматься сразу,
+// refresh токены – не обновляются. Возвращает число отозванных сессий
+func RevokeUserSessions(sctx smart_context.ISmartContext, userID string, reason string) (int, error) {
+	count, err := revokeSessions(sctx, sctx.GetDB().Where("user_id = ?", userID), reason)
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		sctx.Infof("Revoked %d sessions of user %s: %s", count, userID, reason)
+	}
+	return count, nil
+}
+
+// revokeSessions отзывает активные сессии, подходящие под query, и отмечает их в Redis на время жизни access токена
+func revokeSessions(sctx smart_context.ISmartContext, query *gorm.DB, reason string) (int, error) {
+	var revoked []model.AuthSession
+	err := query.Model(&revoked).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).
+		Where("revoked_at IS NULL").
+		Updates(map[string]any{"revoked_at": time.Now(), "revoke_reason": reason}).Error
+	if err != nil {
+		return 0, fmt.Errorf("error revoking sessions: %w", err)
+	}
+
+	closeRevokedFrontends(sctx, revoked, reason)
+
+	redisManager := sctx.GetRedisManager()
+	if redisManager == nil {
+		return len(revoked), nil
+	}
+	ttl := AccessTTL(sctx)
+	for _, session := range revoked {
+		// без отметки в Redis access токен сессии будет приниматься до истечения срока
+		if err := redisManager.SetValue(sctx.GetContext(), revokedSessionKey(session.ID), reason, ttl); err != nil {
+			sctx.Errorf("Error marking session %s as revoked in Redis: %v", session.ID, err)
+		}
+	}
+	return len(revoked), nil
+}
+
+// closeRevokedFrontends закрывает WebSocket соединения фронтендов, открытые с токенами отозванных сессий,
+// чтобы они не продолжали получать стримы устройств. Соединения на других экземплярах сервера закроет
+// периодическая проверка сессии в ws_server
+func closeRevokedFrontends(sctx smart_context.ISmartContext, revoked []model.AuthSession, reason string) {
+	if len(revoked) == 0 {
+		return
+	}
+	sessionIDs := make(map[string]bool, len(revoked))
+	for _, session := range revoked {
+		sessionIDs[session.ID] = true
+	}
+	closed := ws_registry.CloseFrontends(sctx, func(user ws_registry.FrontendUser) bool {
+		return sessionIDs[user.SessionID]
+	}, "session revoked: "+reason)
+	if closed > 0 {
+		sctx.Infof("Closed %d frontend connections of revoked sessions", closed)
+	}
+}
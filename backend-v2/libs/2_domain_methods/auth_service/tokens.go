@@ -0,0 +1,143 @@
+package auth_service
+
+import (
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/env_vars"
+	"backed-api-v2/libs/5_common/rest_middleware"
+	"backed-api-v2/libs/5_common/smart_context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	DefaultAccessTTLSec  = 15 * 60
+	DefaultRefreshTTLSec = 30 * 24 * 60 * 60
+
+	refreshTokenPrefix = "rt_"
+	refreshTokenBytes  = 32
+)
+
+var ErrSessionRevoked = errors.New("session is revoked")
+
+// TokenPair – выданные пользователю токены. Token – access JWT для заголовка Authorization,
+// RefreshToken – одноразовый токен для POST /api/auth/refresh
+type TokenPair struct {
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// AccessTTL – время жизни access токена (AUTH_ACCESS_TTL_SEC). Столько же живет отметка об отзыве сессии в Redis
+func AccessTTL(sctx smart_context.ISmartContext) time.Duration {
+	return time.Duration(env_vars.GetEnvAsInt(sctx, "AUTH_ACCESS_TTL_SEC", DefaultAccessTTLSec)) * time.Second
+}
+
+// RefreshTTL – время жизни сессии без обновления (AUTH_REFRESH_TTL_SEC), каждое обновление продлевает ее
+func RefreshTTL(sctx smart_context.ISmartContext) time.Duration {
+	return time.Duration(env_vars.GetEnvAsInt(sctx, "AUTH_REFRESH_TTL_SEC", DefaultRefreshTTLSec)) * time.Second
+}
+
+// generateAccessToken подписывает access JWT с данными пользователя и id сессии (sid)
+func generateAccessToken(user *model.User, sessionID string, expiresAt time.Time) (string, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return "", errors.New("JWT_SECRET is not set")
+	}
+	claims := jwt.MapClaims{
+		"user_id":  user.ID,
+		"username": user.Username,
+		"role":     user.RoleCode,
+		"sid":      sessionID,
+		"exp":      expiresAt.Unix(),
+		"iat":      time.Now().Unix(),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+}
+
+// newRefreshToken генерирует refresh токен и его хэш. В БД хранится только хэш
+func newRefreshToken() (token string, hash string, err error) {
+	buf := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("error generating refresh token: %w", err)
+	}
+	token = refreshTokenPrefix + hex.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+// hashToken – sha256 токена: токен случайный и длинный, соль не нужна
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidateAccessToken проверяет access JWT и то, что его сессия не отозвана.
+// Используется middleware Authenticate и WebSocket сервером
+func ValidateAccessToken(sctx smart_context.ISmartContext, token string) (*rest_middleware.Identity, error) {
+	identity, err := rest_middleware.ParseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if identity.SessionID == "" {
+		return nil, errors.New("sid not found in token")
+	}
+	revoked, err := isSessionRevoked(sctx, identity.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrSessionRevoked
+	}
+	return identity, nil
+}
+
+// ValidateIdentity повторно проверяет пользователя уже принятого токена для долгих соединений (WebSocket):
+// сессия не отозвана, пользователь существует и его роль не менялась. Иначе – ErrSessionRevoked
+func ValidateIdentity(sctx smart_context.ISmartContext, identity *rest_middleware.Identity) error {
+	revoked, err := isSessionRevoked(sctx, identity.SessionID)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrSessionRevoked
+	}
+	var user model.User
+	if err := sctx.GetDB().Where("id = ?", identity.UserID).Limit(1).Find(&user).Error; err != nil {
+		return fmt.Errorf("error loading user %s: %w", identity.UserID, err)
+	}
+	if user.ID == "" || user.RoleCode != identity.Role {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+func revokedSessionKey(sessionID string) string {
+	return "auth:revoked_session:" + sessionID
+}
+
+// isSessionRevoked проверяет отметку об отзыве в Redis, а если Redis недоступен – саму сессию в Postgres
+func isSessionRevoked(sctx smart_context.ISmartContext, sessionID string) (bool, error) {
+	if redisManager := sctx.GetRedisManager(); redisManager != nil {
+		revoked, err := redisManager.Exists(sctx.GetContext(), revokedSessionKey(sessionID))
+		if err == nil {
+			return revoked, nil
+		}
+		sctx.Warnf("Error checking session %s in Redis, falling back to Postgres: %v", sessionID, err)
+	}
+
+	var count int64
+	err := sctx.GetDB().Model(&model.AuthSession{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("error checking session %s: %w", sessionID, err)
+	}
+	return count == 0, nil
+}
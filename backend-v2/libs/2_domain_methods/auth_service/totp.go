@@ -0,0 +1,93 @@
+package auth_service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Параметры TOTP (RFC 6238) – значения по умолчанию, которые понимают все приложения-аутентификаторы
+const (
+	totpSecretBytes = 20
+	totpDigits      = 6
+	totpModulo      = 1_000_000 // 10^totpDigits
+	totpPeriod      = 30 * time.Second
+	totpSkewSteps   = 1 // допускается расхождение часов на один шаг в обе стороны
+
+	defaultTOTPIssuer = "Backend API"
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newTOTPSecret генерирует секрет TOTP в base32
+func newTOTPSecret() (string, error) {
+	buf := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generating TOTP secret: %w", err)
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// totpURI – otpauth:// URI для QR кода приложения-аутентификатора. Issuer задается TOTP_ISSUER
+func totpURI(secret string, account string) string {
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = defaultTOTPIssuer
+	}
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// totpStep – номер временного шага для момента t
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(totpPeriod.Seconds())
+}
+
+// totpCode вычисляет код для шага (HOTP, RFC 4226)
+func totpCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%totpModulo), nil
+}
+
+// matchTOTP возвращает шаг, которому соответствует код, с учетом расхождения часов, или 0, если код не подходит
+func matchTOTP(secret string, code string, now time.Time) (int64, error) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, nil
+	}
+	current := totpStep(now)
+	for step := current - totpSkewSteps; step <= current+totpSkewSteps; step++ {
+		expected, err := totpCode(secret, step)
+		if err != nil {
+			return 0, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, nil
+		}
+	}
+	return 0, nil
+}
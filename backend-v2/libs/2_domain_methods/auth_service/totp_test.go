@@ -0,0 +1,76 @@
+package auth_service
+
+import (
+	"testing"
+	"time"
+)
+
+// секрет из тестовых векторов RFC 6238 ("12345678901234567890") в base32
+const rfcTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// RFC 6238, приложение B (SHA1): последние 6 цифр 8-значных кодов
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		code, err := totpCode(rfcTOTPSecret, totpStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("totpCode(%d): %v", tt.unix, err)
+		}
+		if code != tt.code {
+			t.Errorf("totpCode(%d) = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := totpStep(now)
+	codeAt := func(step int64) string {
+		code, err := totpCode(rfcTOTPSecret, step)
+		if err != nil {
+			t.Fatalf("totpCode(%d): %v", step, err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name string
+		code string
+		want int64
+	}{
+		{"current step", codeAt(step), step},
+		{"previous step", codeAt(step - 1), step - 1},
+		{"next step", codeAt(step + 1), step + 1},
+		{"with spaces", " " + codeAt(step)[:3] + " " + codeAt(step)[3:] + " ", step},
+		{"two steps behind", codeAt(step - 2), 0},
+		{"wrong length", "12345", 0},
+		{"empty", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := matchTOTP(rfcTOTPSecret, tt.code, now)
+			if err != nil {
+				t.Fatalf("matchTOTP: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("matchTOTP(%q) = %d, want %d", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchTOTPInvalidSecret(t *testing.T) {
+	if _, err := matchTOTP("not base32!", "123456", time.Now()); err == nil {
+		t.Error("matchTOTP with invalid secret: want error")
+	}
+}
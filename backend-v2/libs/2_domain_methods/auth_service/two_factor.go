@@ -0,0 +1,502 @@
+package auth_service
+
+import (
+	"backed-api-v2/libs/2_domain_methods/audit"
+	"backed-api-v2/libs/2_domain_methods/permissions"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	challengeTokenType = "2fa_challenge"
+	challengeTTL       = 5 * time.Minute
+
+	recoveryCodesCount = 10
+	recoveryCodeBytes  = 5
+)
+
+var (
+	ErrInvalidChallenge         = errors.New("invalid or expired two-factor challenge")
+	ErrInvalidTwoFactorCode     = errors.New("invalid two-factor code")
+	ErrTwoFactorEnabled         = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled      = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorSetupNotStarted = errors.New("two-factor setup was not started")
+	ErrTwoFactorRequired        = errors.New("two-factor authentication is required for the user's role")
+)
+
+// TwoFactorChallenge – ответ на вход с верным паролем, когда нужен второй фактор. ChallengeToken передается
+// в POST /api/auth/2fa/verify вместе с кодом. SetupRequired – роль требует 2FA, а она еще не настроена:
+// сначала POST /api/auth/2fa/setup, затем verify с кодом из приложения
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	SetupRequired     bool      `json:"setup_required"`
+	ChallengeToken    string    `json:"challenge_token"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+// TwoFactorSetup – новый секрет TOTP. OtpauthURI отображается QR кодом для приложения-аутентификатора
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+// TwoFactorLogin – токены после проверки второго фактора. RecoveryCodes – только если 2FA была настроена при этом входе
+type TwoFactorLogin struct {
+	*TokenPair
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// TwoFactorStatus – состояние 2FA пользователя
+type TwoFactorStatus struct {
+	Enabled           bool       `json:"enabled"`
+	EnabledAt         *time.Time `json:"enabled_at"`
+	Required          bool       `json:"required"` // роль пользователя требует 2FA
+	RecoveryCodesLeft int64      `json:"recovery_codes_left"`
+}
+
+// twoFactorState загружает TOTP пользователя (nil, если не настраивалась) и требование 2FA для его роли
+func twoFactorState(sctx smart_context.ISmartContext, user *model.User) (*model.UserTotp, bool, error) {
+	var totp model.UserTotp
+	if err := sctx.GetDB().Where("user_id = ?", user.ID).Limit(1).Find(&totp).Error; err != nil {
+		return nil, false, fmt.Errorf("error loading TOTP of user %s: %w", user.ID, err)
+	}
+	var role model.Role
+	if err := sctx.GetDB().Where("code = ?", user.RoleCode).Limit(1).Find(&role).Error; err != nil {
+		return nil, false, fmt.Errorf("error loading role %s: %w", user.RoleCode, err)
+	}
+	if totp.UserID == "" {
+		return nil, role.RequireTwoFactor, nil
+	}
+	return &totp, role.RequireTwoFactor, nil
+}
+
+func totpEnabled(totp *model.UserTotp) bool {
+	return totp != nil && !totp.EnabledAt.IsZero()
+}
+
+// loginChallenge возвращает challenge, если пользователю нужен второй фактор, или nil
+func loginChallenge(sctx smart_context.ISmartContext, user *model.User) (*TwoFactorChallenge, error) {
+	totp, required, err := twoFactorState(sctx, user)
+	if err != nil {
+		return nil, err
+	}
+	enabled := totpEnabled(totp)
+	if !enabled && !required {
+		return nil, nil
+	}
+	expiresAt := time.Now().Add(challengeTTL)
+	token, err := newChallengeToken(user.ID, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &TwoFactorChallenge{
+		TwoFactorRequired: true,
+		SetupRequired:     !enabled,
+		ChallengeToken:    token,
+		ExpiresAt:         expiresAt,
+	}, nil
+}
+
+// StartSession создает сессию пользователя, подтвердившего пароль вне Login (например, при регистрации по приглашению).
+// Как и Login, вместо токенов возвращает challenge, если пользователю нужен второй фактор или роль требует его настройки
+func StartSession(sctx smart_context.ISmartContext, user *model.User) (*TokenPair, *TwoFactorChallenge, error) {
+	challenge, err := loginChallenge(sctx, user)
+	if err != nil || challenge != nil {
+		return nil, challenge, err
+	}
+	tokens, err := IssueTokens(sctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, nil, nil
+}
+
+// newChallengeToken подписывает короткоживущий JWT второго шага входа. В нем нет роли и sid,
+// поэтому как access токен он не принимается
+func newChallengeToken(userID string, expiresAt time.Time) (string, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return "", errors.New("JWT_SECRET is not set")
+	}
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"typ":     challengeTokenType,
+		"exp":     expiresAt.Unix(),
+		"iat":     time.Now().Unix(),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+}
+
+// challengeUser проверяет challenge токен и загружает его пользователя
+func challengeUser(sctx smart_context.ISmartContext, challengeToken string) (*model.User, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" || challengeToken == "" {
+		return nil, ErrInvalidChallenge
+	}
+	token, err := jwt.Parse(challengeToken, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(secret), nil
+	})
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["typ"] != challengeTokenType {
+		return nil, ErrInvalidChallenge
+	}
+	userID, _ := claims["user_id"].(string)
+
+	var user model.User
+	if err := sctx.GetDB().Where("id = ?", userID).Limit(1).Find(&user).Error; err != nil {
+		return nil, fmt.Errorf("error loading user %s: %w", userID, err)
+	}
+	if user.ID == "" {
+		return nil, ErrInvalidChallenge
+	}
+	return &user, nil
+}
+
+// SetupTwoFactorByChallenge начинает настройку 2FA на втором шаге входа (роль требует 2FA, а она не настроена)
+func SetupTwoFactorByChallenge(sctx smart_context.ISmartContext, challengeToken string) (*TwoFactorSetup, error) {
+	user, err := challengeUser(sctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	return BeginTwoFactorSetup(sctx, user)
+}
+
+// VerifyTwoFactorLogin завершает вход: проверяет код TOTP или код восстановления и создает сессию.
+// Если 2FA еще не включена, но настройка начата (SetupTwoFactorByChallenge), код TOTP подтверждает ее –
+// в ответе будут коды восстановления. Неверные коды считаются неудачными попытками входа (см. Login)
+func VerifyTwoFactorLogin(sctx smart_context.ISmartContext, challengeToken string, code string) (*TwoFactorLogin, error) {
+	user, err := challengeUser(sctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	email := normalizeEmail(user.Email)
+	ip := sctx.GetClientIP()
+	store := attempts(sctx)
+	if err := checkLoginLocks(store, email, ip); err != nil {
+		return nil, err
+	}
+
+	totp, required, err := twoFactorState(sctx, user)
+	if err != nil {
+		return nil, err
+	}
+	result := &TwoFactorLogin{}
+	switch {
+	case totpEnabled(totp):
+		ok, err := verifyTwoFactorCode(sctx, totp, code)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, twoFactorFailed(sctx, store, email, ip)
+		}
+	case totp != nil && required:
+		result.RecoveryCodes, err = EnableTwoFactor(sctx, user, code)
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			return nil, twoFactorFailed(sctx, store, email, ip)
+		}
+		if err != nil {
+			return nil, err
+		}
+		audit.Record(sctx, audit.Event{
+			Action:     audit.ActionTwoFactorEnabled,
+			TargetType: audit.TargetUser,
+			TargetID:   user.ID,
+			ActorID:    user.ID,
+			ActorName:  user.Username,
+		})
+	case required:
+		return nil, ErrTwoFactorSetupNotStarted
+	default:
+		// 2FA отключили после выдачи challenge: вход начинается заново
+		return nil, ErrInvalidChallenge
+	}
+
+	if err := store.reset(failuresKey(LockoutSubjectAccount, email)); err != nil {
+		sctx.Warnf("Error resetting login failures of %s: %v", email, err)
+	}
+	result.TokenPair, err = IssueTokens(sctx, user)
+	if err != nil {
+		return nil, err
+	}
+	recordLogin(sctx, user, true)
+	return result, nil
+}
+
+func twoFactorFailed(sctx smart_context.ISmartContext, store attemptStore, email string, ip string) error {
+	recordLoginFailure(sctx, email, "invalid_two_factor_code")
+	err := loginFailed(sctx, store, email, ip)
+	if errors.Is(err, ErrInvalidCredentials) {
+		return ErrInvalidTwoFactorCode
+	}
+	return err
+}
+
+// confirmTwoFactorCode проверяет код для действия с 2FA вошедшего пользователя с теми же счетчиками и блокировками,
+// что и вход: иначе украденная сессия позволяла бы перебирать коды без ограничений
+func confirmTwoFactorCode(sctx smart_context.ISmartContext, user *model.User, totp *model.UserTotp, code string) error {
+	email := normalizeEmail(user.Email)
+	ip := sctx.GetClientIP()
+	store := attempts(sctx)
+	if err := checkLoginLocks(store, email, ip); err != nil {
+		return err
+	}
+	ok, err := verifyTwoFactorCode(sctx, totp, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return twoFactorFailed(sctx, store, email, ip)
+	}
+	if err := store.reset(failuresKey(LockoutSubjectAccount, email)); err != nil {
+		sctx.Warnf("Error resetting login failures of %s: %v", email, err)
+	}
+	return nil
+}
+
+// verifyTwoFactorCode проверяет код TOTP (каждый код принимается один раз) или неиспользованный код восстановления
+func verifyTwoFactorCode(sctx smart_context.ISmartContext, totp *model.UserTotp, code string) (bool, error) {
+	step, err := matchTOTP(totp.Secret, code, time.Now())
+	if err != nil {
+		return false, err
+	}
+	if step > 0 {
+		result := sctx.GetDB().Model(&model.UserTotp{}).
+			Where("user_id = ? AND last_used_step < ?", totp.UserID, step).
+			Update("last_used_step", step)
+		if result.Error != nil {
+			return false, fmt.Errorf("error updating TOTP of user %s: %w", totp.UserID, result.Error)
+		}
+		return result.RowsAffected > 0, nil
+	}
+
+	result := sctx.GetDB().Model(&model.UserRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", totp.UserID, hashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, fmt.Errorf("error using recovery code of user %s: %w", totp.UserID, result.Error)
+	}
+	if result.RowsAffected > 0 {
+		sctx.Warnf("User %s signed in with a recovery code", totp.UserID)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// BeginTwoFactorSetup создает новый секрет TOTP, ожидающий подтверждения кодом (EnableTwoFactor).
+// Неподтвержденный секрет предыдущей попытки заменяется
+func BeginTwoFactorSetup(sctx smart_context.ISmartContext, user *model.User) (*TwoFactorSetup, error) {
+	totp, _, err := twoFactorState(sctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if totpEnabled(totp) {
+		return nil, ErrTwoFactorEnabled
+	}
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	record := &model.UserTotp{UserID: user.ID, Secret: secret, CreatedAt: time.Now()}
+	// enabled_at остается NULL до подтверждения кодом
+	err = sctx.GetDB().Omit("enabled_at").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"secret", "last_used_step", "created_at"}),
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "user_totp.enabled_at IS NULL"}}},
+	}).Create(record).Error
+	if err != nil {
+		return nil, fmt.Errorf("error saving TOTP secret of user %s: %w", user.ID, err)
+	}
+	return &TwoFactorSetup{Secret: secret, OtpauthURI: totpURI(secret, user.Email)}, nil
+}
+
+// EnableTwoFactor подтверждает секрет кодом из приложения, включает 2FA и возвращает коды восстановления
+// (показываются один раз)
+func EnableTwoFactor(sctx smart_context.ISmartContext, user *model.User, code string) ([]string, error) {
+	totp, _, err := twoFactorState(sctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if totp == nil {
+		return nil, ErrTwoFactorSetupNotStarted
+	}
+	if totpEnabled(totp) {
+		return nil, ErrTwoFactorEnabled
+	}
+	step, err := matchTOTP(totp.Secret, code, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if step == 0 {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	var codes []string
+	err = sctx.GetDB().Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.UserTotp{}).
+			Where("user_id = ? AND enabled_at IS NULL", user.ID).
+			Updates(map[string]any{"enabled_at": time.Now(), "last_used_step": step})
+		if result.Error != nil {
+			return fmt.Errorf("error enabling TOTP of user %s: %w", user.ID, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrTwoFactorEnabled
+		}
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sctx.Infof("Two-factor authentication enabled for user %s", user.ID)
+	return codes, nil
+}
+
+// DisableTwoFactor отключает 2FA по действующему коду. Нельзя, если роль пользователя требует 2FA.
+// Неверные коды считаются неудачными попытками входа (см. confirmTwoFactorCode)
+func DisableTwoFactor(sctx smart_context.ISmartContext, user *model.User, code string) error {
+	totp, required, err := twoFactorState(sctx, user)
+	if err != nil {
+		return err
+	}
+	if !totpEnabled(totp) {
+		return ErrTwoFactorNotEnabled
+	}
+	if required {
+		return ErrTwoFactorRequired
+	}
+	if err := confirmTwoFactorCode(sctx, user, totp, code); err != nil {
+		return err
+	}
+	if err := deleteTwoFactor(sctx.GetDB(), user.ID); err != nil {
+		return err
+	}
+	sctx.Infof("Two-factor authentication disabled by user %s", user.ID)
+	return nil
+}
+
+// ResetTwoFactor сбрасывает 2FA пользователя (администратором, например при потере устройства и кодов восстановления).
+// Если роль требует 2FA, при следующем входе пользователь настроит ее заново
+func ResetTwoFactor(sctx smart_context.ISmartContext, userID string) error {
+	var count int64
+	if err := sctx.GetDB().Model(&model.User{}).Where("id = ?", userID).Count(&count).Error; err != nil {
+		return fmt.Errorf("error checking user %s: %w", userID, err)
+	}
+	if count == 0 {
+		return ErrUserNotFound
+	}
+	return deleteTwoFactor(sctx.GetDB(), userID)
+}
+
+func deleteTwoFactor(db *gorm.DB, userID string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&model.UserRecoveryCode{}).Error; err != nil {
+			return fmt.Errorf("error deleting recovery codes of user %s: %w", userID, err)
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&model.UserTotp{}).Error; err != nil {
+			return fmt.Errorf("error deleting TOTP of user %s: %w", userID, err)
+		}
+		return nil
+	})
+}
+
+// RegenerateRecoveryCodes заменяет коды восстановления новыми по действующему коду.
+// Неверные коды считаются неудачными попытками входа (см. confirmTwoFactorCode)
+func RegenerateRecoveryCodes(sctx smart_context.ISmartContext, user *model.User, code string) ([]string, error) {
+	totp, _, err := twoFactorState(sctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if !totpEnabled(totp) {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	if err := confirmTwoFactorCode(sctx, user, totp, code); err != nil {
+		return nil, err
+	}
+	var codes []string
+	err = sctx.GetDB().Transaction(func(tx *gorm.DB) error {
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// GetTwoFactorStatus возвращает состояние 2FA пользователя
+func GetTwoFactorStatus(sctx smart_context.ISmartContext, user *model.User) (*TwoFactorStatus, error) {
+	totp, required, err := twoFactorState(sctx, user)
+	if err != nil {
+		return nil, err
+	}
+	status := &TwoFactorStatus{Required: required}
+	if !totpEnabled(totp) {
+		return status, nil
+	}
+	status.Enabled = true
+	status.EnabledAt = &totp.EnabledAt
+	err = sctx.GetDB().Model(&model.UserRecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", user.ID).
+		Count(&status.RecoveryCodesLeft).Error
+	if err != nil {
+		return nil, fmt.Errorf("error counting recovery codes of user %s: %w", user.ID, err)
+	}
+	return status, nil
+}
+
+// SetRoleTwoFactorRequired включает или выключает требование 2FA для роли. Действует со следующего входа
+func SetRoleTwoFactorRequired(sctx smart_context.ISmartContext, roleCode string, required bool) error {
+	result := sctx.GetDB().Model(&model.Role{}).Where("code = ?", roleCode).Update("require_two_factor", required)
+	if result.Error != nil {
+		return fmt.Errorf("error updating role %s: %w", roleCode, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return permissions.ErrRoleNotFound
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID string) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.UserRecoveryCode{}).Error; err != nil {
+		return nil, fmt.Errorf("error deleting recovery codes of user %s: %w", userID, err)
+	}
+	now := time.Now()
+	codes := make([]string, 0, recoveryCodesCount)
+	rows := make([]model.UserRecoveryCode, 0, recoveryCodesCount)
+	for len(codes) < recoveryCodesCount {
+		buf := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("error generating recovery code: %w", err)
+		}
+		raw := strings.ToLower(totpEncoding.EncodeToString(buf))
+		codes = append(codes, raw[:4]+"-"+raw[4:])
+		rows = append(rows, model.UserRecoveryCode{UserID: userID, CodeHash: hashToken(raw), CreatedAt: now})
+	}
+	// used_at остается NULL, пока код не использован
+	if err := tx.Omit("used_at").Create(&rows).Error; err != nil {
+		return nil, fmt.Errorf("error saving recovery codes of user %s: %w", userID, err)
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode приводит код восстановления к виду, в котором хранится его хэш
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,305 @@
+package command_service
+
+import (
+	"backed-api-v2/libs/2_domain_methods/device_scope"
+	"backed-api-v2/libs/2_domain_methods/permissions"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/env_vars"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/ws_registry"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Уведомления фронтендов о подтверждении команд
+const (
+	ActionApprovalRequested = "approval_requested"
+	ActionApprovalDecided   = "approval_decided"
+)
+
+const DefaultApprovalWindowSec = 3600
+
+var (
+	ErrSelfApproval     = errors.New("command must be approved by another user")
+	ErrNothingToApprove = errors.New("no commands awaiting approval")
+)
+
+// NotAwaitingApprovalError – команда не ждет подтверждения (уже подтверждена, отклонена, истекла...)
+type NotAwaitingApprovalError struct {
+	Status string
+}
+
+func (e *NotAwaitingApprovalError) Error() string {
+	return fmt.Sprintf("command is %s, not awaiting approval", e.Status)
+}
+
+// ApprovalWindow – сколько команда ждет подтверждения, прежде чем истечь (COMMAND_APPROVAL_WINDOW_SEC)
+func ApprovalWindow(sctx smart_context.ISmartContext) time.Duration {
+	return time.Duration(env_vars.GetEnvAsInt(sctx, "COMMAND_APPROVAL_WINDOW_SEC", DefaultApprovalWindowSec)) * time.Second
+}
+
+// ApprovalNotice – уведомление фронтендов о запросе подтверждения или решении по нему
+type ApprovalNotice struct {
+	CommandIDs  []string        `json:"command_ids"`
+	BatchID     string          `json:"batch_id,omitempty"`
+	CommandType string          `json:"command_type"`
+	Params      json.RawMessage `json:"params,omitempty"`
+	DeviceIDs   []string        `json:"device_ids"`
+	RequestedBy string          `json:"requested_by"`
+	Status      string          `json:"status"`
+	DecidedBy   string          `json:"decided_by,omitempty"`
+	Reason      string          `json:"reason,omitempty"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+}
+
+// ApprovalMessage – WS сообщение фронтенду (формат совпадает с ws_server.WSMessage)
+type ApprovalMessage struct {
+	Action  string         `json:"action"`
+	Payload ApprovalNotice `json:"payload"`
+}
+
+func newApprovalNotice(commands []model.Command, batchID string) ApprovalNotice {
+	notice := ApprovalNotice{
+		BatchID:    batchID,
+		CommandIDs: make([]string, 0, len(commands)),
+		DeviceIDs:  make([]string, 0, len(commands)),
+	}
+	for i, cmd := range commands {
+		if i == 0 {
+			notice.CommandType = cmd.CommandType
+			notice.Params = json.RawMessage(cmd.Params)
+			notice.RequestedBy = cmd.UserID
+			notice.Status = cmd.Status
+			notice.ExpiresAt = cmd.ExpiresAt
+		}
+		notice.CommandIDs = append(notice.CommandIDs, cmd.ID)
+		notice.DeviceIDs = append(notice.DeviceIDs, cmd.DeviceID)
+	}
+	return notice
+}
+
+// broadcastApproval отправляет уведомление фронтенд сессиям тех, кто может решить по командам (см. approvalRecipients)
+func broadcastApproval(sctx smart_context.ISmartContext, action string, notice ApprovalNotice) {
+	recipients, err := approvalRecipients(sctx, notice.DeviceIDs)
+	if err != nil {
+		sctx.Errorf("Error selecting recipients of %s notification: %v", action, err)
+		return
+	}
+	if len(recipients) == 0 {
+		return
+	}
+	data, err := json.Marshal(ApprovalMessage{Action: action, Payload: notice})
+	if err != nil {
+		sctx.Errorf("Error marshalling %s notification: %v", action, err)
+		return
+	}
+	sent := ws_registry.SendToFrontends(sctx, data, func(user ws_registry.FrontendUser) bool {
+		return recipients[user.UserID]
+	})
+	sctx.Debugf("Sent %s for %d commands to %d frontend sessions", action, len(notice.CommandIDs), sent)
+}
+
+// approvalRecipients выбирает из пользователей с открытыми фронтенд сессиями тех, у кого есть право commands:approve
+// и кому доступны все устройства команд. Параметры команд и устройства не должны попадать к остальным
+func approvalRecipients(sctx smart_context.ISmartContext, deviceIDs []string) (map[string]bool, error) {
+	userIDs := ws_registry.FrontendUserIDs()
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	var users []model.User
+	if err := sctx.GetDB().Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("error loading users: %w", err)
+	}
+
+	// у батча может быть несколько команд на одно устройство
+	deviceCount := int64(len(slices.Compact(slices.Sorted(slices.Values(deviceIDs)))))
+	recipients := make(map[string]bool, len(users))
+	for _, user := range users {
+		allowed, err := permissions.RoleHasPermission(sctx, user.RoleCode, permissions.CommandsApprove)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			continue
+		}
+		scope, err := device_scope.ForUserID(sctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !scope.All {
+			var count int64
+			query := scope.FilterDevices(sctx.GetDB().Model(&model.Device{}).Where("id IN ?", deviceIDs), "group_id")
+			if err := query.Count(&count).Error; err != nil {
+				return nil, fmt.Errorf("error checking devices of user %s: %w", user.ID, err)
+			}
+			if count < deviceCount {
+				continue
+			}
+		}
+		recipients[user.ID] = true
+	}
+	return recipients, nil
+}
+
+// NotifyApprovalRequested сообщает фронтендам, что команды (одна или батч) ждут подтверждения
+func NotifyApprovalRequested(sctx smart_context.ISmartContext, commands []model.Command, batchID string) {
+	if len(commands) == 0 {
+		return
+	}
+	broadcastApproval(sctx, ActionApprovalRequested, newApprovalNotice(commands, batchID))
+}
+
+// ApproveCommand подтверждает команду и отправляет ее на устройство (если оно на связи).
+// scope – устройства, доступные подтверждающему: команды других устройств не затрагиваются
+func ApproveCommand(sctx smart_context.ISmartContext, scope *device_scope.Scope, commandID string, approverID string, reason string) ([]model.Command, error) {
+	return decide(sctx, scope, sctx.GetDB().Where("id = ?", commandID), "", approverID, true, reason)
+}
+
+// RejectCommand отклоняет команду
+func RejectCommand(sctx smart_context.ISmartContext, scope *device_scope.Scope, commandID string, approverID string, reason string) ([]model.Command, error) {
+	return decide(sctx, scope, sctx.GetDB().Where("id = ?", commandID), "", approverID, false, reason)
+}
+
+// ApproveBatch подтверждает все ожидающие команды батча на устройствах из scope
+func ApproveBatch(sctx smart_context.ISmartContext, scope *device_scope.Scope, batchID string, approverID string, reason string) ([]model.Command, error) {
+	return decide(sctx, scope, sctx.GetDB().Where("batch_id = ? AND status = ?", batchID, StatusAwaitingApproval), batchID, approverID, true, reason)
+}
+
+// RejectBatch отклоняет все ожидающие команды батча на устройствах из scope
+func RejectBatch(sctx smart_context.ISmartContext, scope *device_scope.Scope, batchID string, approverID string, reason string) ([]model.Command, error) {
+	return decide(sctx, scope, sctx.GetDB().Where("batch_id = ? AND status = ?", batchID, StatusAwaitingApproval), batchID, approverID, false, reason)
+}
+
+// decide применяет решение администратора approverID к командам query на устройствах из scope.
+// Подтвердить или отклонить свою команду нельзя – это должен сделать второй человек
+func decide(sctx smart_context.ISmartContext, scope *device_scope.Scope, query *gorm.DB, batchID string, approverID string, approve bool, reason string) ([]model.Command, error) {
+	var commands []model.Command
+	if err := scope.FilterByDevice(sctx, query, "device_id").Order("created_at").Find(&commands).Error; err != nil {
+		return nil, fmt.Errorf("error loading commands for approval: %w", err)
+	}
+	if len(commands) == 0 {
+		if batchID != "" {
+			return nil, ErrNothingToApprove
+		}
+		return nil, ErrCommandNotFound
+	}
+
+	for _, cmd := range commands {
+		if cmd.Status != StatusAwaitingApproval {
+			return nil, &NotAwaitingApprovalError{Status: cmd.Status}
+		}
+		if cmd.UserID == approverID {
+			return nil, ErrSelfApproval
+		}
+	}
+
+	now := time.Now()
+	var decided []model.Command
+	err := sctx.GetDB().Transaction(func(tx *gorm.DB) error {
+		for i := range commands {
+			cmd := commands[i]
+			updates := map[string]any{
+				"approver_id":         approverID,
+				"approval_decided_at": now,
+				"approval_reason":     reason,
+				"updated_at":          now,
+			}
+			if approve {
+				// срок жизни отсчитывается заново с момента подтверждения
+				cmd.Status = StatusPending
+				cmd.ExpiresAt = now.Add(time.Duration(cmd.TTLSeconds) * time.Second)
+				updates["expires_at"] = cmd.ExpiresAt
+			} else {
+				cmd.Status = StatusRejected
+				cmd.ErrorText = "rejected: " + reason
+				cmd.ExecutedAt = now
+				updates["executed_at"] = now
+				updates["error_text"] = cmd.ErrorText
+			}
+			updates["status"] = cmd.Status
+
+			// статус мог смениться параллельно (отмена, истечение, другой администратор) - берем только то, что еще ждет
+			result := tx.Model(&model.Command{}).
+				Where("id = ? AND status = ?", cmd.ID, StatusAwaitingApproval).
+				Updates(updates)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+			cmd.ApproverID = approverID
+			cmd.ApprovalDecidedAt = now
+			cmd.ApprovalReason = reason
+			cmd.UpdatedAt = now
+			decided = append(decided, cmd)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error saving approval decision: %w", err)
+	}
+	if len(decided) == 0 {
+		return nil, &NotAwaitingApprovalError{Status: "already decided"}
+	}
+
+	action := "rejected"
+	if approve {
+		action = "approved"
+	}
+	sctx.Infof("%d '%s' commands %s by user %s", len(decided), decided[0].CommandType, action, approverID)
+
+	if approve {
+		for i := range decided {
+			if _, err := DeliverIfConnected(sctx, &decided[i]); err != nil {
+				sctx.Warnf("Approved command %s not delivered, stored for later execution: %v", decided[i].ID, err)
+			}
+		}
+	}
+
+	notice := newApprovalNotice(decided, batchID)
+	notice.DecidedBy = approverID
+	notice.Reason = reason
+	broadcastApproval(sctx, ActionApprovalDecided, notice)
+	return decided, nil
+}
+
+// expireAwaitingApproval переводит в EXPIRED команды, которые так и не подтвердили, и уведомляет фронтенды
+func expireAwaitingApproval(sctx smart_context.ISmartContext, now time.Time) (int64, error) {
+	var expired []model.Command
+	err := sctx.GetDB().Model(&expired).
+		Clauses(clause.Returning{}).
+		Where("status = ? AND expires_at <= ?", StatusAwaitingApproval, now).
+		Updates(map[string]any{
+			"status":      StatusExpired,
+			"error_text":  "not approved in time",
+			"executed_at": now,
+			"updated_at":  now,
+		}).Error
+	if err != nil {
+		return 0, err
+	}
+	// одно уведомление на батч и на каждую отдельную команду - как в approval_requested
+	var batchIDs []string
+	batches := map[string][]model.Command{}
+	for _, cmd := range expired {
+		if cmd.BatchID == "" {
+			broadcastApproval(sctx, ActionApprovalDecided, newApprovalNotice([]model.Command{cmd}, ""))
+			continue
+		}
+		if _, ok := batches[cmd.BatchID]; !ok {
+			batchIDs = append(batchIDs, cmd.BatchID)
+		}
+		batches[cmd.BatchID] = append(batches[cmd.BatchID], cmd)
+	}
+	for _, batchID := range batchIDs {
+		broadcastApproval(sctx, ActionApprovalDecided, newApprovalNotice(batches[batchID], batchID))
+	}
+	return int64(len(expired)), nil
+}
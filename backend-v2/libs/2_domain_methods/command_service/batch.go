@@ -0,0 +1,322 @@
+package command_service
+
+import (
+	"backed-api-v2/libs/2_domain_methods/device_auth"
+	"backed-api-v2/libs/2_domain_methods/device_scope"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrEmptyBatchTarget  = errors.New("batch target is empty: specify group_id, device_ids, filter or all")
+	ErrNoTargetDevices   = errors.New("no devices match batch target")
+	ErrBatchNotFound     = errors.New("command batch not found")
+	batchInsertChunkSize = 500
+)
+
+// DeviceFilter – условия выбора устройств для массовой команды. Все заданные условия объединяются через AND
+type DeviceFilter struct {
+	GroupID       string     `json:"group_id,omitempty"`
+	Status        string     `json:"status,omitempty"` // ONLINE / OFFLINE
+	Search        string     `json:"search,omitempty"` // подстрока device_identifier или description
+	LastSeenAfter *time.Time `json:"last_seen_after,omitempty"`
+}
+
+// BatchTarget – на какие устройства отправить команду. Заданные селекторы объединяются через AND,
+// all=true явно выбирает все устройства (чтобы пустой запрос не ушел на весь парк)
+type BatchTarget struct {
+	All       bool          `json:"all,omitempty"`
+	GroupID   string        `json:"group_id,omitempty"`
+	DeviceIDs []string      `json:"device_ids,omitempty"`
+	Filter    *DeviceFilter `json:"filter,omitempty"`
+}
+
+func (t BatchTarget) isEmpty() bool {
+	return !t.All && t.GroupID == "" && len(t.DeviceIDs) == 0 && t.Filter == nil
+}
+
+// ResolveTargetDevices возвращает id устройств, попадающих под target, из доступных пользователю (scope)
+func ResolveTargetDevices(sctx smart_context.ISmartContext, target BatchTarget, scope *device_scope.Scope) ([]string, error) {
+	if target.isEmpty() {
+		return nil, ErrEmptyBatchTarget
+	}
+
+	// неподтвержденные устройства не подключаются, команды им не создаем
+	query := sctx.GetDB().Model(&model.Device{}).
+		Where("status IS NULL OR status NOT IN ?", device_auth.NotApprovedStatuses)
+	query = scope.FilterDevices(query, "group_id")
+	if target.GroupID != "" {
+		query = query.Where("group_id = ?", target.GroupID)
+	}
+	if len(target.DeviceIDs) > 0 {
+		query = query.Where("id IN ?", target.DeviceIDs)
+	}
+	if f := target.Filter; f != nil {
+		if f.GroupID != "" {
+			query = query.Where("group_id = ?", f.GroupID)
+		}
+		if f.Status != "" {
+			query = query.Where("status = ?", f.Status)
+		}
+		if f.Search != "" {
+			pattern := "%" + f.Search + "%"
+			query = query.Where("device_identifier ILIKE ? OR description ILIKE ?", pattern, pattern)
+		}
+		if f.LastSeenAfter != nil {
+			query = query.Where("last_seen >= ?", *f.LastSeenAfter)
+		}
+	}
+
+	var deviceIDs []string
+	if err := query.Order("id").Pluck("id", &deviceIDs).Error; err != nil {
+		return nil, fmt.Errorf("error resolving batch target devices: %w", err)
+	}
+	return deviceIDs, nil
+}
+
+// CreateBatch создает запись батча и по PENDING команде на каждое устройство target (в одной транзакции),
+// затем отправляет команды устройствам, которые сейчас на связи. Остальные получат их при подключении (SendPendingCommands), если не истечет ttl.
+// Устройства выбираются из доступных пользователю userID на момент создания (это важно для расписаний)
+func CreateBatch(sctx smart_context.ISmartContext, def *CommandDefinition, params datatypes.JSON, target BatchTarget, userID string, ttl time.Duration) (*model.CommandBatch, []model.Command, error) {
+	scope := device_scope.Unrestricted
+	if userID != "" {
+		var err error
+		if userID == sctx.GetUserID() {
+			// пользователь запроса: учитываются и ограничения его API ключа
+			scope, err = device_scope.ForUser(sctx)
+		} else {
+			scope, err = device_scope.ForUserID(sctx, userID)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	deviceIDs, err := ResolveTargetDevices(sctx, target, scope)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(deviceIDs) == 0 {
+		return nil, nil, ErrNoTargetDevices
+	}
+
+	targetJSON, err := json.Marshal(target)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error marshalling batch target: %w", err)
+	}
+
+	now := time.Now()
+	batch := &model.CommandBatch{
+		CommandType: def.CommandType,
+		Params:      params,
+		Target:      datatypes.JSON(targetJSON),
+		UserID:      userID,
+		TotalCount:  int32(len(deviceIDs)),
+		CreatedAt:   now,
+	}
+
+	var commands []model.Command
+	err = sctx.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(batch).Error; err != nil {
+			return fmt.Errorf("error saving command batch: %w", err)
+		}
+
+		commands = make([]model.Command, 0, len(deviceIDs))
+		for _, deviceID := range deviceIDs {
+			cmd := NewCommand(sctx, def, deviceID, params, userID, ttl)
+			cmd.BatchID = batch.ID
+			commands = append(commands, *cmd)
+		}
+		if err := tx.Omit("approver_id").CreateInBatches(&commands, batchInsertChunkSize).Error; err != nil {
+			return fmt.Errorf("error saving batch commands: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	sctx.Infof("Command batch %s ('%s') created for %d devices", batch.ID, def.CommandType, len(commands))
+
+	if def.RequiresApproval {
+		NotifyApprovalRequested(sctx, commands, batch.ID)
+		return batch, commands, nil
+	}
+
+	delivered := 0
+	for i := range commands {
+		ok, err := DeliverIfConnected(sctx, &commands[i])
+		if err != nil {
+			sctx.Warnf("Batch %s: command %s not delivered, stored for later execution: %v", batch.ID, commands[i].ID, err)
+			continue
+		}
+		if ok {
+			delivered++
+		}
+	}
+	sctx.Infof("Command batch %s: %d sent, %d queued for offline devices", batch.ID, delivered, len(commands)-delivered)
+
+	return batch, commands, nil
+}
+
+// BatchCounts – агрегированные счетчики команд батча по статусам
+type BatchCounts struct {
+	Total     int64            `json:"total"`
+	ByStatus  map[string]int64 `json:"by_status"`
+	Active    int64            `json:"active"`    // еще не завершены
+	Succeeded int64            `json:"succeeded"` // EXECUTED
+	Failed    int64            `json:"failed"`    // FAILED, TIMED_OUT, ERROR
+	Cancelled int64            `json:"cancelled"`
+	Completed bool             `json:"completed"` // все команды в финальном статусе
+}
+
+func newBatchCounts() BatchCounts {
+	return BatchCounts{ByStatus: make(map[string]int64)}
+}
+
+func (c *BatchCounts) add(status string, count int64) {
+	c.Total += count
+	c.ByStatus[status] += count
+	switch {
+	case !IsFinal(status):
+		c.Active += count
+	case status == StatusExecuted:
+		c.Succeeded += count
+	case status == StatusCancelled:
+		c.Cancelled += count
+	default:
+		c.Failed += count
+	}
+	c.Completed = c.Active == 0
+}
+
+// BatchSummary – батч с агрегированными счетчиками
+type BatchSummary struct {
+	model.CommandBatch
+	Counts BatchCounts `json:"counts"`
+}
+
+// BatchDeviceProgress – состояние команды батча на конкретном устройстве
+type BatchDeviceProgress struct {
+	CommandID        string    `json:"command_id"`
+	DeviceID         string    `json:"device_id"`
+	DeviceIdentifier string    `json:"device_identifier"`
+	DeviceStatus     string    `json:"device_status"`
+	Status           string    `json:"status"`
+	ErrorText        string    `json:"error_text"`
+	SentAt           time.Time `json:"sent_at"`
+	DeliveredAt      time.Time `json:"delivered_at"`
+	ExecutedAt       time.Time `json:"executed_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// BatchProgress – батч, счетчики и прогресс по каждому устройству
+type BatchProgress struct {
+	BatchSummary
+	Devices []BatchDeviceProgress `json:"devices"`
+}
+
+type batchStatusCount struct {
+	BatchID string
+	Status  string
+	Count   int64
+}
+
+func loadBatchCounts(sctx smart_context.ISmartContext, batchIDs []string, scope *device_scope.Scope) (map[string]BatchCounts, error) {
+	var rows []batchStatusCount
+	query := sctx.GetDB().Model(&model.Command{}).
+		Select("batch_id, status, COUNT(*) AS count").
+		Where("batch_id IN ?", batchIDs)
+	err := scope.FilterByDevice(sctx, query, "device_id").
+		Group("batch_id, status").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("error counting batch commands: %w", err)
+	}
+
+	result := make(map[string]BatchCounts, len(batchIDs))
+	for _, id := range batchIDs {
+		result[id] = newBatchCounts()
+	}
+	for _, row := range rows {
+		counts := result[row.BatchID]
+		counts.add(row.Status, row.Count)
+		result[row.BatchID] = counts
+	}
+	return result, nil
+}
+
+// ListBatches возвращает последние батчи (новые первыми) с агрегированными счетчиками.
+// Пользователь видит батчи с командами доступных ему устройств, счетчики – только по этим устройствам
+func ListBatches(sctx smart_context.ISmartContext, limit int, scope *device_scope.Scope) ([]BatchSummary, error) {
+	var batches []model.CommandBatch
+	query := sctx.GetDB()
+	if !scope.All {
+		visible := scope.FilterByDevice(sctx, sctx.GetDB().Model(&model.Command{}).Select("batch_id"), "device_id")
+		query = query.Where("id IN (?)", visible)
+	}
+	if err := query.Order("created_at DESC").Limit(limit).Find(&batches).Error; err != nil {
+		return nil, fmt.Errorf("error loading command batches: %w", err)
+	}
+	if len(batches) == 0 {
+		return []BatchSummary{}, nil
+	}
+
+	ids := make([]string, 0, len(batches))
+	for _, batch := range batches {
+		ids = append(ids, batch.ID)
+	}
+	counts, err := loadBatchCounts(sctx, ids, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]BatchSummary, 0, len(batches))
+	for _, batch := range batches {
+		result = append(result, BatchSummary{CommandBatch: batch, Counts: counts[batch.ID]})
+	}
+	return result, nil
+}
+
+// GetBatchProgress возвращает батч со счетчиками и статусом команды на каждом устройстве из доступных пользователю.
+// Батч без таких устройств – ErrBatchNotFound
+func GetBatchProgress(sctx smart_context.ISmartContext, batchID string, scope *device_scope.Scope) (*BatchProgress, error) {
+	var batch model.CommandBatch
+	if err := sctx.GetDB().Where("id = ?", batchID).First(&batch).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBatchNotFound
+		}
+		return nil, fmt.Errorf("error loading command batch %s: %w", batchID, err)
+	}
+
+	var devices []BatchDeviceProgress
+	query := sctx.GetDB().Table(model.TableNameCommand+" AS c").
+		Select(`c.id AS command_id, c.device_id, d.device_identifier, d.status AS device_status,
+			c.status, c.error_text, c.sent_at, c.delivered_at, c.executed_at, c.updated_at`).
+		Joins("LEFT JOIN "+model.TableNameDevice+" AS d ON d.id = c.device_id").
+		Where("c.batch_id = ?", batchID)
+	err := scope.FilterDevices(query, "d.group_id").
+		Order("d.device_identifier").
+		Scan(&devices).Error
+	if err != nil {
+		return nil, fmt.Errorf("error loading commands of batch %s: %w", batchID, err)
+	}
+	if !scope.All && len(devices) == 0 {
+		return nil, ErrBatchNotFound
+	}
+
+	counts := newBatchCounts()
+	for _, device := range devices {
+		counts.add(device.Status, 1)
+	}
+
+	return &BatchProgress{
+		BatchSummary: BatchSummary{CommandBatch: batch, Counts: counts},
+		Devices:      devices,
+	}, nil
+}
@@ -0,0 +1,123 @@
+package command_service
+
+import (
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/ws_registry"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ActionCancelCommand – action, которым сервер сообщает агенту об отмене уже отправленной команды
+const ActionCancelCommand = "cancel_command"
+
+var (
+	ErrCommandNotFound = errors.New("command not found")
+	// ErrCancelConflict – статус команды менялся при каждой попытке отмены
+	ErrCancelConflict = errors.New("command status is changing, try to cancel again")
+)
+
+// CommandFinishedError – команду нельзя отменить, она уже завершена
+type CommandFinishedError struct {
+	Status string
+}
+
+func (e *CommandFinishedError) Error() string {
+	return fmt.Sprintf("command is already %s", e.Status)
+}
+
+// CancelNotice – уведомление агента об отмене команды
+type CancelNotice struct {
+	CommandID string `json:"command_id"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// CancelMessage – WS сообщение с уведомлением об отмене (формат совпадает с ws_server.WSMessage)
+type CancelMessage struct {
+	Action  string       `json:"action"`
+	Payload CancelNotice `json:"payload"`
+}
+
+// cancelAttempts – сколько раз Cancel перечитывает команду, если ее статус успел смениться
+const cancelAttempts = 3
+
+// sentStatuses – команда уже ушла агенту, об отмене ему нужно сообщить
+var sentStatuses = map[string]bool{
+	StatusSent:      true,
+	StatusDelivered: true,
+	StatusRunning:   true,
+}
+
+// Cancel отменяет незавершенную команду. Если команда уже ушла на устройство и оно на связи – агент получает cancel_command
+func Cancel(sctx smart_context.ISmartContext, commandID string, reason string) (*model.Command, error) {
+	errorText := "cancelled"
+	if reason != "" {
+		errorText = "cancelled: " + reason
+	}
+
+	for range cancelAttempts {
+		var cmd model.Command
+		if err := sctx.GetDB().Where("id = ?", commandID).First(&cmd).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrCommandNotFound
+			}
+			return nil, fmt.Errorf("error finding command %s: %w", commandID, err)
+		}
+		if IsFinal(cmd.Status) {
+			return nil, &CommandFinishedError{Status: cmd.Status}
+		}
+
+		now := time.Now()
+		// статус мог смениться после чтения - отменяем только из того же статуса, иначе перечитываем
+		result := sctx.GetDB().Model(&model.Command{}).
+			Where("id = ? AND status = ?", cmd.ID, cmd.Status).
+			Updates(map[string]any{
+				"status":      StatusCancelled,
+				"error_text":  errorText,
+				"executed_at": now,
+				"updated_at":  now,
+			})
+		if result.Error != nil {
+			return nil, fmt.Errorf("error cancelling command %s: %w", cmd.ID, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		previousStatus := cmd.Status
+		cmd.Status = StatusCancelled
+		cmd.ErrorText = errorText
+		cmd.ExecutedAt = now
+		cmd.UpdatedAt = now
+		sctx.Infof("Command '%s' (%s) of device '%s' cancelled (was %s)", cmd.CommandType, cmd.ID, cmd.DeviceID, previousStatus)
+
+		if sentStatuses[previousStatus] {
+			notifyCancelled(sctx, &cmd, reason)
+		}
+		return &cmd, nil
+	}
+	return nil, fmt.Errorf("command %s: %w", commandID, ErrCancelConflict)
+}
+
+func notifyCancelled(sctx smart_context.ISmartContext, cmd *model.Command, reason string) {
+	conn, ok := ws_registry.GetClient(cmd.DeviceID)
+	if !ok {
+		sctx.Infof("Device '%s' is offline, cancel of command %s not sent", cmd.DeviceID, cmd.ID)
+		return
+	}
+	data, err := json.Marshal(CancelMessage{
+		Action:  ActionCancelCommand,
+		Payload: CancelNotice{CommandID: cmd.ID, Reason: reason},
+	})
+	if err != nil {
+		sctx.Errorf("Error marshalling cancel of command %s: %v", cmd.ID, err)
+		return
+	}
+	if err := conn.SendText(sctx, data); err != nil {
+		sctx.Warnf("Error sending cancel of command %s to device '%s': %v", cmd.ID, cmd.DeviceID, err)
+	}
+}
@@ -0,0 +1,167 @@
+package command_service
+
+import (
+	"backed-api-v2/libs/2_domain_methods/permissions"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/json_schema"
+	"backed-api-v2/libs/5_common/smart_context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Уровни опасности команд (command_catalog.danger_level)
+const (
+	DangerLow      = "low"
+	DangerMedium   = "medium"
+	DangerHigh     = "high"
+	DangerCritical = "critical"
+)
+
+// CommandDefinition – описание типа команды из таблицы command_catalog
+type CommandDefinition struct {
+	CommandType       string              `json:"command_type"`
+	Description       string              `json:"description"`
+	ParamsSchema      *json_schema.Schema `json:"params_schema"`
+	DangerLevel       string              `json:"danger_level"`
+	MinRoleCode       string              `json:"min_role_code"`
+	DefaultTTLSeconds int32               `json:"default_ttl_seconds"`
+	RequiresApproval  bool                `json:"requires_approval"` // команду должен подтвердить второй администратор
+	PermissionCode    string              `json:"permission_code"`   // право на отправку; если задано, min_role_code не проверяется
+}
+
+// UnknownCommandError – тип команды отсутствует в каталоге
+type UnknownCommandError struct {
+	CommandType string
+}
+
+func (e *UnknownCommandError) Error() string {
+	return fmt.Sprintf("unknown command '%s'", e.CommandType)
+}
+
+func definitionFromModel(row model.CommandCatalog) (CommandDefinition, error) {
+	schema, err := json_schema.Parse(row.ParamsSchema)
+	if err != nil {
+		return CommandDefinition{}, fmt.Errorf("command '%s': %w", row.CommandType, err)
+	}
+	return CommandDefinition{
+		CommandType:       row.CommandType,
+		Description:       row.Description,
+		ParamsSchema:      schema,
+		DangerLevel:       row.DangerLevel,
+		MinRoleCode:       row.MinRoleCode,
+		DefaultTTLSeconds: row.DefaultTTLSeconds,
+		RequiresApproval:  row.RequiresApproval,
+		PermissionCode:    row.PermissionCode,
+	}, nil
+}
+
+// GetDefinition возвращает описание типа команды или *UnknownCommandError
+func GetDefinition(sctx smart_context.ISmartContext, commandType string) (*CommandDefinition, error) {
+	var row model.CommandCatalog
+	if err := sctx.GetDB().Where("command_type = ?", commandType).First(&row).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &UnknownCommandError{CommandType: commandType}
+		}
+		return nil, fmt.Errorf("error loading command catalog: %w", err)
+	}
+
+	def, err := definitionFromModel(row)
+	if err != nil {
+		return nil, err
+	}
+	return &def, nil
+}
+
+// ListDefinitions возвращает весь каталог, отсортированный по типу команды
+func ListDefinitions(sctx smart_context.ISmartContext) ([]CommandDefinition, error) {
+	var rows []model.CommandCatalog
+	if err := sctx.GetDB().Order("command_type").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("error loading command catalog: %w", err)
+	}
+
+	result := make([]CommandDefinition, 0, len(rows))
+	for _, row := range rows {
+		def, err := definitionFromModel(row)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, def)
+	}
+	return result, nil
+}
+
+// MaxCommandTTL – максимальный срок жизни команды, который можно запросить при отправке
+const MaxCommandTTL = 30 * 24 * time.Hour
+
+// TTL возвращает срок жизни команды: запрошенный (если задан) или значение по умолчанию из каталога
+func (def *CommandDefinition) TTL(requested time.Duration) time.Duration {
+	if requested > 0 {
+		return min(requested, MaxCommandTTL)
+	}
+	return time.Duration(def.DefaultTTLSeconds) * time.Second
+}
+
+// ValidateParams проверяет параметры команды по схеме из каталога и подставляет значения по умолчанию.
+// Для невалидных параметров возвращает json_schema.ValidationErrors.
+func (def *CommandDefinition) ValidateParams(params map[string]any) (map[string]any, error) {
+	if params == nil {
+		params = map[string]any{}
+	}
+	normalized, err := json_schema.Normalize(params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+	result, _ := normalized.(map[string]any)
+
+	def.ParamsSchema.ApplyDefaults(result)
+	if errs := def.ParamsSchema.Validate(result); len(errs) > 0 {
+		return nil, errs
+	}
+	return result, nil
+}
+
+// IsRoleAllowed проверяет, что у роли roleCode есть право на команду (permission_code),
+// а для команд без права – что приоритет роли не ниже минимальной роли команды (если такой роли нет – запрещено)
+func (def *CommandDefinition) IsRoleAllowed(sctx smart_context.ISmartContext, roleCode string) (bool, error) {
+	if def.PermissionCode != "" {
+		return permissions.RoleHasPermission(sctx, roleCode, def.PermissionCode)
+	}
+	priorities, err := LoadRolePriorities(sctx)
+	if err != nil {
+		return false, err
+	}
+	return def.IsRoleAllowedWith(priorities, nil, roleCode), nil
+}
+
+// IsRoleAllowedWith – то же, что IsRoleAllowed, но с уже загруженными приоритетами ролей и правами роли roleCode
+func (def *CommandDefinition) IsRoleAllowedWith(priorities map[string]int32, rolePermissions map[string]bool, roleCode string) bool {
+	if def.PermissionCode != "" {
+		return rolePermissions[def.PermissionCode]
+	}
+	userPriority, ok := priorities[roleCode]
+	if !ok {
+		return false
+	}
+	// неизвестная минимальная роль (опечатка, удаленная роль) запрещает команду всем
+	minPriority, ok := priorities[def.MinRoleCode]
+	if !ok {
+		return false
+	}
+	return userPriority >= minPriority
+}
+
+// LoadRolePriorities возвращает приоритеты ролей (roles.priority) по коду роли
+func LoadRolePriorities(sctx smart_context.ISmartContext) (map[string]int32, error) {
+	var roles []model.Role
+	if err := sctx.GetDB().Find(&roles).Error; err != nil {
+		return nil, fmt.Errorf("error loading roles: %w", err)
+	}
+	result := make(map[string]int32, len(roles))
+	for _, role := range roles {
+		result[role.Code] = role.Priority
+	}
+	return result, nil
+}
@@ -0,0 +1,286 @@
+package command_service
+
+import (
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/ws_registry"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ActionCommand – action сообщения, которым сервер отправляет команду агенту
+const ActionCommand = "command"
+
+// CommandEnvelope – команда в том виде, в котором ее получает агент
+type CommandEnvelope struct {
+	ID          string          `json:"id"`
+	CommandType string          `json:"command"`
+	Params      json.RawMessage `json:"params,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// CommandMessage – WS сообщение с командой (формат совпадает с ws_server.WSMessage)
+type CommandMessage struct {
+	Action  string          `json:"action"`
+	Payload CommandEnvelope `json:"payload"`
+}
+
+// CommandAck – подтверждение от агента по конкретной команде (по commands.id)
+type CommandAck struct {
+	CommandID string          `json:"command_id"`
+	Status    string          `json:"status"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// статусы, которые может прислать агент
+var agentStatuses = map[string]bool{
+	StatusDelivered: true,
+	StatusRunning:   true,
+	StatusExecuted:  true,
+	StatusFailed:    true,
+}
+
+func NewCommandEnvelope(cmd *model.Command) CommandEnvelope {
+	return CommandEnvelope{
+		ID:          cmd.ID,
+		CommandType: cmd.CommandType,
+		Params:      json.RawMessage(cmd.Params),
+		CreatedAt:   cmd.CreatedAt,
+	}
+}
+
+// NewCommand создает (не сохраняя) новую команду устройства со сроком жизни ttl.
+// Команда в статусе PENDING, либо AWAITING_APPROVAL, если тип команды требует подтверждения –
+// тогда expires_at ограничивает ожидание подтверждения, а ttl отсчитывается от момента подтверждения
+func NewCommand(sctx smart_context.ISmartContext, def *CommandDefinition, deviceID string, params datatypes.JSON, userID string, ttl time.Duration) *model.Command {
+	now := time.Now()
+	cmd := &model.Command{
+		DeviceID:    deviceID,
+		CommandType: def.CommandType,
+		Params:      params,
+		UserID:      userID,
+		Status:      StatusPending,
+		ExpiresAt:   now.Add(ttl),
+		TTLSeconds:  int32(ttl / time.Second),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if def.RequiresApproval {
+		cmd.Status = StatusAwaitingApproval
+		cmd.ExpiresAt = now.Add(ApprovalWindow(sctx))
+	}
+	return cmd
+}
+
+// ErrCommandNotDeliverable – пока команду отправляли, ее отменили, подтвердили или отправил другой обработчик
+var ErrCommandNotDeliverable = errors.New("command is no longer waiting for delivery")
+
+// DeliverIfConnected отправляет команду, если устройство сейчас подключено. Возвращает false, если устройства нет на связи –
+// тогда команда остается PENDING и уйдет при подключении. Команды, ожидающие подтверждения, не отправляются
+func DeliverIfConnected(sctx smart_context.ISmartContext, cmd *model.Command) (bool, error) {
+	if cmd.Status != StatusPending && cmd.Status != StatusSent {
+		return false, nil
+	}
+	conn, ok := ws_registry.GetClient(cmd.DeviceID)
+	if !ok {
+		return false, nil
+	}
+	if err := Deliver(sctx, conn, cmd); err != nil {
+		if errors.Is(err, ErrCommandNotDeliverable) {
+			sctx.Infof("Command %s was not sent: %v", cmd.ID, err)
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Deliver переводит команду в SENT и отправляет ее в соединение устройства.
+// Статус занимается до отправки: команда, которую успели отменить после чтения, агенту не уходит (ErrCommandNotDeliverable).
+// Если отправить не удалось (устройство отключилось) – команда возвращается в PENDING и уйдет при следующем подключении.
+func Deliver(sctx smart_context.ISmartContext, conn *ws_registry.Connection, cmd *model.Command) error {
+	data, err := json.Marshal(CommandMessage{
+		Action:  ActionCommand,
+		Payload: NewCommandEnvelope(cmd),
+	})
+	if err != nil {
+		return fmt.Errorf("error marshalling command %s: %w", cmd.ID, err)
+	}
+
+	now := time.Now()
+	if isExpired(cmd, now) {
+		if err := expireCommand(sctx, cmd, now); err != nil {
+			return err
+		}
+		return fmt.Errorf("command %s: %w", cmd.ID, ErrCommandExpired)
+	}
+
+	// занимаем команду из того же статуса и с тем же числом попыток - иначе ее уже изменили параллельно
+	attempts := cmd.Attempts + 1
+	nextRetryAt := now.Add(LoadRetryPolicy(sctx).Backoff(int(attempts)))
+	result := sctx.GetDB().Model(&model.Command{}).
+		Where("id = ? AND status = ? AND attempts = ?", cmd.ID, cmd.Status, cmd.Attempts).
+		Where("status IN ?", UndeliveredStatuses).
+		Updates(map[string]any{
+			"status":        StatusSent,
+			"sent_at":       now,
+			"attempts":      attempts,
+			"next_retry_at": nextRetryAt,
+			"updated_at":    now,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("error updating status of command %s: %w", cmd.ID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("command %s: %w", cmd.ID, ErrCommandNotDeliverable)
+	}
+
+	if err := conn.SendText(sctx, data); err != nil {
+		// агент команду не получил - возвращаем в очередь, если за это время ее не отменили
+		revertErr := sctx.GetDB().Model(&model.Command{}).
+			Where("id = ? AND status = ? AND attempts = ?", cmd.ID, StatusSent, attempts).
+			Updates(map[string]any{
+				"status":     StatusPending,
+				"attempts":   cmd.Attempts,
+				"updated_at": time.Now(),
+			}).Error
+		if revertErr != nil {
+			sctx.Errorf("Error returning command %s to queue: %v", cmd.ID, revertErr)
+		}
+		return fmt.Errorf("error sending command %s: %w", cmd.ID, err)
+	}
+
+	cmd.Status = StatusSent
+	cmd.SentAt = now
+	cmd.Attempts = attempts
+	cmd.NextRetryAt = nextRetryAt
+	cmd.UpdatedAt = now
+
+	sctx.Infof("Command '%s' (%s) sent to device '%s', attempt %d", cmd.CommandType, cmd.ID, cmd.DeviceID, attempts)
+	return nil
+}
+
+// ackAttempts – сколько раз ApplyAck перечитывает команду, если ее статус успел смениться
+const ackAttempts = 3
+
+// ApplyAck применяет подтверждение агента к команде устройства deviceID.
+// Повторное подтверждение с тем же статусом игнорируется, как и подтверждение отмененной или истекшей команды.
+func ApplyAck(sctx smart_context.ISmartContext, deviceID string, ack CommandAck) (*model.Command, error) {
+	if ack.CommandID == "" {
+		return nil, fmt.Errorf("missing command_id")
+	}
+	if !agentStatuses[ack.Status] {
+		return nil, fmt.Errorf("invalid status '%s'", ack.Status)
+	}
+
+	for range ackAttempts {
+		cmd, applied, err := tryApplyAck(sctx, deviceID, ack)
+		if err != nil || applied {
+			return cmd, err
+		}
+	}
+	return nil, fmt.Errorf("command %s: status keeps changing, %s not applied", ack.CommandID, ack.Status)
+}
+
+// tryApplyAck читает команду и обновляет ее только из прочитанного статуса: отмена, истечение или параллельный ack
+// между чтением и обновлением не перезаписываются. applied == false – статус сменился, нужно перечитать
+func tryApplyAck(sctx smart_context.ISmartContext, deviceID string, ack CommandAck) (*model.Command, bool, error) {
+	var cmd model.Command
+	err := sctx.GetDB().Where("id = ? AND device_id = ?", ack.CommandID, deviceID).First(&cmd).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, fmt.Errorf("command %s not found for device", ack.CommandID)
+		}
+		return nil, false, fmt.Errorf("error finding command %s: %w", ack.CommandID, err)
+	}
+
+	if cmd.Status == ack.Status {
+		return &cmd, true, nil
+	}
+	// команду уже отменили или она истекла - агент мог не получить уведомление вовремя, это не ошибка
+	if cmd.Status == StatusCancelled || cmd.Status == StatusExpired {
+		sctx.Infof("Command %s is %s, ignoring %s from device '%s'", cmd.ID, cmd.Status, ack.Status, deviceID)
+		return &cmd, true, nil
+	}
+	if !CanTransition(cmd.Status, ack.Status) {
+		return nil, false, fmt.Errorf("command %s is %s, cannot change status to %s", cmd.ID, cmd.Status, ack.Status)
+	}
+
+	now := time.Now()
+	updates := map[string]any{
+		"status":     ack.Status,
+		"updated_at": now,
+	}
+	if cmd.DeliveredAt.IsZero() {
+		// RUNNING/EXECUTED без DELIVERED тоже означает, что агент команду получил
+		updates["delivered_at"] = now
+	}
+	if IsFinal(ack.Status) {
+		updates["executed_at"] = now
+	}
+	if len(ack.Result) > 0 {
+		updates["result"] = datatypes.JSON(ack.Result)
+	}
+	if ack.Error != "" {
+		updates["error_text"] = ack.Error
+	}
+
+	result := sctx.GetDB().Model(&model.Command{}).
+		Where("id = ? AND status = ?", cmd.ID, cmd.Status).
+		Updates(updates)
+	if result.Error != nil {
+		return nil, false, fmt.Errorf("error updating command %s: %w", cmd.ID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, false, nil
+	}
+
+	sctx.Infof("Command '%s' (%s) of device '%s' changed status %s -> %s", cmd.CommandType, cmd.ID, deviceID, cmd.Status, ack.Status)
+
+	cmd.Status = ack.Status
+	cmd.UpdatedAt = now
+	if len(ack.Result) > 0 {
+		cmd.Result = datatypes.JSON(ack.Result)
+	}
+	if ack.Error != "" {
+		cmd.ErrorText = ack.Error
+	}
+	return &cmd, true, nil
+}
+
+// SendPendingCommands отправляет устройству все накопившиеся PENDING команды (при подключении). Истекшие не отправляются
+func SendPendingCommands(sctx smart_context.ISmartContext, deviceID string, conn *ws_registry.Connection) {
+	var pendingCommands []model.Command
+	err := sctx.GetDB().
+		Where("device_id = ? AND status = ?", deviceID, StatusPending).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("created_at").
+		Find(&pendingCommands).Error
+	if err != nil {
+		sctx.Errorf("Error fetching pending commands for device %s: %v", deviceID, err)
+		return
+	}
+	if len(pendingCommands) == 0 {
+		sctx.Infof("No pending commands for device %s", deviceID)
+		return
+	}
+	sctx.Infof("Found %d pending commands for device %s", len(pendingCommands), deviceID)
+	for i := range pendingCommands {
+		if err := Deliver(sctx, conn, &pendingCommands[i]); err != nil {
+			if errors.Is(err, ErrCommandNotDeliverable) {
+				sctx.Infof("Pending command %s was not sent: %v", pendingCommands[i].ID, err)
+				continue
+			}
+			sctx.Errorf("Error sending pending command %s: %v", pendingCommands[i].ID, err)
+			if errors.Is(err, ws_registry.ErrConnectionClosed) {
+				return
+			}
+		}
+	}
+}
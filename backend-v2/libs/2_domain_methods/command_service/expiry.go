@@ -0,0 +1,176 @@
+package command_service
+
+import (
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/env_vars"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/ws_registry"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultMaxAttempts        = 5
+	DefaultRetryBaseSec       = 30
+	DefaultRetryMaxSec        = 600
+	DefaultSweeperIntervalSec = 15
+)
+
+var ErrCommandExpired = errors.New("command expired")
+
+// RetryPolicy – повторная отправка команд, которые агент не подтвердил (остались SENT).
+// Задержка перед попыткой n: BaseDelay * 2^(n-1), но не больше MaxDelay
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// LoadRetryPolicy читает политику из COMMAND_MAX_ATTEMPTS, COMMAND_RETRY_BASE_SEC, COMMAND_RETRY_MAX_SEC
+func LoadRetryPolicy(sctx smart_context.ISmartContext) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: env_vars.GetEnvAsInt(sctx, "COMMAND_MAX_ATTEMPTS", DefaultMaxAttempts),
+		BaseDelay:   time.Duration(env_vars.GetEnvAsInt(sctx, "COMMAND_RETRY_BASE_SEC", DefaultRetryBaseSec)) * time.Second,
+		MaxDelay:    time.Duration(env_vars.GetEnvAsInt(sctx, "COMMAND_RETRY_MAX_SEC", DefaultRetryMaxSec)) * time.Second,
+	}
+}
+
+// Backoff возвращает, сколько ждать подтверждения после попытки attempt (с 1)
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+func isExpired(cmd *model.Command, now time.Time) bool {
+	return !cmd.ExpiresAt.IsZero() && !now.Before(cmd.ExpiresAt)
+}
+
+// expireCommand переводит неподтвержденную команду в EXPIRED
+func expireCommand(sctx smart_context.ISmartContext, cmd *model.Command, now time.Time) error {
+	err := sctx.GetDB().Model(&model.Command{}).
+		Where("id = ? AND status IN ?", cmd.ID, UndeliveredStatuses).
+		Updates(map[string]any{
+			"status":      StatusExpired,
+			"error_text":  ErrCommandExpired.Error(),
+			"executed_at": now,
+			"updated_at":  now,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("error expiring command %s: %w", cmd.ID, err)
+	}
+	cmd.Status = StatusExpired
+	cmd.ErrorText = ErrCommandExpired.Error()
+	sctx.Infof("Command '%s' (%s) of device '%s' expired", cmd.CommandType, cmd.ID, cmd.DeviceID)
+	return nil
+}
+
+// RunCommandSweeper раз в COMMAND_SWEEPER_INTERVAL_SEC помечает истекшие команды и повторно отправляет неподтвержденные.
+// Завершается при отмене контекста сервера
+func RunCommandSweeper(sctx smart_context.ISmartContext) {
+	interval := time.Duration(env_vars.GetEnvAsInt(sctx, "COMMAND_SWEEPER_INTERVAL_SEC", DefaultSweeperIntervalSec)) * time.Second
+	sctx.Infof("Command sweeper started, interval %s", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		if expired, err := ExpireCommands(sctx, now); err != nil {
+			sctx.Errorf("Error expiring commands: %v", err)
+		} else if expired > 0 {
+			sctx.Infof("Command sweeper: %d commands expired", expired)
+		}
+		RetryUnacknowledged(sctx, now, LoadRetryPolicy(sctx))
+
+		select {
+		case <-sctx.GetContext().Done():
+			sctx.Infof("Command sweeper stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ExpireCommands переводит в EXPIRED все неподтвержденные (в т.ч. администратором) команды с истекшим expires_at.
+// Возвращает их количество
+func ExpireCommands(sctx smart_context.ISmartContext, now time.Time) (int64, error) {
+	awaiting, err := expireAwaitingApproval(sctx, now)
+	if err != nil {
+		return 0, err
+	}
+
+	result := sctx.GetDB().Model(&model.Command{}).
+		Where("status IN ? AND expires_at <= ?", UndeliveredStatuses, now).
+		Updates(map[string]any{
+			"status":      StatusExpired,
+			"error_text":  ErrCommandExpired.Error(),
+			"executed_at": now,
+			"updated_at":  now,
+		})
+	if result.Error != nil {
+		return awaiting, result.Error
+	}
+	return awaiting + result.RowsAffected, nil
+}
+
+// RetryUnacknowledged обрабатывает SENT команды, для которых наступило next_retry_at:
+// если попытки исчерпаны – TIMED_OUT, если устройство на связи – отправляет снова,
+// иначе возвращает в PENDING, чтобы команда ушла при подключении
+func RetryUnacknowledged(sctx smart_context.ISmartContext, now time.Time, policy RetryPolicy) {
+	var commands []model.Command
+	err := sctx.GetDB().
+		Where("status = ? AND next_retry_at <= ?", StatusSent, now).
+		Order("next_retry_at").
+		Find(&commands).Error
+	if err != nil {
+		sctx.Errorf("Error loading unacknowledged commands: %v", err)
+		return
+	}
+
+	for i := range commands {
+		if sctx.GetContext().Err() != nil {
+			return
+		}
+		cmd := &commands[i]
+
+		if int(cmd.Attempts) >= policy.MaxAttempts {
+			timeoutErr := fmt.Sprintf("no acknowledgement from device after %d attempts", cmd.Attempts)
+			updateUnacknowledged(sctx, cmd, map[string]any{
+				"status":      StatusTimedOut,
+				"error_text":  timeoutErr,
+				"executed_at": now,
+				"updated_at":  now,
+			})
+			sctx.Warnf("Command '%s' (%s) of device '%s' timed out: %s", cmd.CommandType, cmd.ID, cmd.DeviceID, timeoutErr)
+			continue
+		}
+
+		conn, ok := ws_registry.GetClient(cmd.DeviceID)
+		if !ok {
+			updateUnacknowledged(sctx, cmd, map[string]any{
+				"status":     StatusPending,
+				"updated_at": now,
+			})
+			sctx.Infof("Command %s not acknowledged and device '%s' is offline, queued for reconnect", cmd.ID, cmd.DeviceID)
+			continue
+		}
+
+		if err := Deliver(sctx, conn, cmd); err != nil {
+			sctx.Warnf("Error resending command %s: %v", cmd.ID, err)
+		}
+	}
+}
+
+// updateUnacknowledged обновляет команду, только если она все еще SENT (ack мог прийти параллельно)
+func updateUnacknowledged(sctx smart_context.ISmartContext, cmd *model.Command, updates map[string]any) {
+	err := sctx.GetDB().Model(&model.Command{}).
+		Where("id = ? AND status = ?", cmd.ID, StatusSent).
+		Updates(updates).Error
+	if err != nil {
+		sctx.Errorf("Error updating unacknowledged command %s: %v", cmd.ID, err)
+	}
+}
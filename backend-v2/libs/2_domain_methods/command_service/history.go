@@ -0,0 +1,56 @@
+package command_service
+
+import (
+	"backed-api-v2/libs/2_domain_methods/device_scope"
+	"backed-api-v2/libs/2_domain_methods/list_query"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+)
+
+// HistoryListSpec – фильтры и сортировка истории команд (list_query), по умолчанию новые первыми
+var HistoryListSpec = &list_query.Spec{
+	Fields: map[string]list_query.Field{
+		"device_id":    {Column: "c.device_id", Type: list_query.String},
+		"group_id":     {Column: "d.group_id", Type: list_query.String},
+		"user_id":      {Column: "c.user_id", Type: list_query.String},
+		"command_type": {Column: "c.command_type", Type: list_query.String},
+		"batch_id":     {Column: "c.batch_id", Type: list_query.String},
+		"status":       {Column: "c.status", Type: list_query.String},
+		"created_at":   {Column: "c.created_at", Type: list_query.Time, Sortable: true},
+		"updated_at":   {Column: "c.updated_at", Type: list_query.Time, Sortable: true},
+	},
+	Search:      []string{"c.command_type", "u.username", "d.device_identifier"},
+	DefaultSort: "-created_at",
+	IDColumn:    "c.id",
+}
+
+// HistoryFilter – устройство, доступ и параметры списка истории команд
+type HistoryFilter struct {
+	DeviceID string              // история одного устройства
+	Scope    *device_scope.Scope // только команды устройств, доступных пользователю (nil – все)
+	Query    *list_query.Query   // фильтры, сортировка и страница по HistoryListSpec
+}
+
+// CommandHistoryItem – команда с инициатором и устройством
+type CommandHistoryItem struct {
+	model.Command
+	Username         string `gorm:"column:username" json:"username"`
+	DeviceIdentifier string `gorm:"column:device_identifier" json:"device_identifier"`
+	DeviceGroupID    string `gorm:"column:device_group_id" json:"device_group_id"`
+}
+
+// ListCommandHistory возвращает страницу истории команд (keyset пагинация по полю сортировки и id)
+func ListCommandHistory(sctx smart_context.ISmartContext, filter HistoryFilter) (*list_query.Page[CommandHistoryItem], error) {
+	query := sctx.GetDB().Table(model.TableNameCommand + " AS c").
+		Select("c.*, u.username, d.device_identifier, d.group_id AS device_group_id").
+		Joins("LEFT JOIN " + model.TableNameUser + " AS u ON u.id = c.user_id").
+		Joins("LEFT JOIN " + model.TableNameDevice + " AS d ON d.id = c.device_id")
+
+	if filter.Scope != nil {
+		query = filter.Scope.FilterDevices(query, "d.group_id")
+	}
+	if filter.DeviceID != "" {
+		query = query.Where("c.device_id = ?", filter.DeviceID)
+	}
+	return list_query.Find[CommandHistoryItem](query, HistoryListSpec, filter.Query)
+}
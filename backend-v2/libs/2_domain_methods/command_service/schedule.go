@@ -0,0 +1,155 @@
+package command_service
+
+import (
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/cron_expr"
+	"backed-api-v2/libs/5_common/smart_context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrScheduleNotFound = errors.New("command schedule not found")
+
+// InvalidScheduleError – некорректное время запуска расписания (cron, run_at или часовой пояс)
+type InvalidScheduleError struct {
+	Message string
+}
+
+func (e *InvalidScheduleError) Error() string {
+	return e.Message
+}
+
+// ScheduleTiming – когда срабатывает расписание: по cron выражению или один раз в run_at
+type ScheduleTiming struct {
+	cron  *cron_expr.Schedule
+	runAt time.Time
+	loc   *time.Location
+}
+
+// ParseTiming проверяет параметры запуска: должно быть задано ровно одно из cronExpr и runAt.
+// Cron выражение вычисляется в часовом поясе timezone (по умолчанию UTC)
+func ParseTiming(cronExpr string, runAt time.Time, timezone string) (*ScheduleTiming, error) {
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, &InvalidScheduleError{Message: fmt.Sprintf("unknown timezone '%s'", timezone)}
+	}
+
+	switch {
+	case cronExpr != "" && !runAt.IsZero():
+		return nil, &InvalidScheduleError{Message: "specify either cron_expr or run_at, not both"}
+	case cronExpr != "":
+		schedule, err := cron_expr.Parse(cronExpr)
+		if err != nil {
+			return nil, &InvalidScheduleError{Message: err.Error()}
+		}
+		return &ScheduleTiming{cron: schedule, loc: loc}, nil
+	case !runAt.IsZero():
+		return &ScheduleTiming{runAt: runAt, loc: loc}, nil
+	default:
+		return nil, &InvalidScheduleError{Message: "cron_expr or run_at is required"}
+	}
+}
+
+// TimingOf возвращает параметры запуска сохраненного расписания
+func TimingOf(schedule *model.CommandSchedule) (*ScheduleTiming, error) {
+	return ParseTiming(schedule.CronExpr, schedule.RunAt, schedule.Timezone)
+}
+
+// IsRecurring – true для cron расписаний
+func (t *ScheduleTiming) IsRecurring() bool {
+	return t.cron != nil
+}
+
+// Next возвращает следующее время запуска строго после after или нулевое время, если запусков больше не будет
+func (t *ScheduleTiming) Next(after time.Time) time.Time {
+	if t.cron == nil {
+		if t.runAt.After(after) {
+			return t.runAt.Local()
+		}
+		return time.Time{}
+	}
+	next := t.cron.Next(after.In(t.loc))
+	if next.IsZero() {
+		return next
+	}
+	// в БД время хранится без часового пояса, как и остальные метки (time.Now())
+	return next.Local()
+}
+
+// NextN возвращает до n ближайших запусков после after – для предпросмотра
+func (t *ScheduleTiming) NextN(after time.Time, n int) []time.Time {
+	result := make([]time.Time, 0, n)
+	for len(result) < n {
+		next := t.Next(after)
+		if next.IsZero() {
+			break
+		}
+		result = append(result, next)
+		after = next
+	}
+	return result
+}
+
+// ScheduleTarget возвращает цель расписания (устройство или группа)
+func ScheduleTarget(schedule *model.CommandSchedule) (BatchTarget, error) {
+	var target BatchTarget
+	if err := json.Unmarshal(schedule.Target, &target); err != nil {
+		return target, fmt.Errorf("invalid target of schedule %s: %w", schedule.ID, err)
+	}
+	return target, nil
+}
+
+// GetSchedule возвращает расписание по id или ErrScheduleNotFound
+func GetSchedule(sctx smart_context.ISmartContext, id string) (*model.CommandSchedule, error) {
+	var schedule model.CommandSchedule
+	if err := sctx.GetDB().Where("id = ?", id).First(&schedule).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrScheduleNotFound
+		}
+		return nil, fmt.Errorf("error loading command schedule %s: %w", id, err)
+	}
+	return &schedule, nil
+}
+
+// SaveSchedule пересчитывает next_run_at от текущего момента и сохраняет расписание (создает, если id пустой)
+func SaveSchedule(sctx smart_context.ISmartContext, schedule *model.CommandSchedule) error {
+	timing, err := TimingOf(schedule)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	schedule.NextRunAt = timing.Next(now)
+	schedule.UpdatedAt = now
+	if schedule.Enabled && schedule.NextRunAt.IsZero() {
+		return &InvalidScheduleError{Message: "schedule has no future runs (run_at is in the past)"}
+	}
+
+	if schedule.ID == "" {
+		enabled := schedule.Enabled
+		schedule.CreatedAt = now
+		// last_batch_id пишет только планировщик, при сохранении расписания оно не трогается (пустая строка - не NULL)
+		if err := sctx.GetDB().Omit("last_batch_id").Create(schedule).Error; err != nil {
+			return fmt.Errorf("error saving command schedule: %w", err)
+		}
+		// enabled имеет default true в БД, поэтому false при Create не запишется
+		if !enabled {
+			if err := sctx.GetDB().Model(schedule).Update("enabled", false).Error; err != nil {
+				return fmt.Errorf("error saving command schedule: %w", err)
+			}
+			schedule.Enabled = false
+		}
+		return nil
+	}
+
+	if err := sctx.GetDB().Omit("last_batch_id").Save(schedule).Error; err != nil {
+		return fmt.Errorf("error saving command schedule %s: %w", schedule.ID, err)
+	}
+	return nil
+}
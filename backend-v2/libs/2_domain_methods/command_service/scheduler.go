@@ -0,0 +1,172 @@
+package command_service
+
+import (
+	"backed-api-v2/libs/2_domain_methods/permissions"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/env_vars"
+	"backed-api-v2/libs/5_common/smart_context"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const DefaultSchedulerIntervalSec = 30
+
+// ErrScheduleOwnerNotAllowed – создателя расписания удалили или у его роли больше нет права на команду. Расписание выключается
+var ErrScheduleOwnerNotAllowed = errors.New("schedule owner is not allowed to send this command")
+
+// RunScheduler раз в COMMAND_SCHEDULER_INTERVAL_SEC запускает наступившие расписания.
+// Завершается при отмене контекста сервера
+func RunScheduler(sctx smart_context.ISmartContext) {
+	interval := time.Duration(env_vars.GetEnvAsInt(sctx, "COMMAND_SCHEDULER_INTERVAL_SEC", DefaultSchedulerIntervalSec)) * time.Second
+	sctx.Infof("Command scheduler started, interval %s", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		RunDueSchedules(sctx, time.Now())
+
+		select {
+		case <-sctx.GetContext().Done():
+			sctx.Infof("Command scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDueSchedules запускает все включенные расписания, у которых наступило next_run_at. Возвращает число запущенных.
+// Пропущенные (пока сервер не работал) запуски не догоняются: расписание срабатывает один раз и планируется от now.
+// Занятые расписания запускаются и при остановке сервера: next_run_at уже перенесен, иначе запуск потерялся бы
+func RunDueSchedules(sctx smart_context.ISmartContext, now time.Time) int {
+	due, err := claimDueSchedules(sctx, now)
+	if err != nil {
+		sctx.Errorf("Error claiming due command schedules: %v", err)
+		return 0
+	}
+
+	fireSctx := sctx.WithContext(context.WithoutCancel(sctx.GetContext()))
+	for i := range due {
+		fireSchedule(fireSctx.LogField("schedule_id", due[i].ID), &due[i])
+	}
+	return len(due)
+}
+
+// claimDueSchedules в одной транзакции выбирает наступившие расписания и сразу переносит next_run_at,
+// чтобы расписание не сработало дважды (в том числе при нескольких экземплярах сервера - SKIP LOCKED)
+func claimDueSchedules(sctx smart_context.ISmartContext, now time.Time) ([]model.CommandSchedule, error) {
+	var claimed []model.CommandSchedule
+	err := sctx.GetDB().Transaction(func(tx *gorm.DB) error {
+		var due []model.CommandSchedule
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("enabled AND next_run_at <= ?", now).
+			Order("next_run_at").
+			Find(&due).Error
+		if err != nil {
+			return err
+		}
+
+		for i := range due {
+			schedule := &due[i]
+			updates := map[string]any{
+				"last_run_at": now,
+				"updated_at":  now,
+			}
+
+			timing, err := TimingOf(schedule)
+			if err != nil {
+				sctx.Errorf("Command schedule %s has invalid timing, disabling: %v", schedule.ID, err)
+				updates["enabled"] = false
+				updates["last_error"] = err.Error()
+			} else if next := timing.Next(now); next.IsZero() {
+				updates["enabled"] = false // однократное расписание (или cron без будущих запусков)
+			} else {
+				updates["next_run_at"] = next
+			}
+
+			if err := tx.Model(&model.CommandSchedule{}).Where("id = ?", schedule.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+			if _, invalid := updates["last_error"]; !invalid {
+				claimed = append(claimed, *schedule)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// fireSchedule создает по расписанию батч обычных команд; результат сохраняется в last_batch_id / last_error.
+// Если создатель больше не может отправлять команду – расписание выключается
+func fireSchedule(sctx smart_context.ISmartContext, schedule *model.CommandSchedule) {
+	updates := map[string]any{"last_error": ""}
+
+	batch, err := createScheduledBatch(sctx, schedule)
+	if err != nil {
+		sctx.Errorf("Command schedule '%s' failed: %v", schedule.Name, err)
+		updates["last_error"] = err.Error()
+		if errors.Is(err, ErrScheduleOwnerNotAllowed) {
+			updates["enabled"] = false
+		}
+	} else {
+		updates["last_batch_id"] = batch.ID
+		sctx.Infof("Command schedule '%s' fired: batch %s", schedule.Name, batch.ID)
+	}
+
+	if err := sctx.GetDB().Model(&model.CommandSchedule{}).Where("id = ?", schedule.ID).Updates(updates).Error; err != nil {
+		sctx.Errorf("Error saving result of command schedule %s: %v", schedule.ID, err)
+	}
+}
+
+func createScheduledBatch(sctx smart_context.ISmartContext, schedule *model.CommandSchedule) (*model.CommandBatch, error) {
+	target, err := ScheduleTarget(schedule)
+	if err != nil {
+		return nil, err
+	}
+	// срок жизни берем из каталога на момент срабатывания
+	def, err := GetDefinition(sctx, schedule.CommandType)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkScheduleOwner(sctx, schedule, def); err != nil {
+		return nil, err
+	}
+	batch, _, err := CreateBatch(sctx, def, schedule.Params, target, schedule.UserID, def.TTL(0))
+	return batch, err
+}
+
+// checkScheduleOwner повторяет проверки отправки команды для создателя расписания с его текущей ролью:
+// право commands:send и право (или минимальная роль) самой команды
+func checkScheduleOwner(sctx smart_context.ISmartContext, schedule *model.CommandSchedule, def *CommandDefinition) error {
+	var owner model.User
+	if err := sctx.GetDB().Where("id = ?", schedule.UserID).First(&owner).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: user %s not found", ErrScheduleOwnerNotAllowed, schedule.UserID)
+		}
+		return fmt.Errorf("error finding owner of command schedule %s: %w", schedule.ID, err)
+	}
+
+	canSend, err := permissions.RoleHasPermission(sctx, owner.RoleCode, permissions.CommandsSend)
+	if err != nil {
+		return err
+	}
+	if !canSend {
+		return fmt.Errorf("%w: role '%s' has no %s", ErrScheduleOwnerNotAllowed, owner.RoleCode, permissions.CommandsSend)
+	}
+	allowed, err := def.IsRoleAllowed(sctx, owner.RoleCode)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("%w: role '%s' cannot send '%s'", ErrScheduleOwnerNotAllowed, owner.RoleCode, def.CommandType)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package command_service
+
+import (
+	"backed-api-v2/libs/2_domain_methods/device_scope"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"fmt"
+)
+
+// CheckCommandScope возвращает ErrCommandNotFound, если команды нет или ее устройство недоступно пользователю
+func CheckCommandScope(sctx smart_context.ISmartContext, scope *device_scope.Scope, commandID string) error {
+	var count int64
+	query := sctx.GetDB().Model(&model.Command{}).Where("id = ?", commandID)
+	if err := scope.FilterByDevice(sctx, query, "device_id").Count(&count).Error; err != nil {
+		return fmt.Errorf("error checking command %s: %w", commandID, err)
+	}
+	if count == 0 {
+		return ErrCommandNotFound
+	}
+	return nil
+}
+
+// CheckBatchScope возвращает ErrBatchNotFound, если батча нет или в нем есть команды устройств, недоступных пользователю:
+// решение по батчу применяется ко всем его командам, поэтому частичного доступа недостаточно
+func CheckBatchScope(sctx smart_context.ISmartContext, scope *device_scope.Scope, batchID string) error {
+	var total, inScope int64
+	if err := sctx.GetDB().Model(&model.Command{}).Where("batch_id = ?", batchID).Count(&total).Error; err != nil {
+		return fmt.Errorf("error checking command batch %s: %w", batchID, err)
+	}
+	query := sctx.GetDB().Model(&model.Command{}).Where("batch_id = ?", batchID)
+	if err := scope.FilterByDevice(sctx, query, "device_id").Count(&inScope).Error; err != nil {
+		return fmt.Errorf("error checking command batch %s: %w", batchID, err)
+	}
+	if total == 0 || inScope < total {
+		return ErrBatchNotFound
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package command_service
+
+// Статусы команд (таблица statuses, context = 'commands')
+const (
+	StatusAwaitingApproval = "AWAITING_APPROVAL" // ждет подтверждения вторым администратором
+	StatusRejected         = "REJECTED"          // администратор отклонил команду
+	StatusPending          = "PENDING"           // сохранена, ждет подключения устройства
+	StatusSent             = "SENT"              // отправлена в сокет устройства
+	StatusDelivered        = "DELIVERED"         // агент подтвердил получение
+	StatusRunning          = "RUNNING"           // агент начал выполнение
+	StatusExecuted         = "EXECUTED"          // выполнена успешно
+	StatusFailed           = "FAILED"            // агент вернул ошибку
+	StatusTimedOut         = "TIMED_OUT"         // не дождались ответа агента
+	StatusCancelled        = "CANCELLED"         // отменена оператором
+	StatusExpired          = "EXPIRED"           // истек срок жизни до подтверждения агентом
+	StatusError            = "ERROR"             // ошибка отправки на стороне сервера
+)
+
+// UndeliveredStatuses – агент еще не подтвердил получение: такие команды истекают по TTL и отправляются повторно
+var UndeliveredStatuses = []string{StatusPending, StatusSent}
+
+// ExpirableStatuses – статусы, в которых команда переходит в EXPIRED по истечении expires_at
+var ExpirableStatuses = []string{StatusAwaitingApproval, StatusPending, StatusSent}
+
+// ActiveStatuses – статусы, из которых команда еще может продвинуться дальше
+var ActiveStatuses = []string{StatusAwaitingApproval, StatusPending, StatusSent, StatusDelivered, StatusRunning}
+
+// allowedTransitions – куда можно перейти из каждого незавершенного статуса
+var allowedTransitions = map[string][]string{
+	StatusAwaitingApproval: {StatusPending, StatusRejected, StatusCancelled, StatusExpired},
+	StatusPending:          {StatusSent, StatusDelivered, StatusRunning, StatusExecuted, StatusFailed, StatusTimedOut, StatusCancelled, StatusExpired, StatusError},
+	StatusSent:             {StatusPending, StatusDelivered, StatusRunning, StatusExecuted, StatusFailed, StatusTimedOut, StatusCancelled, StatusExpired},
+	StatusDelivered:        {StatusRunning, StatusExecuted, StatusFailed, StatusTimedOut, StatusCancelled},
+	StatusRunning:          {StatusExecuted, StatusFailed, StatusTimedOut, StatusCancelled},
+}
+
+// IsFinal возвращает true, если команда уже завершена и статус больше не меняется
+func IsFinal(status string) bool {
+	_, ok := allowedTransitions[status]
+	return !ok
+}
+
+// CanTransition проверяет, допустим ли переход из статуса from в статус to
+func CanTransition(from, to string) bool {
+	for _, status := range allowedTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package command_service
+
+import "testing"
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		want bool
+	}{
+		{StatusAwaitingApproval, StatusPending, true},
+		{StatusAwaitingApproval, StatusRejected, true},
+		{StatusAwaitingApproval, StatusSent, false},
+		{StatusPending, StatusSent, true},
+		{StatusPending, StatusExecuted, true},
+		{StatusPending, StatusRejected, false},
+		{StatusSent, StatusPending, true}, // устройство отключилось – снова в очередь
+		{StatusSent, StatusDelivered, true},
+		{StatusSent, StatusError, false},
+		{StatusDelivered, StatusRunning, true},
+		{StatusDelivered, StatusSent, false},
+		{StatusDelivered, StatusExpired, false},
+		{StatusRunning, StatusExecuted, true},
+		{StatusRunning, StatusDelivered, false},
+		{StatusExecuted, StatusFailed, false},
+		{StatusCancelled, StatusPending, false},
+		{"UNKNOWN", StatusPending, false},
+	}
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestIsFinal(t *testing.T) {
+	tests := []struct {
+		status string
+		want   bool
+	}{
+		{StatusAwaitingApproval, false},
+		{StatusPending, false},
+		{StatusSent, false},
+		{StatusDelivered, false},
+		{StatusRunning, false},
+		{StatusRejected, true},
+		{StatusExecuted, true},
+		{StatusFailed, true},
+		{StatusTimedOut, true},
+		{StatusCancelled, true},
+		{StatusExpired, true},
+		{StatusError, true},
+	}
+	for _, tt := range tests {
+		if got := IsFinal(tt.status); got != tt.want {
+			t.Errorf("IsFinal(%s) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+// ActiveStatuses должны совпадать с незавершенными статусами карты переходов
+func TestActiveStatusesAreNotFinal(t *testing.T) {
+	if len(ActiveStatuses) != len(allowedTransitions) {
+		t.Errorf("ActiveStatuses has %d statuses, transition map has %d", len(ActiveStatuses), len(allowedTransitions))
+	}
+	for _, status := range ActiveStatuses {
+		if IsFinal(status) {
+			t.Errorf("active status %s is final", status)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package device_auth
+
+import (
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Статусы устройств (таблица statuses, context device)
+const (
+	StatusOnline          = "ONLINE"
+	StatusOffline         = "OFFLINE"
+	StatusPendingApproval = "PENDING_APPROVAL"
+	StatusRejected        = "REJECTED"
+)
+
+// NotApprovedStatuses – устройства в этих статусах не подключаются и не получают команды
+var NotApprovedStatuses = []string{StatusPendingApproval, StatusRejected}
+
+var (
+	ErrDeviceNotFound  = errors.New("device not found")
+	ErrPendingApproval = errors.New("device is waiting for administrator approval")
+	ErrDeviceRejected  = errors.New("device registration was rejected")
+)
+
+// DeviceNotPendingError – решение по устройству, которое не ждет подтверждения
+type DeviceNotPendingError struct {
+	Status string
+}
+
+func (e *DeviceNotPendingError) Error() string {
+	return fmt.Sprintf("device is not waiting for approval (status %s)", e.Status)
+}
+
+// CheckApproved возвращает ErrPendingApproval или ErrDeviceRejected для неподтвержденных устройств
+func CheckApproved(device *model.Device) error {
+	switch device.Status {
+	case StatusPendingApproval:
+		return ErrPendingApproval
+	case StatusRejected:
+		return ErrDeviceRejected
+	}
+	return nil
+}
+
+// ListPendingDevices возвращает очередь устройств, ожидающих подтверждения, старые первыми
+func ListPendingDevices(sctx smart_context.ISmartContext) ([]model.Device, error) {
+	devices := []model.Device{}
+	err := sctx.GetDB().Where("status = ?", StatusPendingApproval).Order("created_at").Find(&devices).Error
+	if err != nil {
+		return nil, fmt.Errorf("error loading pending devices: %w", err)
+	}
+	return devices, nil
+}
+
+// AcceptDevice подтверждает устройство (в том числе ранее отклоненное) и, если задана, переносит в группу.
+// Устройство получит статус ONLINE при следующем подключении. Устройству без секрета (зарегистрированному
+// до появления учетных данных) секрет выдается при этом подключении
+func AcceptDevice(sctx smart_context.ISmartContext, id string, groupID string) (*model.Device, error) {
+	updates := map[string]any{
+		"status":     StatusOffline,
+		"updated_at": time.Now(),
+	}
+	if groupID != "" {
+		updates["group_id"] = groupID
+	}
+	return decide(sctx, id, NotApprovedStatuses, updates)
+}
+
+// RejectDevice отклоняет устройство из очереди: его подключения будут отклоняться
+func RejectDevice(sctx smart_context.ISmartContext, id string) (*model.Device, error) {
+	updates := map[string]any{
+		"status":     StatusRejected,
+		"updated_at": time.Now(),
+	}
+	return decide(sctx, id, []string{StatusPendingApproval}, updates)
+}
+
+func decide(sctx smart_context.ISmartContext, id string, fromStatuses []string, updates map[string]any) (*model.Device, error) {
+	result := sctx.GetDB().Model(&model.Device{}).
+		Where("id = ? AND status IN ?", id, fromStatuses).
+		Updates(updates)
+	if result.Error != nil {
+		return nil, fmt.Errorf("error updating device %s: %w", id, result.Error)
+	}
+
+	var device model.Device
+	if err := sctx.GetDB().Where("id = ?", id).Limit(1).Find(&device).Error; err != nil {
+		return nil, fmt.Errorf("error loading device %s: %w", id, err)
+	}
+	if device.ID == "" {
+		return nil, ErrDeviceNotFound
+	}
+	if result.RowsAffected == 0 {
+		return nil, &DeviceNotPendingError{Status: device.Status}
+	}
+	return &device, nil
+}
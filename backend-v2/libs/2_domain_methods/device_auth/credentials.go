@@ -0,0 +1,195 @@
+package device_auth
+
+import (
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const secretBytes = 32
+
+var ErrInvalidCredentials = errors.New("invalid device credentials")
+
+// NewSecret генерирует секрет устройства. Секрет отдается устройству один раз, в БД хранится только хэш
+func NewSecret() (secret string, hash string, err error) {
+	buf := make([]byte, secretBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("error generating device secret: %w", err)
+	}
+	secret = hex.EncodeToString(buf)
+	return secret, HashSecret(secret), nil
+}
+
+// HashSecret – хэш секрета для хранения. Секрет случайный и длинный, поэтому достаточно sha256 без соли
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifySecret сравнивает секрет с хэшем за постоянное время
+func VerifySecret(hash string, secret string) bool {
+	if hash == "" || secret == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(HashSecret(secret))) == 1
+}
+
+// Authenticate находит устройство по device_identifier и проверяет его секрет.
+// Новое устройство регистрируется: с валидным enrollmentToken – сразу, иначе – в статусе PENDING_APPROVAL.
+// Новому устройству и подтвержденному устройству, зарегистрированному до появления учетных данных (см. claimLegacyDevice),
+// выдается секрет – он возвращается в issuedSecret, его нужно передать устройству. Неверный секрет – ErrInvalidCredentials.
+// Подтверждено ли устройство, проверяет CheckApproved
+func Authenticate(sctx smart_context.ISmartContext, deviceIdentifier string, secret string, enrollmentToken string) (device *model.Device, issuedSecret string, err error) {
+	device = &model.Device{}
+	err = sctx.GetDB().Where("device_identifier = ?", deviceIdentifier).First(device).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return enroll(sctx, deviceIdentifier, enrollmentToken)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error loading device %s: %w", deviceIdentifier, err)
+	}
+
+	if device.SecretHash != "" {
+		if !VerifySecret(device.SecretHash, secret) {
+			return nil, "", ErrInvalidCredentials
+		}
+		return device, "", nil
+	}
+	return claimLegacyDevice(sctx, device, enrollmentToken)
+}
+
+// claimLegacyDevice выдает секрет устройству, зарегистрированному до появления учетных данных.
+// device_identifier не секрет, поэтому секрет выдается только с разрешения администратора: по валидному токену
+// регистрации или после подтверждения устройства (AcceptDevice). Такие устройства переведены в PENDING_APPROVAL
+// миграцией, до подтверждения подключение отклоняется без выдачи секрета
+func claimLegacyDevice(sctx smart_context.ISmartContext, device *model.Device, enrollmentToken string) (*model.Device, string, error) {
+	if device.Status == StatusRejected {
+		return nil, "", ErrDeviceRejected
+	}
+	issuedSecret, hash, err := NewSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	updates := map[string]any{"secret_hash": hash, "secret_issued_at": now, "updated_at": now}
+
+	err = sctx.GetDB().Transaction(func(tx *gorm.DB) error {
+		approved := device.Status != StatusPendingApproval
+		if enrollmentToken != "" {
+			token, err := consumeEnrollmentToken(tx, enrollmentToken)
+			if err != nil {
+				return err
+			}
+			if token == nil {
+				sctx.Warnf("Device %s presented invalid, expired or exhausted enrollment token", device.DeviceIdentifier)
+			} else {
+				approved = true
+				updates["enrollment_token_id"] = token.ID
+				if device.Status == StatusPendingApproval {
+					updates["status"] = StatusOffline
+					if token.GroupID != "" && device.GroupID == "" {
+						updates["group_id"] = token.GroupID
+					}
+				}
+			}
+		}
+		if !approved {
+			return ErrPendingApproval
+		}
+
+		// условие в WHERE защищает от гонки двух подключений
+		result := tx.Model(&model.Device{}).
+			Where("id = ? AND secret_hash = '' AND status = ?", device.ID, device.Status).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidCredentials
+		}
+		return nil
+	})
+	if errors.Is(err, ErrPendingApproval) || errors.Is(err, ErrInvalidCredentials) {
+		return nil, "", err
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error issuing secret for device %s: %w", device.DeviceIdentifier, err)
+	}
+
+	device.SecretHash = hash
+	device.SecretIssuedAt = now
+	device.UpdatedAt = now
+	if status, ok := updates["status"].(string); ok {
+		device.Status = status
+	}
+	if groupID, ok := updates["group_id"].(string); ok {
+		device.GroupID = groupID
+	}
+	if tokenID, ok := updates["enrollment_token_id"].(string); ok {
+		device.EnrollmentTokenID = tokenID
+	}
+	sctx.Infof("Secret issued for existing device %s", device.DeviceIdentifier)
+	return device, issuedSecret, nil
+}
+
+// enroll создает новое устройство и выдает ему секрет. Использование токена и создание устройства – в одной транзакции,
+// чтобы неудачная регистрация не тратила использование токена
+func enroll(sctx smart_context.ISmartContext, deviceIdentifier string, enrollmentToken string) (*model.Device, string, error) {
+	issuedSecret, hash, err := NewSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	device := &model.Device{
+		DeviceIdentifier: deviceIdentifier,
+		Status:           StatusPendingApproval,
+		SecretHash:       hash,
+		SecretIssuedAt:   now,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+
+	err = sctx.GetDB().Transaction(func(tx *gorm.DB) error {
+		if enrollmentToken != "" {
+			token, err := consumeEnrollmentToken(tx, enrollmentToken)
+			if err != nil {
+				return err
+			}
+			if token == nil {
+				sctx.Warnf("Device %s presented invalid, expired or exhausted enrollment token", deviceIdentifier)
+			} else {
+				device.Status = StatusOffline
+				device.EnrollmentTokenID = token.ID
+				device.GroupID = token.GroupID
+			}
+		}
+
+		// пустая строка нарушила бы внешний ключ - такие колонки остаются NULL
+		var omit []string
+		if device.GroupID == "" {
+			omit = append(omit, "group_id")
+		}
+		if device.EnrollmentTokenID == "" {
+			omit = append(omit, "enrollment_token_id")
+		}
+		return tx.Omit(omit...).Create(device).Error
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("error registering device %s: %w", deviceIdentifier, err)
+	}
+
+	if device.Status == StatusPendingApproval {
+		sctx.Infof("Device %s registered without enrollment token, waiting for approval", deviceIdentifier)
+	} else {
+		sctx.Infof("Device %s enrolled by token %s", deviceIdentifier, device.EnrollmentTokenID)
+	}
+	return device, issuedSecret, nil
+}
@@ -0,0 +1,113 @@
+package device_auth
+
+import (
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	enrollmentTokenPrefix = "enr_"
+
+	DefaultEnrollmentTTL = 24 * time.Hour
+	MaxEnrollmentTTL     = 365 * 24 * time.Hour
+)
+
+var ErrEnrollmentTokenNotFound = errors.New("enrollment token not found")
+
+// EnrollmentTokenRequest – параметры нового токена регистрации
+type EnrollmentTokenRequest struct {
+	Description string
+	GroupID     string // пустая строка – устройство без группы
+	MaxUses     int
+	TTL         time.Duration
+	CreatedBy   string
+}
+
+// CreateEnrollmentToken создает токен регистрации устройств. Возвращает запись и сам токен – он показывается один раз
+func CreateEnrollmentToken(sctx smart_context.ISmartContext, req EnrollmentTokenRequest) (*model.EnrollmentToken, string, error) {
+	buf := make([]byte, secretBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", fmt.Errorf("error generating enrollment token: %w", err)
+	}
+	token := enrollmentTokenPrefix + hex.EncodeToString(buf)
+
+	if req.MaxUses <= 0 {
+		req.MaxUses = 1
+	}
+	if req.TTL <= 0 {
+		req.TTL = DefaultEnrollmentTTL
+	}
+	now := time.Now()
+	record := &model.EnrollmentToken{
+		TokenHash:   HashSecret(token),
+		Description: req.Description,
+		MaxUses:     int32(req.MaxUses),
+		ExpiresAt:   now.Add(min(req.TTL, MaxEnrollmentTTL)),
+		GroupID:     req.GroupID,
+		CreatedBy:   req.CreatedBy,
+		CreatedAt:   now,
+	}
+	// revoked_at остается NULL, пока токен не отозван, group_id – если группа не задана
+	omit := []string{"revoked_at"}
+	if record.GroupID == "" {
+		omit = append(omit, "group_id")
+	}
+	if err := sctx.GetDB().Omit(omit...).Create(record).Error; err != nil {
+		return nil, "", fmt.Errorf("error saving enrollment token: %w", err)
+	}
+	return record, token, nil
+}
+
+// ListEnrollmentTokens возвращает токены регистрации, новые первыми
+func ListEnrollmentTokens(sctx smart_context.ISmartContext) ([]model.EnrollmentToken, error) {
+	tokens := []model.EnrollmentToken{}
+	if err := sctx.GetDB().Order("created_at DESC").Find(&tokens).Error; err != nil {
+		return nil, fmt.Errorf("error loading enrollment tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// RevokeEnrollmentToken отзывает токен: устройства, уже зарегистрированные по нему, продолжают работать
+func RevokeEnrollmentToken(sctx smart_context.ISmartContext, id string) error {
+	result := sctx.GetDB().Model(&model.EnrollmentToken{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("error revoking enrollment token %s: %w", id, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		if err := sctx.GetDB().Model(&model.EnrollmentToken{}).Where("id = ?", id).Count(&count).Error; err != nil {
+			return fmt.Errorf("error checking enrollment token %s: %w", id, err)
+		}
+		if count == 0 {
+			return ErrEnrollmentTokenNotFound
+		}
+	}
+	return nil
+}
+
+// consumeEnrollmentToken атомарно использует токен: он должен быть не отозван, не истекший и с оставшимися использованиями.
+// Возвращает nil без ошибки, если токен не подходит
+func consumeEnrollmentToken(tx *gorm.DB, token string) (*model.EnrollmentToken, error) {
+	var consumed []model.EnrollmentToken
+	err := tx.Model(&consumed).
+		Clauses(clause.Returning{}).
+		Where("token_hash = ? AND revoked_at IS NULL AND expires_at > ? AND use_count < max_uses", HashSecret(token), time.Now()).
+		Update("use_count", gorm.Expr("use_count + 1")).Error
+	if err != nil {
+		return nil, fmt.Errorf("error consuming enrollment token: %w", err)
+	}
+	if len(consumed) == 0 {
+		return nil, nil
+	}
+	return &consumed[0], nil
+}
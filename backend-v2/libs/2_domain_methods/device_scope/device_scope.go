@@ -0,0 +1,143 @@
+package device_scope
+
+import (
+	"backed-api-v2/libs/2_domain_methods/permissions"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// ErrDeviceNotFound – устройства нет или оно вне групп пользователя. Эти случаи не различаются,
+// чтобы не раскрывать существование устройств из чужих групп
+var ErrDeviceNotFound = errors.New("device not found")
+
+// Scope – устройства, доступные пользователю: все (право devices:all_groups) или только из назначенных ему групп.
+// Устройства без группы видны только пользователям со всеми группами
+type Scope struct {
+	All      bool
+	GroupIDs []string
+}
+
+// Unrestricted – доступ ко всем устройствам (для системных операций без пользователя)
+var Unrestricted = &Scope{All: true}
+
+// ForUser возвращает доступные устройства пользователя запроса (sctx.GetUserID, sctx.GetUserRole)
+// с учетом ограничений его API ключа (sctx.GetAPIKeyScope)
+func ForUser(sctx smart_context.ISmartContext) (*Scope, error) {
+	scope, err := forRole(sctx, sctx.GetUserID(), sctx.GetUserRole())
+	if err != nil {
+		return nil, err
+	}
+	key := sctx.GetAPIKeyScope()
+	if key == nil {
+		return scope, nil
+	}
+	// ключ сужает доступ владельца: до групп ключа, а без права devices:all_groups у ключа – до групп владельца
+	if len(key.GroupIDs) > 0 {
+		if scope.All {
+			return &Scope{GroupIDs: key.GroupIDs}, nil
+		}
+		return &Scope{GroupIDs: intersect(scope.GroupIDs, key.GroupIDs)}, nil
+	}
+	if scope.All && !key.HasPermission(permissions.DevicesAllGroups) {
+		groupIDs, err := UserGroupIDs(sctx, sctx.GetUserID())
+		if err != nil {
+			return nil, err
+		}
+		return &Scope{GroupIDs: groupIDs}, nil
+	}
+	return scope, nil
+}
+
+// ForUserID возвращает доступные устройства пользователя по id (роль берется из БД), например для расписаний
+func ForUserID(sctx smart_context.ISmartContext, userID string) (*Scope, error) {
+	var user model.User
+	if err := sctx.GetDB().Where("id = ?", userID).Limit(1).Find(&user).Error; err != nil {
+		return nil, fmt.Errorf("error loading user %s: %w", userID, err)
+	}
+	if user.ID == "" {
+		return &Scope{}, nil
+	}
+	return forRole(sctx, user.ID, user.RoleCode)
+}
+
+func forRole(sctx smart_context.ISmartContext, userID string, roleCode string) (*Scope, error) {
+	all, err := permissions.RoleHasPermission(sctx, roleCode, permissions.DevicesAllGroups)
+	if err != nil {
+		return nil, err
+	}
+	if all {
+		return Unrestricted, nil
+	}
+	groupIDs, err := UserGroupIDs(sctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &Scope{GroupIDs: groupIDs}, nil
+}
+
+func intersect(values []string, allowed []string) []string {
+	result := []string{}
+	for _, value := range values {
+		if slices.Contains(allowed, value) {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// FilterDevices ограничивает запрос по устройствам: groupColumn – колонка group_id устройства (например, "d.group_id")
+func (s *Scope) FilterDevices(query *gorm.DB, groupColumn string) *gorm.DB {
+	if s.All {
+		return query
+	}
+	if len(s.GroupIDs) == 0 {
+		return query.Where("1 = 0")
+	}
+	return query.Where(groupColumn+" IN ?", s.GroupIDs)
+}
+
+// FilterByDevice ограничивает запрос по записям устройств (метрики, команды): deviceColumn – колонка id устройства
+func (s *Scope) FilterByDevice(sctx smart_context.ISmartContext, query *gorm.DB, deviceColumn string) *gorm.DB {
+	if s.All {
+		return query
+	}
+	devices := s.FilterDevices(sctx.GetDB().Model(&model.Device{}).Select("id"), "group_id")
+	return query.Where(deviceColumn+" IN (?)", devices)
+}
+
+// AllowsGroup проверяет, что группа доступна пользователю
+func (s *Scope) AllowsGroup(groupID string) bool {
+	if s.All {
+		return true
+	}
+	for _, id := range s.GroupIDs {
+		if id == groupID {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDevice возвращает устройство, если оно доступно пользователю, иначе ErrDeviceNotFound
+func (s *Scope) GetDevice(sctx smart_context.ISmartContext, deviceID string) (*model.Device, error) {
+	var device model.Device
+	query := s.FilterDevices(sctx.GetDB().Where("id = ?", deviceID), "group_id")
+	if err := query.Limit(1).Find(&device).Error; err != nil {
+		return nil, fmt.Errorf("error loading device %s: %w", deviceID, err)
+	}
+	if device.ID == "" {
+		return nil, ErrDeviceNotFound
+	}
+	return &device, nil
+}
+
+// CheckDevice возвращает ErrDeviceNotFound, если устройства нет или оно недоступно пользователю
+func (s *Scope) CheckDevice(sctx smart_context.ISmartContext, deviceID string) error {
+	_, err := s.GetDevice(sctx, deviceID)
+	return err
+}
@@ -0,0 +1,109 @@
+package device_scope
+
+import (
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+// UnknownGroupsError – в запросе есть группы, которых нет в device_groups
+type UnknownGroupsError struct {
+	GroupIDs []string
+}
+
+func (e *UnknownGroupsError) Error() string {
+	return fmt.Sprintf("device groups not found: %s", strings.Join(e.GroupIDs, ", "))
+}
+
+// UserGroupIDs возвращает группы устройств, назначенные пользователю
+func UserGroupIDs(sctx smart_context.ISmartContext, userID string) ([]string, error) {
+	groupIDs := []string{}
+	if userID == "" {
+		return groupIDs, nil
+	}
+	err := sctx.GetDB().Model(&model.UserDeviceGroup{}).
+		Where("user_id = ?", userID).
+		Order("group_id").
+		Pluck("group_id", &groupIDs).Error
+	if err != nil {
+		return nil, fmt.Errorf("error loading device groups of user %s: %w", userID, err)
+	}
+	return groupIDs, nil
+}
+
+// SetUserGroups заменяет группы устройств, назначенные пользователю. Изменения действуют со следующего запроса
+func SetUserGroups(sctx smart_context.ISmartContext, userID string, groupIDs []string) ([]string, error) {
+	groupIDs = uniqueSorted(groupIDs)
+	err := sctx.GetDB().Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&model.User{}).Where("id = ?", userID).Count(&count).Error; err != nil {
+			return fmt.Errorf("error checking user %s: %w", userID, err)
+		}
+		if count == 0 {
+			return ErrUserNotFound
+		}
+
+		var known []string
+		if err := tx.Model(&model.DeviceGroup{}).Where("id IN ?", groupIDs).Pluck("id", &known).Error; err != nil {
+			return fmt.Errorf("error checking device groups: %w", err)
+		}
+		if len(known) != len(groupIDs) {
+			return &UnknownGroupsError{GroupIDs: missing(groupIDs, known)}
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&model.UserDeviceGroup{}).Error; err != nil {
+			return fmt.Errorf("error clearing device groups of user %s: %w", userID, err)
+		}
+		if len(groupIDs) == 0 {
+			return nil
+		}
+		now := time.Now()
+		rows := make([]model.UserDeviceGroup, 0, len(groupIDs))
+		for _, groupID := range groupIDs {
+			rows = append(rows, model.UserDeviceGroup{UserID: userID, GroupID: groupID, CreatedAt: now})
+		}
+		if err := tx.Create(&rows).Error; err != nil {
+			return fmt.Errorf("error saving device groups of user %s: %w", userID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return groupIDs, nil
+}
+
+func uniqueSorted(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if value != "" && !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func missing(values []string, known []string) []string {
+	knownSet := make(map[string]bool, len(known))
+	for _, value := range known {
+		knownSet[value] = true
+	}
+	var result []string
+	for _, value := range values {
+		if !knownSet[value] {
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,103 @@
+package api_keys
+
+import (
+	"backed-api-v2/libs/2_domain_methods/audit"
+	"backed-api-v2/libs/2_domain_methods/auth_service"
+	"backed-api-v2/libs/2_domain_methods/device_scope"
+	"backed-api-v2/libs/2_domain_methods/permissions"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/types"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// APIKeyCreated – созданный API ключ. Key возвращается только в этом ответе
+type APIKeyCreated struct {
+	model.APIKey
+	Key string `json:"key"`
+}
+
+// CreateAPIKeyHandler создает API ключ: name, permissions (права ключа, не шире прав роли создателя),
+// group_ids (необязательно – ограничить устройствами групп), expires_in_seconds (необязательно, без него – бессрочный).
+// Ключ передается в заголовке X-Api-Key и действует от имени создателя
+func CreateAPIKeyHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	var request struct {
+		Name        string    `json:"name"`
+		Permissions *[]string `json:"permissions"`
+		GroupIDs    *[]string `json:"group_ids"`
+		ExpiresIn   *int64    `json:"expires_in_seconds"`
+	}
+	raw, err := json.Marshal(args)
+	if err == nil {
+		err = json.Unmarshal(raw, &request)
+	}
+	if err != nil {
+		return nil, run_processor.NewBadRequestError("invalid API key: permissions and group_ids must be arrays of strings", nil)
+	}
+	if request.Name == "" {
+		return nil, run_processor.NewRequiredFieldError("name")
+	}
+	if request.Permissions == nil || len(*request.Permissions) == 0 {
+		return nil, run_processor.NewBadRequestError("permissions must be a non-empty array of permission codes", nil)
+	}
+	req := auth_service.APIKeyRequest{Name: request.Name, Permissions: *request.Permissions}
+	if request.GroupIDs != nil {
+		req.GroupIDs = *request.GroupIDs
+	}
+	if request.ExpiresIn != nil {
+		if *request.ExpiresIn <= 0 {
+			return nil, run_processor.NewBadRequestError("expires_in_seconds must be a positive integer", nil)
+		}
+		req.TTL = time.Duration(*request.ExpiresIn) * time.Second
+	}
+
+	record, key, err := auth_service.CreateAPIKey(sctx, req)
+	if err != nil {
+		var unknownPermissionErr *permissions.UnknownPermissionError
+		var notGrantedErr *auth_service.PermissionsNotGrantedError
+		var unknownGroupsErr *device_scope.UnknownGroupsError
+		switch {
+		case errors.As(err, &unknownPermissionErr):
+			return nil, run_processor.NewBadRequestError(unknownPermissionErr.Error(), unknownPermissionErr.Codes)
+		case errors.As(err, &notGrantedErr):
+			return nil, run_processor.NewHttpError(http.StatusForbidden, notGrantedErr.Error(), notGrantedErr.Codes)
+		case errors.As(err, &unknownGroupsErr):
+			return nil, run_processor.NewBadRequestError(unknownGroupsErr.Error(), unknownGroupsErr.GroupIDs)
+		}
+		return nil, err
+	}
+	sctx.Infof("API key %s (%s) created by user %s", record.ID, record.Name, sctx.GetUserID())
+	audit.Record(sctx, audit.Event{
+		Action:     audit.ActionAPIKeyCreated,
+		TargetType: audit.TargetAPIKey,
+		TargetID:   record.ID,
+		After:      record,
+	})
+	return APIKeyCreated{APIKey: *record, Key: key}, nil
+}
+
+// GetAPIKeysHandler возвращает API ключи (без самих ключей)
+func GetAPIKeysHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	return auth_service.ListAPIKeys(sctx)
+}
+
+// RevokeAPIKeyHandler отзывает API ключ (id в пути)
+func RevokeAPIKeyHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	id, ok := args.GetStringValue("id")
+	if !ok || id == "" {
+		return nil, run_processor.NewRequiredFieldError("id")
+	}
+	if err := auth_service.RevokeAPIKey(sctx, id); err != nil {
+		if errors.Is(err, auth_service.ErrAPIKeyNotFound) {
+			return nil, run_processor.NewNotFoundError(err.Error())
+		}
+		return nil, err
+	}
+	sctx.Infof("API key %s revoked by user %s", id, sctx.GetUserID())
+	audit.Record(sctx, audit.Event{Action: audit.ActionAPIKeyRevoked, TargetType: audit.TargetAPIKey, TargetID: id})
+	return map[string]string{"status": "revoked"}, nil
+}
@@ -1,28 +1,42 @@
 package applications
 
 import (
+	"backed-api-v2/libs/2_domain_methods/handlers/devices"
+	"backed-api-v2/libs/2_domain_methods/list_query"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
 	"backed-api-v2/libs/3_generated_models/model"
 	"backed-api-v2/libs/5_common/smart_context"
 	"backed-api-v2/libs/5_common/types"
-	"fmt"
 )
 
+// applicationListSpec – фильтры, поиск и сортировка списка приложений устройства
+var applicationListSpec = &list_query.Spec{
+	Fields: map[string]list_query.Field{
+		"name":       {Column: "name", Type: list_query.String, Sortable: true},
+		"version":    {Column: "version", Type: list_query.String},
+		"app_type":   {Column: "app_type", Type: list_query.String},
+		"created_at": {Column: "created_at", Type: list_query.Time, Sortable: true},
+	},
+	Search:      []string{"name"},
+	DefaultSort: "name",
+}
+
+// GetApplicationsByDevicesIDHandler возвращает страницу приложений устройства (id в пути). Параметры списка – list_query.Parse
 func GetApplicationsByDevicesIDHandler(sctx smart_context.ISmartContext, params types.ANY_DATA) (interface{}, error) {
 	// Извлекаем параметр "id" из params
 	id, ok := params.GetStringValue("id")
 	if !ok || id == "" {
-		return nil, fmt.Errorf("missing device id")
+		return nil, run_processor.NewRequiredFieldError("id")
+	}
+	if _, err := devices.GetScopedDevice(sctx, id); err != nil {
+		return nil, err
 	}
 
-	var apps []model.Application
-	err := sctx.GetDB().
-		Table("applications").
-		Joins("JOIN device_applications ON device_applications.application_id = applications.id").
-		Where("device_applications.device_id = ?", id).
-		Find(&apps).Error
+	query, err := list_query.Parse(params, applicationListSpec)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching applications: %w", err)
+		return nil, err
 	}
-
-	return apps, nil
+	installed := sctx.GetDB().Model(&model.DeviceApplication{}).Select("application_id").Where("device_id = ?", id)
+	apps := sctx.GetDB().Model(&model.Application{}).Where("id IN (?)", installed)
+	return list_query.Find[model.Application](apps, applicationListSpec, query)
 }
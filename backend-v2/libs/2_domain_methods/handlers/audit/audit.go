@@ -0,0 +1,131 @@
+package audit
+
+import (
+	"backed-api-v2/libs/2_domain_methods/audit"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/types"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseFilter разбирает query параметры журнала аудита:
+// actor_id, action (точное или область: auth.*), target_type, target_id, request_id, from, to (RFC3339), limit, cursor
+func parseFilter(args types.ANY_DATA) (audit.Filter, error) {
+	var filter audit.Filter
+	filter.ActorID, _ = args.GetStringValue("actor_id")
+	filter.Action, _ = args.GetStringValue("action")
+	filter.TargetType, _ = args.GetStringValue("target_type")
+	filter.TargetID, _ = args.GetStringValue("target_id")
+	filter.RequestID, _ = args.GetStringValue("request_id")
+	filter.Cursor, _ = args.GetStringValue("cursor")
+
+	for _, bound := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value, _ := args.GetStringValue(bound.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, run_processor.NewBadRequestError(fmt.Sprintf("%s must be RFC3339 timestamp", bound.name), nil)
+		}
+		*bound.dst = parsed.Local()
+	}
+
+	if _, ok := args["limit"]; ok {
+		limit, _ := args.GetIntValue("limit")
+		if limit <= 0 {
+			return filter, run_processor.NewBadRequestError("limit must be a positive integer", nil)
+		}
+		filter.Limit = int(limit)
+	}
+	return filter, nil
+}
+
+// GetAuditEventsHandler возвращает журнал аудита с фильтрами (см. parseFilter) и курсорной пагинацией, новые события первыми.
+// С format=csv – выгрузка всех событий по фильтру (до audit.MaxExportLimit) в CSV файл
+func GetAuditEventsHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	filter, err := parseFilter(args)
+	if err != nil {
+		return nil, err
+	}
+
+	format, _ := args.GetStringValue("format")
+	switch format {
+	case "", "json":
+		page, err := audit.List(sctx, filter)
+		if errors.Is(err, audit.ErrInvalidCursor) {
+			return nil, run_processor.NewBadRequestError(err.Error(), nil)
+		}
+		return page, err
+	case "csv":
+		events, err := audit.Export(sctx, filter)
+		if errors.Is(err, audit.ErrInvalidCursor) {
+			return nil, run_processor.NewBadRequestError(err.Error(), nil)
+		}
+		if err != nil {
+			return nil, err
+		}
+		body, err := eventsCSV(events)
+		if err != nil {
+			return nil, err
+		}
+		return &run_processor.FileResponse{
+			ContentType: "text/csv; charset=utf-8",
+			FileName:    fmt.Sprintf("audit-%s.csv", time.Now().Format("20060102-150405")),
+			Body:        body,
+		}, nil
+	}
+	return nil, run_processor.NewBadRequestError(fmt.Sprintf("unsupported format '%s', expected json or csv", format), nil)
+}
+
+func eventsCSV(events []model.AuditEvent) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	rows := [][]string{{
+		"id", "created_at", "actor_id", "actor_name", "api_key_id", "action",
+		"target_type", "target_id", "before", "after", "request_id", "client_ip",
+	}}
+	for _, event := range events {
+		row := []string{
+			strconv.FormatInt(event.ID, 10),
+			event.CreatedAt.Format(time.RFC3339),
+			event.ActorID,
+			event.ActorName,
+			event.APIKeyID,
+			event.Action,
+			event.TargetType,
+			event.TargetID,
+			string(event.Before),
+			string(event.After),
+			event.RequestID,
+			event.ClientIP,
+		}
+		for i := range row {
+			row[i] = csvCell(row[i])
+		}
+		rows = append(rows, row)
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return nil, fmt.Errorf("error writing audit CSV: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// csvCell экранирует значение, которое табличный редактор принял бы за формулу: часть полей (например, email
+// неудачного входа) приходит от неаутентифицированных клиентов
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
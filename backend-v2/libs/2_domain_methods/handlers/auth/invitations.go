@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"backed-api-v2/libs/2_domain_methods/audit"
+	"backed-api-v2/libs/2_domain_methods/auth_service"
+	"backed-api-v2/libs/2_domain_methods/device_scope"
+	"backed-api-v2/libs/2_domain_methods/permissions"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/types"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// InvitationCreated – созданное приглашение. Code возвращается только в этом ответе
+type InvitationCreated struct {
+	model.Invitation
+	Code string `json:"code"`
+}
+
+// CreateInvitationHandler создает приглашение: email, role_code, group_ids (группы устройств нового пользователя),
+// expires_in_seconds (по умолчанию неделя). Код приглашения передается приглашенному, он регистрируется
+// через POST /api/auth/accept-invite
+func CreateInvitationHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	var request struct {
+		Email     string    `json:"email"`
+		RoleCode  string    `json:"role_code"`
+		GroupIDs  *[]string `json:"group_ids"`
+		ExpiresIn *int64    `json:"expires_in_seconds"`
+	}
+	raw, err := json.Marshal(args)
+	if err == nil {
+		err = json.Unmarshal(raw, &request)
+	}
+	if err != nil {
+		return nil, run_processor.NewBadRequestError("invalid invitation: group_ids must be an array of device group ids", nil)
+	}
+	if request.Email == "" {
+		return nil, run_processor.NewRequiredFieldError("email")
+	}
+	if request.RoleCode == "" {
+		return nil, run_processor.NewRequiredFieldError("role_code")
+	}
+	var expiresIn int64
+	if request.ExpiresIn != nil {
+		if *request.ExpiresIn <= 0 {
+			return nil, run_processor.NewBadRequestError("expires_in_seconds must be a positive integer", nil)
+		}
+		expiresIn = *request.ExpiresIn
+	}
+	var groupIDs []string
+	if request.GroupIDs != nil {
+		groupIDs = *request.GroupIDs
+	}
+
+	record, code, err := auth_service.CreateInvitation(sctx, auth_service.InvitationRequest{
+		Email:     request.Email,
+		RoleCode:  request.RoleCode,
+		GroupIDs:  groupIDs,
+		TTL:       time.Duration(expiresIn) * time.Second,
+		CreatedBy: sctx.GetUserID(),
+	})
+	if err != nil {
+		var unknownErr *device_scope.UnknownGroupsError
+		switch {
+		case errors.Is(err, permissions.ErrRoleNotFound):
+			return nil, run_processor.NewBadRequestError(err.Error(), nil)
+		case errors.As(err, &unknownErr):
+			return nil, run_processor.NewBadRequestError(unknownErr.Error(), unknownErr.GroupIDs)
+		case errors.Is(err, auth_service.ErrEmailTaken):
+			return nil, run_processor.NewConflictError(err.Error(), nil)
+		}
+		return nil, err
+	}
+	sctx.Infof("Invitation %s for %s (role %s) created by user %s, expires at %v",
+		record.ID, record.Email, record.RoleCode, sctx.GetUserID(), record.ExpiresAt)
+	audit.Record(sctx, audit.Event{
+		Action:     audit.ActionInvitationCreated,
+		TargetType: audit.TargetInvitation,
+		TargetID:   record.ID,
+		After:      record,
+	})
+	return InvitationCreated{Invitation: *record, Code: code}, nil
+}
+
+// GetInvitationsHandler возвращает приглашения (без кодов)
+func GetInvitationsHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	return auth_service.ListInvitations(sctx)
+}
+
+// RevokeInvitationHandler отзывает непринятое приглашение (id в пути)
+func RevokeInvitationHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	id, ok := args.GetStringValue("id")
+	if !ok || id == "" {
+		return nil, run_processor.NewRequiredFieldError("id")
+	}
+	if err := auth_service.RevokeInvitation(sctx, id); err != nil {
+		if errors.Is(err, auth_service.ErrInvitationNotFound) {
+			return nil, run_processor.NewNotFoundError(err.Error())
+		}
+		return nil, err
+	}
+	audit.Record(sctx, audit.Event{Action: audit.ActionInvitationRevoked, TargetType: audit.TargetInvitation, TargetID: id})
+	return map[string]string{"status": "revoked"}, nil
+}
+
+// AcceptInvitationHandler регистрирует пользователя по коду приглашения (code, username, password)
+// и сразу создает ему сессию. Email, роль и группы устройств задаются приглашением.
+// Если роль требует 2FA, вместо токенов возвращается challenge, как при входе (см. LoginHandler)
+func AcceptInvitationHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	code, ok := args.GetStringValue("code")
+	if !ok || code == "" {
+		return nil, run_processor.NewRequiredFieldError("code")
+	}
+	username, ok := args.GetStringValue("username")
+	if !ok || username == "" {
+		return nil, run_processor.NewRequiredFieldError("username")
+	}
+	password, ok := args.GetStringValue("password")
+	if !ok || password == "" {
+		return nil, run_processor.NewRequiredFieldError("password")
+	}
+
+	user, err := auth_service.AcceptInvitation(sctx, code, username, password)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth_service.ErrInvalidInvitation):
+			return nil, run_processor.NewBadRequestError(err.Error(), nil)
+		case errors.Is(err, auth_service.ErrUsernameTaken), errors.Is(err, auth_service.ErrEmailTaken):
+			return nil, run_processor.NewConflictError(err.Error(), nil)
+		}
+		return nil, err
+	}
+	sctx.Infof("User %s (%s) registered by invitation with role %s", user.ID, user.Email, user.RoleCode)
+	audit.Record(sctx, audit.Event{
+		Action:     audit.ActionInvitationAccepted,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+		After:      user,
+		ActorID:    user.ID,
+		ActorName:  user.Username,
+	})
+
+	tokens, challenge, err := auth_service.StartSession(sctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start session: %w", err)
+	}
+	if challenge != nil {
+		return challenge, nil
+	}
+	return tokens, nil
+}
@@ -1,51 +1,52 @@
 package auth
 
 import (
-	"fmt"
-	"time"
-
-	"golang.org/x/crypto/bcrypt"
-
-	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/2_domain_methods/auth_service"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
 	"backed-api-v2/libs/5_common/smart_context"
 	"backed-api-v2/libs/5_common/types"
+	"errors"
+	"math"
+	"net/http"
 )
 
-type LoginResponse struct {
-	Token string `json:"token"`
-}
-
-// LoginHandlerNew выполняет авторизацию пользователя.
-// Он извлекает email и password из args, ищет пользователя в БД,
-// сравнивает пароль (bcrypt) и генерирует JWT с данными пользователя (включая роль).
+// LoginHandler выполняет авторизацию пользователя.
+// Он извлекает email и password из args, проверяет их (auth_service.Login: bcrypt, защита от перебора)
+// и создает сессию: короткоживущий access JWT с данными пользователя (включая роль)
+// и refresh токен для POST /api/auth/refresh.
+// Неизвестный email и неверный пароль дают одинаковый ответ 401, после серии неудач вход временно блокируется – 429.
+// Если пользователю нужен второй фактор, вместо токенов возвращается challenge для POST /api/auth/2fa/verify
 func LoginHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
 	// Извлекаем email
 	email, ok := args.GetStringValue("email")
 	if !ok || email == "" {
-		return nil, fmt.Errorf("missing email")
+		return nil, run_processor.NewRequiredFieldError("email")
 	}
 	// Извлекаем пароль
 	password, ok := args.GetStringValue("password")
 	if !ok || password == "" {
-		return nil, fmt.Errorf("missing password")
+		return nil, run_processor.NewRequiredFieldError("password")
 	}
 
-	// Поиск пользователя по email
-	var user model.User
-	if err := sctx.GetDB().Where("email = ?", email).First(&user).Error; err != nil {
-		return nil, fmt.Errorf("user not found")
+	tokens, challenge, err := auth_service.Login(sctx, email, password)
+	if err != nil {
+		return nil, loginError(err)
 	}
-
-	// Сравнение введённого пароля с хэшированным паролем
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return nil, fmt.Errorf("invalid credentials")
+	if challenge != nil {
+		return challenge, nil
 	}
+	return tokens, nil
+}
 
-	// Генерация JWT с информацией о пользователе (включая роль)
-	token, err := generateJWT(user, sctx, time.Hour*72)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate token: %v", err)
+// loginError переводит ошибки входа в HTTP ответы
+func loginError(err error) error {
+	var lockedErr *auth_service.LoginLockedError
+	switch {
+	case errors.Is(err, auth_service.ErrInvalidCredentials):
+		return run_processor.NewHttpError(http.StatusUnauthorized, err.Error(), nil)
+	case errors.As(err, &lockedErr):
+		return run_processor.NewHttpError(http.StatusTooManyRequests, lockedErr.Error(),
+			map[string]int64{"retry_after_seconds": int64(math.Ceil(lockedErr.RetryAfter.Seconds()))})
 	}
-
-	return LoginResponse{Token: token}, nil
+	return err
 }
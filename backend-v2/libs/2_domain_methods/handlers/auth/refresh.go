@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"backed-api-v2/libs/2_domain_methods/auth_service"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/types"
+	"errors"
+	"net/http"
+)
+
+// RefreshHandler выдает новую пару токенов по refresh_token. Переданный refresh токен после этого недействителен
+func RefreshHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	refreshToken, ok := args.GetStringValue("refresh_token")
+	if !ok || refreshToken == "" {
+		return nil, run_processor.NewRequiredFieldError("refresh_token")
+	}
+
+	tokens, err := auth_service.Refresh(sctx, refreshToken)
+	if errors.Is(err, auth_service.ErrInvalidRefreshToken) || errors.Is(err, auth_service.ErrRefreshTokenReused) {
+		return nil, run_processor.NewHttpError(http.StatusUnauthorized, err.Error(), nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// LogoutHandler завершает сессию refresh_token: ее access токен перестает приниматься
+func LogoutHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	refreshToken, ok := args.GetStringValue("refresh_token")
+	if !ok || refreshToken == "" {
+		return nil, run_processor.NewRequiredFieldError("refresh_token")
+	}
+
+	if err := auth_service.Logout(sctx, refreshToken); err != nil {
+		return nil, err
+	}
+	return map[string]string{"status": "logged_out"}, nil
+}
@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"backed-api-v2/libs/2_domain_methods/audit"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
 	"backed-api-v2/libs/3_generated_models/model"
 	"backed-api-v2/libs/5_common/smart_context"
 	"backed-api-v2/libs/5_common/types"
@@ -10,27 +12,23 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-// RegisterResponse – структура ответа на регистрацию
-type RegisterResponse struct {
-	Token string `json:"token"`
-}
-
-// RegisterHandler регистрирует нового пользователя с назначением роли по коду приглашения.
+// RegisterHandler создает пользователя с ролью OBSERVER (доступен администраторам с правом users:manage)
+// и возвращает его. Сессия не создается: пользователь входит сам через LoginHandler (с 2FA, если ее требует роль).
+// Самостоятельная регистрация с ролью и группами устройств – по приглашению, см. AcceptInvitationHandler.
 // Используем формат входных данных через types.ANY_DATA.
 func RegisterHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
 	username, ok := args.GetStringValue("username")
 	if !ok || username == "" {
-		return nil, fmt.Errorf("missing username")
+		return nil, run_processor.NewRequiredFieldError("username")
 	}
 	email, ok := args.GetStringValue("email")
 	if !ok || email == "" {
-		return nil, fmt.Errorf("missing email")
+		return nil, run_processor.NewRequiredFieldError("email")
 	}
 	password, ok := args.GetStringValue("password")
 	if !ok || password == "" {
-		return nil, fmt.Errorf("missing password")
+		return nil, run_processor.NewRequiredFieldError("password")
 	}
-	// invitationCode, _ := args.GetStringValue("invitation_code")
 
 	// Хэширование пароля с использованием bcrypt
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -39,19 +37,8 @@ func RegisterHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (int
 		return nil, fmt.Errorf("error processing request")
 	}
 
-	// Определяем роль – по умолчанию "observer"
+	// Роль по умолчанию; другую роль задает приглашение или PUT /api/users/{id}/role
 	role := "OBSERVER"
-	// if invitationCode != "" {
-	// 	switch invitationCode {
-	// 	case "admininvite":
-	// 		role = "admin"
-	// 	case "observerplusinvite":
-	// 		role = "observer+"
-	// 	default:
-	// 		return nil, fmt.Errorf("invalid invitation code")
-	// 	}
-	// 	// Здесь можно отметить использование приглашения (например, сохранить в таблице приглашений)
-	// }
 
 	// Создаем нового пользователя
 	newUser := &model.User{
@@ -64,16 +51,19 @@ func RegisterHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (int
 	}
 
 	if err := sctx.GetDB().Create(newUser).Error; err != nil {
-		sctx.Errorf("Error creating user: %v", err)
-		return nil, fmt.Errorf("error creating user")
+		if run_processor.IsUniqueViolation(err) {
+			return nil, run_processor.NewConflictError("user with this username or email already exists", nil)
+		}
+		return nil, fmt.Errorf("error creating user: %w", err)
 	}
 
-	// Генерация JWT-токена с данными пользователя (включая роль)
-	token, err := generateJWT(*newUser, sctx, time.Hour*72)
-	if err != nil {
-		sctx.Errorf("Error generating JWT: %v", err)
-		return nil, fmt.Errorf("error generating token")
-	}
+	audit.Record(sctx, audit.Event{
+		Action:     audit.ActionUserRegistered,
+		TargetType: audit.TargetUser,
+		TargetID:   newUser.ID,
+		After:      newUser,
+	})
 
-	return RegisterResponse{Token: token}, nil
+	newUser.PasswordHash = ""
+	return newUser, nil
 }
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"backed-api-v2/libs/2_domain_methods/auth_service"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/types"
+	"errors"
+	"net/http"
+)
+
+// TwoFactorSetupHandler начинает настройку 2FA на втором шаге входа (challenge с setup_required):
+// возвращает секрет и otpauth URI, настройка подтверждается кодом через TwoFactorVerifyHandler
+func TwoFactorSetupHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	challengeToken, ok := args.GetStringValue("challenge_token")
+	if !ok || challengeToken == "" {
+		return nil, run_processor.NewRequiredFieldError("challenge_token")
+	}
+	setup, err := auth_service.SetupTwoFactorByChallenge(sctx, challengeToken)
+	if err != nil {
+		return nil, twoFactorLoginError(err)
+	}
+	return setup, nil
+}
+
+// TwoFactorVerifyHandler завершает вход по challenge_token и code (код TOTP или код восстановления)
+func TwoFactorVerifyHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	challengeToken, ok := args.GetStringValue("challenge_token")
+	if !ok || challengeToken == "" {
+		return nil, run_processor.NewRequiredFieldError("challenge_token")
+	}
+	code, ok := args.GetStringValue("code")
+	if !ok || code == "" {
+		return nil, run_processor.NewRequiredFieldError("code")
+	}
+	result, err := auth_service.VerifyTwoFactorLogin(sctx, challengeToken, code)
+	if err != nil {
+		return nil, twoFactorLoginError(err)
+	}
+	return result, nil
+}
+
+// twoFactorLoginError переводит ошибки второго шага входа в HTTP ответы
+func twoFactorLoginError(err error) error {
+	switch {
+	case errors.Is(err, auth_service.ErrInvalidChallenge), errors.Is(err, auth_service.ErrInvalidTwoFactorCode):
+		return run_processor.NewHttpError(http.StatusUnauthorized, err.Error(), nil)
+	case errors.Is(err, auth_service.ErrTwoFactorEnabled), errors.Is(err, auth_service.ErrTwoFactorSetupNotStarted):
+		return run_processor.NewConflictError(err.Error(), nil)
+	}
+	return loginError(err)
+}
@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"backed-api-v2/libs/2_domain_methods/audit"
+	"backed-api-v2/libs/2_domain_methods/command_service"
+	"backed-api-v2/libs/2_domain_methods/device_scope"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/types"
+	"errors"
+	"net/http"
+)
+
+type decideFunc func(sctx smart_context.ISmartContext, scope *device_scope.Scope, id string, approverID string, reason string) ([]model.Command, error)
+
+// scopeCheckFunc проверяет, что команда или батч относится к устройствам, доступным пользователю
+type scopeCheckFunc func(sctx smart_context.ISmartContext, scope *device_scope.Scope, id string) error
+
+// handleDecision – общая часть подтверждения/отклонения: id (команды или батча) в пути, reason в теле.
+// Решение записывается в журнал аудита действием action над объектом targetType
+func handleDecision(sctx smart_context.ISmartContext, args types.ANY_DATA, checkScope scopeCheckFunc, decide decideFunc, reasonRequired bool,
+	action string, targetType string) (interface{}, error) {
+	id, ok := args.GetStringValue("id")
+	if !ok || id == "" {
+		return nil, run_processor.NewBadRequestError("missing id", nil)
+	}
+	reason, _ := args.GetStringValue("reason")
+	if reasonRequired && reason == "" {
+		return nil, run_processor.NewRequiredFieldError("reason")
+	}
+	approverID := sctx.GetUserID()
+	if approverID == "" {
+		return nil, run_processor.NewHttpError(http.StatusUnauthorized, "user is not identified", nil)
+	}
+
+	scope, err := device_scope.ForUser(sctx)
+	if err != nil {
+		return nil, err
+	}
+	err = checkScope(sctx, scope, id)
+	var decided []model.Command
+	if err == nil {
+		decided, err = decide(sctx, scope, id, approverID, reason)
+	}
+	if err != nil {
+		var notAwaitingErr *command_service.NotAwaitingApprovalError
+		switch {
+		case errors.Is(err, command_service.ErrCommandNotFound), errors.Is(err, command_service.ErrBatchNotFound):
+			return nil, run_processor.NewNotFoundError(err.Error())
+		case errors.Is(err, command_service.ErrSelfApproval):
+			return nil, run_processor.NewForbiddenError(err.Error())
+		case errors.Is(err, command_service.ErrNothingToApprove), errors.As(err, &notAwaitingErr):
+			return nil, run_processor.NewConflictError(err.Error(), nil)
+		}
+		return nil, err
+	}
+	audit.Record(sctx, audit.Event{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   id,
+		After:      map[string]any{"reason": reason, "commands_count": len(decided)},
+	})
+	return decided, nil
+}
+
+// ApproveCommandHandler подтверждает команду, ожидающую подтверждения. Подтвердить свою команду нельзя
+func ApproveCommandHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	return handleDecision(sctx, args, command_service.CheckCommandScope, command_service.ApproveCommand, false,
+		audit.ActionCommandApproved, audit.TargetCommand)
+}
+
+// RejectCommandHandler отклоняет команду, ожидающую подтверждения. Причина обязательна
+func RejectCommandHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	return handleDecision(sctx, args, command_service.CheckCommandScope, command_service.RejectCommand, true,
+		audit.ActionCommandRejected, audit.TargetCommand)
+}
+
+// ApproveBatchHandler подтверждает все ожидающие команды батча
+func ApproveBatchHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	return handleDecision(sctx, args, command_service.CheckBatchScope, command_service.ApproveBatch, false,
+		audit.ActionBatchApproved, audit.TargetCommandBatch)
+}
+
+// RejectBatchHandler отклоняет все ожидающие команды батча. Причина обязательна
+func RejectBatchHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	return handleDecision(sctx, args, command_service.CheckBatchScope, command_service.RejectBatch, true,
+		audit.ActionBatchRejected, audit.TargetCommandBatch)
+}
@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"backed-api-v2/libs/2_domain_methods/audit"
+	"backed-api-v2/libs/2_domain_methods/command_service"
+	"backed-api-v2/libs/2_domain_methods/device_scope"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/types"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+const (
+	defaultBatchListLimit = 50
+	maxBatchListLimit     = 500
+)
+
+// SendBulkCommandHandler отправляет команду на группу устройств, список устройств или устройства по фильтру.
+// Тело: {"command": ..., "params": {...}, "group_id": ..., "device_ids": [...], "filter": {...}, "all": false}
+func SendBulkCommandHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	prepared, err := PrepareCommand(sctx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var target command_service.BatchTarget
+	raw, err := json.Marshal(args)
+	if err == nil {
+		err = json.Unmarshal(raw, &target)
+	}
+	if err != nil {
+		return nil, run_processor.NewBadRequestError("invalid batch target: "+err.Error(), nil)
+	}
+
+	batch, commands, err := command_service.CreateBatch(sctx, prepared.Definition, prepared.ParamsJSON, target, sctx.GetUserID(), prepared.TTL)
+	if err != nil {
+		if errors.Is(err, command_service.ErrEmptyBatchTarget) || errors.Is(err, command_service.ErrNoTargetDevices) {
+			return nil, run_processor.NewBadRequestError(err.Error(), nil)
+		}
+		return nil, err
+	}
+
+	counts := map[string]int{}
+	for _, cmd := range commands {
+		counts[cmd.Status]++
+	}
+	audit.Record(sctx, audit.Event{
+		Action:     audit.ActionBulkCommandSent,
+		TargetType: audit.TargetCommandBatch,
+		TargetID:   batch.ID,
+		After:      map[string]any{"command": batch.CommandType, "params": prepared.Params, "target": target, "total_count": batch.TotalCount},
+	})
+
+	return types.ANY_DATA{
+		"batch_id":    batch.ID,
+		"command":     batch.CommandType,
+		"params":      prepared.Params,
+		"total_count": batch.TotalCount,
+		"by_status":   counts,
+	}, nil
+}
+
+// GetCommandBatchesHandler возвращает последние массовые команды с агрегированными счетчиками
+func GetCommandBatchesHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	limit := defaultBatchListLimit
+	if value, ok := args.GetStringValue("limit"); ok && value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return nil, run_processor.NewBadRequestError("limit must be a positive integer", nil)
+		}
+		limit = min(parsed, maxBatchListLimit)
+	}
+	scope, err := device_scope.ForUser(sctx)
+	if err != nil {
+		return nil, err
+	}
+	return command_service.ListBatches(sctx, limit, scope)
+}
+
+// GetCommandBatchHandler возвращает прогресс массовой команды: счетчики и статус на каждом устройстве
+func GetCommandBatchHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	id, ok := args.GetStringValue("id")
+	if !ok || id == "" {
+		return nil, run_processor.NewBadRequestError("missing batch id", nil)
+	}
+
+	scope, err := device_scope.ForUser(sctx)
+	if err != nil {
+		return nil, err
+	}
+	progress, err := command_service.GetBatchProgress(sctx, id, scope)
+	if err != nil {
+		if errors.Is(err, command_service.ErrBatchNotFound) {
+			return nil, run_processor.NewNotFoundError(err.Error())
+		}
+		return nil, err
+	}
+	return progress, nil
+}
@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"backed-api-v2/libs/2_domain_methods/audit"
+	"backed-api-v2/libs/2_domain_methods/command_service"
+	"backed-api-v2/libs/2_domain_methods/device_scope"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/types"
+	"errors"
+)
+
+// CancelCommandHandler отменяет незавершенную команду (id в пути, reason в теле). Завершенную отменить нельзя – 409
+func CancelCommandHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	id, ok := args.GetStringValue("id")
+	if !ok || id == "" {
+		return nil, run_processor.NewBadRequestError("missing command id", nil)
+	}
+	reason, _ := args.GetStringValue("reason")
+
+	scope, err := device_scope.ForUser(sctx)
+	if err != nil {
+		return nil, err
+	}
+	err = command_service.CheckCommandScope(sctx, scope, id)
+	var cmd *model.Command
+	if err == nil {
+		cmd, err = command_service.Cancel(sctx, id, reason)
+	}
+	if err != nil {
+		var finishedErr *command_service.CommandFinishedError
+		switch {
+		case errors.Is(err, command_service.ErrCommandNotFound):
+			return nil, run_processor.NewNotFoundError(err.Error())
+		case errors.As(err, &finishedErr):
+			return nil, run_processor.NewConflictError(finishedErr.Error(), nil)
+		case errors.Is(err, command_service.ErrCancelConflict):
+			return nil, run_processor.NewConflictError(command_service.ErrCancelConflict.Error(), nil)
+		}
+		return nil, err
+	}
+	audit.Record(sctx, audit.Event{
+		Action:     audit.ActionCommandCancelled,
+		TargetType: audit.TargetCommand,
+		TargetID:   cmd.ID,
+		After:      map[string]string{"status": cmd.Status, "reason": reason},
+	})
+	return cmd, nil
+}
@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"backed-api-v2/libs/2_domain_methods/command_service"
+	"backed-api-v2/libs/2_domain_methods/permissions"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/types"
+)
+
+// CatalogItem – команда из каталога и признак, может ли текущий пользователь ее отправить
+type CatalogItem struct {
+	command_service.CommandDefinition
+	Allowed bool `json:"allowed"`
+}
+
+// GetCommandCatalogHandler возвращает каталог команд: описание, схему параметров, уровень опасности и минимальную роль (или право)
+func GetCommandCatalogHandler(sctx smart_context.ISmartContext, params types.ANY_DATA) (interface{}, error) {
+	defs, err := command_service.ListDefinitions(sctx)
+	if err != nil {
+		return nil, err
+	}
+
+	priorities, err := command_service.LoadRolePriorities(sctx)
+	if err != nil {
+		return nil, err
+	}
+
+	userRole := sctx.GetUserRole()
+	rolePermissions, err := permissions.RolePermissionSet(sctx, userRole)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]CatalogItem, 0, len(defs))
+	for i := range defs {
+		result = append(result, CatalogItem{
+			CommandDefinition: defs[i],
+			Allowed: defs[i].IsRoleAllowedWith(priorities, rolePermissions, userRole) &&
+				(defs[i].PermissionCode == "" || permissions.APIKeyAllows(sctx, defs[i].PermissionCode)),
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"backed-api-v2/libs/2_domain_methods/command_service"
+	"backed-api-v2/libs/2_domain_methods/device_scope"
+	"backed-api-v2/libs/2_domain_methods/handlers/devices"
+	"backed-api-v2/libs/2_domain_methods/list_query"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/types"
+	"fmt"
+	"strings"
+)
+
+// legacyHistoryParams – прежние параметры истории команд и их аналоги в list_query
+var legacyHistoryParams = map[string]string{
+	"status": "status[in]",
+	"from":   "created_at[gte]",
+	"to":     "created_at[lt]",
+}
+
+// parseHistoryFilter разбирает параметры истории команд (list_query.Parse по command_service.HistoryListSpec).
+// Прежние параметры поддерживаются: status – статусы через запятую, from и to – границы created_at
+func parseHistoryFilter(args types.ANY_DATA) (command_service.HistoryFilter, error) {
+	params := types.ANY_DATA{}
+	for key, value := range args {
+		if replacement, ok := legacyHistoryParams[key]; ok {
+			key = replacement
+			if key == "status[in]" {
+				value = strings.ToUpper(fmt.Sprint(value))
+			}
+		}
+		params[key] = value
+	}
+	query, err := list_query.Parse(params, command_service.HistoryListSpec)
+	return command_service.HistoryFilter{Query: query}, err
+}
+
+// GetCommandsHandler возвращает историю команд устройств, доступных пользователю, с фильтрами, сортировкой и курсорной пагинацией
+func GetCommandsHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	filter, err := parseHistoryFilter(args)
+	if err != nil {
+		return nil, err
+	}
+	if filter.Scope, err = device_scope.ForUser(sctx); err != nil {
+		return nil, err
+	}
+	return command_service.ListCommandHistory(sctx, filter)
+}
+
+// GetDeviceCommandsHandler возвращает историю команд устройства (id в пути), остальные фильтры – как у GetCommandsHandler
+func GetDeviceCommandsHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	id, ok := args.GetStringValue("id")
+	if !ok || id == "" {
+		return nil, run_processor.NewRequiredFieldError("id")
+	}
+
+	if _, err := devices.GetScopedDevice(sctx, id); err != nil {
+		return nil, err
+	}
+
+	filter, err := parseHistoryFilter(args)
+	if err != nil {
+		return nil, err
+	}
+	filter.DeviceID = id
+	return command_service.ListCommandHistory(sctx, filter)
+}
@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"backed-api-v2/libs/2_domain_methods/command_service"
+	"backed-api-v2/libs/2_domain_methods/permissions"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
+	"backed-api-v2/libs/5_common/json_schema"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/types"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// PreparedCommand – команда из запроса, проверенная по каталогу: тип известен, роль позволяет, параметры валидны
+type PreparedCommand struct {
+	Definition *command_service.CommandDefinition
+	Params     map[string]any // параметры с подставленными значениями по умолчанию
+	ParamsJSON datatypes.JSON
+	TTL        time.Duration // ttl_seconds из запроса или срок жизни по умолчанию из каталога
+}
+
+// PrepareCommand берет из args поля command, params и ttl_seconds и проверяет их по каталогу команд.
+// Ошибки запроса возвращаются как *run_processor.HttpError (400 / 403)
+func PrepareCommand(sctx smart_context.ISmartContext, args types.ANY_DATA) (*PreparedCommand, error) {
+	command, ok := args.GetStringValue("command")
+	if !ok || command == "" {
+		return nil, run_processor.NewBadRequestError("missing command", nil)
+	}
+
+	// Тип команды берем из каталога: он определяет право (или минимальную роль) и схему параметров
+	def, err := command_service.GetDefinition(sctx, command)
+	if err != nil {
+		var unknownErr *command_service.UnknownCommandError
+		if errors.As(err, &unknownErr) {
+			return nil, run_processor.NewBadRequestError(unknownErr.Error(), nil)
+		}
+		return nil, err
+	}
+
+	userRole := sctx.GetUserRole()
+	allowed, err := def.IsRoleAllowed(sctx, userRole)
+	if err != nil {
+		return nil, err
+	}
+	if def.PermissionCode != "" && !permissions.APIKeyAllows(sctx, def.PermissionCode) {
+		return nil, run_processor.NewForbiddenError(fmt.Sprintf("API key is not allowed to send command '%s'", command))
+	}
+	if !allowed {
+		return nil, run_processor.NewForbiddenError(fmt.Sprintf("role '%s' is not allowed to send command '%s'", userRole, command))
+	}
+
+	// Параметры команды проверяем по схеме из каталога до сохранения и отправки
+	rawParams, _ := args["params"].(map[string]any)
+	if args["params"] != nil && rawParams == nil {
+		return nil, run_processor.NewBadRequestError("params must be an object", nil)
+	}
+	params, err := def.ValidateParams(rawParams)
+	if err != nil {
+		var validationErrs json_schema.ValidationErrors
+		if errors.As(err, &validationErrs) {
+			return nil, run_processor.NewBadRequestError("invalid command params", validationErrs)
+		}
+		return nil, err
+	}
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling command params: %w", err)
+	}
+
+	var requestedTTL time.Duration
+	if _, ok := args["ttl_seconds"]; ok {
+		ttlSeconds, _ := args.GetIntValue("ttl_seconds")
+		if ttlSeconds <= 0 {
+			return nil, run_processor.NewBadRequestError("ttl_seconds must be a positive integer", nil)
+		}
+		requestedTTL = time.Duration(ttlSeconds) * time.Second
+	}
+
+	return &PreparedCommand{
+		Definition: def,
+		Params:     params,
+		ParamsJSON: datatypes.JSON(paramsJSON),
+		TTL:        def.TTL(requestedTTL),
+	}, nil
+}
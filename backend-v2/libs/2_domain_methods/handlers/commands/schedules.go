@@ -0,0 +1,354 @@
+package commands
+
+import (
+	"backed-api-v2/libs/2_domain_methods/audit"
+	"backed-api-v2/libs/2_domain_methods/command_service"
+	"backed-api-v2/libs/2_domain_methods/device_scope"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/types"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+const (
+	defaultPreviewCount = 5
+	maxPreviewCount     = 50
+)
+
+// ScheduleView – расписание с ближайшими запусками
+type ScheduleView struct {
+	model.CommandSchedule
+	NextRuns []time.Time `json:"next_runs"`
+}
+
+func newScheduleView(schedule *model.CommandSchedule, count int) ScheduleView {
+	view := ScheduleView{CommandSchedule: *schedule, NextRuns: []time.Time{}}
+	if !schedule.Enabled {
+		return view
+	}
+	if timing, err := command_service.TimingOf(schedule); err == nil {
+		view.NextRuns = timing.NextN(time.Now(), count)
+	}
+	return view
+}
+
+// scheduleError переводит ошибки расписаний в HTTP ответы
+func scheduleError(err error) error {
+	var invalidErr *command_service.InvalidScheduleError
+	switch {
+	case errors.As(err, &invalidErr):
+		return run_processor.NewBadRequestError(invalidErr.Error(), nil)
+	case errors.Is(err, command_service.ErrScheduleNotFound):
+		return run_processor.NewNotFoundError(err.Error())
+	}
+	return err
+}
+
+// parseRunAt разбирает run_at в формате RFC3339. Пустая строка – запуск не задан
+func parseRunAt(args types.ANY_DATA) (time.Time, error) {
+	value, _ := args.GetStringValue("run_at")
+	if value == "" {
+		return time.Time{}, nil
+	}
+	runAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, run_processor.NewBadRequestError("run_at must be RFC3339 timestamp", nil)
+	}
+	return runAt.Local(), nil
+}
+
+// parseScheduleTarget берет цель расписания: device_id или group_id (ровно одно) и проверяет,
+// что она существует и доступна пользователю
+func parseScheduleTarget(sctx smart_context.ISmartContext, args types.ANY_DATA) (command_service.BatchTarget, error) {
+	deviceID, _ := args.GetStringValue("device_id")
+	groupID, _ := args.GetStringValue("group_id")
+
+	var target command_service.BatchTarget
+	scope, err := device_scope.ForUser(sctx)
+	if err != nil {
+		return target, err
+	}
+	var count int64
+	switch {
+	case deviceID != "" && groupID != "":
+		return target, run_processor.NewBadRequestError("specify either device_id or group_id, not both", nil)
+	case deviceID != "":
+		target.DeviceIDs = []string{deviceID}
+		query := sctx.GetDB().Model(&model.Device{}).Where("id = ?", deviceID)
+		err = scope.FilterDevices(query, "group_id").Count(&count).Error
+	case groupID != "":
+		target.GroupID = groupID
+		if scope.AllowsGroup(groupID) {
+			err = sctx.GetDB().Model(&model.DeviceGroup{}).Where("id = ?", groupID).Count(&count).Error
+		}
+	default:
+		return target, run_processor.NewBadRequestError("device_id or group_id is required", nil)
+	}
+	if err != nil {
+		return target, fmt.Errorf("error checking schedule target: %w", err)
+	}
+	if count == 0 {
+		return target, run_processor.NewBadRequestError("schedule target not found", nil)
+	}
+	return target, nil
+}
+
+// loadSchedule возвращает расписание, если оно доступно пользователю: пользователь, ограниченный группами устройств,
+// работает только со своими расписаниями
+func loadSchedule(sctx smart_context.ISmartContext, id string) (*model.CommandSchedule, error) {
+	scope, err := device_scope.ForUser(sctx)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := command_service.GetSchedule(sctx, id)
+	if err != nil {
+		return nil, scheduleError(err)
+	}
+	if !scope.All && schedule.UserID != sctx.GetUserID() {
+		return nil, scheduleError(command_service.ErrScheduleNotFound)
+	}
+	return schedule, nil
+}
+
+// GetCommandSchedulesHandler возвращает расписания команд с ближайшими запусками
+// (пользователю, ограниченному группами устройств, – только его расписания)
+func GetCommandSchedulesHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	scope, err := device_scope.ForUser(sctx)
+	if err != nil {
+		return nil, err
+	}
+	query := sctx.GetDB()
+	if !scope.All {
+		query = query.Where("user_id = ?", sctx.GetUserID())
+	}
+
+	var schedules []model.CommandSchedule
+	if err := query.Order("created_at DESC").Find(&schedules).Error; err != nil {
+		return nil, fmt.Errorf("failed to get command schedules: %w", err)
+	}
+
+	result := make([]ScheduleView, 0, len(schedules))
+	for i := range schedules {
+		result = append(result, newScheduleView(&schedules[i], 1))
+	}
+	return result, nil
+}
+
+// GetCommandScheduleHandler возвращает расписание и его ближайшие запуски
+func GetCommandScheduleHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	id, ok := args.GetStringValue("id")
+	if !ok || id == "" {
+		return nil, run_processor.NewRequiredFieldError("id")
+	}
+	schedule, err := loadSchedule(sctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return newScheduleView(schedule, defaultPreviewCount), nil
+}
+
+// CreateCommandScheduleHandler создает расписание: команда (как в /send_command), цель (device_id или group_id)
+// и время запуска – cron_expr (в часовом поясе timezone) или однократный run_at
+func CreateCommandScheduleHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	name, ok := args.GetStringValue("name")
+	if !ok || name == "" {
+		return nil, run_processor.NewRequiredFieldError("name")
+	}
+
+	prepared, err := PrepareCommand(sctx, args)
+	if err != nil {
+		return nil, err
+	}
+	target, err := parseScheduleTarget(sctx, args)
+	if err != nil {
+		return nil, err
+	}
+	targetJSON, err := json.Marshal(target)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling schedule target: %w", err)
+	}
+	runAt, err := parseRunAt(args)
+	if err != nil {
+		return nil, err
+	}
+	cronExpr, _ := args.GetStringValue("cron_expr")
+	timezone, _ := args.GetStringValue("timezone")
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	enabled, ok := args.GetBoolValue("enabled")
+	if !ok {
+		enabled = true
+	}
+
+	schedule := &model.CommandSchedule{
+		Name:        name,
+		CommandType: prepared.Definition.CommandType,
+		Params:      prepared.ParamsJSON,
+		Target:      datatypes.JSON(targetJSON),
+		CronExpr:    cronExpr,
+		RunAt:       runAt,
+		Timezone:    timezone,
+		Enabled:     enabled,
+		UserID:      sctx.GetUserID(),
+	}
+	if err := command_service.SaveSchedule(sctx, schedule); err != nil {
+		return nil, scheduleError(err)
+	}
+	sctx.Infof("Command schedule '%s' (%s) created, next run at %v", schedule.Name, schedule.ID, schedule.NextRunAt)
+	audit.Record(sctx, audit.Event{
+		Action:     audit.ActionScheduleCreated,
+		TargetType: audit.TargetCommandSchedule,
+		TargetID:   schedule.ID,
+		After:      schedule,
+	})
+	return newScheduleView(schedule, defaultPreviewCount), nil
+}
+
+// UpdateCommandScheduleHandler изменяет переданные поля расписания и пересчитывает следующий запуск
+func UpdateCommandScheduleHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	id, ok := args.GetStringValue("id")
+	if !ok || id == "" {
+		return nil, run_processor.NewRequiredFieldError("id")
+	}
+	schedule, err := loadSchedule(sctx, id)
+	if err != nil {
+		return nil, err
+	}
+	before := *schedule
+
+	if name, ok := args.GetStringValue("name"); ok && name != "" {
+		schedule.Name = name
+	}
+
+	// команду и параметры проверяем заново целиком: новые параметры должны подходить к (возможно новой) команде
+	_, hasCommand := args["command"]
+	_, hasParams := args["params"]
+	if hasCommand || hasParams {
+		commandArgs := types.ANY_DATA{"command": schedule.CommandType, "params": args["params"]}
+		if hasCommand {
+			commandArgs["command"] = args["command"]
+		}
+		if !hasParams && len(schedule.Params) > 0 {
+			var params map[string]any
+			if err := json.Unmarshal(schedule.Params, &params); err != nil {
+				return nil, fmt.Errorf("invalid params of schedule %s: %w", schedule.ID, err)
+			}
+			commandArgs["params"] = params
+		}
+		prepared, err := PrepareCommand(sctx, commandArgs)
+		if err != nil {
+			return nil, err
+		}
+		schedule.CommandType = prepared.Definition.CommandType
+		schedule.Params = prepared.ParamsJSON
+	}
+
+	_, hasDevice := args["device_id"]
+	_, hasGroup := args["group_id"]
+	if hasDevice || hasGroup {
+		target, err := parseScheduleTarget(sctx, args)
+		if err != nil {
+			return nil, err
+		}
+		targetJSON, err := json.Marshal(target)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling schedule target: %w", err)
+		}
+		schedule.Target = datatypes.JSON(targetJSON)
+	}
+
+	// cron_expr и run_at взаимоисключающие: задание одного сбрасывает другое
+	if cronExpr, ok := args.GetStringValue("cron_expr"); ok && cronExpr != "" {
+		schedule.CronExpr = cronExpr
+		schedule.RunAt = time.Time{}
+	}
+	if _, ok := args["run_at"]; ok {
+		runAt, err := parseRunAt(args)
+		if err != nil {
+			return nil, err
+		}
+		if !runAt.IsZero() {
+			schedule.RunAt = runAt
+			schedule.CronExpr = ""
+		}
+	}
+	if timezone, ok := args.GetStringValue("timezone"); ok && timezone != "" {
+		schedule.Timezone = timezone
+	}
+	if enabled, ok := args.GetBoolValue("enabled"); ok {
+		schedule.Enabled = enabled
+	}
+
+	if err := command_service.SaveSchedule(sctx, schedule); err != nil {
+		return nil, scheduleError(err)
+	}
+	audit.Record(sctx, audit.Event{
+		Action:     audit.ActionScheduleUpdated,
+		TargetType: audit.TargetCommandSchedule,
+		TargetID:   schedule.ID,
+		Before:     before,
+		After:      schedule,
+	})
+	return newScheduleView(schedule, defaultPreviewCount), nil
+}
+
+// DeleteCommandScheduleHandler удаляет расписание. Уже созданные им команды остаются
+func DeleteCommandScheduleHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	id, ok := args.GetStringValue("id")
+	if !ok || id == "" {
+		return nil, run_processor.NewRequiredFieldError("id")
+	}
+	schedule, err := loadSchedule(sctx, id)
+	if err != nil {
+		return nil, err
+	}
+	result := sctx.GetDB().Delete(&model.CommandSchedule{}, "id = ?", id)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to delete command schedule: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, scheduleError(command_service.ErrScheduleNotFound)
+	}
+	audit.Record(sctx, audit.Event{
+		Action:     audit.ActionScheduleDeleted,
+		TargetType: audit.TargetCommandSchedule,
+		TargetID:   schedule.ID,
+		Before:     schedule,
+	})
+	return map[string]string{"status": "deleted"}, nil
+}
+
+// PreviewCommandScheduleHandler показывает ближайшие запуски для cron_expr/run_at и timezone без сохранения
+func PreviewCommandScheduleHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	cronExpr, _ := args.GetStringValue("cron_expr")
+	timezone, _ := args.GetStringValue("timezone")
+	runAt, err := parseRunAt(args)
+	if err != nil {
+		return nil, err
+	}
+
+	count := defaultPreviewCount
+	if _, ok := args["count"]; ok {
+		value, _ := args.GetIntValue("count")
+		if value <= 0 {
+			return nil, run_processor.NewBadRequestError("count must be a positive integer", nil)
+		}
+		count = min(int(value), maxPreviewCount)
+	}
+
+	timing, err := command_service.ParseTiming(cronExpr, runAt, timezone)
+	if err != nil {
+		return nil, scheduleError(err)
+	}
+	return types.ANY_DATA{
+		"recurring": timing.IsRecurring(),
+		"next_runs": timing.NextN(time.Now(), count),
+	}, nil
+}
@@ -1,6 +1,9 @@
 package device_groups
 
 import (
+	"backed-api-v2/libs/2_domain_methods/audit"
+	"backed-api-v2/libs/2_domain_methods/list_query"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
 	"backed-api-v2/libs/3_generated_models/model"
 	"backed-api-v2/libs/5_common/smart_context"
 	"backed-api-v2/libs/5_common/types"
@@ -8,57 +11,78 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// GetDeviceGroupsHandler returns all device groups.
+// groupListSpec – фильтры, поиск и сортировка списка групп устройств
+var groupListSpec = &list_query.Spec{
+	Fields: map[string]list_query.Field{
+		"name":        {Column: "name", Type: list_query.String, Sortable: true},
+		"description": {Column: "description", Type: list_query.String},
+		"created_at":  {Column: "created_at", Type: list_query.Time, Sortable: true},
+	},
+	Search:      []string{"name", "description"},
+	DefaultSort: "name",
+}
+
+// GetDeviceGroupsHandler returns a page of device groups (list parameters – list_query.Parse).
 func GetDeviceGroupsHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
-	var groups []model.DeviceGroup
-	if err := sctx.GetDB().Find(&groups).Error; err != nil {
-		return nil, fmt.Errorf("failed to get device groups: %w", err)
+	query, err := list_query.Parse(args, groupListSpec)
+	if err != nil {
+		return nil, err
 	}
-	return groups, nil
+	return list_query.Find[model.DeviceGroup](sctx.GetDB().Model(&model.DeviceGroup{}), groupListSpec, query)
 }
 
-// CreateDeviceGroupHandler creates a new device group.
-func CreateDeviceGroupHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
-	name, ok := args.GetStringValue("name")
-	if !ok || name == "" {
-		return nil, fmt.Errorf("name is required")
-	}
-	description, _ := args.GetStringValue("description")
+// CreateDeviceGroupRequest – тело POST /api/device-groups
+type CreateDeviceGroupRequest struct {
+	Name        string `json:"name" validate:"required,max=255"`
+	Description string `json:"description"`
+}
 
+// CreateDeviceGroupHandler creates a new device group.
+func CreateDeviceGroupHandler(sctx smart_context.ISmartContext, req *CreateDeviceGroupRequest) (interface{}, error) {
 	group := model.DeviceGroup{
-		Name:        name,
-		Description: description,
+		Name:        req.Name,
+		Description: req.Description,
 		CreatedAt:   time.Now(),
 	}
 
 	if err := sctx.GetDB().Create(&group).Error; err != nil {
 		return nil, fmt.Errorf("failed to create device group: %w", err)
 	}
+	audit.Record(sctx, audit.Event{
+		Action:     audit.ActionDeviceGroupCreated,
+		TargetType: audit.TargetDeviceGroup,
+		TargetID:   group.ID,
+		After:      group,
+	})
 	return group, nil
 }
 
-// UpdateDeviceGroupHandler updates an existing device group.
-func UpdateDeviceGroupHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
-	id, ok := args.GetStringValue("id")
-	if !ok || id == "" {
-		return nil, fmt.Errorf("id is required")
-	}
+// UpdateDeviceGroupRequest – тело PUT /api/device-groups. Не переданные поля не меняются
+type UpdateDeviceGroupRequest struct {
+	ID          string  `json:"id" validate:"required"`
+	Name        string  `json:"name" validate:"max=255"`
+	Description *string `json:"description"`
+}
 
+// UpdateDeviceGroupHandler updates an existing device group.
+func UpdateDeviceGroupHandler(sctx smart_context.ISmartContext, req *UpdateDeviceGroupRequest) (interface{}, error) {
 	var group model.DeviceGroup
-	if err := sctx.GetDB().Where("id = ?", id).First(&group).Error; err != nil {
+	if err := sctx.GetDB().Where("id = ?", req.ID).First(&group).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("device group not found")
+			return nil, run_processor.NewNotFoundError("device group not found")
 		}
 		return nil, fmt.Errorf("failed to find device group: %w", err)
 	}
+	before := group
 
-	if name, ok := args.GetStringValue("name"); ok && name != "" {
-		group.Name = name
+	if req.Name != "" {
+		group.Name = req.Name
 	}
-	if description, ok := args.GetStringValue("description"); ok {
-		group.Description = description
+	if req.Description != nil {
+		group.Description = *req.Description
 	}
 
 	// При необходимости можно обновить и временную метку
@@ -66,36 +90,64 @@ func UpdateDeviceGroupHandler(sctx smart_context.ISmartContext, args types.ANY_D
 	if err := sctx.GetDB().Save(&group).Error; err != nil {
 		return nil, fmt.Errorf("failed to update device group: %w", err)
 	}
+	audit.Record(sctx, audit.Event{
+		Action:     audit.ActionDeviceGroupUpdated,
+		TargetType: audit.TargetDeviceGroup,
+		TargetID:   group.ID,
+		Before:     before,
+		After:      group,
+	})
 	return group, nil
 }
 
+// DeleteDeviceGroupRequest – id группы в query (?id=) или в теле DELETE /api/device-groups
+type DeleteDeviceGroupRequest struct {
+	ID string `query:"id" json:"id" validate:"required"`
+}
+
 // DeleteDeviceGroupHandler deletes a device group by its ID.
-func DeleteDeviceGroupHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
-	id, ok := args.GetStringValue("id")
-	if !ok || id == "" {
-		return nil, fmt.Errorf("id is required")
-	}
-	if err := sctx.GetDB().Delete(&model.DeviceGroup{}, "id = ?", id).Error; err != nil {
+func DeleteDeviceGroupHandler(sctx smart_context.ISmartContext, req *DeleteDeviceGroupRequest) (interface{}, error) {
+	var deleted []model.DeviceGroup
+	if err := sctx.GetDB().Clauses(clause.Returning{}).Delete(&deleted, "id = ?", req.ID).Error; err != nil {
 		return nil, fmt.Errorf("failed to delete device group: %w", err)
 	}
+	for _, group := range deleted {
+		audit.Record(sctx, audit.Event{
+			Action:     audit.ActionDeviceGroupDeleted,
+			TargetType: audit.TargetDeviceGroup,
+			TargetID:   group.ID,
+			Before:     group,
+		})
+	}
 	return map[string]string{"status": "deleted"}, nil
 }
 
+// AssignDeviceRequest – тело POST /api/device-groups/assign
+type AssignDeviceRequest struct {
+	DeviceID string `json:"device_id" validate:"required"`
+	GroupID  string `json:"group_id" validate:"required"`
+}
+
 // AssignDeviceToGroupHandler assigns a device to a group by updating the devices table.
-func AssignDeviceToGroupHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
-	deviceId, ok := args.GetStringValue("device_id")
-	if !ok || deviceId == "" {
-		return nil, fmt.Errorf("device_id is required")
-	}
-	groupId, ok := args.GetStringValue("group_id")
-	if !ok || groupId == "" {
-		return nil, fmt.Errorf("group_id is required")
+func AssignDeviceToGroupHandler(sctx smart_context.ISmartContext, req *AssignDeviceRequest) (interface{}, error) {
+	var device model.Device
+	if err := sctx.GetDB().Where("id = ?", req.DeviceID).Limit(1).Find(&device).Error; err != nil {
+		return nil, fmt.Errorf("failed to find device: %w", err)
 	}
 	// Обновляем столбец group_id для указанного устройства
 	if err := sctx.GetDB().Model(&model.Device{}).
-		Where("id = ?", deviceId).
-		Update("group_id", groupId).Error; err != nil {
+		Where("id = ?", req.DeviceID).
+		Update("group_id", req.GroupID).Error; err != nil {
 		return nil, fmt.Errorf("failed to assign device to group: %w", err)
 	}
+	if device.ID != "" {
+		audit.Record(sctx, audit.Event{
+			Action:     audit.ActionDeviceGroupAssigned,
+			TargetType: audit.TargetDevice,
+			TargetID:   device.ID,
+			Before:     map[string]any{"group_id": device.GroupID},
+			After:      map[string]any{"group_id": req.GroupID},
+		})
+	}
 	return map[string]string{"status": "assigned"}, nil
 }
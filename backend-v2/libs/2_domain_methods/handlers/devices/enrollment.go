@@ -0,0 +1,167 @@
+package devices
+
+import (
+	"backed-api-v2/libs/2_domain_methods/audit"
+	"backed-api-v2/libs/2_domain_methods/device_auth"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/types"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// EnrollmentTokenCreated – созданный токен. Token возвращается только в этом ответе
+type EnrollmentTokenCreated struct {
+	model.EnrollmentToken
+	Token string `json:"token"`
+}
+
+// optionalPositiveInt возвращает значение параметра или 0, если он не передан. Переданное значение должно быть > 0
+func optionalPositiveInt(args types.ANY_DATA, name string) (int, error) {
+	if _, ok := args[name]; !ok {
+		return 0, nil
+	}
+	value, _ := args.GetIntValue(name)
+	if value <= 0 {
+		return 0, run_processor.NewBadRequestError(fmt.Sprintf("%s must be a positive integer", name), nil)
+	}
+	return int(value), nil
+}
+
+// checkGroupExists проверяет группу из запроса (пустая строка – без группы)
+func checkGroupExists(sctx smart_context.ISmartContext, groupID string) error {
+	if groupID == "" {
+		return nil
+	}
+	var count int64
+	if err := sctx.GetDB().Model(&model.DeviceGroup{}).Where("id = ?", groupID).Count(&count).Error; err != nil {
+		return fmt.Errorf("error checking device group %s: %w", groupID, err)
+	}
+	if count == 0 {
+		return run_processor.NewBadRequestError("device group not found", nil)
+	}
+	return nil
+}
+
+// CreateEnrollmentTokenHandler создает токен регистрации устройств: description, group_id (группа новых устройств),
+// max_uses (по умолчанию 1), expires_in_seconds (по умолчанию сутки)
+func CreateEnrollmentTokenHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	description, _ := args.GetStringValue("description")
+	groupID, _ := args.GetStringValue("group_id")
+	if err := checkGroupExists(sctx, groupID); err != nil {
+		return nil, err
+	}
+	maxUses, err := optionalPositiveInt(args, "max_uses")
+	if err != nil {
+		return nil, err
+	}
+	expiresIn, err := optionalPositiveInt(args, "expires_in_seconds")
+	if err != nil {
+		return nil, err
+	}
+
+	record, token, err := device_auth.CreateEnrollmentToken(sctx, device_auth.EnrollmentTokenRequest{
+		Description: description,
+		GroupID:     groupID,
+		MaxUses:     maxUses,
+		TTL:         time.Duration(expiresIn) * time.Second,
+		CreatedBy:   sctx.GetUserID(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	sctx.Infof("Enrollment token %s created: max uses %d, expires at %v", record.ID, record.MaxUses, record.ExpiresAt)
+	audit.Record(sctx, audit.Event{
+		Action:     audit.ActionEnrollmentTokenCreated,
+		TargetType: audit.TargetEnrollmentToken,
+		TargetID:   record.ID,
+		After:      record,
+	})
+	return EnrollmentTokenCreated{EnrollmentToken: *record, Token: token}, nil
+}
+
+// GetEnrollmentTokensHandler возвращает токены регистрации (без самих токенов)
+func GetEnrollmentTokensHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	return device_auth.ListEnrollmentTokens(sctx)
+}
+
+// RevokeEnrollmentTokenHandler отзывает токен регистрации
+func RevokeEnrollmentTokenHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	id, ok := args.GetStringValue("id")
+	if !ok || id == "" {
+		return nil, run_processor.NewRequiredFieldError("id")
+	}
+	if err := device_auth.RevokeEnrollmentToken(sctx, id); err != nil {
+		if errors.Is(err, device_auth.ErrEnrollmentTokenNotFound) {
+			return nil, run_processor.NewNotFoundError(err.Error())
+		}
+		return nil, err
+	}
+	audit.Record(sctx, audit.Event{Action: audit.ActionEnrollmentTokenRevoked, TargetType: audit.TargetEnrollmentToken, TargetID: id})
+	return map[string]string{"status": "revoked"}, nil
+}
+
+// GetPendingDevicesHandler возвращает очередь устройств, подключившихся без токена регистрации
+func GetPendingDevicesHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	return device_auth.ListPendingDevices(sctx)
+}
+
+// approvalError переводит ошибки подтверждения устройств в HTTP ответы
+func approvalError(err error) error {
+	var notPendingErr *device_auth.DeviceNotPendingError
+	switch {
+	case errors.Is(err, device_auth.ErrDeviceNotFound):
+		return run_processor.NewNotFoundError(err.Error())
+	case errors.As(err, &notPendingErr):
+		return run_processor.NewConflictError(err.Error(), nil)
+	}
+	return err
+}
+
+// AcceptDeviceHandler подтверждает устройство из очереди (id в пути), group_id в теле – группа устройства
+func AcceptDeviceHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	id, ok := args.GetStringValue("id")
+	if !ok || id == "" {
+		return nil, run_processor.NewRequiredFieldError("id")
+	}
+	groupID, _ := args.GetStringValue("group_id")
+	if err := checkGroupExists(sctx, groupID); err != nil {
+		return nil, err
+	}
+
+	device, err := device_auth.AcceptDevice(sctx, id, groupID)
+	if err != nil {
+		return nil, approvalError(err)
+	}
+	sctx.Infof("Device %s (%s) accepted by user %s", device.ID, device.DeviceIdentifier, sctx.GetUserID())
+	audit.Record(sctx, audit.Event{
+		Action:     audit.ActionDeviceAccepted,
+		TargetType: audit.TargetDevice,
+		TargetID:   device.ID,
+		After:      map[string]string{"device_identifier": device.DeviceIdentifier, "group_id": groupID},
+	})
+	return device, nil
+}
+
+// RejectDeviceHandler отклоняет устройство из очереди: его подключения будут отклоняться
+func RejectDeviceHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	id, ok := args.GetStringValue("id")
+	if !ok || id == "" {
+		return nil, run_processor.NewRequiredFieldError("id")
+	}
+
+	device, err := device_auth.RejectDevice(sctx, id)
+	if err != nil {
+		return nil, approvalError(err)
+	}
+	sctx.Infof("Device %s (%s) rejected by user %s", device.ID, device.DeviceIdentifier, sctx.GetUserID())
+	audit.Record(sctx, audit.Event{
+		Action:     audit.ActionDeviceRejected,
+		TargetType: audit.TargetDevice,
+		TargetID:   device.ID,
+		After:      map[string]string{"device_identifier": device.DeviceIdentifier},
+	})
+	return device, nil
+}
@@ -1,35 +1,64 @@
 package devices
 
 import (
+	"backed-api-v2/libs/2_domain_methods/device_scope"
+	"backed-api-v2/libs/2_domain_methods/list_query"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
 	"backed-api-v2/libs/3_generated_models/model"
 	"backed-api-v2/libs/5_common/smart_context"
 	"backed-api-v2/libs/5_common/types"
-	"fmt"
+	"errors"
 )
 
+// deviceListSpec – фильтры, поиск и сортировка списка устройств
+var deviceListSpec = &list_query.Spec{
+	Fields: map[string]list_query.Field{
+		"device_identifier": {Column: "device_identifier", Type: list_query.String, Sortable: true},
+		"description":       {Column: "description", Type: list_query.String},
+		"status":            {Column: "status", Type: list_query.String},
+		"group_id":          {Column: "group_id", Type: list_query.String},
+		"last_seen":         {Column: "last_seen", Type: list_query.Time},
+		"created_at":        {Column: "created_at", Type: list_query.Time, Sortable: true},
+		"updated_at":        {Column: "updated_at", Type: list_query.Time, Sortable: true},
+	},
+	Search:      []string{"device_identifier", "description"},
+	DefaultSort: "device_identifier",
+}
+
+// GetDevicesHandler возвращает страницу устройств, доступных пользователю (из назначенных ему групп или все).
+// Параметры списка – list_query.Parse
 func GetDevicesHandler(sctx smart_context.ISmartContext, params types.ANY_DATA) (interface{}, error) {
-	var devices []model.Device
-	err := sctx.GetDB().Find(&devices).Error
+	query, err := list_query.Parse(params, deviceListSpec)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка при сохранении состояния объекта: %w", err)
+		return nil, err
 	}
-
-	return devices, nil
+	scope, err := device_scope.ForUser(sctx)
+	if err != nil {
+		return nil, err
+	}
+	return list_query.Find[model.Device](scope.FilterDevices(sctx.GetDB().Model(&model.Device{}), "group_id"), deviceListSpec, query)
 }
 
 func GetDevicesByIDHandler(sctx smart_context.ISmartContext, params types.ANY_DATA) (interface{}, error) {
 	// Извлекаем параметр "id" из params
 	id, ok := params.GetStringValue("id")
 	if !ok || id == "" {
-		return nil, fmt.Errorf("missing device id")
+		return nil, run_processor.NewRequiredFieldError("id")
 	}
 
-	var device model.Device
-	// Ищем устройство по id
-	err := sctx.GetDB().Where("id = ?", id).First(&device).Error
+	// Ищем устройство по id среди доступных пользователю
+	return GetScopedDevice(sctx, id)
+}
+
+// GetScopedDevice возвращает устройство, доступное пользователю запроса. Недоступное устройство – 404, как и отсутствующее
+func GetScopedDevice(sctx smart_context.ISmartContext, deviceID string) (*model.Device, error) {
+	scope, err := device_scope.ForUser(sctx)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка при получении устройства: %w", err)
+		return nil, err
 	}
-
-	return device, nil
+	device, err := scope.GetDevice(sctx, deviceID)
+	if errors.Is(err, device_scope.ErrDeviceNotFound) {
+		return nil, run_processor.NewNotFoundError(err.Error())
+	}
+	return device, err
 }
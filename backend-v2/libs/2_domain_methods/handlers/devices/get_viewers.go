@@ -0,0 +1,21 @@
+package devices
+
+import (
+	"backed-api-v2/libs/2_domain_methods/run_processor"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/types"
+	"backed-api-v2/libs/5_common/ws_registry"
+)
+
+// GetDeviceViewersHandler возвращает фронтенд сессии, которые сейчас смотрят устройство (камера, микрофон, статус)
+func GetDeviceViewersHandler(sctx smart_context.ISmartContext, params types.ANY_DATA) (interface{}, error) {
+	id, ok := params.GetStringValue("id")
+	if !ok || id == "" {
+		return nil, run_processor.NewRequiredFieldError("id")
+	}
+	if _, err := GetScopedDevice(sctx, id); err != nil {
+		return nil, err
+	}
+
+	return ws_registry.ListViewers(id), nil
+}
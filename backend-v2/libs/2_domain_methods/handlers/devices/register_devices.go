@@ -38,7 +38,7 @@ func RegisterDeviceHandler(sctx smart_context.ISmartContext, params types.ANY_DA
 		UpdatedAt:        time.Now(),
 	}
 
-	err = sctx.GetDB().Create(&device).Error
+	err = sctx.GetDB().Omit("enrollment_token_id").Create(&device).Error
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при сохранении состояния объекта: %w", err)
 	}
@@ -1,6 +1,7 @@
 package geocoding
 
 import (
+	"backed-api-v2/libs/2_domain_methods/run_processor"
 	"backed-api-v2/libs/3_generated_models/model"
 	"backed-api-v2/libs/5_common/smart_context"
 	"backed-api-v2/libs/5_common/types"
@@ -21,7 +22,7 @@ var db *geoip2.Reader
 func GeoCodingHandler(sctx smart_context.ISmartContext, params types.ANY_DATA) (interface{}, error) {
 	id, ok := params.GetStringValue("id")
 	if !ok || id == "" {
-		return nil, fmt.Errorf("missing device id")
+		return nil, run_processor.NewRequiredFieldError("id")
 	}
 
 	var metric model.Metric
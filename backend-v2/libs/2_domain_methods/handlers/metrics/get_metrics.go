@@ -1,27 +1,56 @@
 package metrics
 
 import (
+	"backed-api-v2/libs/2_domain_methods/device_scope"
+	"backed-api-v2/libs/2_domain_methods/handlers/devices"
+	"backed-api-v2/libs/2_domain_methods/list_query"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
 	"backed-api-v2/libs/3_generated_models/model"
 	"backed-api-v2/libs/5_common/smart_context"
 	"backed-api-v2/libs/5_common/types"
 	"fmt"
 )
 
+// metricListSpec – фильтры, поиск и сортировка списка метрик
+var metricListSpec = &list_query.Spec{
+	Fields: map[string]list_query.Field{
+		"device_id":        {Column: "device_id", Type: list_query.String},
+		"hostname":         {Column: "hostname", Type: list_query.String},
+		"public_ip":        {Column: "public_ip", Type: list_query.String},
+		"os_info":          {Column: "os_info", Type: list_query.String},
+		"disk_free":        {Column: "disk_free", Type: list_query.Number},
+		"disk_used":        {Column: "disk_used", Type: list_query.Number},
+		"memory_available": {Column: "memory_available", Type: list_query.Number},
+		"memory_used":      {Column: "memory_used", Type: list_query.Number},
+		"process_count":    {Column: "process_count", Type: list_query.Number},
+		"created_at":       {Column: "created_at", Type: list_query.Time, Sortable: true},
+	},
+	Search:      []string{"hostname", "public_ip", "os_info"},
+	DefaultSort: "-created_at",
+}
+
+// GetMetricsHandler возвращает страницу метрик устройств, доступных пользователю, новые первыми.
+// Параметры списка – list_query.Parse
 func GetMetricsHandler(sctx smart_context.ISmartContext, params types.ANY_DATA) (interface{}, error) {
-	var metrics []model.Metric
-	err := sctx.GetDB().Find(&metrics).Error
+	query, err := list_query.Parse(params, metricListSpec)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка при сохранении состояния объекта: %w", err)
+		return nil, err
 	}
-
-	return metrics, nil
+	scope, err := device_scope.ForUser(sctx)
+	if err != nil {
+		return nil, err
+	}
+	return list_query.Find[model.Metric](scope.FilterByDevice(sctx, sctx.GetDB().Model(&model.Metric{}), "device_id"), metricListSpec, query)
 }
 
 func GetMetricsByDeviceIDHandler(sctx smart_context.ISmartContext, params types.ANY_DATA) (interface{}, error) {
 	// Извлекаем параметр "id" из params
 	id, ok := params.GetStringValue("id")
 	if !ok || id == "" {
-		return nil, fmt.Errorf("missing device id")
+		return nil, run_processor.NewRequiredFieldError("id")
+	}
+	if _, err := devices.GetScopedDevice(sctx, id); err != nil {
+		return nil, err
 	}
 
 	var metric model.Metric
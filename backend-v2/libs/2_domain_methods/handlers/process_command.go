@@ -1,14 +1,15 @@
 package handlers
 
 import (
+	"backed-api-v2/libs/2_domain_methods/audit"
+	"backed-api-v2/libs/2_domain_methods/command_service"
+	"backed-api-v2/libs/2_domain_methods/handlers/commands"
+	"backed-api-v2/libs/2_domain_methods/handlers/devices"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
 	"backed-api-v2/libs/3_generated_models/model"
 	"backed-api-v2/libs/5_common/smart_context"
 	"backed-api-v2/libs/5_common/types"
-	"backed-api-v2/libs/5_common/ws_registry"
 	"fmt"
-	"time"
-
-	"github.com/gorilla/websocket"
 )
 
 func SendCommandHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
@@ -17,52 +18,53 @@ func SendCommandHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (
 	// Извлекаем device identifier из args
 	deviceId, ok := args.GetStringValue("device_id")
 	if !ok || deviceId == "" {
-		return nil, fmt.Errorf("missing device identifier")
+		return nil, run_processor.NewRequiredFieldError("device_id")
 	}
-
-	// Извлекаем команду, которую нужно отправить
-	command, ok := args.GetStringValue("command")
-	if !ok || command == "" {
-		return nil, fmt.Errorf("missing command")
+	// Команду можно отправить только устройству из доступных пользователю групп
+	if _, err := devices.GetScopedDevice(sctx, deviceId); err != nil {
+		return nil, err
 	}
 
-	// Сохраним команду в БД со статусом "pending"
-	cmdRecord := &model.Command{
-		DeviceID:    deviceId,
-		CommandType: command,
-		UserID:      "a7c4265d-545c-404f-a1ef-daf4af2dfb12", // или другой способ идентификации инициатора TODO: После подготовки пользователей, сюда надо будет вставить его
-		Status:      "PENDING",
-		CreatedAt:   time.Now(),
+	// Команда и параметры проверяются по каталогу: тип, минимальная роль, схема параметров
+	prepared, err := commands.PrepareCommand(sctx, args)
+	if err != nil {
+		return nil, err
 	}
+	command := prepared.Definition.CommandType
 
-	if err := sctx.GetDB().Create(cmdRecord).Error; err != nil {
+	// Сохраним команду в БД со статусом "pending" (или "awaiting approval", если команда требует подтверждения)
+	cmdRecord := command_service.NewCommand(sctx, prepared.Definition, deviceId, prepared.ParamsJSON, sctx.GetUserID(), prepared.TTL)
+	if err := sctx.GetDB().Omit("batch_id", "approver_id").Create(cmdRecord).Error; err != nil {
 		return nil, fmt.Errorf("error saving command to db: %w", err)
 	}
-	sctx.Infof("Command saved with ID: %s", cmdRecord.ID)
-
-	// Находим соединение для этого устройства из глобального реестра WebSocket-соединений.
-	conn, ok := ws_registry.GetClient(deviceId)
-	if !ok {
-		sctx.Infof("Client with device '%s' not found, command stored for later execution", deviceId)
-		return map[string]any{"status": "PENDING"}, nil
-	}
+	sctx.Infof("Command saved with ID: %s, status %s", cmdRecord.ID, cmdRecord.Status)
+	audit.Record(sctx, audit.Event{
+		Action:     audit.ActionCommandSent,
+		TargetType: audit.TargetCommand,
+		TargetID:   cmdRecord.ID,
+		After:      map[string]any{"device_id": deviceId, "command": command, "params": prepared.Params, "status": cmdRecord.Status},
+	})
 
-	// Отправляем команду по WebSocket
-	if err := conn.WriteMessage(websocket.TextMessage, []byte(command)); err != nil {
-		sctx.GetDB().Model(cmdRecord).Update("status", "ERROR")
-		return nil, fmt.Errorf("error sending command: %w", err)
+	if cmdRecord.Status == command_service.StatusAwaitingApproval {
+		// Опасные команды уходят на устройство только после подтверждения вторым администратором
+		command_service.NotifyApprovalRequested(sctx, []model.Command{*cmdRecord}, "")
+	} else {
+		// Отправляем команду по WebSocket, если устройство подключено. Иначе она останется PENDING и уйдет при переподключении
+		delivered, err := command_service.DeliverIfConnected(sctx, cmdRecord)
+		if err != nil {
+			sctx.Warnf("Command %s not delivered, stored for later execution: %v", cmdRecord.ID, err)
+		} else if !delivered {
+			sctx.Infof("Client with device '%s' not found, command stored for later execution", deviceId)
+		}
 	}
 
-	sctx.Infof("Command '%s' sent to device '%s'", command, deviceId)
-	sctx.GetDB().Model(cmdRecord).Updates(map[string]any{
-		"status":      "SENT",
-		"executed_at": time.Now(),
-	})
-
 	resp := types.ANY_DATA{
-		"status":  "success",
-		"device":  deviceId,
-		"command": command,
+		"status":     cmdRecord.Status,
+		"command_id": cmdRecord.ID,
+		"device":     deviceId,
+		"command":    command,
+		"params":     prepared.Params,
+		"expires_at": cmdRecord.ExpiresAt,
 	}
 
 	return resp, nil
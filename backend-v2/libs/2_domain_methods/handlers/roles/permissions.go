@@ -0,0 +1,113 @@
+package roles
+
+import (
+	"backed-api-v2/libs/2_domain_methods/audit"
+	"backed-api-v2/libs/2_domain_methods/auth_service"
+	"backed-api-v2/libs/2_domain_methods/permissions"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/types"
+	"encoding/json"
+	"errors"
+	"slices"
+)
+
+// RolePermissions – права роли
+type RolePermissions struct {
+	RoleCode    string   `json:"role_code"`
+	Permissions []string `json:"permissions"`
+}
+
+// GetPermissionsHandler возвращает все права с описаниями
+func GetPermissionsHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	return permissions.ListPermissions(sctx)
+}
+
+// GetRolePermissionsHandler возвращает права роли (code в пути)
+func GetRolePermissionsHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	code, ok := args.GetStringValue("code")
+	if !ok || code == "" {
+		return nil, run_processor.NewRequiredFieldError("code")
+	}
+	codes, err := permissions.GetRolePermissions(sctx, code)
+	if err != nil {
+		return nil, permissionsError(err)
+	}
+	return RolePermissions{RoleCode: code, Permissions: codes}, nil
+}
+
+// SetRolePermissionsHandler заменяет права роли (code в пути) на список из тела: {"permissions": [...]}.
+// Своей роли нельзя убрать право roles:manage – иначе управлять правами станет некому
+func SetRolePermissionsHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	code, ok := args.GetStringValue("code")
+	if !ok || code == "" {
+		return nil, run_processor.NewRequiredFieldError("code")
+	}
+	var request struct {
+		Permissions *[]string `json:"permissions"`
+	}
+	raw, err := json.Marshal(args)
+	if err == nil {
+		err = json.Unmarshal(raw, &request)
+	}
+	if err != nil || request.Permissions == nil {
+		return nil, run_processor.NewBadRequestError("permissions must be an array of permission codes", nil)
+	}
+	if code == sctx.GetUserRole() && !slices.Contains(*request.Permissions, permissions.RolesManage) {
+		return nil, run_processor.NewConflictError("cannot remove "+permissions.RolesManage+" from your own role", nil)
+	}
+
+	previousCodes, err := permissions.GetRolePermissions(sctx, code)
+	if err != nil {
+		return nil, permissionsError(err)
+	}
+	codes, err := permissions.SetRolePermissions(sctx, code, *request.Permissions)
+	if err != nil {
+		return nil, permissionsError(err)
+	}
+	sctx.Infof("Permissions of role %s set to %v by user %s", code, codes, sctx.GetUserID())
+	audit.Record(sctx, audit.Event{
+		Action:     audit.ActionRolePermissionsChanged,
+		TargetType: audit.TargetRole,
+		TargetID:   code,
+		Before:     previousCodes,
+		After:      codes,
+	})
+	return RolePermissions{RoleCode: code, Permissions: codes}, nil
+}
+
+// SetRoleTwoFactorHandler включает или выключает требование 2FA для роли (code в пути): {"required": true}.
+// Пользователи роли без 2FA настроят ее при следующем входе
+func SetRoleTwoFactorHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	code, ok := args.GetStringValue("code")
+	if !ok || code == "" {
+		return nil, run_processor.NewRequiredFieldError("code")
+	}
+	required, ok := args.GetBoolValue("required")
+	if !ok {
+		return nil, run_processor.NewBadRequestError("required must be a boolean", nil)
+	}
+	if err := auth_service.SetRoleTwoFactorRequired(sctx, code, required); err != nil {
+		return nil, permissionsError(err)
+	}
+	sctx.Infof("Two-factor requirement of role %s set to %v by user %s", code, required, sctx.GetUserID())
+	audit.Record(sctx, audit.Event{
+		Action:     audit.ActionRoleTwoFactorChanged,
+		TargetType: audit.TargetRole,
+		TargetID:   code,
+		After:      map[string]bool{"require_two_factor": required},
+	})
+	return map[string]any{"role_code": code, "require_two_factor": required}, nil
+}
+
+// permissionsError переводит ошибки прав в HTTP ответы
+func permissionsError(err error) error {
+	var unknownErr *permissions.UnknownPermissionError
+	switch {
+	case errors.Is(err, permissions.ErrRoleNotFound):
+		return run_processor.NewNotFoundError(err.Error())
+	case errors.As(err, &unknownErr):
+		return run_processor.NewBadRequestError(unknownErr.Error(), unknownErr.Codes)
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+package users
+
+import (
+	"backed-api-v2/libs/2_domain_methods/audit"
+	"backed-api-v2/libs/2_domain_methods/device_scope"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/types"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// UserDeviceGroups – группы устройств, назначенные пользователю
+type UserDeviceGroups struct {
+	UserID   string   `json:"user_id"`
+	GroupIDs []string `json:"group_ids"`
+}
+
+// GetUserDeviceGroupsHandler возвращает группы устройств, назначенные пользователю (id в пути)
+func GetUserDeviceGroupsHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	id, ok := args.GetStringValue("id")
+	if !ok || id == "" {
+		return nil, run_processor.NewRequiredFieldError("id")
+	}
+	var count int64
+	if err := sctx.GetDB().Model(&model.User{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if count == 0 {
+		return nil, run_processor.NewNotFoundError("user not found")
+	}
+
+	groupIDs, err := device_scope.UserGroupIDs(sctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return UserDeviceGroups{UserID: id, GroupIDs: groupIDs}, nil
+}
+
+// SetUserDeviceGroupsHandler заменяет группы устройств пользователя (id в пути) на список из тела: {"group_ids": [...]}.
+// Пользователь без права devices:all_groups видит только устройства этих групп
+func SetUserDeviceGroupsHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	id, ok := args.GetStringValue("id")
+	if !ok || id == "" {
+		return nil, run_processor.NewRequiredFieldError("id")
+	}
+	var request struct {
+		GroupIDs *[]string `json:"group_ids"`
+	}
+	raw, err := json.Marshal(args)
+	if err == nil {
+		err = json.Unmarshal(raw, &request)
+	}
+	if err != nil || request.GroupIDs == nil {
+		return nil, run_processor.NewBadRequestError("group_ids must be an array of device group ids", nil)
+	}
+
+	previousGroupIDs, err := device_scope.UserGroupIDs(sctx, id)
+	if err != nil {
+		return nil, err
+	}
+	groupIDs, err := device_scope.SetUserGroups(sctx, id, *request.GroupIDs)
+	if err != nil {
+		var unknownErr *device_scope.UnknownGroupsError
+		switch {
+		case errors.Is(err, device_scope.ErrUserNotFound):
+			return nil, run_processor.NewNotFoundError(err.Error())
+		case errors.As(err, &unknownErr):
+			return nil, run_processor.NewBadRequestError(unknownErr.Error(), unknownErr.GroupIDs)
+		}
+		return nil, err
+	}
+	sctx.Infof("Device groups of user %s set to %v by user %s", id, groupIDs, sctx.GetUserID())
+	audit.Record(sctx, audit.Event{
+		Action:     audit.ActionUserGroupsChanged,
+		TargetType: audit.TargetUser,
+		TargetID:   id,
+		Before:     previousGroupIDs,
+		After:      groupIDs,
+	})
+	return UserDeviceGroups{UserID: id, GroupIDs: groupIDs}, nil
+}
@@ -1,34 +1,58 @@
 package users
 
 import (
+	"backed-api-v2/libs/2_domain_methods/audit"
+	"backed-api-v2/libs/2_domain_methods/auth_service"
+	"backed-api-v2/libs/2_domain_methods/list_query"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
 	"backed-api-v2/libs/3_generated_models/model"
 	"backed-api-v2/libs/5_common/smart_context"
 	"backed-api-v2/libs/5_common/types"
+	"errors"
 	"fmt"
+	"net/http"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
+// userListSpec – фильтры, поиск и сортировка списка пользователей
+var userListSpec = &list_query.Spec{
+	Fields: map[string]list_query.Field{
+		"username":   {Column: "username", Type: list_query.String, Sortable: true},
+		"email":      {Column: "email", Type: list_query.String, Sortable: true},
+		"role_code":  {Column: "role_code", Type: list_query.String},
+		"created_at": {Column: "created_at", Type: list_query.Time, Sortable: true},
+		"updated_at": {Column: "updated_at", Type: list_query.Time, Sortable: true},
+	},
+	Search:      []string{"username", "email"},
+	DefaultSort: "username",
+}
+
+// GetUsersHandler возвращает страницу пользователей без хэшей паролей. Параметры списка – list_query.Parse
 func GetUsersHandler(sctx smart_context.ISmartContext, params types.ANY_DATA) (interface{}, error) {
-	var users []model.User
-	err := sctx.GetDB().Find(&users).Error
+	query, err := list_query.Parse(params, userListSpec)
+	if err != nil {
+		return nil, err
+	}
+	page, err := list_query.Find[model.User](sctx.GetDB().Model(&model.User{}), userListSpec, query)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка при сохранении состояния объекта: %w", err)
+		return nil, err
 	}
 
-	for _, user := range users {
-		user.PasswordHash = ""
+	for i := range page.Items {
+		page.Items[i].PasswordHash = ""
 	}
 
-	return users, nil
+	return page, nil
 }
 
 func GetUserByIDHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
 
 	userId, ok := args.GetStringValue("user_id")
 	if !ok || userId == "" {
-		return nil, fmt.Errorf("user_id is missing")
+		return nil, run_processor.NewRequiredFieldError("user_id")
 	}
 
 	var user model.User
@@ -40,60 +64,97 @@ func GetUserByIDHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (
 	return user, nil
 }
 
+// GetProfileHandler возвращает профиль текущего (аутентифицированного) пользователя
 func GetProfileHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
-	// Извлекаем user_id из ANY_DATA
-	userId, ok := args.GetStringValue("user_id")
-	if !ok || userId == "" {
-		return nil, fmt.Errorf("user_id is missing")
-	}
-
-	var user model.User
-	if err := sctx.GetDB().Where("id = ?", userId).First(&user).Error; err != nil {
-		return nil, fmt.Errorf("failed to get user: %w", err)
+	user, err := loadCurrentUser(sctx)
+	if err != nil {
+		return nil, err
 	}
 	// Не передаём хэш пароля в ответе
 	user.PasswordHash = ""
 	return user, nil
 }
 
-// UpdateProfileHandler позволяет изменить данные профиля текущего пользователя.
-// Можно обновлять поля username, email и, при необходимости, пароль.
-func UpdateProfileHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
-	userId, ok := args.GetStringValue("user_id")
-	if !ok || userId == "" {
-		return nil, fmt.Errorf("user_id is missing")
+// loadCurrentUser загружает пользователя из токена запроса. id из параметров запроса не принимается
+func loadCurrentUser(sctx smart_context.ISmartContext) (*model.User, error) {
+	userId := sctx.GetUserID()
+	if userId == "" {
+		return nil, run_processor.NewHttpError(http.StatusUnauthorized, "user is not identified", nil)
 	}
 
 	var user model.User
 	if err := sctx.GetDB().Where("id = ?", userId).First(&user).Error; err != nil {
-		return nil, fmt.Errorf("failed to find user: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, run_processor.NewNotFoundError("user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
+	return &user, nil
+}
+
+// UpdateProfileRequest – тело PUT /api/profile. Пустые поля не меняются
+type UpdateProfileRequest struct {
+	Username string `json:"username" validate:"max=100"`
+	Email    string `json:"email" validate:"email"`
+	Password string `json:"password"`
+}
+
+// UpdateProfileHandler позволяет изменить данные профиля текущего пользователя (из токена).
+// Можно обновлять поля username, email и, при необходимости, пароль.
+// После смены пароля все сессии пользователя, включая текущую, отзываются – нужно войти заново.
+func UpdateProfileHandler(sctx smart_context.ISmartContext, req *UpdateProfileRequest) (interface{}, error) {
+	user, err := loadCurrentUser(sctx)
+	if err != nil {
+		return nil, err
+	}
+
+	before := map[string]any{"username": user.Username, "email": user.Email}
 
 	// Обновляем username, если передан
-	if username, ok := args.GetStringValue("username"); ok && username != "" {
-		user.Username = username
+	if req.Username != "" {
+		user.Username = req.Username
 	}
 
 	// Обновляем email, если передан
-	if email, ok := args.GetStringValue("email"); ok && email != "" {
-		user.Email = email
+	if req.Email != "" {
+		user.Email = req.Email
 	}
 
 	// Если передан новый пароль – хэшируем его
-	if password, ok := args.GetStringValue("password"); ok && password != "" {
-		hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	passwordChanged := false
+	if req.Password != "" {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		if err != nil {
 			return nil, fmt.Errorf("failed to hash password: %w", err)
 		}
 		user.PasswordHash = string(hashed)
+		passwordChanged = true
 	}
 
 	user.UpdatedAt = time.Now()
 
-	if err := sctx.GetDB().Save(&user).Error; err != nil {
+	if err := sctx.GetDB().Save(user).Error; err != nil {
 		return nil, fmt.Errorf("failed to update user: %w", err)
 	}
 
+	if passwordChanged {
+		if _, err := auth_service.RevokeUserSessions(sctx, user.ID, auth_service.RevokeReasonPasswordChanged); err != nil {
+			return nil, err
+		}
+	}
+
+	after := map[string]any{"username": user.Username, "email": user.Email}
+	if passwordChanged {
+		after["password_changed"] = true
+	}
+	audit.Record(sctx, audit.Event{
+		Action:     audit.ActionUserUpdated,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+		Before:     before,
+		After:      after,
+	})
+
 	// Очищаем поле пароля для ответа
 	user.PasswordHash = ""
 	return user, nil
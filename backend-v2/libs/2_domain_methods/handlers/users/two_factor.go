@@ -0,0 +1,129 @@
+package users
+
+import (
+	"backed-api-v2/libs/2_domain_methods/audit"
+	"backed-api-v2/libs/2_domain_methods/auth_service"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/types"
+	"errors"
+	"math"
+	"net/http"
+)
+
+// RecoveryCodes – новые коды восстановления, показываются один раз
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// GetTwoFactorStatusHandler возвращает состояние 2FA текущего пользователя
+func GetTwoFactorStatusHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	user, err := loadCurrentUser(sctx)
+	if err != nil {
+		return nil, err
+	}
+	return auth_service.GetTwoFactorStatus(sctx, user)
+}
+
+// BeginTwoFactorSetupHandler создает секрет TOTP текущего пользователя: secret и otpauth_uri для приложения.
+// 2FA включается после подтверждения кодом (EnableTwoFactorHandler)
+func BeginTwoFactorSetupHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	user, err := loadCurrentUser(sctx)
+	if err != nil {
+		return nil, err
+	}
+	setup, err := auth_service.BeginTwoFactorSetup(sctx, user)
+	if err != nil {
+		return nil, twoFactorError(err)
+	}
+	return setup, nil
+}
+
+// EnableTwoFactorHandler включает 2FA по коду из приложения (code) и возвращает коды восстановления
+func EnableTwoFactorHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	user, code, err := userAndCode(sctx, args)
+	if err != nil {
+		return nil, err
+	}
+	codes, err := auth_service.EnableTwoFactor(sctx, user, code)
+	if err != nil {
+		return nil, twoFactorError(err)
+	}
+	audit.Record(sctx, audit.Event{Action: audit.ActionTwoFactorEnabled, TargetType: audit.TargetUser, TargetID: user.ID})
+	return RecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+// DisableTwoFactorHandler отключает 2FA текущего пользователя по коду TOTP или коду восстановления (code)
+func DisableTwoFactorHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	user, code, err := userAndCode(sctx, args)
+	if err != nil {
+		return nil, err
+	}
+	if err := auth_service.DisableTwoFactor(sctx, user, code); err != nil {
+		return nil, twoFactorError(err)
+	}
+	audit.Record(sctx, audit.Event{Action: audit.ActionTwoFactorDisabled, TargetType: audit.TargetUser, TargetID: user.ID})
+	return map[string]string{"status": "disabled"}, nil
+}
+
+// RegenerateRecoveryCodesHandler заменяет коды восстановления текущего пользователя по действующему коду (code)
+func RegenerateRecoveryCodesHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	user, code, err := userAndCode(sctx, args)
+	if err != nil {
+		return nil, err
+	}
+	codes, err := auth_service.RegenerateRecoveryCodes(sctx, user, code)
+	if err != nil {
+		return nil, twoFactorError(err)
+	}
+	audit.Record(sctx, audit.Event{Action: audit.ActionRecoveryCodesRegenerated, TargetType: audit.TargetUser, TargetID: user.ID})
+	return RecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+// ResetUserTwoFactorHandler сбрасывает 2FA пользователя (id в пути), например при потере устройства
+func ResetUserTwoFactorHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	id, ok := args.GetStringValue("id")
+	if !ok || id == "" {
+		return nil, run_processor.NewRequiredFieldError("id")
+	}
+	if err := auth_service.ResetTwoFactor(sctx, id); err != nil {
+		if errors.Is(err, auth_service.ErrUserNotFound) {
+			return nil, run_processor.NewNotFoundError(err.Error())
+		}
+		return nil, err
+	}
+	sctx.Infof("Two-factor authentication of user %s reset by user %s", id, sctx.GetUserID())
+	audit.Record(sctx, audit.Event{Action: audit.ActionTwoFactorReset, TargetType: audit.TargetUser, TargetID: id})
+	return map[string]string{"status": "reset"}, nil
+}
+
+func userAndCode(sctx smart_context.ISmartContext, args types.ANY_DATA) (*model.User, string, error) {
+	code, ok := args.GetStringValue("code")
+	if !ok || code == "" {
+		return nil, "", run_processor.NewRequiredFieldError("code")
+	}
+	user, err := loadCurrentUser(sctx)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, code, nil
+}
+
+// twoFactorError переводит ошибки 2FA в HTTP ответы
+func twoFactorError(err error) error {
+	var lockedErr *auth_service.LoginLockedError
+	switch {
+	case errors.Is(err, auth_service.ErrInvalidTwoFactorCode):
+		return run_processor.NewBadRequestError(err.Error(), nil)
+	case errors.As(err, &lockedErr):
+		return run_processor.NewHttpError(http.StatusTooManyRequests, lockedErr.Error(),
+			map[string]int64{"retry_after_seconds": int64(math.Ceil(lockedErr.RetryAfter.Seconds()))})
+	case errors.Is(err, auth_service.ErrTwoFactorEnabled),
+		errors.Is(err, auth_service.ErrTwoFactorNotEnabled),
+		errors.Is(err, auth_service.ErrTwoFactorSetupNotStarted),
+		errors.Is(err, auth_service.ErrTwoFactorRequired):
+		return run_processor.NewConflictError(err.Error(), nil)
+	}
+	return err
+}
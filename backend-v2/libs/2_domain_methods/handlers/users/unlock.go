@@ -0,0 +1,43 @@
+package users
+
+import (
+	"backed-api-v2/libs/2_domain_methods/audit"
+	"backed-api-v2/libs/2_domain_methods/auth_service"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/types"
+	"errors"
+)
+
+const defaultLockoutsLimit = 100
+
+// UnlockUserHandler снимает блокировку входа пользователя (id в пути) после серии неудачных попыток.
+// Блокировки по IP снимаются только по истечении срока
+func UnlockUserHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	id, ok := args.GetStringValue("id")
+	if !ok || id == "" {
+		return nil, run_processor.NewRequiredFieldError("id")
+	}
+	if err := auth_service.UnlockUser(sctx, id, sctx.GetUserID()); err != nil {
+		if errors.Is(err, auth_service.ErrUserNotFound) {
+			return nil, run_processor.NewNotFoundError(err.Error())
+		}
+		return nil, err
+	}
+	sctx.Infof("Login of user %s unlocked by user %s", id, sctx.GetUserID())
+	audit.Record(sctx, audit.Event{Action: audit.ActionUserUnlocked, TargetType: audit.TargetUser, TargetID: id})
+	return map[string]string{"status": "unlocked"}, nil
+}
+
+// GetLoginLockoutsHandler возвращает журнал блокировок входа, новые первыми (limit, по умолчанию 100)
+func GetLoginLockoutsHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	limit := defaultLockoutsLimit
+	if _, ok := args["limit"]; ok {
+		value, _ := args.GetIntValue("limit")
+		if value <= 0 {
+			return nil, run_processor.NewBadRequestError("limit must be a positive integer", nil)
+		}
+		limit = int(value)
+	}
+	return auth_service.ListLockouts(sctx, limit)
+}
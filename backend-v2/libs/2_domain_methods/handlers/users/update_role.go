@@ -0,0 +1,65 @@
+package users
+
+import (
+	"backed-api-v2/libs/2_domain_methods/audit"
+	"backed-api-v2/libs/2_domain_methods/auth_service"
+	"backed-api-v2/libs/2_domain_methods/run_processor"
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"backed-api-v2/libs/5_common/types"
+	"fmt"
+	"time"
+)
+
+// UpdateUserRoleHandler меняет роль пользователя (id в пути, role_code в теле).
+// Сессии пользователя отзываются: токены со старой ролью перестают приниматься
+func UpdateUserRoleHandler(sctx smart_context.ISmartContext, args types.ANY_DATA) (interface{}, error) {
+	id, ok := args.GetStringValue("id")
+	if !ok || id == "" {
+		return nil, run_processor.NewRequiredFieldError("id")
+	}
+	roleCode, ok := args.GetStringValue("role_code")
+	if !ok || roleCode == "" {
+		return nil, run_processor.NewRequiredFieldError("role_code")
+	}
+
+	var count int64
+	if err := sctx.GetDB().Model(&model.Role{}).Where("code = ?", roleCode).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("error checking role %s: %w", roleCode, err)
+	}
+	if count == 0 {
+		return nil, run_processor.NewBadRequestError("role not found", nil)
+	}
+
+	var user model.User
+	if err := sctx.GetDB().Where("id = ?", id).Limit(1).Find(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.ID == "" {
+		return nil, run_processor.NewNotFoundError("user not found")
+	}
+
+	if user.RoleCode != roleCode {
+		previousRole := user.RoleCode
+		user.RoleCode = roleCode
+		user.UpdatedAt = time.Now()
+		err := sctx.GetDB().Model(&user).Updates(map[string]any{"role_code": user.RoleCode, "updated_at": user.UpdatedAt}).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to update user: %w", err)
+		}
+		if _, err := auth_service.RevokeUserSessions(sctx, user.ID, auth_service.RevokeReasonRoleChanged); err != nil {
+			return nil, err
+		}
+		sctx.Infof("Role of user %s changed to %s by user %s", user.ID, roleCode, sctx.GetUserID())
+		audit.Record(sctx, audit.Event{
+			Action:     audit.ActionUserRoleChanged,
+			TargetType: audit.TargetUser,
+			TargetID:   user.ID,
+			Before:     map[string]string{"role_code": previousRole},
+			After:      map[string]string{"role_code": roleCode},
+		})
+	}
+
+	user.PasswordHash = ""
+	return user, nil
+}
@@ -0,0 +1,196 @@
+package list_query
+
+import (
+	"backed-api-v2/libs/2_domain_methods/run_processor"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Page – стандартный ответ списка. NextCursor пустой на последней странице, Total – число записей по фильтрам
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	Total      int64  `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// cursor – позиция в выборке: сортировка, значение поля сортировки и id последней записи страницы
+type cursor struct {
+	Sort  string `json:"s"`
+	Value any    `json:"v"`
+	ID    any    `json:"id"`
+}
+
+// Apply добавляет к запросу фильтры и поиск
+func Apply(query *gorm.DB, spec *Spec, q *Query) *gorm.DB {
+	for _, filter := range q.Filters {
+		column := spec.Fields[filter.Field].Column
+		switch filter.Op {
+		case OpEq:
+			query = query.Where(column+" = ?", filter.Value)
+		case OpNe:
+			query = query.Where(column+" <> ?", filter.Value)
+		case OpGt:
+			query = query.Where(column+" > ?", filter.Value)
+		case OpGte:
+			query = query.Where(column+" >= ?", filter.Value)
+		case OpLt:
+			query = query.Where(column+" < ?", filter.Value)
+		case OpLte:
+			query = query.Where(column+" <= ?", filter.Value)
+		case OpIn:
+			query = query.Where(column+" IN ?", filter.Value)
+		case OpLike:
+			query = query.Where(column+" ILIKE ?", "%"+escapeLike(fmt.Sprint(filter.Value))+"%")
+		case OpNull:
+			if filter.Value == true {
+				query = query.Where(column + " IS NULL")
+			} else {
+				query = query.Where(column + " IS NOT NULL")
+			}
+		}
+	}
+
+	if q.Search != "" && len(spec.Search) > 0 {
+		pattern := "%" + escapeLike(q.Search) + "%"
+		conditions := make([]string, len(spec.Search))
+		values := make([]any, len(spec.Search))
+		for i, column := range spec.Search {
+			conditions[i] = column + " ILIKE ?"
+			values[i] = pattern
+		}
+		query = query.Where("("+strings.Join(conditions, " OR ")+")", values...)
+	}
+	return query
+}
+
+// Find возвращает страницу списка: фильтры и поиск q, общее число записей, сортировку по q.SortBy и id
+// и keyset пагинацию по курсору. Запрос должен выбирать колонки элемента T (Select/Table задаются вызывающим)
+func Find[T any](query *gorm.DB, spec *Spec, q *Query) (*Page[T], error) {
+	query = Apply(query, spec, q)
+
+	page := &Page[T]{Items: []T{}}
+	if err := query.Session(&gorm.Session{}).Count(&page.Total).Error; err != nil {
+		return nil, fmt.Errorf("error counting list items: %w", err)
+	}
+
+	sortColumn, sortType := spec.idColumn(), String
+	if field, ok := spec.Fields[q.SortBy]; ok {
+		sortColumn, sortType = field.Column, field.Type
+	}
+	direction, op := "ASC", ">"
+	if q.Desc {
+		direction, op = "DESC", "<"
+	}
+
+	if q.Cursor != "" {
+		position, err := decodeCursor(q.Cursor, q.sort(), sortType)
+		if err != nil {
+			return nil, err
+		}
+		if sortColumn == spec.idColumn() {
+			query = query.Where(fmt.Sprintf("%s %s ?", sortColumn, op), position.ID)
+		} else {
+			condition, values := afterPosition(sortColumn, spec.idColumn(), op, position)
+			query = query.Where(condition, values...)
+		}
+	}
+
+	order := fmt.Sprintf("%s %s", sortColumn, direction)
+	if sortColumn != spec.idColumn() {
+		// NULL значения сортировки всегда в конце списка, в обоих направлениях - на это рассчитывает afterPosition
+		order += fmt.Sprintf(" NULLS LAST, %s %s", spec.idColumn(), direction)
+	}
+
+	// берем на одну запись больше, чтобы понять, есть ли следующая страница
+	var items []T
+	if err := query.Order(order).Limit(q.Limit + 1).Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("error loading list items: %w", err)
+	}
+	if len(items) <= q.Limit {
+		page.Items = append(page.Items, items...)
+		return page, nil
+	}
+
+	page.Items = items[:q.Limit]
+	next, err := encodeCursor(page.Items[len(page.Items)-1], spec, q)
+	if err != nil {
+		return nil, err
+	}
+	page.NextCursor = next
+	return page, nil
+}
+
+// afterPosition – условие "запись после курсора" для сортировки по sortColumn, id с NULLS LAST.
+// Сравнение кортежей с NULL дает NULL, поэтому записи без значения сортировки обрабатываются отдельно
+func afterPosition(sortColumn string, idColumn string, op string, position *cursor) (string, []any) {
+	if position.Value == nil {
+		// курсор уже в хвосте с NULL - дальше только такие же записи по id
+		return fmt.Sprintf("%s IS NULL AND %s %s ?", sortColumn, idColumn, op), []any{position.ID}
+	}
+	return fmt.Sprintf("((%s, %s) %s (?, ?) OR %s IS NULL)", sortColumn, idColumn, op, sortColumn),
+		[]any{position.Value, position.ID}
+}
+
+func (q *Query) sort() string {
+	if q.Desc {
+		return "-" + q.SortBy
+	}
+	return q.SortBy
+}
+
+// encodeCursor берет значения сортировки и id из JSON представления последнего элемента
+func encodeCursor(item any, spec *Spec, q *Query) (string, error) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return "", fmt.Errorf("error encoding cursor: %w", err)
+	}
+	var fields map[string]any
+	if err := unmarshalNumbers(data, &fields); err != nil {
+		return "", fmt.Errorf("error encoding cursor: %w", err)
+	}
+	position := cursor{Sort: q.sort(), ID: fields[spec.idField()]}
+	if q.SortBy != spec.idField() {
+		position.Value = fields[q.SortBy]
+	}
+	data, err = json.Marshal(position)
+	if err != nil {
+		return "", fmt.Errorf("error encoding cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor проверяет, что курсор выдан для той же сортировки, и приводит значение к типу поля
+func decodeCursor(s string, sort string, sortType FieldType) (*cursor, error) {
+	invalid := run_processor.NewValidationError("invalid cursor", run_processor.FieldError{Field: ParamCursor, Message: "is invalid or was issued for another sort"})
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, invalid
+	}
+	var position cursor
+	if err := unmarshalNumbers(data, &position); err != nil || position.Sort != sort || position.ID == nil {
+		return nil, invalid
+	}
+	if position.Value != nil {
+		if position.Value, err = parseValue(sortType, fmt.Sprint(position.Value)); err != nil {
+			return nil, invalid
+		}
+	}
+	return &position, nil
+}
+
+// unmarshalNumbers – json.Unmarshal с числами json.Number: целые не теряют точность при переводе в float64
+func unmarshalNumbers(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,129 @@
+package list_query
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type testItem struct {
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	Priority  *float64   `json:"priority"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	created := time.Date(2026, time.January, 2, 3, 4, 5, 123456789, time.UTC)
+	priority := 2.5
+
+	tests := []struct {
+		name      string
+		item      testItem
+		sortBy    string
+		desc      bool
+		wantValue any
+	}{
+		{"string", testItem{ID: 9007199254740993, Name: "web-01"}, "name", false, "web-01"},
+		{"number", testItem{ID: 7, Priority: &priority}, "priority", true, 2.5},
+		{"time", testItem{ID: 7, CreatedAt: &created}, "created_at", true, created},
+		{"null value", testItem{ID: 7}, "created_at", false, nil},
+		{"id", testItem{ID: 7, Name: "web-01"}, "id", true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &Query{SortBy: tt.sortBy, Desc: tt.desc}
+			encoded, err := encodeCursor(tt.item, testSpec, q)
+			if err != nil {
+				t.Fatalf("encodeCursor: %v", err)
+			}
+
+			sortType := String
+			if field, ok := testSpec.Fields[tt.sortBy]; ok {
+				sortType = field.Type
+			}
+			position, err := decodeCursor(encoded, q.sort(), sortType)
+			if err != nil {
+				t.Fatalf("decodeCursor: %v", err)
+			}
+			// id без потери точности: большие целые не проходят через float64
+			if position.ID != json.Number(strconv.FormatInt(tt.item.ID, 10)) {
+				t.Errorf("cursor id = %#v, want %d", position.ID, tt.item.ID)
+			}
+			if wantTime, ok := tt.wantValue.(time.Time); ok {
+				if got, _ := position.Value.(time.Time); !got.Equal(wantTime) {
+					t.Errorf("cursor value = %v, want %v", position.Value, wantTime)
+				}
+			} else if !reflect.DeepEqual(position.Value, tt.wantValue) {
+				t.Errorf("cursor value = %#v, want %#v", position.Value, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	encoded, err := encodeCursor(testItem{ID: 1, Name: "a"}, testSpec, &Query{SortBy: "name"})
+	if err != nil {
+		t.Fatalf("encodeCursor: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+		sort   string
+	}{
+		{"other sort field", encoded, "created_at"},
+		{"other direction", encoded, "-name"},
+		{"not base64", "!!!", "name"},
+		{"not json", "bm90IGpzb24", "name"},
+		{"no id", "eyJzIjoibmFtZSJ9", "name"}, // {"s":"name"}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(tt.cursor, tt.sort, String); err == nil {
+				t.Error("decodeCursor: want error")
+			}
+		})
+	}
+}
+
+func TestAfterPosition(t *testing.T) {
+	tests := []struct {
+		name       string
+		op         string
+		position   cursor
+		wantSQL    string
+		wantValues []any
+	}{
+		{
+			name:       "value",
+			op:         ">",
+			position:   cursor{Value: "b", ID: 5},
+			wantSQL:    "((name, id) > (?, ?) OR name IS NULL)",
+			wantValues: []any{"b", 5},
+		},
+		{
+			name:       "null value",
+			op:         "<",
+			position:   cursor{ID: 5},
+			wantSQL:    "name IS NULL AND id < ?",
+			wantValues: []any{5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, values := afterPosition("name", "id", tt.op, &tt.position)
+			if sql != tt.wantSQL || !reflect.DeepEqual(values, tt.wantValues) {
+				t.Errorf("afterPosition = %q %v, want %q %v", sql, values, tt.wantSQL, tt.wantValues)
+			}
+		})
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	if got := escapeLike(`50%_off\`); got != `50\%\_off\\` {
+		t.Errorf("escapeLike = %s", got)
+	}
+}
@@ -0,0 +1,254 @@
+package list_query
+
+import (
+	"backed-api-v2/libs/2_domain_methods/run_processor"
+	"backed-api-v2/libs/5_common/types"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+)
+
+// Параметры списка в query. Остальные параметры – фильтры: field=value или field[op]=value
+const (
+	ParamLimit  = "limit"
+	ParamCursor = "cursor"
+	ParamSort   = "sort"
+	ParamSearch = "search"
+)
+
+// Операторы фильтров
+const (
+	OpEq   = "eq"
+	OpNe   = "ne"
+	OpGt   = "gt"
+	OpGte  = "gte"
+	OpLt   = "lt"
+	OpLte  = "lte"
+	OpIn   = "in"   // значения через запятую
+	OpLike = "like" // подстрока без учета регистра
+	OpNull = "null" // true – значения нет, false – есть
+)
+
+// FieldType – тип значения поля: от него зависят разбор значения фильтра и допустимые операторы
+type FieldType int
+
+const (
+	String FieldType = iota
+	Number
+	Time // RFC3339
+	Bool
+)
+
+var typeOperators = map[FieldType][]string{
+	String: {OpEq, OpNe, OpIn, OpLike, OpNull},
+	Number: {OpEq, OpNe, OpGt, OpGte, OpLt, OpLte, OpIn, OpNull},
+	Time:   {OpEq, OpNe, OpGt, OpGte, OpLt, OpLte, OpNull},
+	Bool:   {OpEq, OpNe, OpNull},
+}
+
+// Field – поле списка, доступное для фильтров и, если Sortable, для сортировки.
+// Имя поля в Spec.Fields совпадает с ключом JSON элемента ответа: по нему берется значение для курсора
+type Field struct {
+	Column   string // колонка в запросе, например "d.group_id"
+	Type     FieldType
+	Sortable bool // записи без значения (NULL) идут в конце в обоих направлениях; ключ JSON элемента не должен быть omitempty
+}
+
+// Spec – описание списка: поля, поиск и сортировка по умолчанию
+type Spec struct {
+	Fields      map[string]Field
+	Search      []string // колонки для search (ILIKE по подстроке любой из них)
+	DefaultSort string   // поле сортировки, "-" в начале – по убыванию
+	IDColumn    string   // уникальная колонка для порядка и курсора, по умолчанию "id"
+	IDField     string   // ключ JSON этой колонки в элементе, по умолчанию "id"
+	MaxLimit    int      // 0 – MaxLimit
+}
+
+// Filter – условие на поле
+type Filter struct {
+	Field string
+	Op    string
+	Value any // []any для OpIn, bool для OpNull
+}
+
+// Query – параметры списка из запроса
+type Query struct {
+	Filters []Filter
+	Search  string
+	SortBy  string
+	Desc    bool
+	Limit   int
+	Cursor  string // next_cursor предыдущей страницы
+}
+
+// Parse разбирает параметры списка: limit, cursor, sort (поле, "-" в начале – по убыванию), search и фильтры
+// field=value, field[op]=value по полям spec. Параметры, не похожие на фильтры по полям spec (например, параметры пути),
+// пропускаются. Ошибки – run_processor ошибки валидации с полем
+func Parse(args types.ANY_DATA, spec *Spec) (*Query, error) {
+	query := &Query{Limit: DefaultLimit}
+	var fieldErrors []run_processor.FieldError
+	fail := func(field string, message string) {
+		fieldErrors = append(fieldErrors, run_processor.FieldError{Field: field, Message: message})
+	}
+
+	if _, ok := args[ParamLimit]; ok {
+		limit, _ := args.GetIntValue(ParamLimit)
+		if limit <= 0 {
+			fail(ParamLimit, "must be a positive integer")
+		}
+		query.Limit = min(int(limit), spec.maxLimit())
+	}
+	query.Cursor, _ = args.GetStringValue(ParamCursor)
+	query.Search, _ = args.GetStringValue(ParamSearch)
+	query.Search = strings.TrimSpace(query.Search)
+
+	sort, _ := args.GetStringValue(ParamSort)
+	if sort == "" {
+		sort = spec.DefaultSort
+	}
+	if sort != "" {
+		query.Desc = strings.HasPrefix(sort, "-")
+		query.SortBy = strings.TrimPrefix(sort, "-")
+		if field, ok := spec.Fields[query.SortBy]; (!ok || !field.Sortable) && query.SortBy != spec.idField() {
+			fail(ParamSort, fmt.Sprintf("must be one of: %s", strings.Join(spec.sortFields(), ", ")))
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(args)) {
+		raw := args[key]
+		name, op, hasOp := strings.Cut(key, "[")
+		if hasOp {
+			if !strings.HasSuffix(op, "]") {
+				continue
+			}
+			op = strings.TrimSuffix(op, "]")
+		} else {
+			op = OpEq
+		}
+		field, ok := spec.Fields[name]
+		if !ok {
+			if hasOp {
+				fail(key, "unknown filter field")
+			}
+			continue
+		}
+		if !slices.Contains(typeOperators[field.Type], op) {
+			fail(key, fmt.Sprintf("operator must be one of: %s", strings.Join(typeOperators[field.Type], ", ")))
+			continue
+		}
+		value, err := parseFilterValue(field.Type, op, fmt.Sprint(raw))
+		if err != nil {
+			fail(key, err.Error())
+			continue
+		}
+		query.Filters = append(query.Filters, Filter{Field: name, Op: op, Value: value})
+	}
+
+	if len(fieldErrors) > 0 {
+		return nil, run_processor.NewValidationError("invalid list query", fieldErrors...)
+	}
+	return query, nil
+}
+
+func parseFilterValue(fieldType FieldType, op string, raw string) (any, error) {
+	switch op {
+	case OpNull:
+		isNull, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be true or false")
+		}
+		return isNull, nil
+	case OpLike:
+		return raw, nil
+	case OpIn:
+		var values []any
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			value, err := parseFilterValue(fieldType, OpEq, item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("must contain at least one value")
+		}
+		return values, nil
+	}
+	value, err := parseValue(fieldType, raw)
+	if t, ok := value.(time.Time); ok {
+		// время в БД хранится без зоны, в локальном времени сервера
+		value = t.Local()
+	}
+	return value, err
+}
+
+// parseValue приводит значение фильтра или курсора к типу поля
+func parseValue(fieldType FieldType, raw string) (any, error) {
+	switch fieldType {
+	case Number:
+		if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return n, nil
+		}
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return n, nil
+	case Time:
+		t, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be RFC3339 timestamp")
+		}
+		return t, nil
+	case Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be true or false")
+		}
+		return b, nil
+	}
+	return raw, nil
+}
+
+func (s *Spec) maxLimit() int {
+	if s.MaxLimit > 0 {
+		return s.MaxLimit
+	}
+	return MaxLimit
+}
+
+func (s *Spec) idColumn() string {
+	if s.IDColumn != "" {
+		return s.IDColumn
+	}
+	return "id"
+}
+
+func (s *Spec) idField() string {
+	if s.IDField != "" {
+		return s.IDField
+	}
+	return "id"
+}
+
+func (s *Spec) sortFields() []string {
+	fields := []string{s.idField()}
+	for name, field := range s.Fields {
+		if field.Sortable {
+			fields = append(fields, name)
+		}
+	}
+	slices.Sort(fields)
+	return fields
+}
@@ -0,0 +1,122 @@
+package list_query
+
+import (
+	"backed-api-v2/libs/2_domain_methods/run_processor"
+	"backed-api-v2/libs/5_common/types"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testSpec = &Spec{
+	Fields: map[string]Field{
+		"name":       {Column: "name", Type: String, Sortable: true},
+		"status":     {Column: "status", Type: String},
+		"priority":   {Column: "priority", Type: Number, Sortable: true},
+		"enabled":    {Column: "enabled", Type: Bool},
+		"created_at": {Column: "created_at", Type: Time, Sortable: true},
+	},
+	Search:      []string{"name"},
+	DefaultSort: "-created_at",
+	MaxLimit:    100,
+}
+
+func TestParse(t *testing.T) {
+	created := time.Date(2026, time.January, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		args types.ANY_DATA
+		want Query
+	}{
+		{
+			name: "defaults",
+			args: types.ANY_DATA{},
+			want: Query{SortBy: "created_at", Desc: true, Limit: DefaultLimit},
+		},
+		{
+			name: "limit, sort and search",
+			args: types.ANY_DATA{"limit": "20", "sort": "name", "search": "  web ", "cursor": "abc"},
+			want: Query{SortBy: "name", Limit: 20, Search: "web", Cursor: "abc"},
+		},
+		{
+			name: "limit above spec maximum",
+			args: types.ANY_DATA{"limit": "1000"},
+			want: Query{SortBy: "created_at", Desc: true, Limit: 100},
+		},
+		{
+			name: "sort by id",
+			args: types.ANY_DATA{"sort": "-id"},
+			want: Query{SortBy: "id", Desc: true, Limit: DefaultLimit},
+		},
+		{
+			name: "filters",
+			args: types.ANY_DATA{
+				"status":           "ONLINE",
+				"priority[gte]":    "5",
+				"enabled":          "true",
+				"name[in]":         "a, b,",
+				"created_at[null]": "false",
+				"created_at[lt]":   created.Format(time.RFC3339),
+				"device_id":        "path parameter",
+			},
+			want: Query{
+				SortBy: "created_at",
+				Desc:   true,
+				Limit:  DefaultLimit,
+				Filters: []Filter{
+					{Field: "created_at", Op: OpLt, Value: created.Local()},
+					{Field: "created_at", Op: OpNull, Value: false},
+					{Field: "enabled", Op: OpEq, Value: true},
+					{Field: "name", Op: OpIn, Value: []any{"a", "b"}},
+					{Field: "priority", Op: OpGte, Value: int64(5)},
+					{Field: "status", Op: OpEq, Value: "ONLINE"},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.args, testSpec)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("Parse = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  types.ANY_DATA
+		field string
+	}{
+		{"zero limit", types.ANY_DATA{"limit": "0"}, ParamLimit},
+		{"bad limit", types.ANY_DATA{"limit": "ten"}, ParamLimit},
+		{"not sortable", types.ANY_DATA{"sort": "status"}, ParamSort},
+		{"unknown sort", types.ANY_DATA{"sort": "-missing"}, ParamSort},
+		{"unknown filter field", types.ANY_DATA{"missing[eq]": "1"}, "missing[eq]"},
+		{"operator not allowed", types.ANY_DATA{"enabled[gt]": "true"}, "enabled[gt]"},
+		{"bad number", types.ANY_DATA{"priority": "high"}, "priority"},
+		{"bad time", types.ANY_DATA{"created_at[gt]": "yesterday"}, "created_at[gt]"},
+		{"bad null", types.ANY_DATA{"name[null]": "maybe"}, "name[null]"},
+		{"empty in", types.ANY_DATA{"status[in]": " , "}, "status[in]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.args, testSpec)
+			var httpErr *run_processor.HttpError
+			if !errors.As(err, &httpErr) {
+				t.Fatalf("Parse error = %v, want validation error", err)
+			}
+			fields, _ := httpErr.Details.([]run_processor.FieldError)
+			if len(fields) != 1 || fields[0].Field != tt.field {
+				t.Errorf("Parse error fields = %+v, want one error for %s", fields, tt.field)
+			}
+		})
+	}
+}
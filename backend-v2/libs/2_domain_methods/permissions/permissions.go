@@ -0,0 +1,182 @@
+package permissions
+
+import (
+	"backed-api-v2/libs/3_generated_models/model"
+	"backed-api-v2/libs/5_common/smart_context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Права доступа маршрутов API (таблица permissions). Права на типы команд (commands:send:<категория>)
+// задаются в command_catalog.permission_code
+const (
+	DevicesRead        = "devices:read"
+	DevicesAllGroups   = "devices:all_groups" // без права – только устройства назначенных пользователю групп
+	DevicesEnroll      = "devices:enroll"
+	DeviceGroupsRead   = "device_groups:read"
+	DeviceGroupsManage = "device_groups:manage"
+	CommandsRead       = "commands:read"
+	CommandsSend       = "commands:send"
+	CommandsCancel     = "commands:cancel"
+	CommandsApprove    = "commands:approve"
+	SchedulesRead      = "schedules:read"
+	SchedulesWrite     = "schedules:write"
+	SchedulesDelete    = "schedules:delete"
+	UsersManage        = "users:manage"
+	RolesManage        = "roles:manage"
+	APIKeysManage      = "api_keys:manage"
+	AuditRead          = "audit:read"
+)
+
+var ErrRoleNotFound = errors.New("role not found")
+
+// UnknownPermissionError – в запросе есть права, которых нет в таблице permissions
+type UnknownPermissionError struct {
+	Codes []string
+}
+
+func (e *UnknownPermissionError) Error() string {
+	return fmt.Sprintf("unknown permissions: %s", strings.Join(e.Codes, ", "))
+}
+
+// APIKeyAllows проверяет ограничения API ключа запроса: false, если запрос аутентифицирован ключом без этого права.
+// Право роли владельца ключа проверяется отдельно (RoleHasPermission)
+func APIKeyAllows(sctx smart_context.ISmartContext, permission string) bool {
+	scope := sctx.GetAPIKeyScope()
+	return scope == nil || scope.HasPermission(permission)
+}
+
+// RoleHasPermission проверяет, что у роли есть право
+func RoleHasPermission(sctx smart_context.ISmartContext, roleCode string, permission string) (bool, error) {
+	if roleCode == "" {
+		return false, nil
+	}
+	var count int64
+	err := sctx.GetDB().Model(&model.RolePermission{}).
+		Where("role_code = ? AND permission_code = ?", roleCode, permission).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("error checking permission %s of role %s: %w", permission, roleCode, err)
+	}
+	return count > 0, nil
+}
+
+// RolePermissionSet возвращает права роли в виде множества (для проверки нескольких прав одним запросом)
+func RolePermissionSet(sctx smart_context.ISmartContext, roleCode string) (map[string]bool, error) {
+	var codes []string
+	err := sctx.GetDB().Model(&model.RolePermission{}).
+		Where("role_code = ?", roleCode).
+		Pluck("permission_code", &codes).Error
+	if err != nil {
+		return nil, fmt.Errorf("error loading permissions of role %s: %w", roleCode, err)
+	}
+	result := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		result[code] = true
+	}
+	return result, nil
+}
+
+// ListPermissions возвращает все права
+func ListPermissions(sctx smart_context.ISmartContext) ([]model.Permission, error) {
+	result := []model.Permission{}
+	if err := sctx.GetDB().Order("code").Find(&result).Error; err != nil {
+		return nil, fmt.Errorf("error loading permissions: %w", err)
+	}
+	return result, nil
+}
+
+// GetRolePermissions возвращает отсортированные права роли или ErrRoleNotFound
+func GetRolePermissions(sctx smart_context.ISmartContext, roleCode string) ([]string, error) {
+	if err := checkRoleExists(sctx.GetDB(), roleCode); err != nil {
+		return nil, err
+	}
+	codes := []string{}
+	err := sctx.GetDB().Model(&model.RolePermission{}).
+		Where("role_code = ?", roleCode).
+		Order("permission_code").
+		Pluck("permission_code", &codes).Error
+	if err != nil {
+		return nil, fmt.Errorf("error loading permissions of role %s: %w", roleCode, err)
+	}
+	return codes, nil
+}
+
+// SetRolePermissions заменяет права роли. Изменения действуют сразу: права проверяются при каждом запросе
+func SetRolePermissions(sctx smart_context.ISmartContext, roleCode string, codes []string) ([]string, error) {
+	codes = uniqueSorted(codes)
+	err := sctx.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := checkRoleExists(tx, roleCode); err != nil {
+			return err
+		}
+
+		var known []string
+		if err := tx.Model(&model.Permission{}).Where("code IN ?", codes).Pluck("code", &known).Error; err != nil {
+			return fmt.Errorf("error checking permissions: %w", err)
+		}
+		if len(known) != len(codes) {
+			return &UnknownPermissionError{Codes: missing(codes, known)}
+		}
+
+		if err := tx.Where("role_code = ?", roleCode).Delete(&model.RolePermission{}).Error; err != nil {
+			return fmt.Errorf("error clearing permissions of role %s: %w", roleCode, err)
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		rows := make([]model.RolePermission, 0, len(codes))
+		for _, code := range codes {
+			rows = append(rows, model.RolePermission{RoleCode: roleCode, PermissionCode: code})
+		}
+		if err := tx.Create(&rows).Error; err != nil {
+			return fmt.Errorf("error saving permissions of role %s: %w", roleCode, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func checkRoleExists(db *gorm.DB, roleCode string) error {
+	var count int64
+	if err := db.Model(&model.Role{}).Where("code = ?", roleCode).Count(&count).Error; err != nil {
+		return fmt.Errorf("error checking role %s: %w", roleCode, err)
+	}
+	if count == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+func uniqueSorted(codes []string) []string {
+	seen := make(map[string]bool, len(codes))
+	result := make([]string, 0, len(codes))
+	for _, code := range codes {
+		if code != "" && !seen[code] {
+			seen[code] = true
+			result = append(result, code)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func missing(codes []string, known []string) []string {
+	knownSet := make(map[string]bool, len(known))
+	for _, code := range known {
+		knownSet[code] = true
+	}
+	var result []string
+	for _, code := range codes {
+		if !knownSet[code] {
+			result = append(result, code)
+		}
+	}
+	return result
+}
@@ -0,0 +1,24 @@
+package run_processor
+
+import (
+	"backed-api-v2/libs/5_common/smart_context"
+	"fmt"
+	"net/http"
+)
+
+// FileResponse – результат хендлера, который отдается файлом, а не JSON (например, CSV выгрузка)
+type FileResponse struct {
+	ContentType string
+	FileName    string // имя файла для Content-Disposition, пустое – без заголовка
+	Body        []byte
+}
+
+func (f *FileResponse) write(sctx smart_context.ISmartContext, w http.ResponseWriter) {
+	w.Header().Set("Content-Type", f.ContentType)
+	if f.FileName != "" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", f.FileName))
+	}
+	if _, err := w.Write(f.Body); err != nil {
+		sctx.Errorf("Error writing file response: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package run_processor
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"gorm.io/gorm"
+
+	"backed-api-v2/libs/5_common/rest_middleware"
+)
+
+// postgres: unique_violation
+const uniqueViolationSQLState = "23505"
+
+// HttpError – ошибка хендлера с HTTP статусом, стабильным кодом и сообщением для пользователя.
+// Остальные ошибки WrapSmartHandler приводит к HttpError через AsHttpError
+type HttpError struct {
+	Status  int
+	Code    string // rest_middleware.ErrorCode*
+	Message string
+	Details any
+}
+
+// FieldError – ошибка конкретного поля запроса (details ошибки валидации)
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *HttpError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// NewHttpError – ошибка с кодом по умолчанию для статуса
+func NewHttpError(status int, message string, details any) *HttpError {
+	return &HttpError{
+		Status:  status,
+		Code:    rest_middleware.ErrorCodeForStatus(status),
+		Message: message,
+		Details: details,
+	}
+}
+
+func NewBadRequestError(message string, details any) *HttpError {
+	return NewHttpError(http.StatusBadRequest, message, details)
+}
+
+// NewValidationError – 400 validation_failed, в details – ошибки полей
+func NewValidationError(message string, fields ...FieldError) *HttpError {
+	err := NewHttpError(http.StatusBadRequest, message, nil)
+	err.Code = rest_middleware.ErrorCodeValidation
+	if len(fields) > 0 {
+		err.Details = fields
+	}
+	return err
+}
+
+// NewRequiredFieldError – ошибка валидации для отсутствующего обязательного поля
+func NewRequiredFieldError(field string) *HttpError {
+	message := field + " is required"
+	return NewValidationError(message, FieldError{Field: field, Message: message})
+}
+
+func NewNotFoundError(message string) *HttpError {
+	return NewHttpError(http.StatusNotFound, message, nil)
+}
+
+func NewForbiddenError(message string) *HttpError {
+	return NewHttpError(http.StatusForbidden, message, nil)
+}
+
+func NewConflictError(message string, details any) *HttpError {
+	return NewHttpError(http.StatusConflict, message, details)
+}
+
+// AsHttpError приводит ошибку хендлера к HttpError: gorm.ErrRecordNotFound – 404, нарушение уникальности – 409,
+// остальное – 500 без текста исходной ошибки (он только в логе)
+func AsHttpError(err error) *HttpError {
+	var httpErr *HttpError
+	if errors.As(err, &httpErr) {
+		return httpErr
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return NewNotFoundError("not found")
+	}
+	if IsUniqueViolation(err) {
+		return NewConflictError("already exists", nil)
+	}
+	return NewHttpError(http.StatusInternalServerError, "internal server error", nil)
+}
+
+// IsUniqueViolation – ошибка БД о нарушении уникального ограничения
+func IsUniqueViolation(err error) bool {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	// pgconn.PgError, без прямой зависимости от драйвера
+	var sqlErr interface{ SQLState() string }
+	return errors.As(err, &sqlErr) && sqlErr.SQLState() == uniqueViolationSQLState
+}
+
+// writeHttpError отвечает ошибкой в формате rest_middleware.ErrorResponse с request_id запроса
+func writeHttpError(w http.ResponseWriter, requestID string, err *HttpError) error {
+	return rest_middleware.WriteError(w, err.Status, rest_middleware.ErrorResponse{
+		Error:     err.Message,
+		Code:      err.Code,
+		Details:   err.Details,
+		RequestID: requestID,
+	})
+}
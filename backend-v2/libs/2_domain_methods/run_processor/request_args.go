@@ -0,0 +1,88 @@
+package run_processor
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"backed-api-v2/libs/5_common/types"
+)
+
+// MaxRequestBodyBytes – предел размера JSON тела запроса
+const MaxRequestBodyBytes = 10 << 20
+
+// requestArgs – параметры запроса по источникам
+type requestArgs struct {
+	Path  map[string]string
+	Query url.Values
+	Body  []byte // JSON тело, nil – тела нет
+}
+
+// readRequestArgs извлекает параметры пути (chi), query и JSON тело POST/PUT/PATCH/DELETE.
+// Тело читается, если Content-Type – application/json или не указан
+func readRequestArgs(w http.ResponseWriter, r *http.Request) (*requestArgs, error) {
+	args := &requestArgs{Path: map[string]string{}, Query: r.URL.Query()}
+
+	if rc := chi.RouteContext(r.Context()); rc != nil {
+		for i, key := range rc.URLParams.Keys {
+			args.Path[key] = rc.URLParams.Values[i]
+		}
+	}
+
+	if !hasJSONBody(r) {
+		return args, nil
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxRequestBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, NewHttpError(http.StatusRequestEntityTooLarge, "request body is too large", nil)
+		}
+		return nil, NewBadRequestError("error reading request body", nil)
+	}
+	if len(strings.TrimSpace(string(body))) > 0 {
+		args.Body = body
+	}
+	return args, nil
+}
+
+func hasJSONBody(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return false
+	}
+	if r.Body == nil || r.Body == http.NoBody {
+		return false
+	}
+	contentType := r.Header.Get("Content-Type")
+	return contentType == "" || strings.Contains(contentType, "application/json")
+}
+
+// merged – параметры одним словарем для SmartHandlerFunc: query, поверх – поля тела (если это JSON объект),
+// поверх – параметры пути. Тело, которое не удалось разобрать, игнорируется
+func (a *requestArgs) merged() types.ANY_DATA {
+	params := types.ANY_DATA{}
+	for key, values := range a.Query {
+		if len(values) > 0 {
+			params[key] = values[0]
+		}
+	}
+	if a.Body != nil {
+		var bodyParams types.ANY_DATA
+		if err := json.Unmarshal(a.Body, &bodyParams); err == nil {
+			for k, v := range bodyParams {
+				params[k] = v
+			}
+		}
+	}
+	for key, value := range a.Path {
+		params[key] = value
+	}
+	return params
+}
@@ -3,9 +3,6 @@ package run_processor
 import (
 	"encoding/json"
 	"net/http"
-	"strings"
-
-	"github.com/go-chi/chi/v5"
 
 	"backed-api-v2/libs/5_common/rest_middleware"
 	"backed-api-v2/libs/5_common/smart_context"
@@ -16,52 +13,64 @@ type SmartHandlerFunc func(sctx smart_context.ISmartContext, args types.ANY_DATA
 
 func WrapSmartHandler(sctx smart_context.ISmartContext, handler SmartHandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Извлекаем query-параметры
-		params := types.ANY_DATA{}
-		for key, values := range r.URL.Query() {
-			if len(values) > 0 {
-				params[key] = values[0]
-			}
-		}
-
-		// Извлекаем параметры пути из контекста chi
-		rc := chi.RouteContext(r.Context())
-		for i, key := range rc.URLParams.Keys {
-			params[key] = rc.URLParams.Values[i]
-		}
+		serveRequest(sctx, w, r, func(handlerSctx smart_context.ISmartContext, args *requestArgs) (interface{}, error) {
+			return handler(handlerSctx, args.merged())
+		})
+	}
+}
 
-		// Если метод POST и Content-Type содержит "application/json", пытаемся декодировать тело запроса
-		if r.Method == http.MethodPost && strings.Contains(r.Header.Get("Content-Type"), "application/json") {
-			var bodyParams types.ANY_DATA
-			if err := json.NewDecoder(r.Body).Decode(&bodyParams); err == nil {
-				for k, v := range bodyParams {
-					params[k] = v
-				}
-			}
+// serveRequest – общая часть WrapSmartHandler и WrapTypedHandler: разбор параметров, пользователь запроса,
+// вызов хендлера и ответ (JSON, файл или ошибка)
+func serveRequest(sctx smart_context.ISmartContext, w http.ResponseWriter, r *http.Request,
+	call func(handlerSctx smart_context.ISmartContext, args *requestArgs) (interface{}, error)) {
+	// Пользователь из проверенного токена (нет на открытых маршрутах)
+	handlerSctx := sctx.WithClientIP(rest_middleware.ClientIP(sctx, r))
+	if identity := rest_middleware.GetIdentity(r.Context()); identity != nil {
+		handlerSctx = handlerSctx.WithUserID(identity.UserID).WithUsername(identity.Username).WithUserRole(identity.Role)
+		if identity.APIKey != nil {
+			handlerSctx = handlerSctx.WithAPIKeyScope(identity.APIKey)
 		}
+	}
 
-		// Вызов основного хендлера с переданными параметрами
-		result, err := handler(sctx, params)
-		if err != nil {
+	// Вызов основного хендлера с параметрами запроса
+	args, err := readRequestArgs(w, r)
+	var result interface{}
+	if err == nil {
+		result, err = call(handlerSctx, args)
+	}
+	if err != nil {
+		httpErr := AsHttpError(err)
+		if httpErr.Status >= http.StatusInternalServerError {
 			sctx.Errorf("Handler error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		} else {
+			sctx.Warnf("Handler error: %v", err)
+		}
+		if err := writeHttpError(w, handlerSctx.GetRequestID(), httpErr); err != nil {
+			sctx.Errorf("Error encoding error response: %v", err)
 		}
+		return
+	}
+
+	// Файл (например, CSV выгрузка) отдается как есть
+	if file, ok := result.(*FileResponse); ok {
+		file.write(sctx, w)
+		return
+	}
 
-		// Если результат не nil, сериализуем его в JSON
-		if result != nil {
-			w.Header().Set("Content-Type", "application/json")
-			if err := json.NewEncoder(w).Encode(result); err != nil {
-				sctx.Errorf("Error encoding response: %v", err)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			}
+	// Если результат не nil, сериализуем его в JSON
+	if result != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			sctx.Errorf("Error encoding response: %v", err)
+			_ = writeHttpError(w, handlerSctx.GetRequestID(), AsHttpError(err))
 		}
 	}
 }
 
+// WrapRestApiSmartHandler – WrapSmartHandler с цепочкой rest_middleware.WithRestApiSmartContext.
+// Хендлер получает sctx цепочки: с session_id и request_id запроса
 func WrapRestApiSmartHandler(sctx smart_context.ISmartContext, handler SmartHandlerFunc) http.HandlerFunc {
-	baseHandler := WrapSmartHandler(sctx, handler)
 	return rest_middleware.WithRestApiSmartContext(sctx, func(sctx smart_context.ISmartContext, w http.ResponseWriter, r *http.Request) {
-		baseHandler(w, r)
+		WrapSmartHandler(sctx, handler)(w, r)
 	})
 }
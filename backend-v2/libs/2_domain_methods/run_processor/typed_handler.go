@@ -0,0 +1,252 @@
+package run_processor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"backed-api-v2/libs/5_common/rest_middleware"
+	"backed-api-v2/libs/5_common/smart_context"
+)
+
+// TypedHandlerFunc – хендлер с типизированным запросом. Запрос заполняется и проверяется до вызова хендлера
+type TypedHandlerFunc[T any] func(sctx smart_context.ISmartContext, req *T) (interface{}, error)
+
+// RequestValidator – проверка запроса, которую не выразить тегами validate (например, зависимость полей).
+// Вызывается после проверки тегов
+type RequestValidator interface {
+	Validate() error
+}
+
+// WrapTypedHandler – аналог WrapSmartHandler для TypedHandlerFunc. Поля T заполняются по тегам:
+//
+//	json:"name"  – поле JSON тела (POST/PUT/PATCH/DELETE)
+//	query:"name" – query параметр, повторяющийся или через запятую для срезов
+//	path:"name"  – параметр пути chi
+//
+// Если у поля несколько тегов, приоритет у path, затем query, затем тела. Правила тега validate – см. validateRequest.
+// Ошибки разбора и проверки возвращаются ответом 400 validation_failed с ошибками полей в details
+func WrapTypedHandler[T any](sctx smart_context.ISmartContext, handler TypedHandlerFunc[T]) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serveRequest(sctx, w, r, func(handlerSctx smart_context.ISmartContext, args *requestArgs) (interface{}, error) {
+			req := new(T)
+			if err := bindRequest(args, req); err != nil {
+				return nil, err
+			}
+			return handler(handlerSctx, req)
+		})
+	}
+}
+
+// WrapRestApiTypedHandler – WrapTypedHandler с цепочкой rest_middleware.WithRestApiSmartContext
+func WrapRestApiTypedHandler[T any](sctx smart_context.ISmartContext, handler TypedHandlerFunc[T]) http.HandlerFunc {
+	return rest_middleware.WithRestApiSmartContext(sctx, func(sctx smart_context.ISmartContext, w http.ResponseWriter, r *http.Request) {
+		WrapTypedHandler(sctx, handler)(w, r)
+	})
+}
+
+// bindRequest заполняет req (указатель на структуру) из тела, query и пути и проверяет его
+func bindRequest(args *requestArgs, req any) error {
+	if args.Body != nil {
+		if err := json.Unmarshal(args.Body, req); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) && typeErr.Field != "" {
+				return NewValidationError("invalid request", FieldError{Field: typeErr.Field, Message: "must be " + kindName(typeErr.Type)})
+			}
+			return NewBadRequestError("invalid JSON body", nil)
+		}
+	}
+
+	value := reflect.ValueOf(req).Elem()
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+	var fieldErrors []FieldError
+	err := walkFields(value, func(field reflect.StructField, value reflect.Value) error {
+		for _, source := range []string{"query", "path"} {
+			name := tagName(field, source)
+			if name == "" {
+				continue
+			}
+			var values []string
+			if source == "query" {
+				values = args.Query[name]
+			} else if pathValue, ok := args.Path[name]; ok {
+				values = []string{pathValue}
+			}
+			if len(values) == 0 {
+				continue
+			}
+			if err := setFromStrings(value, values); err != nil {
+				if errors.Is(err, errUnsupportedType) {
+					return fmt.Errorf("field %s: %w", field.Name, err)
+				}
+				fieldErrors = append(fieldErrors, FieldError{Field: name, Message: err.Error()})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(fieldErrors) > 0 {
+		return NewValidationError("invalid request", fieldErrors...)
+	}
+
+	if err := validateRequest(req); err != nil {
+		return err
+	}
+	if validator, ok := req.(RequestValidator); ok {
+		return validator.Validate()
+	}
+	return nil
+}
+
+// walkFields обходит экспортируемые поля структуры, включая поля встроенных структур
+func walkFields(value reflect.Value, visit func(field reflect.StructField, value reflect.Value) error) error {
+	structType := value.Type()
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := walkFields(value.Field(i), visit); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := visit(field, value.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tagName – имя параметра из тега (без опций вроде omitempty), пустое – тега нет
+func tagName(field reflect.StructField, tag string) string {
+	name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// fieldName – имя поля в ошибках: из тегов path, query, json или имя поля Go
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"path", "query", "json"} {
+		if name := tagName(field, tag); name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+var (
+	errUnsupportedType = errors.New("unsupported field type")
+	timeType           = reflect.TypeOf(time.Time{})
+)
+
+// setFromStrings записывает в value значение параметра пути или query. Текст ошибки – для FieldError
+func setFromStrings(value reflect.Value, values []string) error {
+	switch {
+	case value.Kind() == reflect.Pointer:
+		elem := reflect.New(value.Type().Elem())
+		if err := setFromStrings(elem.Elem(), values); err != nil {
+			return err
+		}
+		value.Set(elem)
+		return nil
+	case value.Kind() == reflect.Slice:
+		var items []string
+		for _, v := range values {
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+		}
+		slice := reflect.MakeSlice(value.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setFromString(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		value.Set(slice)
+		return nil
+	}
+	return setFromString(value, values[0])
+}
+
+func setFromString(value reflect.Value, raw string) error {
+	if value.Type() == timeType {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return errors.New("must be an RFC 3339 time")
+		}
+		value.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New("must be " + kindName(value.Type()))
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, value.Type().Bits())
+		if err != nil {
+			return errors.New("must be " + kindName(value.Type()))
+		}
+		value.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, value.Type().Bits())
+		if err != nil {
+			return errors.New("must be " + kindName(value.Type()))
+		}
+		value.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(raw, value.Type().Bits())
+		if err != nil {
+			return errors.New("must be " + kindName(value.Type()))
+		}
+		value.SetFloat(n)
+	default:
+		return errUnsupportedType
+	}
+	return nil
+}
+
+// kindName – тип значения для сообщения об ошибке ("must be an integer")
+func kindName(t reflect.Type) string {
+	if t == timeType {
+		return "an RFC 3339 time"
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return kindName(t.Elem())
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "an integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a non-negative integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	}
+	return "a valid value"
+}
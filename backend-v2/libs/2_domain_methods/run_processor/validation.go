@@ -0,0 +1,134 @@
+package run_processor
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// validateRequest проверяет поля req по тегу validate – правила через запятую:
+//
+//	required  – значение не пустое (для срезов – хотя бы один элемент, для указателей – не nil)
+//	min=N     – не меньше N: для строк – символов, для срезов – элементов, для чисел – значение
+//	max=N     – не больше N, аналогично min
+//	oneof=a b – одно из значений через пробел
+//	email     – адрес электронной почты
+//	uuid      – UUID
+//
+// Правила, кроме required, проверяются только для непустых значений
+func validateRequest(req any) error {
+	var fieldErrors []FieldError
+	value := reflect.ValueOf(req).Elem()
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+	err := walkFields(value, func(field reflect.StructField, value reflect.Value) error {
+		rules := field.Tag.Get("validate")
+		if rules == "" {
+			return nil
+		}
+		message, err := checkRules(value, rules)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		if message != "" {
+			fieldErrors = append(fieldErrors, FieldError{Field: fieldName(field), Message: message})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(fieldErrors) > 0 {
+		return NewValidationError("invalid request", fieldErrors...)
+	}
+	return nil
+}
+
+// checkRules возвращает сообщение о первом нарушенном правиле или ошибку в самом теге
+func checkRules(value reflect.Value, rules string) (string, error) {
+	for _, rule := range strings.Split(rules, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		if name == "required" {
+			if isEmpty(value) {
+				return "is required", nil
+			}
+			continue
+		}
+		if isEmpty(value) {
+			return "", nil
+		}
+		for value.Kind() == reflect.Pointer {
+			value = value.Elem()
+		}
+
+		switch name {
+		case "min", "max":
+			limit, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				return "", fmt.Errorf("invalid %s rule %q", name, param)
+			}
+			size, unit := measure(value)
+			if unit == "invalid" {
+				return "", fmt.Errorf("%s rule is not supported for %s", name, value.Kind())
+			}
+			if name == "min" && size < limit {
+				return fmt.Sprintf("must be at least %s%s", param, unit), nil
+			}
+			if name == "max" && size > limit {
+				return fmt.Sprintf("must be at most %s%s", param, unit), nil
+			}
+		case "oneof":
+			allowed := strings.Fields(param)
+			actual := fmt.Sprint(value.Interface())
+			if !slices.Contains(allowed, actual) {
+				return "must be one of: " + strings.Join(allowed, ", "), nil
+			}
+		case "email":
+			address, err := mail.ParseAddress(value.String())
+			if value.Kind() != reflect.String || err != nil || address.Address != value.String() {
+				return "must be a valid email address", nil
+			}
+		case "uuid":
+			if _, err := uuid.Parse(value.String()); value.Kind() != reflect.String || err != nil {
+				return "must be a valid UUID", nil
+			}
+		default:
+			return "", fmt.Errorf("unknown validation rule %q", name)
+		}
+	}
+	return "", nil
+}
+
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return value.IsNil()
+	case reflect.Slice, reflect.Map, reflect.String:
+		return value.Len() == 0
+	}
+	return value.IsZero()
+}
+
+// measure – величина для min/max и единица для сообщения
+func measure(value reflect.Value) (float64, string) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), " characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(value.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), ""
+	}
+	return 0, "invalid"
+}
@@ -6,19 +6,35 @@ package model
 
 import (
 	"time"
+
+	"gorm.io/datatypes"
 )
 
 const TableNameCommand = "commands"
 
 // Command mapped from table <commands>
 type Command struct {
-	ID          string    `gorm:"column:id;primaryKey;default:gen_random_uuid()" json:"id"`
-	DeviceID    string    `gorm:"column:device_id" json:"device_id"`
-	CommandType string    `gorm:"column:command_type;not null" json:"command_type"`
-	UserID      string    `gorm:"column:user_id" json:"user_id"`
-	Status      string    `gorm:"column:status" json:"status"`
-	CreatedAt   time.Time `gorm:"column:created_at;not null;default:now()" json:"created_at"`
-	ExecutedAt  time.Time `gorm:"column:executed_at" json:"executed_at"`
+	ID                string         `gorm:"column:id;primaryKey;default:gen_random_uuid()" json:"id"`
+	DeviceID          string         `gorm:"column:device_id" json:"device_id"`
+	CommandType       string         `gorm:"column:command_type;not null" json:"command_type"`
+	UserID            string         `gorm:"column:user_id" json:"user_id"`
+	Status            string         `gorm:"column:status" json:"status"`
+	CreatedAt         time.Time      `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+	ExecutedAt        time.Time      `gorm:"column:executed_at" json:"executed_at"`
+	Result            datatypes.JSON `gorm:"column:result" json:"result"`
+	ErrorText         string         `gorm:"column:error_text" json:"error_text"`
+	SentAt            time.Time      `gorm:"column:sent_at" json:"sent_at"`
+	DeliveredAt       time.Time      `gorm:"column:delivered_at" json:"delivered_at"`
+	UpdatedAt         time.Time      `gorm:"column:updated_at;not null;default:now()" json:"updated_at"`
+	Params            datatypes.JSON `gorm:"column:params" json:"params"`
+	BatchID           string         `gorm:"column:batch_id" json:"batch_id"`
+	ExpiresAt         time.Time      `gorm:"column:expires_at" json:"expires_at"`
+	Attempts          int32          `gorm:"column:attempts;not null" json:"attempts"`
+	NextRetryAt       time.Time      `gorm:"column:next_retry_at" json:"next_retry_at"`
+	TTLSeconds        int32          `gorm:"column:ttl_seconds" json:"ttl_seconds"`
+	ApproverID        string         `gorm:"column:approver_id" json:"approver_id"`
+	ApprovalDecidedAt time.Time      `gorm:"column:approval_decided_at" json:"approval_decided_at"`
+	ApprovalReason    string         `gorm:"column:approval_reason" json:"approval_reason"`
 }
 
 // TableName Command's table name
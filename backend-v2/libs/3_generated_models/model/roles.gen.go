@@ -8,10 +8,12 @@ const TableNameRole = "roles"
 
 // Role mapped from table <roles>
 type Role struct {
-	ID          string `gorm:"column:id;primaryKey;default:gen_random_uuid()" json:"id"`
-	Name        string `gorm:"column:name" json:"name"`
-	Code        string `gorm:"column:code;not null" json:"code"`
-	Description string `gorm:"column:description" json:"description"`
+	ID               string `gorm:"column:id;primaryKey;default:gen_random_uuid()" json:"id"`
+	Name             string `gorm:"column:name" json:"name"`
+	Code             string `gorm:"column:code;not null" json:"code"`
+	Description      string `gorm:"column:description" json:"description"`
+	Priority         int32  `gorm:"column:priority;not null" json:"priority"`
+	RequireTwoFactor bool   `gorm:"column:require_two_factor;not null" json:"require_two_factor"`
 }
 
 // TableName Role's table name
@@ -2,6 +2,7 @@ package redis_manager
 
 import (
 	"context"
+	"os"
 	"time"
 
 	"backed-api-v2/libs/5_common/smart_context"
@@ -14,13 +15,16 @@ type RedisManager struct {
 	client *redis.Client
 }
 
-// NewRedisManager инициализирует подключение к Redis.
+// NewRedisManager инициализирует подключение к Redis (REDIS_ADDR, REDIS_PASSWORD).
 func NewRedisManager(sctx smart_context.ISmartContext) (*RedisManager, error) {
-	addr := "localhost:6379"
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
 	client := redis.NewClient(&redis.Options{
 		Addr:     addr,
-		Password: "", // по умолчанию без пароля
-		DB:       0,  // используется базовый DB
+		Password: os.Getenv("REDIS_PASSWORD"), // по умолчанию без пароля
+		DB:       0,                           // используется базовый DB
 	})
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -40,6 +44,37 @@ func (rm *RedisManager) GetValue(ctx context.Context, key string) (string, error
 	return rm.client.Get(ctx, key).Result()
 }
 
+// Exists проверяет, есть ли ключ в Redis.
+func (rm *RedisManager) Exists(ctx context.Context, key string) (bool, error) {
+	count, err := rm.client.Exists(ctx, key).Result()
+	return count > 0, err
+}
+
+// Increment увеличивает счетчик на 1 и возвращает новое значение. Время жизни задается при создании счетчика
+// и не продлевается последующими увеличениями.
+func (rm *RedisManager) Increment(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	count, err := rm.client.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if count == 1 {
+		if err := rm.client.Expire(ctx, key, expiration).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
+// TTL возвращает оставшееся время жизни ключа; для отсутствующего ключа или ключа без срока – значение <= 0.
+func (rm *RedisManager) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return rm.client.TTL(ctx, key).Result()
+}
+
+// Delete удаляет ключи.
+func (rm *RedisManager) Delete(ctx context.Context, keys ...string) error {
+	return rm.client.Del(ctx, keys...).Err()
+}
+
 // Publish публикует сообщение в указанный канал.
 func (rm *RedisManager) Publish(ctx context.Context, channel string, message interface{}) error {
 	return rm.client.Publish(ctx, channel, message).Err()
@@ -0,0 +1,221 @@
+package cron_expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule – разобранное cron выражение из 5 полей: минута час день_месяца месяц день_недели.
+// Поддерживаются *, списки (1,15), диапазоны (1-5), шаги (*/10, 0-30/5), имена месяцев и дней недели (JAN, MON)
+// и макросы @yearly, @monthly, @weekly, @daily, @hourly
+type Schedule struct {
+	minute     uint64
+	hour       uint64
+	dayOfMonth uint64
+	month      uint64
+	dayOfWeek  uint64
+
+	// как в классическом cron: если ограничены и день месяца, и день недели - подходит любой из них
+	domRestricted bool
+	dowRestricted bool
+}
+
+type field struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}}
+	// 7 - тоже воскресенье
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}}
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// максимальный горизонт поиска следующего запуска (на случай выражений вроде "0 0 30 2 *")
+const searchYears = 5
+
+// Parse разбирает cron выражение
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := macros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields (minute hour day-of-month month day-of-week), got %d", len(parts))
+	}
+
+	s := &Schedule{}
+	var err error
+	if s.minute, err = parseField(parts[0], minuteField); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(parts[1], hourField); err != nil {
+		return nil, err
+	}
+	if s.dayOfMonth, err = parseField(parts[2], domField); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(parts[3], monthField); err != nil {
+		return nil, err
+	}
+	if s.dayOfWeek, err = parseField(parts[4], dowField); err != nil {
+		return nil, err
+	}
+	if s.dayOfWeek&(1<<7) != 0 {
+		s.dayOfWeek |= 1 << 0
+	}
+	s.domRestricted = parts[2] != "*" && parts[2] != "?"
+	s.dowRestricted = parts[4] != "*" && parts[4] != "?"
+	return s, nil
+}
+
+func parseField(value string, f field) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(value, ",") {
+		itemBits, err := parseItem(item, f)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s '%s': %w", f.name, value, err)
+		}
+		bits |= itemBits
+	}
+	return bits, nil
+}
+
+func parseItem(item string, f field) (uint64, error) {
+	rangePart, step := item, 1
+	if i := strings.Index(item, "/"); i >= 0 {
+		rangePart = item[:i]
+		var err error
+		step, err = strconv.Atoi(item[i+1:])
+		if err != nil || step <= 0 {
+			return 0, fmt.Errorf("bad step '%s'", item[i+1:])
+		}
+	}
+
+	from, to := f.min, f.max
+	switch {
+	case rangePart == "*" || rangePart == "?":
+	case strings.Contains(rangePart, "-"):
+		bounds := strings.SplitN(rangePart, "-", 2)
+		var err error
+		if from, err = parseValue(bounds[0], f); err != nil {
+			return 0, err
+		}
+		if to, err = parseValue(bounds[1], f); err != nil {
+			return 0, err
+		}
+		if from > to {
+			return 0, fmt.Errorf("range start %d is greater than end %d", from, to)
+		}
+	default:
+		value, err := parseValue(rangePart, f)
+		if err != nil {
+			return 0, err
+		}
+		from = value
+		// "5/15" - начиная с 5 до конца диапазона
+		if step == 1 {
+			to = value
+		}
+	}
+
+	var bits uint64
+	for v := from; v <= to; v += step {
+		bits |= 1 << uint(v)
+	}
+	return bits, nil
+}
+
+func parseValue(value string, f field) (int, error) {
+	if n, ok := f.names[strings.ToUpper(value)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("bad value '%s'", value)
+	}
+	if n < f.min || n > f.max {
+		return 0, fmt.Errorf("value %d out of range %d-%d", n, f.min, f.max)
+	}
+	return n, nil
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := has(s.dayOfMonth, t.Day())
+	dowMatch := has(s.dayOfWeek, int(t.Weekday()))
+	if s.domRestricted && s.dowRestricted {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+// Next возвращает ближайшее время запуска строго после after (в часовом поясе after).
+// Если такого времени нет в пределах нескольких лет - возвращает нулевое время
+func (s *Schedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(searchYears, 0, 0)
+
+	for t.Before(limit) {
+		if !has(s.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !has(s.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if !has(s.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// NextN возвращает до n ближайших запусков после after (для предпросмотра расписания)
+func (s *Schedule) NextN(after time.Time, n int) []time.Time {
+	result := make([]time.Time, 0, n)
+	for len(result) < n {
+		next := s.Next(after)
+		if next.IsZero() {
+			break
+		}
+		result = append(result, next)
+		after = next
+	}
+	return result
+}
@@ -0,0 +1,87 @@
+package cron_expr
+
+import (
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestNext(t *testing.T) {
+	// четверг
+	after := date(2026, time.January, 1, 10, 30)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/15 * * * *", date(2026, time.January, 1, 10, 45)},
+		{"0 * * * *", date(2026, time.January, 1, 11, 0)},
+		{"30 10 * * *", date(2026, time.January, 2, 10, 30)}, // строго после after
+		{"5/20 * * * *", date(2026, time.January, 1, 10, 45)},
+		{"@daily", date(2026, time.January, 2, 0, 0)},
+		{"@hourly", date(2026, time.January, 1, 11, 0)},
+		{"@monthly", date(2026, time.February, 1, 0, 0)},
+		{"0 0 1 JAN *", date(2027, time.January, 1, 0, 0)},
+		{"0 9 * * MON-FRI", date(2026, time.January, 2, 9, 0)},
+		{"0 9 * * 1", date(2026, time.January, 5, 9, 0)},
+		{"0 0 * * 7", date(2026, time.January, 4, 0, 0)},    // 7 – воскресенье
+		{"0 12 13 * 5", date(2026, time.January, 2, 12, 0)}, // день месяца ИЛИ день недели
+		{"0 0 29 2 *", date(2028, time.February, 29, 0, 0)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			if got := schedule.Next(after); !got.Equal(tt.want) {
+				t.Errorf("Next = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextN(t *testing.T) {
+	schedule, err := Parse("0 */6 * * *")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := []time.Time{
+		date(2026, time.January, 1, 12, 0),
+		date(2026, time.January, 1, 18, 0),
+		date(2026, time.January, 2, 0, 0),
+	}
+	got := schedule.NextN(date(2026, time.January, 1, 10, 30), len(want))
+	if len(got) != len(want) {
+		t.Fatalf("NextN returned %d times, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("NextN[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * FOO *",
+		"a * * * *",
+	}
+	for _, expr := range tests {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q): want error", expr)
+		}
+	}
+}
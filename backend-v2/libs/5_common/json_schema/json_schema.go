@@ -0,0 +1,237 @@
+package json_schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Schema – подмножество JSON Schema, которого достаточно для описания параметров команд.
+// Поддерживаются type, properties, required, additionalProperties, enum, minimum/maximum,
+// minLength/maxLength, pattern, items, minItems/maxItems и default.
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Default              any                `json:"default,omitempty"`
+}
+
+// FieldError – ошибка валидации конкретного поля
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors – все найденные ошибки валидации
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	parts := make([]string, 0, len(e))
+	for _, fe := range e {
+		if fe.Field == "" {
+			parts = append(parts, fe.Message)
+		} else {
+			parts = append(parts, fmt.Sprintf("%s: %s", fe.Field, fe.Message))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Parse разбирает схему из JSON (например, из колонки БД)
+func Parse(data []byte) (*Schema, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var schema Schema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("invalid json schema: %w", err)
+	}
+	return &schema, nil
+}
+
+// Ptr – хелпер для заполнения числовых ограничений схемы
+func Ptr[T any](v T) *T {
+	return &v
+}
+
+// Normalize приводит значение к виду, который дает encoding/json (map[string]any, []any, float64...),
+// чтобы валидировать одинаково и уже раскодированные данные, и произвольные Go структуры.
+func Normalize(value any) (any, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var result any
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ApplyDefaults подставляет значения default для отсутствующих свойств объекта
+func (s *Schema) ApplyDefaults(value map[string]any) {
+	if s == nil || value == nil {
+		return
+	}
+	for name, prop := range s.Properties {
+		current, ok := value[name]
+		if !ok && prop.Default != nil {
+			value[name] = prop.Default
+			continue
+		}
+		if nested, isMap := current.(map[string]any); isMap {
+			prop.ApplyDefaults(nested)
+		}
+	}
+}
+
+// Validate проверяет значение по схеме. nil схема принимает любое значение.
+func (s *Schema) Validate(value any) ValidationErrors {
+	if s == nil {
+		return nil
+	}
+	var errs ValidationErrors
+	s.validate("", value, &errs)
+	return errs
+}
+
+func (s *Schema) validate(path string, value any, errs *ValidationErrors) {
+	add := func(format string, args ...any) {
+		*errs = append(*errs, FieldError{Field: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.Type != "" && !matchesType(s.Type, value) {
+		add("must be of type %s", s.Type)
+		return
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		add("must be one of %v", s.Enum)
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			add("must be at least %d characters long", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			add("must be at most %d characters long", *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			re, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				add("invalid pattern in schema: %v", err)
+			} else if !re.MatchString(v) {
+				add("must match pattern %s", s.Pattern)
+			}
+		}
+
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			add("must be >= %v", *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			add("must be <= %v", *s.Maximum)
+		}
+
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			add("must contain at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			add("must contain at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, FieldError{Field: joinPath(path, name), Message: "is required"})
+			}
+		}
+
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names) // стабильный порядок ошибок
+
+		for _, name := range names {
+			prop, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					*errs = append(*errs, FieldError{Field: joinPath(path, name), Message: "is not allowed"})
+				}
+				continue
+			}
+			prop.validate(joinPath(path, name), v[name], errs)
+		}
+	}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func matchesType(schemaType string, value any) bool {
+	switch schemaType {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == math.Trunc(f)
+	case "null":
+		return value == nil
+	default:
+		return true
+	}
+}
+
+func inEnum(enum []any, value any) bool {
+	for _, item := range enum {
+		normalized, err := Normalize(item)
+		if err != nil {
+			continue
+		}
+		if reflect.DeepEqual(normalized, value) {
+			return true
+		}
+	}
+	return false
+}
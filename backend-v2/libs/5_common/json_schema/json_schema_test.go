@@ -0,0 +1,90 @@
+package json_schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var testSchema = &Schema{
+	Type:                 "object",
+	Required:             []string{"path"},
+	AdditionalProperties: Ptr(false),
+	Properties: map[string]*Schema{
+		"path":    {Type: "string", MinLength: Ptr(1), MaxLength: Ptr(8), Pattern: "^/"},
+		"mode":    {Type: "string", Enum: []any{"fast", "full"}, Default: "fast"},
+		"retries": {Type: "integer", Minimum: Ptr(0.0), Maximum: Ptr(5.0)},
+		"tags":    {Type: "array", MaxItems: Ptr(2), Items: &Schema{Type: "string"}},
+		"options": {
+			Type:       "object",
+			Properties: map[string]*Schema{"depth": {Type: "integer", Default: 1}},
+		},
+	},
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  ValidationErrors
+	}{
+		{"valid", `{"path": "/tmp", "mode": "full", "retries": 3, "tags": ["a"]}`, nil},
+		{"not an object", `[]`, ValidationErrors{{Field: "", Message: "must be of type object"}}},
+		{"missing required", `{}`, ValidationErrors{{Field: "path", Message: "is required"}}},
+		{"additional property", `{"path": "/", "extra": 1}`, ValidationErrors{{Field: "extra", Message: "is not allowed"}}},
+		{"wrong type", `{"path": 5}`, ValidationErrors{{Field: "path", Message: "must be of type string"}}},
+		{"too long and no pattern", `{"path": "tmp/long/path"}`, ValidationErrors{
+			{Field: "path", Message: "must be at most 8 characters long"},
+			{Field: "path", Message: "must match pattern ^/"},
+		}},
+		{"not in enum", `{"path": "/", "mode": "slow"}`, ValidationErrors{{Field: "mode", Message: "must be one of [fast full]"}}},
+		{"not an integer", `{"path": "/", "retries": 1.5}`, ValidationErrors{{Field: "retries", Message: "must be of type integer"}}},
+		{"above maximum", `{"path": "/", "retries": 6}`, ValidationErrors{{Field: "retries", Message: "must be <= 5"}}},
+		{"too many items", `{"path": "/", "tags": ["a", "b", "c"]}`, ValidationErrors{{Field: "tags", Message: "must contain at most 2 items"}}},
+		{"wrong item type", `{"path": "/", "tags": ["a", 1]}`, ValidationErrors{{Field: "tags[1]", Message: "must be of type string"}}},
+		{"nested", `{"path": "/", "options": {"depth": "deep"}}`, ValidationErrors{{Field: "options.depth", Message: "must be of type integer"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value any
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatalf("bad test value: %v", err)
+			}
+			if got := testSchema.Validate(value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateNilSchema(t *testing.T) {
+	var schema *Schema
+	if errs := schema.Validate(map[string]any{"any": 1}); errs != nil {
+		t.Errorf("nil schema: got errors %v", errs)
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	value := map[string]any{"path": "/", "options": map[string]any{}}
+	testSchema.ApplyDefaults(value)
+
+	want := map[string]any{"path": "/", "mode": "fast", "options": map[string]any{"depth": 1}}
+	if !reflect.DeepEqual(value, want) {
+		t.Errorf("ApplyDefaults = %v, want %v", value, want)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	type params struct {
+		Path    string `json:"path"`
+		Retries int    `json:"retries"`
+	}
+	got, err := Normalize(params{Path: "/", Retries: 2})
+	if err != nil {
+		t.Fatalf("Normalize: %v", err)
+	}
+	want := map[string]any{"path": "/", "retries": float64(2)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Normalize = %#v, want %#v", got, want)
+	}
+}
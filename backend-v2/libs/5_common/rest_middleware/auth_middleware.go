@@ -0,0 +1,144 @@
+package rest_middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"backed-api-v2/libs/5_common/smart_context"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Identity – пользователь из проверенного JWT
+type Identity struct {
+	UserID    string
+	Username  string
+	Role      string
+	SessionID string // id сессии (auth_sessions), по нему проверяется отзыв токена
+
+	APIKey *smart_context.APIKeyScope // ограничения API ключа, если запрос аутентифицирован ключом, а не JWT
+}
+
+const IdentityKey = "auth_identity"
+
+// GetIdentity возвращает пользователя, проверенного Authenticate, или nil для открытых маршрутов
+func GetIdentity(ctx context.Context) *Identity {
+	if ctx == nil {
+		return nil
+	}
+	if identity, ok := ctx.Value(IdentityKey).(*Identity); ok {
+		return identity
+	}
+	return nil
+}
+
+// ParseToken проверяет подпись и срок действия JWT и возвращает пользователя из claims
+func ParseToken(tokenStr string) (*Identity, error) {
+	secret := getJWTSecret()
+	if secret == "" {
+		return nil, errors.New("JWT_SECRET is not set")
+	}
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(secret), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token claims")
+	}
+
+	identity := &Identity{}
+	identity.UserID, _ = claims["user_id"].(string)
+	identity.Username, _ = claims["username"].(string)
+	identity.Role, _ = claims["role"].(string)
+	identity.SessionID, _ = claims["sid"].(string)
+	if identity.UserID == "" || identity.Role == "" {
+		return nil, errors.New("user_id or role not found in token")
+	}
+	return identity, nil
+}
+
+// bearerToken извлекает токен из заголовка "Authorization: Bearer <token>"
+func bearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", errors.New("Authorization header missing")
+	}
+	parts := strings.Split(header, " ")
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || parts[1] == "" {
+		return "", errors.New("Invalid Authorization header format")
+	}
+	return parts[1], nil
+}
+
+// TokenValidator проверяет токен и возвращает пользователя. Кроме ParseToken, проверяет, не отозвана ли сессия
+type TokenValidator func(sctx smart_context.ISmartContext, token string) (*Identity, error)
+
+// APIKeyValidator проверяет API ключ из заголовка X-Api-Key и возвращает пользователя-владельца с ограничениями ключа
+type APIKeyValidator func(sctx smart_context.ISmartContext, key string) (*Identity, error)
+
+// Authenticate пропускает только запросы с валидным JWT или, если заголовка Authorization нет, API ключом (X-Api-Key)
+// и сохраняет пользователя в контексте запроса. run_processor переносит его в smart_context (GetUserID, GetUsername,
+// GetUserRole, GetAPIKeyScope)
+func Authenticate(sctx smart_context.ISmartContext, validate TokenValidator, validateAPIKey APIKeyValidator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if apiKey := r.Header.Get("X-Api-Key"); apiKey != "" && r.Header.Get("Authorization") == "" {
+				identity, err := validateAPIKey(sctx.WithContext(r.Context()).WithClientIP(ClientIP(sctx, r)), apiKey)
+				if err != nil {
+					writeError(w, r, http.StatusUnauthorized, "Invalid API key")
+					return
+				}
+				ctx := context.WithValue(r.Context(), IdentityKey, identity)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			tokenStr, err := bearerToken(r)
+			if err != nil {
+				writeError(w, r, http.StatusUnauthorized, err.Error())
+				return
+			}
+			identity, err := validate(sctx.WithContext(r.Context()), tokenStr)
+			if err != nil {
+				writeError(w, r, http.StatusUnauthorized, "Invalid token")
+				return
+			}
+			ctx := context.WithValue(r.Context(), IdentityKey, identity)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// UserSessionOnly закрывает маршруты для API ключей: профиль, 2FA и управление ключами доступны только
+// пользователю, вошедшему интерактивно
+func UserSessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if identity := GetIdentity(r.Context()); identity != nil && identity.APIKey != nil {
+			writeError(w, r, http.StatusForbidden, "Not available for API keys")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Public явно помечает маршруты, доступные без аутентификации (логин, WebSocket рукопожатие, тестовые).
+// Пользователь в контекст не попадает, даже если заголовок Authorization передан
+func Public(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+	})
+}
+
+func getJWTSecret() string {
+	return os.Getenv("JWT_SECRET")
+}
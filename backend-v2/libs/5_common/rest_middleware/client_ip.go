@@ -0,0 +1,41 @@
+package rest_middleware
+
+import (
+	"backed-api-v2/libs/5_common/smart_context"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+var proxyHeadersWarning sync.Once
+
+// ClientIP возвращает IP адрес клиента. Заголовкам X-Real-IP и X-Forwarded-For доверяем только за обратным прокси
+// (TRUST_PROXY_HEADERS=true): иначе клиент может подставить в них любой адрес.
+// Если заголовки приходят, а TRUST_PROXY_HEADERS не включен, один раз пишется предупреждение: за прокси все клиенты
+// получают адрес прокси, и счетчики попыток входа по IP блокируют всех сразу
+func ClientIP(sctx smart_context.ISmartContext, r *http.Request) string {
+	realIP := strings.TrimSpace(r.Header.Get("X-Real-IP"))
+	forwarded := r.Header.Get("X-Forwarded-For")
+	if os.Getenv("TRUST_PROXY_HEADERS") == "true" {
+		if realIP != "" {
+			return realIP
+		}
+		if forwarded != "" {
+			if ip := strings.TrimSpace(strings.Split(forwarded, ",")[0]); ip != "" {
+				return ip
+			}
+		}
+	} else if realIP != "" || forwarded != "" {
+		proxyHeadersWarning.Do(func() {
+			sctx.Warnf("Request from %s has X-Real-IP/X-Forwarded-For headers, but TRUST_PROXY_HEADERS is not enabled: "+
+				"client IP is the proxy address, login limits per IP apply to all clients behind it", r.RemoteAddr)
+		})
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
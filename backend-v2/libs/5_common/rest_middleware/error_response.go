@@ -0,0 +1,72 @@
+package rest_middleware
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Стабильные коды ошибок API (поле code ответа). Клиенты опираются на код, а не на текст сообщения
+const (
+	ErrorCodeBadRequest         = "bad_request"
+	ErrorCodeValidation         = "validation_failed"
+	ErrorCodeUnauthorized       = "unauthorized"
+	ErrorCodeForbidden          = "forbidden"
+	ErrorCodeNotFound           = "not_found"
+	ErrorCodeConflict           = "conflict"
+	ErrorCodeTooManyRequests    = "too_many_requests"
+	ErrorCodeInternal           = "internal_error"
+	ErrorCodeServiceUnavailable = "service_unavailable"
+)
+
+// ErrorResponse – тело ответа с ошибкой, единое для хендлеров и middleware
+type ErrorResponse struct {
+	Error     string `json:"error"` // сообщение для пользователя
+	Code      string `json:"code"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// ErrorCodeForStatus – код ошибки по умолчанию для HTTP статуса
+func ErrorCodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrorCodeBadRequest
+	case http.StatusUnauthorized:
+		return ErrorCodeUnauthorized
+	case http.StatusForbidden:
+		return ErrorCodeForbidden
+	case http.StatusNotFound:
+		return ErrorCodeNotFound
+	case http.StatusConflict:
+		return ErrorCodeConflict
+	case http.StatusUnprocessableEntity:
+		return ErrorCodeValidation
+	case http.StatusTooManyRequests:
+		return ErrorCodeTooManyRequests
+	case http.StatusServiceUnavailable:
+		return ErrorCodeServiceUnavailable
+	}
+	if status >= http.StatusInternalServerError {
+		return ErrorCodeInternal
+	}
+	return ErrorCodeBadRequest
+}
+
+// WriteError отвечает ошибкой в формате ErrorResponse. Пустой Code заполняется по статусу
+func WriteError(w http.ResponseWriter, status int, body ErrorResponse) error {
+	if body.Code == "" {
+		body.Code = ErrorCodeForStatus(status)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(body)
+}
+
+// writeError – ответ middleware, работающего до WithRequestId: request_id – из заголовка запроса или уже назначенный ответу
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	requestID := w.Header().Get("X-Request-Id")
+	if requestID == "" {
+		requestID = r.Header.Get("X-Request-Id")
+	}
+	_ = WriteError(w, status, ErrorResponse{Error: message, RequestID: requestID})
+}
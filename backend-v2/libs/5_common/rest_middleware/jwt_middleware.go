@@ -19,7 +19,7 @@ func WithRequestId(handler SmartHandlerFunc) SmartHandlerFunc {
 		if requestId == "" {
 			requestId = uuid.New().String()
 		}
-		sctx = sctx.WithField("request_id", requestId)
+		sctx = sctx.WithRequestID(requestId)
 		w.Header().Set("X-Request-Id", requestId)
 		handler(sctx, w, r)
 	}
@@ -58,7 +58,7 @@ func WithRecoverer(handler SmartHandlerFunc) SmartHandlerFunc {
 		defer func() {
 			if rec := recover(); rec != nil {
 				sctx.Errorf("Recovered from panic: %v\nStack: %s", rec, debug.Stack())
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				writeError(w, r, http.StatusInternalServerError, "Internal server error")
 			}
 		}()
 		handler(sctx, w, r)
@@ -88,7 +88,7 @@ func WithWaitGroup(smartHandler SmartHandlerFunc) SmartHandlerFunc {
 		// Проверяем, не закрыт ли контекст сервера.
 		if err := sctx.GetContext().Err(); err != nil {
 			sctx.Warnf("Server context is closed: %v. Cannot run request", err)
-			http.Error(w, "Server context is closed", http.StatusServiceUnavailable)
+			writeError(w, r, http.StatusServiceUnavailable, "Server context is closed")
 			return
 		}
 
@@ -0,0 +1,39 @@
+package rest_middleware
+
+import (
+	"net/http"
+
+	"backed-api-v2/libs/5_common/smart_context"
+)
+
+// PermissionChecker проверяет, что у роли есть право
+type PermissionChecker func(sctx smart_context.ISmartContext, roleCode string, permission string) (bool, error)
+
+// PermissionMiddleware возвращает обертку маршрута, которая пропускает только пользователей (проверенных Authenticate),
+// роль которых имеет заданное право. Для API ключа право должно быть еще и среди прав ключа. Использование: requirePermission := PermissionMiddleware(sctx, checker);
+// r.Get(path, requirePermission("devices:read", handler))
+func PermissionMiddleware(sctx smart_context.ISmartContext, check PermissionChecker) func(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return func(permission string, next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			identity := GetIdentity(r.Context())
+			if identity == nil {
+				writeError(w, r, http.StatusUnauthorized, "Authentication required")
+				return
+			}
+			allowed, err := check(sctx.WithContext(r.Context()), identity.Role, permission)
+			if err != nil {
+				sctx.Errorf("Error checking permission %s for role %s: %v", permission, identity.Role, err)
+				writeError(w, r, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			if identity.APIKey != nil && !identity.APIKey.HasPermission(permission) {
+				allowed = false
+			}
+			if !allowed {
+				writeError(w, r, http.StatusForbidden, "Insufficient privileges")
+				return
+			}
+			next(w, r)
+		}
+	}
+}
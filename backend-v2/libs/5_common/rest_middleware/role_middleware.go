@@ -1,72 +1,40 @@
 package rest_middleware
 
 import (
-	"fmt"
 	"net/http"
-	"os"
-	"strings"
-
-	"github.com/golang-jwt/jwt/v4"
 )
 
-// RoleMiddleware проверяет, что токен (из заголовка Authorization) содержит роль,
-// достаточную для доступа к данному ресурсу.
-// Пример: для admin необходимо, чтобы роль была "admin".
+// RoleMiddleware проверяет, что роль пользователя, проверенного Authenticate,
+// достаточна для доступа к данному ресурсу.
+// Пример: для ADMIN необходимо, чтобы роль была "ADMIN".
+// Маршруты API проверяют права (PermissionMiddleware), роль – только служебные маршруты (pprof).
+// API ключам служебные маршруты недоступны.
 func RoleMiddleware(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		tokenStr := r.Header.Get("Authorization")
-		if tokenStr == "" {
-			http.Error(w, "Authorization header missing", http.StatusUnauthorized)
-			return
-		}
-		parts := strings.Split(tokenStr, " ")
-		if len(parts) != 2 {
-			http.Error(w, "Invalid Authorization header format", http.StatusUnauthorized)
-			return
-		}
-		tokenStr = parts[1]
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			secret := []byte(getJWTSecret())
-			return secret, nil
-		})
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-			return
-		}
-		userRole, ok := claims["role"].(string)
-		if !ok {
-			http.Error(w, "Role not found in token", http.StatusUnauthorized)
+		identity := GetIdentity(r.Context())
+		if identity == nil {
+			writeError(w, r, http.StatusUnauthorized, "Authentication required")
 			return
 		}
-		if !roleSufficient(userRole, requiredRole) {
-			http.Error(w, "Insufficient privileges", http.StatusForbidden)
+		if identity.APIKey != nil || !roleSufficient(identity.Role, requiredRole) {
+			writeError(w, r, http.StatusForbidden, "Insufficient privileges")
 			return
 		}
 		next(w, r)
 	}
 }
 
-func roleSufficient(userRole, requiredRole string) bool {
-	rolePriority := map[string]int{
-		"observer":  1,
-		"observer+": 2,
-		"admin":     3,
-	}
-	return rolePriority[userRole] >= rolePriority[requiredRole]
+// rolePriority – приоритеты ролей по кодам из таблицы roles (roles.priority)
+var rolePriority = map[string]int{
+	"OBSERVER":      1,
+	"OBSERVER_PLUS": 2,
+	"ADMIN":         3,
 }
 
-func getJWTSecret() string {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "defaultsecret"
+func roleSufficient(userRole, requiredRole string) bool {
+	required, ok := rolePriority[requiredRole]
+	if !ok {
+		return false // неизвестная требуемая роль не должна открывать доступ всем
 	}
-	return secret
+	return rolePriority[userRole] >= required
 }
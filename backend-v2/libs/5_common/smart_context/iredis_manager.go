@@ -0,0 +1,18 @@
+package smart_context
+
+import (
+	"context"
+	"time"
+)
+
+// IRedisManager определяет интерфейс для работы с Redis (он совпадает с методами redis_manager.RedisManager).
+// Redis необязателен: если его нет, GetRedisManager возвращает nil и данные берутся из Postgres
+type IRedisManager interface {
+	SetValue(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+	GetValue(ctx context.Context, key string) (string, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Increment(ctx context.Context, key string, expiration time.Duration) (int64, error)
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	Delete(ctx context.Context, keys ...string) error
+	Publish(ctx context.Context, channel string, message interface{}) error
+}
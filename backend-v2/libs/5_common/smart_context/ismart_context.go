@@ -52,9 +52,32 @@ type ISmartContext interface {
 	WithSessionId(session string) ISmartContext
 	GetSessionId() string
 
+	// Id запроса (X-Request-Id, rest_middleware.WithRequestId)
+	WithRequestID(requestID string) ISmartContext
+	GetRequestID() string
+
+	// Аутентифицированный пользователь запроса (заполняется из проверенного JWT)
+	WithUserID(userID string) ISmartContext
+	GetUserID() string
+	WithUsername(username string) ISmartContext
+	GetUsername() string
+	WithUserRole(role string) ISmartContext
+	GetUserRole() string
+
+	// Ограничения API ключа, если запрос аутентифицирован ключом (X-Api-Key), иначе nil
+	WithAPIKeyScope(scope *APIKeyScope) ISmartContext
+	GetAPIKeyScope() *APIKeyScope
+
+	// IP адрес клиента HTTP запроса (rest_middleware.ClientIP)
+	WithClientIP(ip string) ISmartContext
+	GetClientIP() string
+
 	WithGeocoder(geocoderInstance IGeocoder) ISmartContext
 	GetGeocoder() IGeocoder
 
+	WithRedisManager(redisManager IRedisManager) ISmartContext
+	GetRedisManager() IRedisManager
+
 	// WithMinioManager(minioManager IMinioManager) ISmartContext
 	// GetMinioManager() IMinioManager
 }
@@ -2,6 +2,7 @@ package smart_context
 
 import (
 	"backed-api-v2/libs/5_common/types"
+	"slices"
 	"sync"
 )
 
@@ -19,6 +20,21 @@ func (sc *SmartContext) GetSessionId() string {
 	return result
 }
 
+const REQUEST_ID_KEY = "request_id"
+
+func (sc *SmartContext) WithRequestID(requestID string) ISmartContext {
+	return sc.WithField(REQUEST_ID_KEY, requestID)
+}
+
+// GetRequestID возвращает id запроса (X-Request-Id) или пустую строку
+func (sc *SmartContext) GetRequestID() string {
+	result, ok := types.GetFieldTypedValue[string](sc.dataFields, REQUEST_ID_KEY)
+	if !ok {
+		return ""
+	}
+	return result
+}
+
 const WAIT_GROUP = "wait_group"
 
 func (sc *SmartContext) WithWaitGroup(wg *sync.WaitGroup) ISmartContext {
@@ -64,3 +80,110 @@ func (sc *SmartContext) GetGeocoder() IGeocoder {
 	}
 	return result
 }
+
+// Данные аутентифицированного пользователя (из проверенного JWT)
+const (
+	USER_ID_KEY   = "user_id"
+	USERNAME_KEY  = "username"
+	USER_ROLE_KEY = "user_role"
+)
+
+func (sc *SmartContext) WithUserID(userID string) ISmartContext {
+	return sc.WithField(USER_ID_KEY, userID)
+}
+
+// GetUserID возвращает id аутентифицированного пользователя или пустую строку
+func (sc *SmartContext) GetUserID() string {
+	result, ok := types.GetFieldTypedValue[string](sc.dataFields, USER_ID_KEY)
+	if !ok {
+		return ""
+	}
+	return result
+}
+
+func (sc *SmartContext) WithUsername(username string) ISmartContext {
+	return sc.WithField(USERNAME_KEY, username)
+}
+
+// GetUsername возвращает имя аутентифицированного пользователя или пустую строку
+func (sc *SmartContext) GetUsername() string {
+	result, ok := types.GetFieldTypedValue[string](sc.dataFields, USERNAME_KEY)
+	if !ok {
+		return ""
+	}
+	return result
+}
+
+func (sc *SmartContext) WithUserRole(role string) ISmartContext {
+	return sc.WithField(USER_ROLE_KEY, role)
+}
+
+// GetUserRole возвращает код роли аутентифицированного пользователя или пустую строку
+func (sc *SmartContext) GetUserRole() string {
+	result, ok := types.GetFieldTypedValue[string](sc.dataFields, USER_ROLE_KEY)
+	if !ok {
+		return ""
+	}
+	return result
+}
+
+const API_KEY_SCOPE_KEY = "api_key_scope"
+
+// APIKeyScope – ограничения API ключа: ключ действует от имени создателя, но только с правами Permissions
+// и, если GroupIDs не пуст, только с устройствами этих групп
+type APIKeyScope struct {
+	ID          string
+	Name        string
+	Permissions []string
+	GroupIDs    []string
+}
+
+// HasPermission проверяет, что право входит в права ключа
+func (s *APIKeyScope) HasPermission(permission string) bool {
+	return slices.Contains(s.Permissions, permission)
+}
+
+func (sc *SmartContext) WithAPIKeyScope(scope *APIKeyScope) ISmartContext {
+	return sc.WithField(API_KEY_SCOPE_KEY, scope)
+}
+
+// GetAPIKeyScope возвращает ограничения API ключа запроса или nil для запросов пользователя
+func (sc *SmartContext) GetAPIKeyScope() *APIKeyScope {
+	result, ok := types.GetFieldTypedValue[*APIKeyScope](sc.dataFields, API_KEY_SCOPE_KEY)
+	if !ok {
+		return nil
+	}
+	return result
+}
+
+const CLIENT_IP_KEY = "client_ip"
+
+func (sc *SmartContext) WithClientIP(ip string) ISmartContext {
+	return sc.WithField(CLIENT_IP_KEY, ip)
+}
+
+// GetClientIP возвращает IP адрес клиента HTTP запроса или пустую строку
+func (sc *SmartContext) GetClientIP() string {
+	result, ok := types.GetFieldTypedValue[string](sc.dataFields, CLIENT_IP_KEY)
+	if !ok {
+		return ""
+	}
+	return result
+}
+
+// REDIS_MANAGER_KEY – ключ для хранения менеджера Redis в dataFields.
+const REDIS_MANAGER_KEY = "redis_manager"
+
+// WithRedisManager возвращает новый SmartContext с добавленным менеджером Redis.
+func (sc *SmartContext) WithRedisManager(redisManager IRedisManager) ISmartContext {
+	return sc.WithField(REDIS_MANAGER_KEY, redisManager)
+}
+
+// GetRedisManager извлекает из SmartContext менеджер Redis или nil, если Redis недоступен.
+func (sc *SmartContext) GetRedisManager() IRedisManager {
+	result, ok := types.GetFieldTypedValue[IRedisManager](sc.dataFields, REDIS_MANAGER_KEY)
+	if !ok {
+		return nil
+	}
+	return result
+}
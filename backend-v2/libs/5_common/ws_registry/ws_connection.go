@@ -0,0 +1,177 @@
+package ws_registry
+
+import (
+	"backed-api-v2/libs/5_common/smart_context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	ErrConnectionClosed = errors.New("websocket connection is closed")
+	ErrQueueFull        = errors.New("websocket outbound queue is full")
+	ErrSendTimeout      = errors.New("websocket send timeout")
+)
+
+// DropPolicy определяет, что делать, если очередь исходящих сообщений заполнена.
+type DropPolicy int
+
+const (
+	DropPolicyBlock  DropPolicy = iota // ждем освобождения места не дольше timeout
+	DropPolicyNewest                   // отбрасываем новое сообщение (ErrQueueFull)
+	DropPolicyOldest                   // выкидываем самое старое сообщение из очереди, новое ставим (для стримов: кадры, аудио)
+)
+
+const (
+	DefaultQueueSize   = 256
+	DefaultSendTimeout = 5 * time.Second
+)
+
+// OutboundMessage – сообщение в очереди на отправку
+type OutboundMessage struct {
+	Sctx smart_context.ISmartContext // чтобы логгировать под тем же request id
+	Type int                         // WebSocket message type (e.g., TextMessage, PingMessage)
+	Data []byte                      // Actual message data
+}
+
+// Connection – WebSocket соединение с ограниченной очередью исходящих сообщений.
+// gorilla/websocket не позволяет писать в соединение из нескольких горутин,
+// поэтому все писатели кладут сообщения в очередь, а пишет в сокет только одна горутина (writePump).
+type Connection struct {
+	id          string // session id - для списка зрителей и логов
+	remoteAddr  string
+	connectedAt time.Time
+
+	conn  *websocket.Conn
+	queue chan OutboundMessage
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func NewConnection(id string, conn *websocket.Conn, queueSize int) *Connection {
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	return &Connection{
+		id:          id,
+		remoteAddr:  conn.RemoteAddr().String(),
+		connectedAt: time.Now(),
+		conn:        conn,
+		queue:       make(chan OutboundMessage, queueSize),
+		closed:      make(chan struct{}),
+	}
+}
+
+func (c *Connection) ID() string {
+	return c.id
+}
+
+func (c *Connection) RemoteAddr() string {
+	return c.remoteAddr
+}
+
+func (c *Connection) ConnectedAt() time.Time {
+	return c.connectedAt
+}
+
+// Conn возвращает исходное соединение. Писать в него напрямую можно только из writePump!
+func (c *Connection) Conn() *websocket.Conn {
+	return c.conn
+}
+
+// Queue возвращает очередь исходящих сообщений для writePump
+func (c *Connection) Queue() <-chan OutboundMessage {
+	return c.queue
+}
+
+// Done закрывается, когда соединение закрыто
+func (c *Connection) Done() <-chan struct{} {
+	return c.closed
+}
+
+func (c *Connection) IsClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close помечает соединение закрытым: новые сообщения не принимаются, writePump завершается.
+// Безопасно вызывать несколько раз.
+func (c *Connection) Close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+}
+
+// SendText ставит текстовое сообщение в очередь, ожидая место не дольше DefaultSendTimeout
+func (c *Connection) SendText(sctx smart_context.ISmartContext, data []byte) error {
+	return c.Send(sctx, websocket.TextMessage, data, DropPolicyBlock, DefaultSendTimeout)
+}
+
+// Send ставит сообщение в очередь на отправку согласно политике policy.
+// timeout используется только для DropPolicyBlock (0 - ждать до отмены контекста или закрытия соединения).
+func (c *Connection) Send(sctx smart_context.ISmartContext, msgType int, data []byte, policy DropPolicy, timeout time.Duration) error {
+	if c.IsClosed() {
+		return ErrConnectionClosed
+	}
+
+	msg := OutboundMessage{
+		Sctx: sctx,
+		Type: msgType,
+		Data: data,
+	}
+
+	// быстрый путь - место в очереди есть
+	select {
+	case c.queue <- msg:
+		return nil
+	default:
+	}
+
+	switch policy {
+	case DropPolicyNewest:
+		return ErrQueueFull
+
+	case DropPolicyOldest:
+		for {
+			select {
+			case <-c.closed:
+				return ErrConnectionClosed
+			case c.queue <- msg:
+				return nil
+			default:
+			}
+			// очередь заполнена - выкидываем самое старое сообщение и пробуем снова
+			select {
+			case dropped := <-c.queue:
+				sctx.Debugf("WebSocket connection: outbound queue is full, dropped oldest message (%d bytes)", len(dropped.Data))
+			default:
+			}
+		}
+
+	default:
+		var timeoutChan <-chan time.Time
+		if timeout > 0 {
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			timeoutChan = timer.C
+		}
+
+		select {
+		case c.queue <- msg:
+			return nil
+		case <-c.closed:
+			return ErrConnectionClosed
+		case <-sctx.GetContext().Done():
+			return sctx.GetContext().Err()
+		case <-timeoutChan:
+			return ErrSendTimeout
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package ws_registry
+
+import (
+	"backed-api-v2/libs/5_common/smart_context"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// FrontendUser – пользователь фронтенд сессии, по нему выбираются получатели уведомлений и закрываемые соединения
+type FrontendUser struct {
+	UserID    string
+	SessionID string // id сессии входа (auth_sessions), с которой получен JWT
+}
+
+var (
+	frontends      = make(map[*Connection]FrontendUser) // все зарегистрированные фронтенд сессии - для общих уведомлений
+	frontendsMutex sync.RWMutex
+)
+
+// AddFrontend регистрирует фронтенд сессию пользователя для общих уведомлений (не привязанных к устройству)
+func AddFrontend(conn *Connection, user FrontendUser) {
+	frontendsMutex.Lock()
+	defer frontendsMutex.Unlock()
+	frontends[conn] = user
+}
+
+// RemoveFrontend удаляет фронтенд сессию из общих уведомлений
+func RemoveFrontend(conn *Connection) {
+	frontendsMutex.Lock()
+	defer frontendsMutex.Unlock()
+	delete(frontends, conn)
+}
+
+// FrontendUserIDs возвращает id пользователей, у которых есть открытые фронтенд сессии
+func FrontendUserIDs() []string {
+	frontendsMutex.RLock()
+	defer frontendsMutex.RUnlock()
+
+	seen := make(map[string]bool, len(frontends))
+	userIDs := make([]string, 0, len(frontends))
+	for conn, user := range frontends {
+		if conn.IsClosed() || seen[user.UserID] {
+			continue
+		}
+		seen[user.UserID] = true
+		userIDs = append(userIDs, user.UserID)
+	}
+	return userIDs
+}
+
+// SendToFrontends рассылает сообщение фронтенд сессиям пользователей, для которых allow возвращает true.
+// Возвращает количество получателей
+func SendToFrontends(sctx smart_context.ISmartContext, data []byte, allow func(user FrontendUser) bool) int {
+	frontendsMutex.RLock()
+	targets := make([]*Connection, 0, len(frontends))
+	for conn, user := range frontends {
+		if allow(user) {
+			targets = append(targets, conn)
+		}
+	}
+	frontendsMutex.RUnlock()
+
+	sent := 0
+	for _, conn := range targets {
+		err := conn.Send(sctx, websocket.TextMessage, data, DropPolicyBlock, DefaultSendTimeout)
+		if err == ErrConnectionClosed {
+			RemoveFrontend(conn)
+			continue
+		}
+		if err != nil {
+			sctx.Warnf("Failed to send to frontend session %s: %v", conn.ID(), err)
+			continue
+		}
+		sent++
+	}
+	return sent
+}
+
+// CloseFrontends закрывает фронтенд соединения, для которых match возвращает true (например, при отзыве сессии):
+// клиент получает CloseMessage, новые сообщения, в том числе стримы устройств, в соединение больше не ставятся.
+// Возвращает количество закрытых соединений
+func CloseFrontends(sctx smart_context.ISmartContext, match func(user FrontendUser) bool, reason string) int {
+	frontendsMutex.RLock()
+	var targets []*Connection
+	for conn, user := range frontends {
+		if match(user) {
+			targets = append(targets, conn)
+		}
+	}
+	frontendsMutex.RUnlock()
+
+	for _, conn := range targets {
+		closeMessage := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason)
+		if err := conn.Send(sctx, websocket.CloseMessage, closeMessage, DropPolicyOldest, 0); err != nil && err != ErrConnectionClosed {
+			sctx.Warnf("Failed to send close message to frontend session %s: %v", conn.ID(), err)
+		}
+		// writePump допишет CloseMessage из очереди и закроет сокет
+		conn.Close()
+		RemoveFrontend(conn)
+	}
+	return len(targets)
+}
@@ -2,17 +2,15 @@ package ws_registry
 
 import (
 	"sync"
-
-	"github.com/gorilla/websocket"
 )
 
 var (
-	clients      = make(map[string]*websocket.Conn) // ключ – deviceId
+	clients      = make(map[string]*Connection) // ключ – deviceId
 	clientsMutex sync.RWMutex
 )
 
 // SetClient сохраняет соединение для указанного deviceId.
-func SetClient(deviceId string, conn *websocket.Conn) {
+func SetClient(deviceId string, conn *Connection) {
 	clientsMutex.Lock()
 	defer clientsMutex.Unlock()
 	clients[deviceId] = conn
@@ -26,20 +24,38 @@ func RemoveClient(deviceId string) {
 }
 
 // GetClient возвращает соединение для указанного deviceId.
-func GetClient(deviceId string) (*websocket.Conn, bool) {
+// Закрытые соединения не возвращаются и удаляются из реестра.
+func GetClient(deviceId string) (*Connection, bool) {
 	clientsMutex.RLock()
-	defer clientsMutex.RUnlock()
 	conn, ok := clients[deviceId]
-	return conn, ok
+	clientsMutex.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	if conn.IsClosed() {
+		clientsMutex.Lock()
+		if clients[deviceId] == conn {
+			delete(clients, deviceId)
+		}
+		clientsMutex.Unlock()
+		return nil, false
+	}
+	return conn, true
 }
 
-func RemoveConnection(conn *websocket.Conn) {
+// RemoveConnection удаляет соединение из реестра, из всех подписок и из списка фронтендов.
+// Возвращает снятые подписки (см. UnsubscribeAll): при повторном вызове – пустые
+func RemoveConnection(conn *Connection) map[string][]string {
 	clientsMutex.Lock()
-	defer clientsMutex.Unlock()
 	for key, c := range clients {
 		if c == conn {
 			delete(clients, key)
-			break
 		}
 	}
+	clientsMutex.Unlock()
+
+	removed := UnsubscribeAll(conn)
+	RemoveFrontend(conn)
+	return removed
 }
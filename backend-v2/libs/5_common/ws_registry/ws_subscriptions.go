@@ -0,0 +1,203 @@
+package ws_registry
+
+import (
+	"backed-api-v2/libs/5_common/smart_context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Топики устройства, на которые может подписаться фронтенд
+const (
+	TopicCameraFrame   = "camera_frame"
+	TopicCaptureFrame  = "capture_frame"
+	TopicScreenshot    = "screenshot"
+	TopicAudioStream   = "audio_stream"
+	TopicRecordedAudio = "recorded_audio"
+	TopicStatus        = "status"
+)
+
+// AllTopics – топики по умолчанию, если при подписке не указаны конкретные
+var AllTopics = []string{
+	TopicCameraFrame,
+	TopicCaptureFrame,
+	TopicScreenshot,
+	TopicAudioStream,
+	TopicRecordedAudio,
+	TopicStatus,
+}
+
+func IsKnownTopic(topic string) bool {
+	for _, t := range AllTopics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// Viewer – информация о фронтенд сессии, подписанной на устройство
+type Viewer struct {
+	SessionID    string    `json:"session_id"`
+	RemoteAddr   string    `json:"remote_addr"`
+	Topics       []string  `json:"topics"`
+	SubscribedAt time.Time `json:"subscribed_at"`
+}
+
+type subscription struct {
+	topics       map[string]bool
+	subscribedAt time.Time
+}
+
+var (
+	subscriptions      = make(map[string]map[*Connection]*subscription) // ключ – deviceId
+	subscriptionsMutex sync.RWMutex
+)
+
+// Subscribe подписывает соединение на топики устройства. Повторная подписка добавляет топики к уже имеющимся.
+func Subscribe(deviceId string, conn *Connection, topics []string) {
+	if len(topics) == 0 {
+		topics = AllTopics
+	}
+
+	subscriptionsMutex.Lock()
+	defer subscriptionsMutex.Unlock()
+
+	subscribers, ok := subscriptions[deviceId]
+	if !ok {
+		subscribers = make(map[*Connection]*subscription)
+		subscriptions[deviceId] = subscribers
+	}
+
+	sub, ok := subscribers[conn]
+	if !ok {
+		sub = &subscription{
+			topics:       make(map[string]bool),
+			subscribedAt: time.Now(),
+		}
+		subscribers[conn] = sub
+	}
+	for _, topic := range topics {
+		sub.topics[topic] = true
+	}
+}
+
+// Unsubscribe отписывает соединение от топиков устройства. Без топиков – от устройства целиком.
+// Возвращает топики, на которые соединение действительно было подписано (отсортированы)
+func Unsubscribe(deviceId string, conn *Connection, topics []string) []string {
+	subscriptionsMutex.Lock()
+	defer subscriptionsMutex.Unlock()
+
+	subscribers, ok := subscriptions[deviceId]
+	if !ok {
+		return nil
+	}
+	sub, ok := subscribers[conn]
+	if !ok {
+		return nil
+	}
+
+	var removed []string
+	if len(topics) == 0 {
+		for topic := range sub.topics {
+			removed = append(removed, topic)
+		}
+	}
+	for _, topic := range topics {
+		if sub.topics[topic] {
+			delete(sub.topics, topic)
+			removed = append(removed, topic)
+		}
+	}
+	if len(topics) == 0 || len(sub.topics) == 0 {
+		delete(subscribers, conn)
+	}
+	if len(subscribers) == 0 {
+		delete(subscriptions, deviceId)
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+// UnsubscribeAll отписывает соединение от всех устройств (при отключении).
+// Возвращает снятые подписки: топики по id устройства
+func UnsubscribeAll(conn *Connection) map[string][]string {
+	subscriptionsMutex.Lock()
+	defer subscriptionsMutex.Unlock()
+
+	removed := make(map[string][]string)
+	for deviceId, subscribers := range subscriptions {
+		if sub, ok := subscribers[conn]; ok {
+			topics := make([]string, 0, len(sub.topics))
+			for topic := range sub.topics {
+				topics = append(topics, topic)
+			}
+			sort.Strings(topics)
+			removed[deviceId] = topics
+			delete(subscribers, conn)
+		}
+		if len(subscribers) == 0 {
+			delete(subscriptions, deviceId)
+		}
+	}
+	return removed
+}
+
+// Publish рассылает сообщение всем подписчикам топика устройства. Возвращает количество получателей.
+// Для стримов используется DropPolicyOldest, чтобы медленный зритель не тормозил остальных.
+func Publish(sctx smart_context.ISmartContext, deviceId string, topic string, data []byte, policy DropPolicy) int {
+	subscriptionsMutex.RLock()
+	var targets []*Connection
+	for conn, sub := range subscriptions[deviceId] {
+		if sub.topics[topic] {
+			targets = append(targets, conn)
+		}
+	}
+	subscriptionsMutex.RUnlock()
+
+	sent := 0
+	for _, conn := range targets {
+		err := conn.Send(sctx, websocket.TextMessage, data, policy, DefaultSendTimeout)
+		if err == ErrConnectionClosed {
+			// подписки закрытого соединения снимает его владелец (RemoveConnection), чтобы записать конец просмотра
+			continue
+		}
+		if err != nil {
+			sctx.Warnf("Failed to publish %s of device %s to session %s: %v", topic, deviceId, conn.ID(), err)
+			continue
+		}
+		sent++
+	}
+	return sent
+}
+
+// ListViewers возвращает фронтенд сессии, подписанные на устройство
+func ListViewers(deviceId string) []Viewer {
+	subscriptionsMutex.RLock()
+	defer subscriptionsMutex.RUnlock()
+
+	viewers := make([]Viewer, 0, len(subscriptions[deviceId]))
+	for conn, sub := range subscriptions[deviceId] {
+		if conn.IsClosed() {
+			continue
+		}
+		topics := make([]string, 0, len(sub.topics))
+		for topic := range sub.topics {
+			topics = append(topics, topic)
+		}
+		sort.Strings(topics)
+
+		viewers = append(viewers, Viewer{
+			SessionID:    conn.ID(),
+			RemoteAddr:   conn.RemoteAddr(),
+			Topics:       topics,
+			SubscribedAt: sub.subscribedAt,
+		})
+	}
+	sort.Slice(viewers, func(i, j int) bool {
+		return viewers[i].SubscribedAt.Before(viewers[j].SubscribedAt)
+	})
+	return viewers
+}
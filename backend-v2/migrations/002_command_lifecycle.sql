@@ -0,0 +1,14 @@
+-- Жизненный цикл команды: статусы доставки/выполнения и результат, который прислал агент
+INSERT INTO statuses ("name", code, context) VALUES('delivered', 'DELIVERED', 'commands') ON CONFLICT (code) DO NOTHING;
+INSERT INTO statuses ("name", code, context) VALUES('running', 'RUNNING', 'commands') ON CONFLICT (code) DO NOTHING;
+INSERT INTO statuses ("name", code, context) VALUES('failed', 'FAILED', 'commands') ON CONFLICT (code) DO NOTHING;
+INSERT INTO statuses ("name", code, context) VALUES('timed out', 'TIMED_OUT', 'commands') ON CONFLICT (code) DO NOTHING;
+INSERT INTO statuses ("name", code, context) VALUES('cancelled', 'CANCELLED', 'commands') ON CONFLICT (code) DO NOTHING;
+
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS result JSONB;
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS error_text TEXT;
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS sent_at TIMESTAMP;
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS delivered_at TIMESTAMP;
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS commands_device_id_status_idx ON commands (device_id, status);
@@ -0,0 +1,2 @@
+-- Параметры команды (проверяются по схеме из каталога команд перед сохранением)
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS params JSONB;
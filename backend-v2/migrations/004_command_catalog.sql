@@ -0,0 +1,48 @@
+-- Приоритет ролей: чем больше, тем больше прав. Используется для минимальной роли команды
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS priority INTEGER NOT NULL DEFAULT 0;
+
+UPDATE roles SET priority = 1 WHERE code = 'OBSERVER';
+UPDATE roles SET priority = 2 WHERE code = 'OBSERVER_PLUS';
+UPDATE roles SET priority = 3 WHERE code = 'ADMIN';
+
+-- Каталог команд агента: описание, схема параметров, уровень опасности и минимальная роль
+CREATE TABLE IF NOT EXISTS command_catalog (
+    command_type TEXT PRIMARY KEY NOT NULL,
+    description TEXT,
+    params_schema JSONB NOT NULL DEFAULT '{"type": "object", "additionalProperties": false}',
+    danger_level TEXT NOT NULL DEFAULT 'low' CHECK (danger_level IN ('low', 'medium', 'high', 'critical')),
+    min_role_code TEXT NOT NULL REFERENCES roles(code),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO command_catalog (command_type, description, danger_level, min_role_code) VALUES
+    ('start_camera', 'Start camera stream', 'high', 'OBSERVER_PLUS'),
+    ('stop_camera', 'Stop camera stream', 'low', 'OBSERVER_PLUS'),
+    ('capture_frame', 'Capture a single camera frame', 'high', 'OBSERVER_PLUS'),
+    ('start_mic', 'Start microphone stream', 'high', 'OBSERVER_PLUS'),
+    ('stop_mic', 'Stop microphone stream', 'low', 'OBSERVER_PLUS'),
+    ('screenshot', 'Take a screenshot', 'medium', 'OBSERVER_PLUS'),
+    ('enable_usb', 'Enable USB storage ports', 'medium', 'ADMIN'),
+    ('disable_usb', 'Disable USB storage ports', 'high', 'ADMIN')
+ON CONFLICT (command_type) DO NOTHING;
+
+INSERT INTO command_catalog (command_type, description, params_schema, danger_level, min_role_code) VALUES
+    ('record_audio', 'Record audio from microphone and send it back', '{
+        "type": "object",
+        "additionalProperties": false,
+        "properties": {
+            "duration": {"type": "integer", "description": "Recording duration in seconds", "minimum": 1, "maximum": 300, "default": 5}
+        }
+    }', 'high', 'OBSERVER_PLUS'),
+    ('create_vpn', 'Create VPN connection on the device', '{
+        "type": "object",
+        "additionalProperties": false,
+        "required": ["server_address"],
+        "properties": {
+            "name": {"type": "string", "description": "VPN connection name", "minLength": 1, "maxLength": 64, "pattern": "^[A-Za-z0-9 _.\\-]+$", "default": "MyVPN"},
+            "server_address": {"type": "string", "description": "VPN server host name or IP address", "minLength": 1, "maxLength": 253, "pattern": "^[A-Za-z0-9.\\-:]+$"},
+            "tunnel_type": {"type": "string", "description": "VPN tunnel type", "enum": ["L2tp", "Pptp", "Sstp", "Ikev2", "Automatic"], "default": "L2tp"}
+        }
+    }', 'critical', 'ADMIN')
+ON CONFLICT (command_type) DO NOTHING;
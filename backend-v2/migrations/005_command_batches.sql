@@ -0,0 +1,15 @@
+-- Массовые команды: одна запись батча и по строке commands на каждое целевое устройство
+CREATE TABLE IF NOT EXISTS command_batches (
+    id TEXT PRIMARY KEY DEFAULT gen_random_uuid() NOT NULL,
+    command_type TEXT NOT NULL REFERENCES command_catalog(command_type),
+    params JSONB,
+    target JSONB NOT NULL DEFAULT '{}', -- как выбирали устройства: группа, список id или фильтр
+    user_id TEXT REFERENCES users(id),
+    total_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS batch_id TEXT REFERENCES command_batches(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS commands_batch_id_status_idx ON commands (batch_id, status);
+CREATE INDEX IF NOT EXISTS devices_group_id_idx ON devices (group_id);
@@ -0,0 +1,21 @@
+-- Отложенные и повторяющиеся команды. При срабатывании создается батч (command_batches) с обычными строками commands
+CREATE TABLE IF NOT EXISTS command_schedules (
+    id TEXT PRIMARY KEY DEFAULT gen_random_uuid() NOT NULL,
+    name TEXT NOT NULL,
+    command_type TEXT NOT NULL REFERENCES command_catalog(command_type),
+    params JSONB,
+    target JSONB NOT NULL DEFAULT '{}', -- устройство (device_ids) или группа (group_id)
+    cron_expr TEXT NOT NULL DEFAULT '', -- повторяющееся расписание, либо
+    run_at TIMESTAMP,                   -- однократный запуск
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at TIMESTAMP,
+    last_run_at TIMESTAMP,
+    last_batch_id TEXT REFERENCES command_batches(id) ON DELETE SET NULL,
+    last_error TEXT,
+    user_id TEXT REFERENCES users(id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS command_schedules_enabled_next_run_at_idx ON command_schedules (enabled, next_run_at);
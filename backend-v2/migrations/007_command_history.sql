@@ -0,0 +1,4 @@
+-- Индексы для истории команд (GET /api/commands): keyset пагинация по времени и фильтр по инициатору
+CREATE INDEX IF NOT EXISTS commands_created_at_id_idx ON commands (created_at, id);
+CREATE INDEX IF NOT EXISTS commands_updated_at_id_idx ON commands (updated_at, id);
+CREATE INDEX IF NOT EXISTS commands_user_id_idx ON commands (user_id);
@@ -0,0 +1,15 @@
+-- Срок жизни команд, повторная отправка неподтвержденных и отмена
+INSERT INTO statuses ("name", code, context) VALUES('expired', 'EXPIRED', 'commands') ON CONFLICT (code) DO NOTHING;
+
+-- TTL команды по умолчанию (секунды). Можно переопределить при отправке
+ALTER TABLE command_catalog ADD COLUMN IF NOT EXISTS default_ttl_seconds INTEGER NOT NULL DEFAULT 86400 CHECK (default_ttl_seconds > 0);
+
+-- стримы и снимки через сутки уже никому не нужны
+UPDATE command_catalog SET default_ttl_seconds = 600 WHERE command_type IN ('start_camera', 'stop_camera', 'capture_frame', 'start_mic', 'stop_mic', 'screenshot', 'record_audio');
+
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS next_retry_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS commands_status_expires_at_idx ON commands (status, expires_at);
+CREATE INDEX IF NOT EXISTS commands_status_next_retry_at_idx ON commands (status, next_retry_at);
@@ -0,0 +1,13 @@
+-- Подтверждение опасных команд вторым администратором
+INSERT INTO statuses ("name", code, context) VALUES('awaiting approval', 'AWAITING_APPROVAL', 'commands') ON CONFLICT (code) DO NOTHING;
+INSERT INTO statuses ("name", code, context) VALUES('rejected', 'REJECTED', 'commands') ON CONFLICT (code) DO NOTHING;
+
+ALTER TABLE command_catalog ADD COLUMN IF NOT EXISTS requires_approval BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE command_catalog SET requires_approval = TRUE WHERE command_type IN ('disable_usb', 'create_vpn', 'start_camera', 'start_mic');
+
+-- ttl_seconds: срок жизни после подтверждения (пока команда ждет подтверждения, expires_at – срок ожидания)
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS ttl_seconds INTEGER;
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS approver_id TEXT REFERENCES users(id);
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS approval_decided_at TIMESTAMP;
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS approval_reason TEXT;
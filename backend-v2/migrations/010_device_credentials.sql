@@ -0,0 +1,4 @@
+-- Учетные данные устройств для WebSocket: хэш (sha256) секрета, который устройство передает в register_device.
+-- У уже зарегистрированных устройств секрета нет – он будет выдан при следующем подключении
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS secret_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS secret_issued_at TIMESTAMP;
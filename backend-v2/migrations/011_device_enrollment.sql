@@ -0,0 +1,21 @@
+-- Регистрация устройств по токенам: без валидного токена новое устройство ждет подтверждения администратора
+INSERT INTO statuses ("name", code, context) VALUES('pending approval', 'PENDING_APPROVAL', 'device') ON CONFLICT (code) DO NOTHING;
+-- REJECTED уже есть (добавлен для команд), для отклоненных устройств используем тот же код
+
+-- Токен хранится только в виде хэша (sha256), сам токен показывается один раз при создании
+CREATE TABLE IF NOT EXISTS enrollment_tokens (
+    id TEXT PRIMARY KEY DEFAULT gen_random_uuid() NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    description TEXT,
+    group_id TEXT REFERENCES device_groups(id) ON DELETE SET NULL, -- группа, в которую попадет устройство
+    max_uses INTEGER NOT NULL DEFAULT 1 CHECK (max_uses > 0),
+    use_count INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    created_by TEXT REFERENCES users(id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS enrollment_token_id TEXT REFERENCES enrollment_tokens(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS devices_status_idx ON devices (status);
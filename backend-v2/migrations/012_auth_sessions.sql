@@ -0,0 +1,17 @@
+-- Сессии пользователей: короткоживущий access JWT (с sid сессии) и ротируемый refresh токен.
+-- Refresh токен хранится только в виде хэша (sha256), при каждом обновлении выдается новый.
+-- previous_token_hash – предыдущий токен: его повторное предъявление означает утечку, сессия отзывается
+CREATE TABLE IF NOT EXISTS auth_sessions (
+    id TEXT PRIMARY KEY DEFAULT gen_random_uuid() NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    refresh_token_hash TEXT NOT NULL UNIQUE,
+    previous_token_hash TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    refreshed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    revoke_reason TEXT
+);
+
+CREATE INDEX IF NOT EXISTS auth_sessions_user_id_idx ON auth_sessions (user_id);
+CREATE INDEX IF NOT EXISTS auth_sessions_previous_token_hash_idx ON auth_sessions (previous_token_hash);
@@ -0,0 +1,74 @@
+-- Права доступа: маршруты API проверяют именованное право, роль получает права через role_permissions.
+-- Связи ролей и прав можно менять во время работы (PUT /api/roles/{code}/permissions)
+CREATE TABLE IF NOT EXISTS permissions (
+    code TEXT PRIMARY KEY NOT NULL,
+    description TEXT
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_code TEXT NOT NULL REFERENCES roles(code) ON DELETE CASCADE,
+    permission_code TEXT NOT NULL REFERENCES permissions(code) ON DELETE CASCADE,
+    PRIMARY KEY (role_code, permission_code)
+);
+
+INSERT INTO permissions (code, description) VALUES
+    ('devices:read', 'View devices, their viewers, metrics and applications'),
+    ('devices:enroll', 'Manage enrollment tokens and approve or reject new devices'),
+    ('device_groups:read', 'View device groups'),
+    ('device_groups:manage', 'Create, edit and delete device groups, assign devices to groups'),
+    ('commands:read', 'View command catalog, history and batches'),
+    ('commands:send', 'Send commands to devices (each command type also requires its own permission)'),
+    ('commands:cancel', 'Cancel pending commands'),
+    ('commands:approve', 'Approve or reject dangerous commands as the second administrator'),
+    ('commands:send:camera', 'Send camera commands'),
+    ('commands:send:microphone', 'Send microphone commands'),
+    ('commands:send:screen', 'Send screenshot commands'),
+    ('commands:send:usb', 'Send USB port commands'),
+    ('commands:send:vpn', 'Send VPN commands'),
+    ('schedules:read', 'View command schedules'),
+    ('schedules:write', 'Create and edit command schedules'),
+    ('schedules:delete', 'Delete command schedules'),
+    ('users:manage', 'View and register users, change their roles'),
+    ('roles:manage', 'Edit role permissions')
+ON CONFLICT (code) DO NOTHING;
+
+-- Права, которые раньше давала минимальная роль маршрута (приоритет роли, roles.priority)
+INSERT INTO role_permissions (role_code, permission_code)
+SELECT r.code, p.code
+FROM roles r
+JOIN (VALUES
+    ('devices:read', 'OBSERVER'),
+    ('devices:enroll', 'ADMIN'),
+    ('device_groups:read', 'OBSERVER'),
+    ('device_groups:manage', 'ADMIN'),
+    ('commands:read', 'OBSERVER'),
+    ('commands:send', 'OBSERVER'),
+    ('commands:cancel', 'OBSERVER_PLUS'),
+    ('commands:approve', 'ADMIN'),
+    ('schedules:read', 'OBSERVER'),
+    ('schedules:write', 'OBSERVER'),
+    ('schedules:delete', 'OBSERVER_PLUS'),
+    ('users:manage', 'ADMIN'),
+    ('roles:manage', 'ADMIN')
+) AS p (code, min_role_code) ON TRUE
+JOIN roles m ON m.code = p.min_role_code
+WHERE r.priority >= m.priority
+ON CONFLICT DO NOTHING;
+
+-- Право на тип команды: если задано, заменяет проверку по min_role_code
+ALTER TABLE command_catalog ADD COLUMN IF NOT EXISTS permission_code TEXT REFERENCES permissions(code) ON DELETE SET NULL;
+
+UPDATE command_catalog SET permission_code = 'commands:send:camera' WHERE command_type IN ('start_camera', 'stop_camera', 'capture_frame');
+UPDATE command_catalog SET permission_code = 'commands:send:microphone' WHERE command_type IN ('start_mic', 'stop_mic', 'record_audio');
+UPDATE command_catalog SET permission_code = 'commands:send:screen' WHERE command_type = 'screenshot';
+UPDATE command_catalog SET permission_code = 'commands:send:usb' WHERE command_type IN ('enable_usb', 'disable_usb');
+UPDATE command_catalog SET permission_code = 'commands:send:vpn' WHERE command_type = 'create_vpn';
+
+-- Права на типы команд выдаем тем же ролям, что проходили проверку по min_role_code
+INSERT INTO role_permissions (role_code, permission_code)
+SELECT DISTINCT r.code, c.permission_code
+FROM command_catalog c
+JOIN roles m ON m.code = c.min_role_code
+JOIN roles r ON r.priority >= m.priority
+WHERE c.permission_code IS NOT NULL
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,17 @@
+-- Группы устройств, назначенные пользователям: пользователь без права devices:all_groups
+-- видит и управляет только устройствами этих групп
+CREATE TABLE IF NOT EXISTS user_device_groups (
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    group_id TEXT NOT NULL REFERENCES device_groups(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, group_id)
+);
+
+CREATE INDEX IF NOT EXISTS user_device_groups_group_id_idx ON user_device_groups (group_id);
+
+INSERT INTO permissions (code, description) VALUES
+    ('devices:all_groups', 'Access devices of all groups, including devices without a group')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO role_permissions (role_code, permission_code) VALUES ('ADMIN', 'devices:all_groups')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,17 @@
+-- Приглашения пользователей: администратор создает приглашение (email, роль, группы устройств, срок),
+-- приглашенный регистрируется по коду через POST /api/auth/accept-invite. Код одноразовый, хранится только хэш (sha256)
+CREATE TABLE IF NOT EXISTS invitations (
+    id TEXT PRIMARY KEY DEFAULT gen_random_uuid() NOT NULL,
+    code_hash TEXT NOT NULL UNIQUE,
+    email TEXT NOT NULL,
+    role_code TEXT NOT NULL REFERENCES roles(code),
+    group_ids JSONB NOT NULL DEFAULT '[]', -- группы устройств нового пользователя (user_device_groups)
+    expires_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP,
+    accepted_user_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+    revoked_at TIMESTAMP,
+    created_by TEXT REFERENCES users(id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS invitations_email_idx ON invitations (email);
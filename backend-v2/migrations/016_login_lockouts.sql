@@ -0,0 +1,17 @@
+-- Блокировки входа после серии неудачных попыток (по аккаунту – email, и по IP адресу).
+-- Сами счетчики живут в Redis (или в памяти), таблица – журнал блокировок для аудита и снятия администратором
+CREATE TABLE IF NOT EXISTS login_lockouts (
+    id TEXT PRIMARY KEY DEFAULT gen_random_uuid() NOT NULL,
+    subject_type TEXT NOT NULL CHECK (subject_type IN ('account', 'ip')),
+    subject TEXT NOT NULL, -- email (в нижнем регистре) или IP адрес
+    user_id TEXT REFERENCES users(id) ON DELETE SET NULL, -- пользователь с этим email, если он существует
+    client_ip TEXT NOT NULL DEFAULT '', -- IP последней неудачной попытки
+    failed_attempts INTEGER NOT NULL,
+    locked_until TIMESTAMP NOT NULL,
+    unlocked_at TIMESTAMP,
+    unlocked_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS login_lockouts_subject_idx ON login_lockouts (subject_type, subject);
+CREATE INDEX IF NOT EXISTS login_lockouts_created_at_idx ON login_lockouts (created_at);
@@ -0,0 +1,22 @@
+-- Двухфакторная аутентификация (TOTP, RFC 6238). Пока enabled_at NULL, секрет ожидает подтверждения кодом.
+-- last_used_step – последний принятый временной шаг: один и тот же код нельзя использовать дважды
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret TEXT NOT NULL, -- base32
+    enabled_at TIMESTAMP,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Одноразовые коды восстановления на случай потери устройства с TOTP. Хранится только хэш (sha256)
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id TEXT PRIMARY KEY DEFAULT gen_random_uuid() NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, code_hash)
+);
+
+-- Политика: пользователи роли без настроенной 2FA при входе обязаны ее настроить
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS require_two_factor BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,26 @@
+-- API ключи для автоматизации (заголовок X-Api-Key вместо JWT). Ключ действует от имени создателя,
+-- но только с правами permissions и, если group_ids не пуст, только с устройствами этих групп.
+-- Сам ключ показывается один раз при создании, хранится только хэш (sha256); key_prefix – для опознания ключа в списке
+CREATE TABLE IF NOT EXISTS api_keys (
+    id TEXT PRIMARY KEY DEFAULT gen_random_uuid() NOT NULL,
+    name TEXT NOT NULL,
+    key_prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    permissions JSONB NOT NULL DEFAULT '[]',
+    group_ids JSONB NOT NULL DEFAULT '[]',
+    expires_at TIMESTAMP, -- NULL – бессрочный
+    last_used_at TIMESTAMP,
+    last_used_ip TEXT NOT NULL DEFAULT '',
+    created_by TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_created_by_idx ON api_keys (created_by);
+
+INSERT INTO permissions (code, description) VALUES
+    ('api_keys:manage', 'Create, list and revoke API keys')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO role_permissions (role_code, permission_code) VALUES ('ADMIN', 'api_keys:manage')
+ON CONFLICT DO NOTHING;
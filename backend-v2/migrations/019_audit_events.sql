@@ -0,0 +1,45 @@
+-- Журнал аудита: кто и когда изменил пользователей, группы, устройства, отправил команду или смотрел медиа устройства.
+-- Записи только добавляются (audit.Record), изменение и удаление запрещены триггером.
+-- Внешних ключей нет намеренно: запись должна пережить удаление пользователя или группы
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    actor_id TEXT NOT NULL DEFAULT '', -- пусто – действие без аутентифицированного пользователя (например, неудачный вход)
+    actor_name TEXT NOT NULL DEFAULT '',
+    api_key_id TEXT NOT NULL DEFAULT '', -- если запрос выполнен API ключом
+    action TEXT NOT NULL, -- <область>.<действие>, например user.role_changed
+    target_type TEXT NOT NULL DEFAULT '',
+    target_id TEXT NOT NULL DEFAULT '',
+    before JSONB, -- измененные поля до действия, NULL – объект создан
+    after JSONB, -- измененные поля после действия, NULL – объект удален
+    request_id TEXT NOT NULL DEFAULT '',
+    client_ip TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_created_at_idx ON audit_events (created_at);
+CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events (actor_id, id);
+CREATE INDEX IF NOT EXISTS audit_events_target_idx ON audit_events (target_type, target_id, id);
+CREATE INDEX IF NOT EXISTS audit_events_action_idx ON audit_events (action, id);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events;
+CREATE TRIGGER audit_events_no_truncate
+    BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+
+INSERT INTO permissions (code, description) VALUES
+    ('audit:read', 'View and export the audit log')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO role_permissions (role_code, permission_code) VALUES ('ADMIN', 'audit:read')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,5 @@
+-- Устройства, зарегистрированные до появления учетных данных (без секрета), ждут подтверждения администратора:
+-- device_identifier не секрет, и выдавать секрет первому подключившемуся с ним нельзя.
+-- После подтверждения (или по токену регистрации) секрет выдается при следующем подключении
+UPDATE devices SET status = 'PENDING_APPROVAL', updated_at = NOW()
+WHERE secret_hash = '' AND status <> 'REJECTED';
@@ -5,6 +5,7 @@ import websocket
 from clientV2.config import settings
 from clientV2.core.services.logger_service import LoggerService
 from clientV2.utils.device_id import get_device_id
+from clientV2.utils.device_secret import get_device_secret, save_device_secret
 from clientV2.adapters.devices import camera_adapter, microphone_adapter, screenshot_adapter
 
 logger = LoggerService()
@@ -19,6 +20,7 @@ class WSClient:
         self.stop_event = threading.Event()
         self.thread = None
         self.on_message_callback = None  # Функция обратного вызова для входящих сообщений
+        self.reconnect_interval = settings.RECONNECT_INTERVAL
 
     def connect(self):
         while not self.stop_event.is_set():
@@ -35,20 +37,25 @@ class WSClient:
                 self.ws.run_forever()
             except Exception as e:
                 logger.error(f"WebSocket connection error: {e}")
-            logger.info("Connection lost. Reconnecting in 5 seconds...")
-            time.sleep(5)
+            delay = self.reconnect_interval
+            self.reconnect_interval = settings.RECONNECT_INTERVAL
+            logger.info(f"Connection lost. Reconnecting in {delay} seconds...")
+            time.sleep(delay)
 
     def on_open(self, ws):
         with self.lock:
             self.connected = True
 
+        secret = get_device_secret()
+        payload = {"secret": secret} if secret else {"enrollment_token": settings.ENROLLMENT_TOKEN}
         register_message = {
             "action": "register_device",
-            "device_key": get_device_id()
+            "device_key": get_device_id(),
+            "payload": payload
         }
         try:
             ws.send(json.dumps(register_message))
-            logger.info(f"Sent registration message: {register_message}")
+            logger.info(f"Sent registration message for device: {register_message['device_key']}")
             logger.info(f"WebSocket connection established")
             camera_adapter.set_ws_client(self)
             microphone_adapter.set_ws_client(self)
@@ -57,10 +64,39 @@ class WSClient:
             logger.error(f"Error sending registration message: {e}")
 
     def on_message(self, ws, message):
+        if self.handle_connection_message(message):
+            return
         logger.info(f"Message received: {message}")
         if self.on_message_callback:
             self.on_message_callback(message)
 
+    def handle_connection_message(self, message):
+        """
+        Обрабатывает служебные сообщения соединения (выдача секрета, ошибки аутентификации).
+        Возвращает True, если сообщение обработано и не должно уходить в обработчик команд.
+        """
+        try:
+            data = json.loads(message)
+        except (ValueError, TypeError):
+            return False
+        if not isinstance(data, dict):
+            return False
+
+        action = data.get("action")
+        payload = data.get("payload") or {}
+        if action == "device_credentials" and payload.get("secret"):
+            save_device_secret(payload["secret"])
+            logger.info("Device secret received from server and saved")
+            return True
+        if action == "error" and payload.get("code") == "unauthorized":
+            logger.error(f"Server rejected device credentials: {payload.get('message')}")
+            return True
+        if action == "error" and payload.get("code") == "pending_approval":
+            logger.warn("Device is waiting for administrator approval")
+            self.reconnect_interval = settings.PENDING_APPROVAL_RECONNECT_INTERVAL
+            return True
+        return False
+
     def on_error(self, ws, error):
         logger.error(f"WebSocket error: {error}")
 
@@ -4,3 +4,8 @@ import os
 SERVER_WS_URL = os.getenv("SERVER_WS_URL", "ws://127.0.0.1:9000/ws")
 METRICS_INTERVAL = int(os.getenv("METRICS_INTERVAL", 600))
 HEARTBEAT_INTERVAL = int(os.getenv("HEARTBEAT_INTERVAL", 120))
+# Токен регистрации, выданный администратором. Нужен только при первом подключении, пока у устройства нет секрета
+ENROLLMENT_TOKEN = os.getenv("ENROLLMENT_TOKEN", "")
+# Пока устройство ждет подтверждения администратора, переподключаемся реже
+RECONNECT_INTERVAL = int(os.getenv("RECONNECT_INTERVAL", 5))
+PENDING_APPROVAL_RECONNECT_INTERVAL = int(os.getenv("PENDING_APPROVAL_RECONNECT_INTERVAL", 60))
@@ -1,5 +1,6 @@
 import json
 import time
+from collections import OrderedDict
 from clientV2.core.services.logger_service import LoggerService
 from clientV2.adapters.devices import camera_adapter, screenshot_adapter, microphone_adapter
 from clientV2.core.use_cases import vpn_connection, usb_ports, send_recorded_audio
@@ -19,33 +20,124 @@ COMMAND_HANDLERS = {
     "disable_usb": usb_ports.disable_usb_ports,  # отключение USB-портов
 }
 
+# Сервер повторно отправляет команду, если не получил подтверждение. Запоминаем последние команды,
+# чтобы не выполнять их повторно, а только заново отправить результат.
+MAX_REMEMBERED_COMMANDS = 200
+_finished_commands = OrderedDict()   # command_id -> (status, result, error)
+_cancelled_commands = OrderedDict()  # command_id -> reason
+
+
+def _remember(storage: OrderedDict, command_id, value):
+    storage[command_id] = value
+    storage.move_to_end(command_id)
+    while len(storage) > MAX_REMEMBERED_COMMANDS:
+        storage.popitem(last=False)
+
+
+def handle_cancel(data: dict, logger: LoggerService):
+    """Запоминает отмененную сервером команду, чтобы не выполнять ее, если она еще не началась."""
+    payload = data.get("payload") or {}
+    command_id = payload.get("command_id")
+    if not command_id:
+        return
+    _remember(_cancelled_commands, command_id, payload.get("reason", ""))
+    logger.info(f"Command {command_id} cancelled by server: {payload.get('reason', '')}")
+
+
+def parse_command(message: str):
+    """
+    Разбирает входящее сообщение сервера.
+    Команда приходит конвертом {"action": "command", "payload": {"id": ..., "command": ..., "params": {...}}}.
+    Возвращает (command_id, command, params) или (None, None, None), если это не команда.
+    """
+    try:
+        data = json.loads(message)
+    except (ValueError, TypeError):
+        # старый формат - голая строка с именем команды
+        return None, message.lower().strip(), {}
+
+    if not isinstance(data, dict) or data.get("action") != "command":
+        return None, None, None
+
+    payload = data.get("payload") or {}
+    params = payload.get("params") or {}
+    return payload.get("id"), str(payload.get("command", "")).lower().strip(), params
+
+
+def send_command_ack(ws_client, command_id, action: str, status: str, result=None, error: str = "", logger: LoggerService = None):
+    """Отправляет серверу статус выполнения команды по её id."""
+    message = {
+        "action": action,
+        "device_key": get_device_id(),  # Идентификатор устройства
+        "payload": {
+            "command_id": command_id,
+            "status": status,
+            "result": result,
+            "error": error,
+            "timestamp": int(time.time())
+        }
+    }
+    try:
+        ws_client.send_message(json.dumps(message))
+        if logger:
+            logger.info(f"Sent {action} ({status}) for command {command_id}.")
+    except Exception as e:
+        if logger:
+            logger.error(f"Error sending {action} message: {e}")
+
+
 def process_command(ws_client, command: str, logger: LoggerService):
     """
-    Обрабатывает команду, выполняет соответствующий обработчик и, если команда распознана,
-    отправляет подтверждение серверу с действием "command_executed".
+    Обрабатывает команду, выполняет соответствующий обработчик и отправляет серверу
+    подтверждение по id команды: RUNNING перед выполнением, затем "command_executed" с результатом или ошибкой.
     """
-    cmd = command.lower().strip()
-    logger.info(f"Processing command: {cmd}")
+    try:
+        data = json.loads(command)
+    except (ValueError, TypeError):
+        data = None
+    if isinstance(data, dict) and data.get("action") == "cancel_command":
+        handle_cancel(data, logger)
+        return
+
+    command_id, cmd, params = parse_command(command)
+    if not cmd:
+        return
+
+    if command_id in _cancelled_commands:
+        logger.info(f"Skipping cancelled command: {cmd} ({command_id})")
+        return
+
+    if command_id in _finished_commands:
+        # повторная отправка - команда уже выполнена, подтверждение потерялось
+        status, result, error = _finished_commands[command_id]
+        logger.info(f"Command {command_id} already executed, resending result.")
+        send_command_ack(ws_client, command_id, "command_executed", status, result=result, error=error, logger=logger)
+        return
+
+    logger.info(f"Processing command: {cmd} ({command_id})")
     handler = COMMAND_HANDLERS.get(cmd)
-    if handler:
-        result = handler()  # Вызываем обработчик; если функция что-то возвращает, можно обработать результат.
+    if not handler:
+        logger.info(f"Unknown command received: {command}")
+        if command_id:
+            send_command_ack(ws_client, command_id, "command_executed", "FAILED",
+                             error=f"unknown command '{cmd}'", logger=logger)
+        return
+
+    if command_id:
+        send_command_ack(ws_client, command_id, "command_ack", "RUNNING", logger=logger)
+
+    result, error = None, ""
+    try:
+        # Параметры уже проверены сервером по схеме команды; если функция что-то возвращает, отправляем как результат.
+        result = handler(**params)
         logger.info(f"Command '{cmd}' executed successfully.")
-        
-
-        # Формируем сообщение подтверждения
-        confirmation_message = {
-            "action": "command_executed",
-            "device_key": get_device_id(),  # Идентификатор устройства
-            "payload": {
-                "command": cmd,
-                "timestamp": int(time.time())
-            }
-        }
+    except Exception as e:
+        error = str(e)
+        logger.error(f"Command '{cmd}' failed: {e}")
 
-        try:
-            ws_client.send_message(json.dumps(confirmation_message))
-            logger.info("Sent command_executed confirmation message.")
-        except Exception as e:
-            logger.error(f"Error sending command_executed message: {e}")
-    else:
-        logger.info(f"Unknown command received: {command}")
\ No newline at end of file
+    if command_id:
+        status = "FAILED" if error else "EXECUTED"
+        result = result if isinstance(result, (dict, list, str, int, float, bool)) else None
+        _remember(_finished_commands, command_id, (status, result, error))
+        send_command_ack(ws_client, command_id, "command_executed", status,
+                         result=result, error=error, logger=logger)
@@ -6,8 +6,8 @@ from clientV2.utils.device_id import get_device_id
 
 logger = LoggerService()
 
-def send_recorded_audio():
-    audio_bytes = microphone_adapter.record_audio(duration=5)
+def send_recorded_audio(duration=5):
+    audio_bytes = microphone_adapter.record_audio(duration=duration)
     if audio_bytes is None:
         logger.error("Audio recording failed.")
         return
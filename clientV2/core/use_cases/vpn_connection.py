@@ -3,13 +3,11 @@ from clientV2.core.services.logger_service import LoggerService
 
 logger = LoggerService()
 
-def create_vpn_connection():
-    vpn_name = "MyVPN"
-    server_address = "vpn.example.com"
+def create_vpn_connection(server_address, name="MyVPN", tunnel_type="L2tp"):
     command = [
         "powershell",
         "-Command",
-        f"Add-VpnConnection -Name \"{vpn_name}\" -ServerAddress \"{server_address}\" -TunnelType L2tp -Force -PassThru"
+        f"Add-VpnConnection -Name \"{name}\" -ServerAddress \"{server_address}\" -TunnelType {tunnel_type} -Force -PassThru"
     ]
     try:
         output = subprocess.check_output(command, stderr=subprocess.STDOUT, text=True)
@@ -0,0 +1,23 @@
+import os
+
+DEVICE_SECRET_FILE = os.path.join(os.path.expanduser("~"), ".clientv2_device_secret")
+
+
+def get_device_secret():
+    """
+    Возвращает секрет устройства, выданный сервером, или None, если его еще нет.
+    Секрет передается в register_device при каждом подключении.
+    """
+    if os.path.exists(DEVICE_SECRET_FILE):
+        with open(DEVICE_SECRET_FILE, "r") as f:
+            secret = f.read().strip()
+            if secret:
+                return secret
+    return None
+
+
+def save_device_secret(secret: str):
+    """Сохраняет секрет, выданный сервером (action device_credentials). Файл доступен только владельцу."""
+    fd = os.open(DEVICE_SECRET_FILE, os.O_WRONLY | os.O_CREAT | os.O_TRUNC, 0o600)
+    with os.fdopen(fd, "w") as f:
+        f.write(secret)
@@ -13,7 +13,8 @@ export const AudioStream: React.FC<AudioStreamProps> = ({ deviceId }) => {
             // Отправляем регистрацию, если нужно
             const registrationMessage = {
                 action: 'register_frontend',
-                device_key: deviceId
+                device_key: deviceId,
+                payload: { token: localStorage.getItem('token') }
             };
             ws.send(JSON.stringify(registrationMessage));
         };
@@ -23,7 +23,8 @@ export const AudioStreamMic: React.FC<AudioStreamMicProps> = ({ deviceId }) => {
             // Регистрируем фронтенд-клиента
             const registrationMessage = {
                 action: 'register_frontend',
-                device_key: deviceId
+                device_key: deviceId,
+                payload: { token: localStorage.getItem('token') }
             };
             ws.send(JSON.stringify(registrationMessage));
         };
@@ -14,7 +14,8 @@ export const CameraStream: React.FC<CameraStreamProps> = ({ id }) => {
             console.info(`WS connection opened for frontend client with id: ${id}`);
             const registrationMessage = {
                 action: 'register_frontend',
-                device_key: id
+                device_key: id,
+                payload: { token: localStorage.getItem('token') }
             };
             ws.send(JSON.stringify(registrationMessage));
         };
@@ -15,7 +15,7 @@ import {
     Badge
 } from 'antd';
 import type { MenuProps, TabsProps } from 'antd';
-import instance from 'service/api';
+import instance, { fetchAll } from 'service/api';
 import { MapContainer, Marker, Popup, TileLayer } from 'react-leaflet';
 import 'leaflet/dist/leaflet.css';
 import { CameraStream } from 'components/CameraStream/CameraStream';
@@ -116,8 +116,7 @@ export const ClientDetails: React.FC = () => {
 
     const fetchApps = async () => {
         try {
-            const res = await instance.get<Application[]>(`/api/apps/${id}`);
-            setApps(res.data);
+            setApps(await fetchAll<Application>(`/api/apps/${id}`));
         } catch (err) {
             message.error('Ошибка при получении списка приложений');
         }
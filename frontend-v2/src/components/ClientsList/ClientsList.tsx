@@ -13,7 +13,7 @@ import {
     ConfigProvider
 } from 'antd';
 import { useNavigate } from 'react-router-dom';
-import instance from 'service/api';
+import instance, { fetchAll, Page } from 'service/api';
 
 interface Device {
     id: string;
@@ -102,17 +102,20 @@ export const ClientsList: React.FC = () => {
     const fetchDevices = async () => {
         setLoading(true);
         try {
-            const [devicesRes, metricsRes] = await Promise.all([
-                instance.get<Device[]>('/api/devices'),
-                instance.get<Metric[]>('/api/metrics')
+            // метрик может быть очень много: берем одну страницу свежих и оставляем последнюю метрику каждого устройства
+            const [devices, metricsRes] = await Promise.all([
+                fetchAll<Device>('/api/devices'),
+                instance.get<Page<Metric>>('/api/metrics', { params: { sort: '-created_at', limit: 500 } })
             ]);
 
             const metricsMap: { [key: string]: Metric } = {};
-            metricsRes.data.forEach((m) => {
-                metricsMap[m.device_id] = m;
+            metricsRes.data.items.forEach((m) => {
+                if (!metricsMap[m.device_id]) {
+                    metricsMap[m.device_id] = m;
+                }
             });
 
-            const combined: ClientNode[] = devicesRes.data.map((device) => ({
+            const combined: ClientNode[] = devices.map((device) => ({
                 device,
                 metric: metricsMap[device.id]
             }));
@@ -127,8 +130,7 @@ export const ClientsList: React.FC = () => {
 
     const fetchGroups = async () => {
         try {
-            const res = await instance.get<DeviceGroup[]>('/api/device-groups');
-            setGroups(res.data);
+            setGroups(await fetchAll<DeviceGroup>('/api/device-groups'));
         } catch (err) {
             message.error('Failed to fetch device groups');
         }
@@ -2,6 +2,9 @@ import React from 'react';
 import { Dropdown, Menu, Avatar, Space } from 'antd';
 import { MenuFoldOutlined, MenuUnfoldOutlined, UserOutlined } from '@ant-design/icons';
 import { useNavigate } from 'react-router-dom';
+import { useDispatch } from 'react-redux';
+import { AppDispatch } from 'store';
+import { logoutUser } from 'store/authSlice';
 
 interface AppHeaderProps {
     collapsed: boolean;
@@ -10,6 +13,7 @@ interface AppHeaderProps {
 
 export const AppHeader: React.FC<AppHeaderProps> = ({ collapsed, toggleCollapsed }) => {
     const navigate = useNavigate();
+    const dispatch = useDispatch<AppDispatch>();
 
     const profileMenu = (
         <Menu
@@ -30,7 +34,7 @@ export const AppHeader: React.FC<AppHeaderProps> = ({ collapsed, toggleCollapsed
                 {
                     key: 'logout',
                     label: 'Выход',
-                    onClick: () => navigate('/login')
+                    onClick: () => dispatch(logoutUser()).then(() => navigate('/login'))
                 }
             ]}
         />
@@ -1,6 +1,6 @@
 import React, { useEffect, useState } from 'react';
 import { Table, Button, Modal, Form, Input, message } from 'antd';
-import instance from 'service/api';
+import instance, { fetchAll } from 'service/api';
 
 interface DeviceGroup {
     id: string;
@@ -19,8 +19,7 @@ export const DeviceGroupsPage: React.FC = () => {
     const fetchGroups = async () => {
         setLoading(true);
         try {
-            const res = await instance.get<DeviceGroup[]>('/api/device-groups');
-            setGroups(res.data);
+            setGroups(await fetchAll<DeviceGroup>('/api/device-groups'));
         } catch (err) {
             message.error('Failed to fetch device groups');
         } finally {
@@ -3,28 +3,54 @@ import { Form, Input, Button, message } from 'antd';
 import { useDispatch, useSelector } from 'react-redux';
 import { AppDispatch, RootState } from 'store';
 import { useNavigate } from 'react-router-dom';
-import { loginUser } from 'store/authSlice';
+import { loginUser, TwoFactorChallenge } from 'store/authSlice';
+import instance from 'service/api';
 import { ReactComponent as Logo } from 'assets/logo.svg';
 
 export const LoginPage: React.FC = () => {
     const navigate = useNavigate();
     const dispatch = useDispatch<AppDispatch>();
     const { loading, error } = useSelector((state: RootState) => state.auth);
+    // второй шаг входа: код 2FA
+    const [challenge, setChallenge] = useState<TwoFactorChallenge | null>(null);
+    const [setup, setSetup] = useState<{ secret: string; otpauth_uri: string } | null>(null);
+    const [recoveryCodes, setRecoveryCodes] = useState<string[] | null>(null);
 
-    const onFinish = async (values: { email: string; password: string }) => {
+    const login = async (credentials: Parameters<typeof loginUser>[0]) => {
         try {
-            const resultAction = await dispatch(loginUser(values));
+            const resultAction = await dispatch(loginUser(credentials));
             if (loginUser.fulfilled.match(resultAction)) {
                 message.success('Logged in successfully');
+                const codes = resultAction.payload.recovery_codes;
+                if (codes?.length) {
+                    setRecoveryCodes(codes);
+                    return;
+                }
                 navigate('/devices');
-            } else {
-                message.error(resultAction.payload as string);
+                return;
             }
+            const payload = resultAction.payload as any;
+            if (payload?.challenge) {
+                setChallenge(payload.challenge);
+                if (payload.challenge.setup_required) {
+                    const response = await instance.post('/api/auth/2fa/setup', {
+                        challenge_token: payload.challenge.challenge_token
+                    });
+                    setSetup(response.data);
+                }
+                return;
+            }
+            message.error(payload as string);
         } catch (err) {
             message.error('Login failed');
         }
     };
 
+    const onFinish = (values: { email: string; password: string }) => login(values);
+
+    const onVerify = (values: { code: string }) =>
+        login({ challenge_token: challenge?.challenge_token, code: values.code });
+
     return (
         <div
             style={{
@@ -36,25 +62,60 @@ export const LoginPage: React.FC = () => {
         >
             <Logo style={{ width: '350px', height: '100px', marginBottom: 16 }} />
             <h2>Login</h2>
-            <Form onFinish={onFinish}>
-                <Form.Item
-                    name="email"
-                    rules={[{ required: true, message: 'Please enter your email!' }]}
-                >
-                    <Input placeholder="Email" />
-                </Form.Item>
-                <Form.Item
-                    name="password"
-                    rules={[{ required: true, message: 'Please enter your password!' }]}
-                >
-                    <Input.Password placeholder="Password" />
-                </Form.Item>
-                <Form.Item>
-                    <Button type="primary" htmlType="submit" loading={loading} block>
-                        Login
+            {recoveryCodes ? (
+                <div>
+                    <p>Save these recovery codes. Each code can be used once if you lose your authenticator.</p>
+                    <pre>{recoveryCodes.join('\n')}</pre>
+                    <Button type="primary" block onClick={() => navigate('/devices')}>
+                        Continue
                     </Button>
-                </Form.Item>
-            </Form>
+                </div>
+            ) : challenge ? (
+                <Form onFinish={onVerify}>
+                    {setup && (
+                        <div style={{ textAlign: 'left', wordBreak: 'break-all' }}>
+                            <p>Two-factor authentication is required. Add this key to your authenticator app:</p>
+                            <p>
+                                <code>{setup.secret}</code>
+                            </p>
+                            <p>
+                                <a href={setup.otpauth_uri}>{setup.otpauth_uri}</a>
+                            </p>
+                        </div>
+                    )}
+                    <Form.Item
+                        name="code"
+                        rules={[{ required: true, message: 'Please enter the code from your authenticator!' }]}
+                    >
+                        <Input placeholder="Authentication or recovery code" autoComplete="one-time-code" />
+                    </Form.Item>
+                    <Form.Item>
+                        <Button type="primary" htmlType="submit" loading={loading} block>
+                            Verify
+                        </Button>
+                    </Form.Item>
+                </Form>
+            ) : (
+                <Form onFinish={onFinish}>
+                    <Form.Item
+                        name="email"
+                        rules={[{ required: true, message: 'Please enter your email!' }]}
+                    >
+                        <Input placeholder="Email" />
+                    </Form.Item>
+                    <Form.Item
+                        name="password"
+                        rules={[{ required: true, message: 'Please enter your password!' }]}
+                    >
+                        <Input.Password placeholder="Password" />
+                    </Form.Item>
+                    <Form.Item>
+                        <Button type="primary" htmlType="submit" loading={loading} block>
+                            Login
+                        </Button>
+                    </Form.Item>
+                </Form>
+            )}
             {error && <p style={{ color: 'red' }}>{error}</p>}
         </div>
     );
@@ -25,10 +25,8 @@ export const ProfilePage: React.FC = () => {
         // Fetch profile data on component mount
         const fetchProfile = async () => {
             try {
-                const userId = user?.user_id || '';
-                const res = await instance.get<ProfileData>('/api/profile', {
-                    params: { user_id: userId }
-                });
+                // Профиль определяется по токену
+                const res = await instance.get<ProfileData>('/api/profile');
                 setProfile(res.data);
                 form.setFieldsValue({
                     username: res.data.username,
@@ -44,9 +42,7 @@ export const ProfilePage: React.FC = () => {
 
     const onFinish = async (values: any) => {
         try {
-            const userId = user?.user_id || '';
-            const payload = { user_id: userId, ...values };
-            const res = await instance.put<ProfileData>('/api/profile', payload);
+            const res = await instance.put<ProfileData>('/api/profile', values);
             message.success('Profile updated successfully');
             setProfile(res.data);
             setEditMode(false);
@@ -1,7 +1,7 @@
 import React, { useEffect, useState } from 'react';
 import { useSelector } from 'react-redux';
 import { Table, Button, Modal, Form, Input, Select, message } from 'antd';
-import instance from 'service/api';
+import instance, { fetchAll } from 'service/api';
 import { RootState } from 'store';
 
 interface User {
@@ -29,12 +29,7 @@ export const UsersPage: React.FC = () => {
     const fetchUsers = async () => {
         setLoading(true);
         try {
-            const res = await instance.get<User[]>('/api/users', {
-                headers: {
-                    Authorization: `Bearer ${token}`
-                }
-            });
-            setUsers(res.data);
+            setUsers(await fetchAll<User>('/api/users'));
         } catch (error) {
             message.error('Failed to fetch users');
         } finally {
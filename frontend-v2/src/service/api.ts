@@ -1,8 +1,79 @@
-import axios from 'axios';
+import axios, { AxiosError, InternalAxiosRequestConfig } from 'axios';
 
 // Здесь можно сконфигурировать базовый URL, интерцепторы и т.д.
 const instance = axios.create({
     baseURL: 'http://localhost:9000' // или просто '/', если страница у нас на том же домене
 });
 
+// Все закрытые маршруты бэкенда требуют JWT: подставляем токен из localStorage (его сохраняет authSlice)
+instance.interceptors.request.use((config) => {
+    const token = localStorage.getItem('token');
+    if (token && !config.headers.Authorization) {
+        config.headers.Authorization = `Bearer ${token}`;
+    }
+    return config;
+});
+
+// Access токен живет недолго: при 401 один раз обновляем пару токенов по refresh_token и повторяем запрос.
+// Параллельные запросы ждут одно обновление – refresh токен одноразовый
+let refreshing: Promise<string> | null = null;
+
+const refreshTokens = (): Promise<string> => {
+    if (!refreshing) {
+        const refreshToken = localStorage.getItem('refresh_token');
+        refreshing = (
+            refreshToken
+                ? axios.post(`${instance.defaults.baseURL}/api/auth/refresh`, { refresh_token: refreshToken })
+                : Promise.reject(new Error('no refresh token'))
+        )
+            .then((response) => {
+                localStorage.setItem('token', response.data.token);
+                localStorage.setItem('refresh_token', response.data.refresh_token);
+                return response.data.token as string;
+            })
+            .finally(() => {
+                refreshing = null;
+            });
+    }
+    return refreshing;
+};
+
+instance.interceptors.response.use(undefined, async (error: AxiosError) => {
+    const config = error.config as (InternalAxiosRequestConfig & { _retried?: boolean }) | undefined;
+    if (error.response?.status !== 401 || !config || config._retried || config.url?.startsWith('/api/auth/')) {
+        return Promise.reject(error);
+    }
+    config._retried = true;
+    try {
+        const token = await refreshTokens();
+        config.headers.Authorization = `Bearer ${token}`;
+        return instance(config);
+    } catch {
+        // сессия истекла или отозвана (смена пароля или роли) – нужно войти заново
+        localStorage.removeItem('token');
+        localStorage.removeItem('refresh_token');
+        window.location.assign('/login');
+        return Promise.reject(error);
+    }
+});
+
+// Page – ответ списков бэкенда (list_query): страница элементов, их общее число и курсор следующей страницы
+export interface Page<T> {
+    items: T[];
+    total: number;
+    next_cursor?: string;
+}
+
+// fetchAll загружает все страницы списка, переходя по next_cursor
+export const fetchAll = async <T>(url: string, params: Record<string, unknown> = {}): Promise<T[]> => {
+    const items: T[] = [];
+    let cursor: string | undefined;
+    do {
+        const res = await instance.get<Page<T>>(url, { params: { limit: 500, ...params, cursor } });
+        items.push(...res.data.items);
+        cursor = res.data.next_cursor;
+    } while (cursor);
+    return items;
+};
+
 export default instance;
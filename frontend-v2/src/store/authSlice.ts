@@ -27,24 +27,63 @@ const initialState: AuthState = {
 };
 
 interface LoginCredentials {
-    email: string;
-    password: string;
+    email?: string;
+    password?: string;
+    // второй шаг входа с 2FA
+    challenge_token?: string;
+    code?: string;
 }
 
-// Async thunk для логина
-export const loginUser = createAsyncThunk<string, LoginCredentials>(
+// Ответ на верный пароль, когда нужен второй фактор
+export interface TwoFactorChallenge {
+    two_factor_required: true;
+    setup_required: boolean;
+    challenge_token: string;
+    expires_at: string;
+}
+
+interface LoginResponse {
+    token: string;
+    refresh_token: string;
+    recovery_codes?: string[]; // коды восстановления, если 2FA настроена при этом входе
+}
+
+// Async thunk для логина: access токен и refresh токен (для обновления в service/api)
+export const loginUser = createAsyncThunk<LoginResponse, LoginCredentials>(
     'auth/loginUser',
     async (credentials, { rejectWithValue }) => {
         try {
-            const response = await instance.post('/api/auth/login', credentials);
-            const token: string = response.data.token;
-            return token;
+            const response = credentials.challenge_token
+                ? await instance.post('/api/auth/2fa/verify', credentials)
+                : await instance.post('/api/auth/login', credentials);
+            if (response.data.two_factor_required) {
+                return rejectWithValue({ challenge: response.data as TwoFactorChallenge });
+            }
+            return {
+                token: response.data.token,
+                refresh_token: response.data.refresh_token,
+                recovery_codes: response.data.recovery_codes
+            };
         } catch (err: any) {
-            return rejectWithValue(err.response?.data || 'Login failed');
+            // ошибки API приходят JSON объектом { error, details }
+            return rejectWithValue(err.response?.data?.error || err.response?.data || 'Login failed');
         }
     }
 );
 
+// Async thunk для выхода: сессия завершается и на сервере
+export const logoutUser = createAsyncThunk('auth/logoutUser', async (_, { dispatch }) => {
+    const refreshToken = localStorage.getItem('refresh_token');
+    if (refreshToken) {
+        try {
+            await instance.post('/api/auth/logout', { refresh_token: refreshToken });
+        } catch (err) {
+            // сессия уже могла быть отозвана – локально выходим в любом случае
+        }
+    }
+    dispatch(authSlice.actions.logout());
+});
+
 export const authSlice = createSlice({
     name: 'auth',
     initialState,
@@ -54,6 +93,7 @@ export const authSlice = createSlice({
             state.user = null;
             state.error = null;
             localStorage.removeItem('token');
+            localStorage.removeItem('refresh_token');
         },
         setToken(state, action: PayloadAction<string>) {
             state.token = action.payload;
@@ -83,17 +123,18 @@ export const authSlice = createSlice({
         });
         builder.addCase(loginUser.fulfilled, (state, action) => {
             state.loading = false;
-            state.token = action.payload;
+            state.token = action.payload.token;
             try {
-                state.user = jwtDecode<DecodedToken>(action.payload);
+                state.user = jwtDecode<DecodedToken>(action.payload.token);
             } catch (error) {
                 state.user = null;
             }
-            localStorage.setItem('token', action.payload);
+            localStorage.setItem('token', action.payload.token);
+            localStorage.setItem('refresh_token', action.payload.refresh_token);
         });
         builder.addCase(loginUser.rejected, (state, action) => {
             state.loading = false;
-            state.error = action.payload as string;
+            state.error = typeof action.payload === 'string' ? action.payload : null;
         });
     }
 });